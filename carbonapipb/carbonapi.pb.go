@@ -32,5 +32,6 @@ type AccessLogDetails struct {
 	UsedBackendCache              bool              `json:"used_backend_cache"`
 	ZipperRequests                uint64            `json:"zipper_requests,omitempty"`
 	TotalMetricsCount             uint64            `json:"total_metrics_count,omitempty"`
+	MemoHits                      int               `json:"memo_hits,omitempty"`
 	RequestHeaders                map[string]string `json:"request_headers"`
 }
@@ -2,12 +2,15 @@ package config
 
 import (
 	"encoding/json"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/go-graphite/carbonapi/cache"
 	"github.com/go-graphite/carbonapi/expr"
 	"github.com/go-graphite/carbonapi/expr/interfaces"
 	"github.com/go-graphite/carbonapi/limiter"
+	"github.com/go-graphite/carbonapi/pkg/parser"
 	"github.com/go-graphite/carbonapi/pkg/tlsconfig"
 	zipperCfg "github.com/go-graphite/carbonapi/zipper/config"
 	zipper "github.com/go-graphite/carbonapi/zipper/interfaces"
@@ -64,6 +67,73 @@ type Listener struct {
 	ClientTLSConfig tlsconfig.TLSConfig `mapstructure:"clientTLSConfig"`
 }
 
+// GRPCConfig sets listeners of carbonapi_v3_grpc.CarbonV1 service, listeners without TLS serve plaintext HTTP/2 (h2c)
+type GRPCConfig struct {
+	Listeners      []Listener `mapstructure:"listeners"`
+	MaxMessageSize int        `mapstructure:"maxMessageSize"`
+}
+
+// UserFunctionsConfig sets the file with user-defined functions, see udf package
+type UserFunctionsConfig struct {
+	File           string        `mapstructure:"file"`
+	ReloadInterval time.Duration `mapstructure:"reloadInterval"`
+}
+
+// VariableConfig sets how dashboard variable is resolved, when render request doesn't pass it as var-<name>
+type VariableConfig struct {
+	// Query is a glob for find request, values of the variable are last nodes of found metrics
+	Query string `mapstructure:"query"`
+	// Regex filters values, if it has a capturing group, values are replaced with it
+	Regex string `mapstructure:"regex"`
+
+	regex *regexp.Regexp
+}
+
+// Value returns value of the variable for the found metric and false if it's filtered out
+func (c *VariableConfig) Value(path string) (string, bool) {
+	value := path[strings.LastIndexByte(path, '.')+1:]
+	if c.regex == nil {
+		return value, true
+	}
+	m := c.regex.FindStringSubmatch(value)
+	if m == nil {
+		return "", false
+	}
+	if len(m) > 1 {
+		return m[1], true
+	}
+	return value, true
+}
+
+// LimitsConfig sets limits of resources used by a single render request
+type LimitsConfig struct {
+	expr.Limits `mapstructure:",squash"`
+	// TenantHeader is the name of HTTP header with tenant, user name of basic authentication is used if it's not set.
+	// Tenant isn't verified, so it must be set by a trusted proxy.
+	TenantHeader string `mapstructure:"tenantHeader"`
+	// Tenants overrides limits, that are set, for some tenants
+	Tenants map[string]expr.Limits `mapstructure:"tenants"`
+}
+
+// ForTenant returns limits for the tenant
+func (c *LimitsConfig) ForTenant(tenant string) expr.Limits {
+	// keys of maps are lowercased by config parser
+	if limits, ok := c.Tenants[strings.ToLower(tenant)]; ok {
+		return c.Limits.Merge(limits)
+	}
+	return c.Limits
+}
+
+// Modes of type checking of render targets against function descriptions
+const (
+	// TypeCheckOff disables type checking
+	TypeCheckOff = "off"
+	// TypeCheckWarn logs and counts targets with type errors, but evaluates them
+	TypeCheckWarn = "warn"
+	// TypeCheckStrict rejects targets with type errors
+	TypeCheckStrict = "strict"
+)
+
 type DurationTruncate struct {
 	Duration time.Duration
 	Truncate time.Duration
@@ -102,6 +172,7 @@ type ConfigType struct {
 	Define                     []Define           `mapstructure:"define"`
 	Prefix                     string             `mapstructure:"prefix"`
 	Expvar                     ExpvarConfig       `mapstructure:"expvar"`
+	GRPC                       GRPCConfig         `mapstructure:"grpc"`
 	NotFoundStatusCode         int                `mapstructure:"notFoundStatusCode"`
 	HTTPResponseStackTrace     bool               `mapstructure:"httpResponseStackTrace"`
 	UseCachingDNSResolver      bool               `mapstructure:"useCachingDNSResolver"`
@@ -112,6 +183,18 @@ type ConfigType struct {
 
 	MaxQueryLength              uint64 `mapstructure:"maxQueryLength"`
 	CombineMultipleTargetsInOne bool   `mapstructure:"combineMultipleTargetsInOne"`
+	MaxParallelEvaluations      int    `mapstructure:"maxParallelEvaluations"`
+	MemoizeSubexpressions       bool   `mapstructure:"memoizeSubexpressions"`
+	TypeCheck                   string `mapstructure:"typeCheck"`
+
+	Limits LimitsConfig `mapstructure:"limits"`
+
+	UserFunctions UserFunctionsConfig `mapstructure:"userFunctions"`
+
+	// Variables are dashboard variables resolved by server, keys are lowercased
+	Variables map[string]VariableConfig `mapstructure:"variables"`
+
+	ExpressionLimits parser.Limits `mapstructure:"expressionLimits"`
 
 	NudgeStartTimeOnAggregation             bool `mapstructure:"nudgeStartTimeOnAggregation"`
 	UseBucketsHighestTimestampOnAggregation bool `mapstructure:"useBucketsHighestTimestampOnAggregation"`
@@ -172,6 +255,7 @@ var Config = ConfigType{
 	Cpus:            0,
 	IdleConnections: 10,
 	PidFile:         "",
+	TypeCheck:       TypeCheckWarn,
 
 	ResponseCache: cache.NullCache{},
 	BackendCache:  cache.NullCache{},
@@ -199,6 +283,9 @@ var Config = ConfigType{
 		Enabled:      true,
 		PProfEnabled: false,
 	},
+	GRPC: GRPCConfig{
+		MaxMessageSize: 64 * 1024 * 1024,
+	},
 	NotFoundStatusCode:     200,
 	HTTPResponseStackTrace: true,
 	UseCachingDNSResolver:  false,
@@ -2,9 +2,11 @@ package config
 
 import (
 	"bytes"
+	"context"
 	"expvar"
 	"fmt"
 	"os"
+	"regexp"
 	"runtime"
 	"sort"
 	"strconv"
@@ -27,6 +29,7 @@ import (
 	"github.com/go-graphite/carbonapi/expr/helper"
 	"github.com/go-graphite/carbonapi/expr/rewrite"
 	tconfig "github.com/go-graphite/carbonapi/expr/types/config"
+	"github.com/go-graphite/carbonapi/expr/udf"
 	"github.com/go-graphite/carbonapi/limiter"
 	"github.com/go-graphite/carbonapi/pkg/parser"
 	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
@@ -277,6 +280,17 @@ func SetUpConfig(logger *zap.Logger, BuildVersion string) {
 		Config.Listeners = append(Config.Listeners, Listener{Address: "127.0.0.1:8081"})
 	}
 
+	parser.SetLimits(Config.ExpressionLimits)
+
+	switch Config.TypeCheck {
+	case TypeCheckOff, TypeCheckWarn, TypeCheckStrict:
+	default:
+		logger.Fatal("unknown typeCheck mode",
+			zap.String("type_check", Config.TypeCheck),
+			zap.Strings("supported_modes", []string{TypeCheckOff, TypeCheckWarn, TypeCheckStrict}),
+		)
+	}
+
 	for _, define := range Config.Define {
 		if define.Name == "" {
 			logger.Fatal("empty define name")
@@ -289,6 +303,38 @@ func SetUpConfig(logger *zap.Logger, BuildVersion string) {
 			)
 		}
 	}
+
+	if Config.UserFunctions.File != "" {
+		watcher := udf.NewWatcher(logger, Config.UserFunctions.File, Config.UserFunctions.ReloadInterval)
+		if err := watcher.Load(); err != nil {
+			logger.Fatal("unable to load user-defined functions",
+				zap.Error(err),
+				zap.String("file", Config.UserFunctions.File),
+			)
+		}
+		if Config.UserFunctions.ReloadInterval > 0 {
+			go watcher.Run(context.Background())
+		}
+	}
+
+	for name, variable := range Config.Variables {
+		if variable.Query == "" {
+			logger.Fatal("empty query of variable",
+				zap.String("variable", name),
+			)
+		}
+		if variable.Regex != "" {
+			re, err := regexp.Compile(variable.Regex)
+			if err != nil {
+				logger.Fatal("unable to compile regex of variable",
+					zap.Error(err),
+					zap.String("variable", name),
+				)
+			}
+			variable.regex = re
+			Config.Variables[name] = variable
+		}
+	}
 }
 
 func createCache(logger *zap.Logger, cacheName string, cacheConfig *CacheConfig) cache.BytesCache {
@@ -405,6 +451,11 @@ func SetUpViper(logger *zap.Logger, configPath *string, exactConfig bool, viperP
 	viper.SetDefault("useCachingDNSResolver", false)
 	viper.SetDefault("logger", map[string]string{})
 	viper.SetDefault("combineMultipleTargetsInOne", false)
+	viper.SetDefault("maxParallelEvaluations", 1)
+	viper.SetDefault("memoizeSubexpressions", true)
+	viper.SetDefault("typeCheck", TypeCheckWarn)
+	viper.SetDefault("userFunctions.reloadInterval", 10*time.Second)
+	viper.SetDefault("expressionLimits.maxDepth", 100)
 	viper.SetDefault("nudgeStartTimeOnAggregation", false)
 	viper.SetDefault("useBucketsHighestTimestampOnAggregation", false)
 
@@ -91,6 +91,12 @@ func setupGraphiteMetrics(logger *zap.Logger) {
 		metrics.Register("find_requests", http.ApiMetrics.FindRequests)
 		metrics.Register("render_requests", http.ApiMetrics.RenderRequests)
 
+		metrics.Register("expression_limits.max_depth_exceeded", http.ApiMetrics.MaxDepthExceeded)
+		metrics.Register("expression_limits.max_nodes_exceeded", http.ApiMetrics.MaxNodesExceeded)
+		metrics.Register("expression_limits.max_function_calls_exceeded", http.ApiMetrics.MaxFunctionCallsExceeded)
+		metrics.Register("expression_limits.max_globs_exceeded", http.ApiMetrics.MaxGlobsExceeded)
+		metrics.Register("type_check_errors", http.ApiMetrics.TypeCheckErrors)
+
 		if http.ApiMetrics.MemcacheTimeouts != nil {
 			metrics.Register("memcache_timeouts", http.ApiMetrics.MemcacheTimeouts)
 		}
@@ -0,0 +1,86 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/lomik/zapwriter"
+
+	"github.com/go-graphite/carbonapi/carbonapipb"
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+	"github.com/go-graphite/carbonapi/zipper/divergence"
+)
+
+type divergenceCounter struct {
+	Server string `json:"server"`
+	Prefix string `json:"prefix"`
+	Points uint64 `json:"points"`
+}
+
+type divergenceReport struct {
+	Enabled  bool                `json:"enabled"`
+	Counters []divergenceCounter `json:"counters"`
+	Recent   []divergence.Entry  `json:"recent"`
+}
+
+type divergenceTracker interface {
+	Divergence() *divergence.Tracker
+}
+
+// divergenceHandler shows metrics, which responses recently differed between replicas
+func divergenceHandler(w http.ResponseWriter, r *http.Request) {
+	t0 := time.Now()
+	username, _, _ := r.BasicAuth()
+
+	srcIP, srcPort := splitRemoteAddr(r.RemoteAddr)
+
+	accessLogger := zapwriter.Logger("access")
+	var accessLogDetails = carbonapipb.AccessLogDetails{
+		Handler:        "divergence",
+		Username:       username,
+		URL:            r.URL.RequestURI(),
+		PeerIP:         srcIP,
+		PeerPort:       srcPort,
+		Host:           r.Host,
+		Referer:        r.Referer(),
+		URI:            r.RequestURI,
+		RequestHeaders: utilctx.GetLogHeaders(r.Context()),
+	}
+
+	logAsError := false
+	defer func() {
+		deferredAccessLogging(accessLogger, &accessLogDetails, t0, logAsError)
+	}()
+
+	var tracker *divergence.Tracker
+	if z, ok := config.Config.ZipperInstance.(divergenceTracker); ok {
+		tracker = z.Divergence()
+	}
+
+	report := divergenceReport{
+		Enabled:  tracker != nil,
+		Counters: make([]divergenceCounter, 0),
+		Recent:   tracker.Recent(),
+	}
+	if report.Recent == nil {
+		report.Recent = make([]divergence.Entry, 0)
+	}
+	for _, c := range tracker.Counters() {
+		report.Counters = append(report.Counters, divergenceCounter{Server: c.Server, Prefix: c.Prefix, Points: c.Points})
+	}
+
+	b, err := json.Marshal(report)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError)+": "+err.Error(), http.StatusInternalServerError)
+		accessLogDetails.HTTPCode = http.StatusInternalServerError
+		accessLogDetails.Reason = err.Error()
+		logAsError = true
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	_, _ = w.Write(b)
+	accessLogDetails.HTTPCode = http.StatusOK
+}
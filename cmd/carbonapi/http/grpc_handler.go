@@ -0,0 +1,269 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	"github.com/ansel1/merry"
+	grpcv3 "github.com/go-graphite/protocol/carbonapi_v3_grpc"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/lomik/zapwriter"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/expr/types"
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+	"github.com/go-graphite/carbonapi/zipper/interfaces"
+	"github.com/go-graphite/carbonapi/zipper/protocols/v3grpc"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// protocolVersion is reported by GetVersion, methods accept and return carbonapi_v3_pb messages
+const protocolVersion = 3
+
+// grpcServer implements carbonapi_v3_grpc.CarbonV1 and CarbonV1Stream services with the zipper, so carbonapi could be
+// used as a backend of carbonapi_v3_grpc protocol and zippers could be chained
+type grpcServer struct{}
+
+// NewGRPCServer returns gRPC server with CarbonV1 and CarbonV1Stream services registered. Headers to pass and to log
+// are taken from metadata of the request, the same way as from headers of HTTP requests.
+func NewGRPCServer(headersToPass, headersToLog []string, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.UnaryInterceptor(grpcInterceptor(headersToPass, headersToLog)),
+		grpc.StreamInterceptor(grpcStreamInterceptor(headersToPass, headersToLog)),
+	)
+	s := grpc.NewServer(opts...)
+	grpcv3.RegisterCarbonV1Server(s, grpcServer{})
+	v3grpc.RegisterCarbonV1StreamServer(s, grpcServer{})
+	return s
+}
+
+func metadataValue(md metadata.MD, name string) string {
+	if v := md.Get(name); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// requestContext sets uuid, headers to pass and to log from metadata of the request
+func requestContext(ctx context.Context, headersToPass, headersToLog []string) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	headersToPassMap := make(map[string]string)
+	for _, name := range headersToPass {
+		if h := metadataValue(md, name); h != "" {
+			headersToPassMap[name] = h
+		}
+	}
+	headersToLogMap := make(map[string]string)
+	for _, name := range headersToLog {
+		if h := metadataValue(md, name); h != "" {
+			headersToLogMap[name] = h
+		}
+	}
+
+	ctx = utilctx.SetUUID(ctx, metadataValue(md, utilctx.HeaderUUIDAPI))
+	ctx = utilctx.SetPassHeaders(ctx, headersToPassMap)
+	return utilctx.SetLogHeaders(ctx, headersToLogMap)
+}
+
+func logRequestError(ctx context.Context, method string, err error) {
+	zapwriter.Logger("grpc").Debug("request failed",
+		zap.String("method", method),
+		zap.String("carbonapi_uuid", utilctx.GetUUID(ctx)),
+		zap.Any("headers", utilctx.GetLogHeaders(ctx)),
+		zap.Error(err),
+	)
+}
+
+func grpcInterceptor(headersToPass, headersToLog []string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx = requestContext(ctx, headersToPass, headersToLog)
+		resp, err := handler(ctx, req)
+		if err != nil {
+			logRequestError(ctx, info.FullMethod, err)
+		}
+		return resp, err
+	}
+}
+
+// contextServerStream replaces context of the stream
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func grpcStreamInterceptor(headersToPass, headersToLog []string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := requestContext(ss.Context(), headersToPass, headersToLog)
+		err := handler(srv, &contextServerStream{ServerStream: ss, ctx: ctx})
+		if err != nil {
+			logRequestError(ctx, info.FullMethod, err)
+		}
+		return err
+	}
+}
+
+// grpcError returns status for the error, cancellation and deadline of the request take precedence
+func grpcError(ctx context.Context, err merry.Error) error {
+	switch ctx.Err() {
+	case context.Canceled:
+		return status.Error(codes.Canceled, ctx.Err().Error())
+	case context.DeadlineExceeded:
+		return status.Error(codes.DeadlineExceeded, ctx.Err().Error())
+	}
+
+	code := codes.Internal
+	if merry.Is(err, zipperTypes.ErrNotFound) {
+		code = codes.NotFound
+	} else if merry.Is(err, zipperTypes.ErrNotImplementedYet) {
+		code = codes.Unimplemented
+	} else {
+		switch merry.HTTPCode(err) {
+		case http.StatusBadRequest:
+			code = codes.InvalidArgument
+		case http.StatusNotFound:
+			code = codes.NotFound
+		case http.StatusForbidden:
+			code = codes.PermissionDenied
+		case http.StatusGatewayTimeout, http.StatusRequestTimeout:
+			code = codes.DeadlineExceeded
+		case http.StatusNotImplemented:
+			code = codes.Unimplemented
+		case http.StatusTooManyRequests:
+			code = codes.ResourceExhausted
+		case http.StatusServiceUnavailable, http.StatusBadGateway:
+			code = codes.Unavailable
+		}
+	}
+	return status.Error(code, err.Error())
+}
+
+func (grpcServer) GetVersion(ctx context.Context, _ *empty.Empty) (*grpcv3.ProtocolVersionResponse, error) {
+	return &grpcv3.ProtocolVersionResponse{Version: protocolVersion}, nil
+}
+
+// FetchMetrics fetches all requests with a single zipper call, so concurrency is bounded by limiters of the backends
+func (grpcServer) FetchMetrics(ctx context.Context, request *pb.MultiFetchRequest) (*pb.MultiFetchResponse, error) {
+	metrics, _, err := config.Config.ZipperInstance.Render(ctx, *request)
+	// partial results are returned as is, the same way as for HTTP API
+	if err != nil && len(metrics) == 0 {
+		return nil, grpcError(ctx, err)
+	}
+
+	response := &pb.MultiFetchResponse{Metrics: make([]pb.FetchResponse, 0, len(metrics))}
+	for _, m := range metrics {
+		response.Metrics = append(response.Metrics, m.FetchResponse)
+	}
+	return response, nil
+}
+
+// FetchMetricsStream fetches each request separately and sends its series as soon as all the backends answered for
+// it, so series of fast requests aren't held back by slow ones. Series of a single request are merged from all the
+// backends before they are sent.
+func (grpcServer) FetchMetricsStream(request *pb.MultiFetchRequest, stream v3grpc.CarbonV1Stream_FetchMetricsStreamServer) error {
+	ctx := stream.Context()
+
+	type result struct {
+		metrics []*types.MetricData
+		err     merry.Error
+	}
+	results := make(chan result, len(request.Metrics))
+	for i := range request.Metrics {
+		go func(m pb.FetchRequest) {
+			metrics, _, err := config.Config.ZipperInstance.Render(ctx, pb.MultiFetchRequest{Metrics: []pb.FetchRequest{m}})
+			results <- result{metrics: metrics, err: err}
+		}(request.Metrics[i])
+	}
+
+	sent := 0
+	var e merry.Error
+	for range request.Metrics {
+		r := <-results
+		// partial results are sent as is, the same way as for HTTP API
+		if r.err != nil && len(r.metrics) == 0 {
+			if e == nil || merry.Is(e, zipperTypes.ErrNotFound) || merry.HTTPCode(e) == http.StatusNotFound {
+				e = r.err
+			}
+			continue
+		}
+		for _, m := range r.metrics {
+			if err := stream.Send(&m.FetchResponse); err != nil {
+				// requests, that are still running, are cancelled with the context of the stream
+				return err
+			}
+			sent++
+		}
+	}
+	if sent == 0 && e != nil {
+		return grpcError(ctx, e)
+	}
+	return nil
+}
+
+func (grpcServer) FindMetrics(ctx context.Context, request *pb.MultiGlobRequest) (*pb.MultiGlobResponse, error) {
+	globs, _, err := config.Config.ZipperInstance.Find(ctx, *request)
+	if err != nil && (globs == nil || len(globs.Metrics) == 0) {
+		return nil, grpcError(ctx, err)
+	}
+	if globs == nil {
+		globs = &pb.MultiGlobResponse{}
+	}
+	return globs, nil
+}
+
+// MetricsInfo merges infos of all backend groups
+func (grpcServer) MetricsInfo(ctx context.Context, request *pb.MultiMetricsInfoRequest) (*pb.MultiMetricsInfoResponse, error) {
+	infos, _, err := config.Config.ZipperInstance.Info(ctx, request.Names)
+	if err != nil && (infos == nil || len(infos.Info) == 0) {
+		return nil, grpcError(ctx, err)
+	}
+
+	response := &pb.MultiMetricsInfoResponse{}
+	if infos == nil {
+		return response, nil
+	}
+	groups := make([]string, 0, len(infos.Info))
+	for group := range infos.Info {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		response.Metrics = append(response.Metrics, infos.Info[group].Metrics...)
+	}
+	return response, nil
+}
+
+func (grpcServer) ListMetrics(ctx context.Context, _ *empty.Empty) (*pb.ListMetricsResponse, error) {
+	z, ok := config.Config.ZipperInstance.(interfaces.MetricsZipper)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "zipper doesn't support listing metrics")
+	}
+	res, _, err := z.List(ctx)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return res, nil
+}
+
+func (grpcServer) Stats(ctx context.Context, _ *empty.Empty) (*pb.MetricDetailsResponse, error) {
+	z, ok := config.Config.ZipperInstance.(interfaces.MetricsZipper)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "zipper doesn't support metric details")
+	}
+	res, _, err := z.Stats(ctx)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return res, nil
+}
@@ -0,0 +1,168 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ansel1/merry"
+	grpcv3 "github.com/go-graphite/protocol/carbonapi_v3_grpc"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/golang/protobuf/ptypes/empty"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/expr/types"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+)
+
+func TestGRPCServer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewGRPCServer(nil, nil)
+	go func() {
+		_ = s.Serve(l)
+	}()
+	defer s.Stop()
+
+	// plaintext HTTP/2
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := grpcv3.NewCarbonV1Client(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	metrics, err := client.FetchMetrics(ctx, &pb.MultiFetchRequest{
+		Metrics: []pb.FetchRequest{{Name: "foo.bar"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics.Metrics) != 1 || metrics.Metrics[0].Name != "foo.bar" || len(metrics.Metrics[0].Values) != 3 {
+		t.Errorf("unexpected response %+v", metrics)
+	}
+
+	globs, err := client.FindMetrics(ctx, &pb.MultiGlobRequest{Metrics: []string{"foo.*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(globs.Metrics) != 1 || globs.Metrics[0].Matches[0].Path != "foo.bar" {
+		t.Errorf("unexpected response %+v", globs)
+	}
+
+	infos, err := client.MetricsInfo(ctx, &pb.MultiMetricsInfoRequest{Names: []string{"foo.bar"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos.Metrics) != 1 || infos.Metrics[0].Name != "foo.bar" {
+		t.Errorf("unexpected response %+v", infos)
+	}
+
+	if _, err = client.ListMetrics(ctx, &empty.Empty{}); status.Code(err) != codes.Unimplemented {
+		t.Errorf("got error %v for zipper without listing, want %v", err, codes.Unimplemented)
+	}
+}
+
+// streamZipper answers requests for "slow" only after release is closed
+type streamZipper struct {
+	mockCarbonZipper
+	release chan struct{}
+}
+
+func (z streamZipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, merry.Error) {
+	name := request.Metrics[0].Name
+	switch name {
+	case "slow":
+		select {
+		case <-z.release:
+		case <-ctx.Done():
+			return nil, nil, zipperTypes.ErrTimeoutExceeded
+		}
+	case "missing":
+		return nil, nil, zipperTypes.ErrNotFound
+	}
+	return []*types.MetricData{types.MakeMetricData(name, []float64{1, 2, 3}, 60, 0)}, nil, nil
+}
+
+func TestGRPCServerFetchStream(t *testing.T) {
+	z := streamZipper{release: make(chan struct{})}
+	if err := config.Config.SetZipper(z); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = config.Config.SetZipper(newMockCarbonZipper())
+	}()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewGRPCServer(nil, nil)
+	go func() {
+		_ = s.Serve(l)
+	}()
+	defer s.Stop()
+
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	fetch := func(names ...string) grpc.ClientStream {
+		request := &pb.MultiFetchRequest{}
+		for _, name := range names {
+			request.Metrics = append(request.Metrics, pb.FetchRequest{Name: name})
+		}
+		stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, "/carbonapi_v3_grpc.CarbonV1Stream/FetchMetricsStream")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := stream.SendMsg(request); err != nil {
+			t.Fatal(err)
+		}
+		if err := stream.CloseSend(); err != nil {
+			t.Fatal(err)
+		}
+		return stream
+	}
+
+	// series of the fast request are received, while the slow one is still being fetched
+	stream := fetch("slow", "fast", "missing")
+	var m pb.FetchResponse
+	if err := stream.RecvMsg(&m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "fast" || len(m.Values) != 3 {
+		t.Errorf("unexpected response %+v, expected fast", m)
+	}
+	close(z.release)
+	if err := stream.RecvMsg(&m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "slow" {
+		t.Errorf("unexpected response %+v, expected slow", m)
+	}
+	if err := stream.RecvMsg(&m); err != io.EOF {
+		t.Errorf("got error %v, expected end of stream", err)
+	}
+
+	stream = fetch("missing")
+	if err := stream.RecvMsg(&m); status.Code(err) != codes.NotFound {
+		t.Errorf("got error %v, expected %v", err, codes.NotFound)
+	}
+}
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"errors"
 	"fmt"
 	"html"
 	"net/http"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/go-graphite/carbonapi/carbonapipb"
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/expr"
 	"github.com/go-graphite/carbonapi/pkg/parser"
 	"github.com/lomik/zapwriter"
 	"go.uber.org/zap"
@@ -248,7 +250,7 @@ func stripError(err string) string {
 	} else if strings.Contains(err, " connection reset ") {
 		return "connection reset"
 	}
-	return html.EscapeString(err)
+	return err
 }
 
 func buildParseErrorString(target, e string, err error) string {
@@ -261,9 +263,30 @@ func buildParseErrorString(target, e string, err error) string {
 			"Parsed so far", target[0:len(target)-len(e)],
 			"Could not parse", e)
 	}
+	pos := len(target) - len(e)
+	var parseErr *parser.ParseError
+	if errors.As(err, &parseErr) {
+		// errors of the parsed expression (e.x. of expanded templates) point to the node
+		pos = parseErr.Pos
+	}
+	msg += fmt.Sprintf("%-20s: %d\n\n%s\n", "Position", pos, parser.Snippet(target, pos))
 	return msg
 }
 
+// buildTypeErrorString lists type errors of the target, each one with a snippet pointing to the argument
+func buildTypeErrorString(target string, errs expr.TypeErrors) string {
+	var buf strings.Builder
+	for i, err := range errs {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(err.Error())
+		buf.WriteByte('\n')
+		buf.WriteString(parser.Snippet(target, err.Pos))
+	}
+	return buf.String()
+}
+
 func deferredAccessLogging(accessLogger *zap.Logger, accessLogDetails *carbonapipb.AccessLogDetails, t time.Time, logAsError bool) {
 	accessLogDetails.Runtime = time.Since(t).Seconds()
 	if logAsError {
@@ -2,10 +2,13 @@ package http
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/go-graphite/carbonapi/carbonapipb"
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
 )
 
@@ -121,3 +124,19 @@ func Test_queryLengthLimitExceeded(t *testing.T) {
 		})
 	}
 }
+
+func Test_errorsEscapedOnce(t *testing.T) {
+	rr := httptest.NewRecorder()
+	setError(rr, &carbonapipb.AccessLogDetails{}, `invalid target "a<b>"`, http.StatusBadRequest, "")
+	if got, want := strings.TrimSpace(rr.Body.String()), "invalid target &#34;a&lt;b&gt;&#34;"; got != want {
+		t.Errorf("setError() body = %q, want %q", got, want)
+	}
+
+	msg, reason := joinErrors(map[string]string{"a<b>": `bad "arg"`}, "\n", http.StatusBadRequest)
+	if want := "a&lt;b&gt;: bad &#34;arg&#34;"; msg != want {
+		t.Errorf("joinErrors() msg = %q, want %q", msg, want)
+	}
+	if want := `a<b>: bad "arg"`; reason != want {
+		t.Errorf("joinErrors() reason = %q, want %q", reason, want)
+	}
+}
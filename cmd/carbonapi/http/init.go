@@ -32,12 +32,18 @@ func InitHandlers(headersToPass, headersToLog []string) *http.ServeMux {
 	r.HandleFunc(config.Config.Prefix+"/functions", enrichContextWithHeaders(headersToPass, headersToLog, functionsHandler))
 	r.HandleFunc(config.Config.Prefix+"/functions/", enrichContextWithHeaders(headersToPass, headersToLog, functionsHandler))
 
+	r.HandleFunc(config.Config.Prefix+"/parse", enrichContextWithHeaders(headersToPass, headersToLog, parseHandler))
+	r.HandleFunc(config.Config.Prefix+"/parse/", enrichContextWithHeaders(headersToPass, headersToLog, parseHandler))
+
 	r.HandleFunc(config.Config.Prefix+"/tags", enrichContextWithHeaders(headersToPass, headersToLog, tagHandler))
 	r.HandleFunc(config.Config.Prefix+"/tags/", enrichContextWithHeaders(headersToPass, headersToLog, tagHandler))
 
 	r.HandleFunc(config.Config.Prefix+"/_internal/capabilities", enrichContextWithHeaders(headersToPass, headersToLog, capabilityHandler))
 	r.HandleFunc(config.Config.Prefix+"/_internal/capabilities/", enrichContextWithHeaders(headersToPass, headersToLog, capabilityHandler))
 
+	r.HandleFunc(config.Config.Prefix+"/debug/routing", enrichContextWithHeaders(headersToPass, headersToLog, routingHandler))
+	r.HandleFunc(config.Config.Prefix+"/debug/divergence", enrichContextWithHeaders(headersToPass, headersToLog, divergenceHandler))
+
 	r.HandleFunc(config.Config.Prefix+"/", enrichContextWithHeaders(headersToPass, headersToLog, usageHandler))
 
 	if config.Config.Expvar.Enabled {
@@ -6,14 +6,18 @@ import (
 	"math"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/ansel1/merry"
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/expr"
 	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
 	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
 	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
 	"github.com/lomik/zapwriter"
+	"github.com/msaf1980/go-metrics"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -151,6 +155,172 @@ func TestRenderHandler(t *testing.T) {
 	}
 }
 
+func TestRenderHandlerTypeCheck(t *testing.T) {
+	config.Config.TypeCheck = config.TypeCheckStrict
+	defer func() {
+		config.Config.TypeCheck = config.TypeCheckWarn
+	}()
+
+	req, rr := setUpRequest(t, "/render/?target=aliasByNode(foo.bar,foo)&target=summarize(foo.bar,'1h','bogus')&target=movingAverage(foo.bar)&from=-10minutes&format=json")
+	renderHandler(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	body := rr.Body.String()
+	for _, expected := range []string{
+		"aliasByNode(nodes): expected nodeOrTag, got series foo",
+		"summarize(func): invalid aggregation function &#34;bogus&#34;",
+		"movingAverage(windowSize): missing required argument",
+		"aliasByNode(foo.bar,foo)\n                    ^",
+	} {
+		assert.Contains(t, body, expected)
+	}
+}
+
+func TestRenderHandlerTypeCheckModes(t *testing.T) {
+	defer func() {
+		config.Config.TypeCheck = config.TypeCheckWarn
+	}()
+
+	tests := []struct {
+		mode     string
+		rejected bool
+		errors   uint64
+	}{
+		{mode: config.TypeCheckOff, rejected: false, errors: 0},
+		{mode: config.TypeCheckWarn, rejected: false, errors: 1},
+		{mode: config.TypeCheckStrict, rejected: true, errors: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			config.Config.TypeCheck = tt.mode
+			count := ApiMetrics.TypeCheckErrors.Count()
+			req, rr := setUpRequest(t, "/render/?target=movingAverage(foo.bar)&from=-10minutes&format=json")
+			renderHandler(rr, req)
+			// in other modes the target is evaluated and fails on its own
+			rejected := strings.Contains(rr.Body.String(), "movingAverage(windowSize): missing required argument")
+			assert.Equal(t, tt.rejected, rejected, rr.Body.String())
+			assert.Equal(t, count+tt.errors, ApiMetrics.TypeCheckErrors.Count())
+		})
+	}
+}
+
+func TestRenderHandlerParseError(t *testing.T) {
+	req, rr := setUpRequest(t, "/render/?target=sumSeries(foo.bar%20baz)&from=-10minutes&format=json")
+	renderHandler(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	body := rr.Body.String()
+	for _, expected := range []string{
+		"unexpected character at position 18",
+		"sumSeries(foo.bar baz)\n                  ^",
+	} {
+		assert.Contains(t, body, expected)
+	}
+}
+
+func TestRenderHandlerLimits(t *testing.T) {
+	config.Config.Limits = config.LimitsConfig{
+		Limits:       expr.Limits{MaxFetchedSeries: 10},
+		TenantHeader: "X-Tenant",
+		Tenants: map[string]expr.Limits{
+			"small": {MaxDatapoints: 2},
+		},
+	}
+	defer func() {
+		config.Config.Limits = config.LimitsConfig{}
+	}()
+
+	req, rr := setUpRequest(t, "/render/?target=sumSeries(foo.bar)&from=-10minutes&format=json")
+	req.Header.Set("X-Tenant", "Small")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.Contains(t, rr.Body.String(), "limit exceeded: maxDatapoints is 2, fetched 3 datapoints")
+
+	req, rr = setUpRequest(t, "/render/?target=sumSeries(foo.bar)&from=-10minutes&format=json")
+	req.Header.Set("X-Tenant", "other")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestRenderHandlerVariables(t *testing.T) {
+	config.Config.Variables = map[string]config.VariableConfig{
+		"node": {Query: "foo.*"},
+	}
+	defer func() {
+		config.Config.Variables = nil
+	}()
+
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{
+			name:     "request",
+			url:      "/render/?target=alias(foo.$node,'$node')&var-node=bar&from=-10minutes&format=json",
+			expected: `"target":"bar"`,
+		},
+		{
+			name:     "config",
+			url:      "/render/?target=alias(foo.$node,'$node')&from=-10minutes&format=json",
+			expected: `"target":"bar"`,
+		},
+		{
+			name:     "all",
+			url:      "/render/?target=alias(foo.$node,'$node')&var-node=$__all&from=-10minutes&format=json",
+			expected: `"target":"bar"`,
+		},
+		{
+			name:     "unknown",
+			url:      "/render/?target=alias(foo.bar,'$unknown')&from=-10minutes&format=json",
+			expected: `"target":"$unknown"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, rr := setUpRequest(t, tt.url)
+			renderHandler(rr, req)
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.expected)
+		})
+	}
+}
+
+func TestRenderHandlerExpressionLimits(t *testing.T) {
+	parser.SetLimits(parser.Limits{MaxDepth: 2, MaxGlobs: 1})
+	defer parser.SetLimits(parser.Limits{})
+
+	tests := []struct {
+		url      string
+		expected string
+		counter  metrics.Counter
+	}{
+		{
+			url:      "/render/?target=sumSeries(scale(absolute(foo.bar),2))&from=-10minutes&format=json",
+			expected: "expression is too complex: maxDepth is 2 at position 24",
+			counter:  ApiMetrics.MaxDepthExceeded,
+		},
+		{
+			url:      "/render/?target=sumSeries(foo.*,bar.*)&from=-10minutes&format=json",
+			expected: "expression is too complex: maxGlobs is 1 at position 16",
+			counter:  ApiMetrics.MaxGlobsExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			count := tt.counter.Count()
+			req, rr := setUpRequest(t, tt.url)
+			renderHandler(rr, req)
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.expected)
+			assert.Equal(t, count+1, tt.counter.Count())
+		})
+	}
+}
+
 func TestFindHandler(t *testing.T) {
 	req, rr := setUpRequest(t, "/metrics/find/?query=foo.bar&format=json")
 	findHandler(rr, req)
@@ -1,10 +1,13 @@
 package http
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/go-graphite/carbonapi/cache"
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/pkg/parser"
 	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
 	"github.com/msaf1980/go-metrics"
 	"go.uber.org/zap"
@@ -29,6 +32,15 @@ var ApiMetrics = struct {
 
 	FindRequests metrics.Counter
 
+	// targets rejected by limits of complexity (see parser.Limits)
+	MaxDepthExceeded         metrics.Counter
+	MaxNodesExceeded         metrics.Counter
+	MaxFunctionCallsExceeded metrics.Counter
+	MaxGlobsExceeded         metrics.Counter
+
+	// targets with type errors (see typeCheck in doc/configuration.md)
+	TypeCheckErrors metrics.Counter
+
 	MemcacheTimeouts metrics.UGauge
 
 	CacheSize  metrics.UGauge
@@ -50,6 +62,13 @@ var ApiMetrics = struct {
 	Requests5xx: metrics.NewCounter(),
 
 	FindRequests: metrics.NewCounter(),
+
+	MaxDepthExceeded:         metrics.NewCounter(),
+	MaxNodesExceeded:         metrics.NewCounter(),
+	MaxFunctionCallsExceeded: metrics.NewCounter(),
+	MaxGlobsExceeded:         metrics.NewCounter(),
+
+	TypeCheckErrors: metrics.NewCounter(),
 }
 
 var ZipperMetrics = struct {
@@ -92,6 +111,24 @@ var ZipperMetrics = struct {
 	CacheMisses: metrics.NewCounter(),
 }
 
+// complexityLimitStats counts the error, if the target is rejected by limits of complexity
+func complexityLimitStats(err error) {
+	var complexityErr *parser.ComplexityError
+	if !errors.As(err, &complexityErr) {
+		return
+	}
+	switch complexityErr.Limit {
+	case parser.LimitMaxDepth:
+		ApiMetrics.MaxDepthExceeded.Add(1)
+	case parser.LimitMaxNodes:
+		ApiMetrics.MaxNodesExceeded.Add(1)
+	case parser.LimitMaxFunctionCalls:
+		ApiMetrics.MaxFunctionCallsExceeded.Add(1)
+	case parser.LimitMaxGlobs:
+		ApiMetrics.MaxGlobsExceeded.Add(1)
+	}
+}
+
 func ZipperStats(stats *zipperTypes.Stats) {
 	if stats == nil {
 		return
@@ -109,8 +146,16 @@ func ZipperStats(stats *zipperTypes.Stats) {
 	ZipperMetrics.SearchRequests.Add(stats.SearchRequests)
 	ZipperMetrics.CacheMisses.Add(stats.CacheMisses)
 	ZipperMetrics.CacheHits.Add(stats.CacheHits)
+
+	for _, d := range stats.ReplicaDivergences {
+		name := "zipper.replica_divergence." + metricNodeReplacer.Replace(d.Server) + "." + metricNodeReplacer.Replace(d.Prefix)
+		metrics.GetOrRegisterCounter(name, nil).Add(d.Points)
+	}
 }
 
+// metricNodeReplacer makes server address or metric prefix usable as a single node of metric name
+var metricNodeReplacer = strings.NewReplacer(".", "_", ":", "_", "/", "_")
+
 func SetupMetrics(logger *zap.Logger) {
 	switch config.Config.ResponseCacheConfig.Type {
 	case "memcache":
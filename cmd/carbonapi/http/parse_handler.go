@@ -0,0 +1,178 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/lomik/zapwriter"
+
+	"github.com/go-graphite/carbonapi/carbonapipb"
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/date"
+	"github.com/go-graphite/carbonapi/expr"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+)
+
+// parsedNode is a node of expression tree. Span is a pair of byte offsets of the start and the end of the node in the target.
+type parsedNode struct {
+	Type      string                `json:"type"`
+	Function  string                `json:"function,omitempty"`
+	Name      string                `json:"name,omitempty"`
+	Value     interface{}           `json:"value,omitempty"`
+	Args      []parsedNode          `json:"args,omitempty"`
+	NamedArgs map[string]parsedNode `json:"namedArgs,omitempty"`
+	Span      [2]int                `json:"span"`
+}
+
+type parsedMetric struct {
+	Metric            string `json:"metric"`
+	ConsolidationFunc string `json:"consolidationFunc,omitempty"`
+	From              int64  `json:"from"`
+	Until             int64  `json:"until"`
+}
+
+type parsedTarget struct {
+	Target     string          `json:"target"`
+	AST        *parsedNode     `json:"ast,omitempty"`
+	Formatted  string          `json:"formatted,omitempty"`
+	Metrics    []parsedMetric  `json:"metrics,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Position   *int            `json:"position,omitempty"`
+	TypeErrors expr.TypeErrors `json:"typeErrors,omitempty"`
+}
+
+func buildParsedNode(e parser.Expr) parsedNode {
+	start, end := e.Span()
+	node := parsedNode{Span: [2]int{start, end}}
+	switch e.Type() {
+	case parser.EtFunc:
+		node.Type = "function"
+		node.Function = e.Target()
+		for _, arg := range e.Args() {
+			node.Args = append(node.Args, buildParsedNode(arg))
+		}
+		if namedArgs := e.NamedArgs(); len(namedArgs) > 0 {
+			node.NamedArgs = make(map[string]parsedNode, len(namedArgs))
+			for name, arg := range namedArgs {
+				node.NamedArgs[name] = buildParsedNode(arg)
+			}
+		}
+	case parser.EtConst:
+		node.Type = "constant"
+		node.Value = e.FloatValue()
+	case parser.EtString:
+		node.Type = "string"
+		node.Value = e.StringValue()
+	case parser.EtBool:
+		node.Type = "bool"
+		node.Value = e.StringValue() == "true"
+	default:
+		node.Type = "name"
+		node.Name = e.Target()
+	}
+	return node
+}
+
+func parseTarget(target string, from, until int64) parsedTarget {
+	res := parsedTarget{Target: target}
+
+	exp, e, err := parser.ParseExpr(target)
+	if err == nil && e != "" {
+		err = parser.ErrUnexpectedCharacter
+	}
+	if err != nil {
+		res.Error = err.Error()
+		pos := len(target) - len(e)
+		var parseErr *parser.ParseError
+		if errors.As(err, &parseErr) {
+			pos = parseErr.Pos
+		}
+		res.Position = &pos
+		return res
+	}
+
+	node := buildParsedNode(exp)
+	res.AST = &node
+	res.Formatted = parser.Format(exp)
+	for _, m := range exp.Metrics(from, until) {
+		res.Metrics = append(res.Metrics, parsedMetric{
+			Metric:            m.Metric,
+			ConsolidationFunc: m.ConsolidationFunc,
+			From:              m.From,
+			Until:             m.Until,
+		})
+	}
+	res.TypeErrors = expr.TypeCheck(exp)
+	return res
+}
+
+// parseHandler returns expression trees of requested targets, their canonical form and metrics they would fetch.
+// Nothing is fetched, errors are reported per target.
+func parseHandler(w http.ResponseWriter, r *http.Request) {
+	t0 := time.Now()
+	username, _, _ := r.BasicAuth()
+
+	srcIP, srcPort := splitRemoteAddr(r.RemoteAddr)
+
+	accessLogger := zapwriter.Logger("access")
+	var accessLogDetails = carbonapipb.AccessLogDetails{
+		Handler:        "parse",
+		Username:       username,
+		URL:            r.URL.RequestURI(),
+		PeerIP:         srcIP,
+		PeerPort:       srcPort,
+		Host:           r.Host,
+		Referer:        r.Referer(),
+		URI:            r.RequestURI,
+		RequestHeaders: utilctx.GetLogHeaders(r.Context()),
+	}
+
+	logAsError := false
+	defer func() {
+		deferredAccessLogging(accessLogger, &accessLogDetails, t0, logAsError)
+	}()
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest)+": "+err.Error(), http.StatusBadRequest)
+		accessLogDetails.HTTPCode = http.StatusBadRequest
+		accessLogDetails.Reason = err.Error()
+		logAsError = true
+		return
+	}
+
+	targets := r.Form["target"]
+	if len(targets) == 0 {
+		http.Error(w, http.StatusText(http.StatusBadRequest)+": no target specified", http.StatusBadRequest)
+		accessLogDetails.HTTPCode = http.StatusBadRequest
+		accessLogDetails.Reason = "no target specified"
+		logAsError = true
+		return
+	}
+
+	now := timeNow()
+	qtz := r.FormValue("tz")
+	from := date.DateParamToEpoch(r.FormValue("from"), qtz, now.Add(-24*time.Hour).Unix(), config.Config.DefaultTimeZone)
+	until := date.DateParamToEpoch(r.FormValue("until"), qtz, now.Unix(), config.Config.DefaultTimeZone)
+
+	res := make([]parsedTarget, 0, len(targets))
+	for _, target := range targets {
+		res = append(res, parseTarget(target, from, until))
+	}
+
+	b, err := json.Marshal(res)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError)+": "+err.Error(), http.StatusInternalServerError)
+		accessLogDetails.HTTPCode = http.StatusInternalServerError
+		accessLogDetails.Reason = err.Error()
+		logAsError = true
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	_, _ = w.Write(b)
+	accessLogDetails.HTTPCode = http.StatusOK
+}
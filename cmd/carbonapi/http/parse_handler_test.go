@@ -0,0 +1,63 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHandler(t *testing.T) {
+	query := url.Values{
+		"target": []string{"a.*.errors / a.*.requests", "sumSeries(foo.bar baz)", "movingAverage(foo.bar)"},
+		"from":   []string{"1000"},
+		"until":  []string{"2000"},
+	}
+	req, rr := setUpRequest(t, "/parse/?"+query.Encode())
+	parseHandler(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var res []parsedTarget
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+		t.Fatalf("failed to unmarshal response %q: %v", rr.Body.String(), err)
+	}
+	if len(res) != 3 {
+		t.Fatalf("got %d targets, expected 3", len(res))
+	}
+
+	expectedAST := &parsedNode{
+		Type:     "function",
+		Function: "divideSeries",
+		Args: []parsedNode{
+			{Type: "name", Name: "a.*.errors", Span: [2]int{0, 10}},
+			{Type: "name", Name: "a.*.requests", Span: [2]int{13, 25}},
+		},
+		Span: [2]int{0, 25},
+	}
+	assert.Equal(t, expectedAST, res[0].AST)
+	assert.Equal(t, "divideSeries(a.*.errors, a.*.requests)", res[0].Formatted)
+	assert.Equal(t, []parsedMetric{
+		{Metric: "a.*.errors", From: 1000, Until: 2000},
+		{Metric: "a.*.requests", From: 1000, Until: 2000},
+	}, res[0].Metrics)
+	assert.Empty(t, res[0].Error)
+
+	assert.Nil(t, res[1].AST)
+	assert.Equal(t, "unexpected character at position 18", res[1].Error)
+	if assert.NotNil(t, res[1].Position) {
+		assert.Equal(t, 18, *res[1].Position)
+	}
+
+	if assert.Len(t, res[2].TypeErrors, 1) {
+		assert.Equal(t, "windowSize", res[2].TypeErrors[0].Argument)
+	}
+}
+
+func TestParseHandlerNoTarget(t *testing.T) {
+	req, rr := setUpRequest(t, "/parse/")
+	parseHandler(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
@@ -109,6 +109,7 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	targets := r.Form["target"]
+	vars := requestVariables(r)
 	from := r.FormValue("from")
 	until := r.FormValue("until")
 	template := r.FormValue("template")
@@ -169,7 +170,7 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 		until32 = timestampTruncate(until32, duration, config.Config.TruncateTime)
 		// recalc duration
 		duration = time.Second * time.Duration(until32-from32)
-		responseCacheKey = responseCacheComputeKey(from32, until32, targets, formatRaw, maxDataPoints, noNullPoints, template)
+		responseCacheKey = responseCacheComputeKey(from32, until32, cacheKeyTargets(targets, vars), formatRaw, maxDataPoints, noNullPoints, template)
 		if useCache {
 			responseCacheTimeout = getCacheTimeout(logger, r, now32, until32, duration, &config.Config.ResponseCacheConfig)
 			backendCacheTimeout = getCacheTimeout(logger, r, now32, until32, duration, &config.Config.BackendCacheConfig)
@@ -274,9 +275,9 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 
 	var backendCacheKey string
 	if len(config.Config.TruncateTime) > 0 {
-		backendCacheKey = backendCacheComputeKeyAbs(from32, until32, targets, maxDataPoints, noNullPoints)
+		backendCacheKey = backendCacheComputeKeyAbs(from32, until32, cacheKeyTargets(targets, vars), maxDataPoints, noNullPoints)
 	} else {
-		backendCacheKey = backendCacheComputeKey(from, until, targets, maxDataPoints, noNullPoints)
+		backendCacheKey = backendCacheComputeKey(from, until, cacheKeyTargets(targets, vars), maxDataPoints, noNullPoints)
 	}
 
 	results, err := backendCacheFetchResults(logger, useCache, backendCacheKey, accessLogDetails)
@@ -287,40 +288,113 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 		results = make([]*types.MetricData, 0)
 		values := make(map[parser.MetricRequest][]*types.MetricData)
 
-		if config.Config.CombineMultipleTargetsInOne && len(targets) > 0 {
-			exprs := make([]parser.Expr, 0, len(targets))
-			for _, target := range targets {
-				exp, e, err := parser.ParseExpr(target)
-				if err != nil || e != "" {
-					msg := buildParseErrorString(target, e, err)
-					setError(w, accessLogDetails, msg, http.StatusBadRequest, uid.String())
-					logAsError = true
-					return
+		// all targets are parsed and checked before anything is fetched
+		exprs := make([]parser.Expr, 0, len(targets))
+		for _, target := range targets {
+			exp, e, err := parser.ParseExpr(target)
+			if err != nil || e != "" {
+				complexityLimitStats(err)
+				msg := buildParseErrorString(target, e, err)
+				setError(w, accessLogDetails, msg, http.StatusBadRequest, uid.String())
+				logAsError = true
+				return
+			}
+			exprs = append(exprs, exp)
+		}
+
+		// dashboard variables are substituted into parsed targets, so they can't change their structure
+		vars, stats, err := resolveVariables(ctx, vars, exprs, from32, until32)
+		if stats != nil {
+			accessLogDetails.ZipperRequests += stats.ZipperRequests
+			accessLogDetails.TotalMetricsCount += stats.TotalMetricsCount
+		}
+		if err != nil {
+			returnCode := merry.HTTPCode(err)
+			if returnCode == http.StatusNotFound {
+				returnCode = config.Config.NotFoundStatusCode
+			}
+			setError(w, accessLogDetails, err.Error(), returnCode, uid.String())
+			logAsError = returnCode >= 500
+			return
+		}
+		var typeErrors map[string]string
+		for i, target := range targets {
+			exprs[i], err = parser.SubstituteVariables(exprs[i], vars)
+			if err != nil {
+				setError(w, accessLogDetails, err.Error(), http.StatusBadRequest, uid.String())
+				logAsError = true
+				return
+			}
+			if config.Config.TypeCheck == config.TypeCheckOff {
+				continue
+			}
+			if errs := expr.TypeCheck(exprs[i]); len(errs) > 0 {
+				ApiMetrics.TypeCheckErrors.Add(1)
+				if config.Config.TypeCheck != config.TypeCheckStrict {
+					// descriptions of functions could be stricter than their implementations
+					logger.Warn("target doesn't match function descriptions",
+						zap.String("target", target),
+						zap.Error(errs),
+					)
+					continue
+				}
+				if typeErrors == nil {
+					typeErrors = make(map[string]string)
 				}
-				exprs = append(exprs, exp)
+				typeErrors[target] = buildTypeErrorString(target, errs)
 			}
+		}
+		if len(typeErrors) > 0 {
+			setErrors(w, accessLogDetails, typeErrors, http.StatusBadRequest, uid.String())
+			logAsError = true
+			return
+		}
+
+		// tenant isn't verified, it's expected to be set by a trusted proxy (see limits in doc/configuration.md)
+		tenant := username
+		if config.Config.Limits.TenantHeader != "" {
+			tenant = r.Header.Get(config.Config.Limits.TenantHeader)
+		}
+		evalCtx := expr.WithLimits(ctx, config.Config.Limits.ForTenant(tenant))
+		if config.Config.MemoizeSubexpressions {
+			// identical subexpressions of targets are evaluated once
+			evalCtx = expr.WithMemo(evalCtx)
+		}
 
+		if config.Config.CombineMultipleTargetsInOne && len(targets) > 0 {
 			ApiMetrics.RenderRequests.Add(1)
 
-			result, errs := expr.FetchAndEvalExprs(ctx, config.Config.Evaluator, exprs, from32, until32, values)
+			result, errs := expr.FetchAndEvalExprs(evalCtx, config.Config.Evaluator, exprs, from32, until32, values)
 			if errs != nil {
 				errors = errs
 			}
 
 			results = append(results, result...)
-		} else {
-			for _, target := range targets {
-				exp, e, err := parser.ParseExpr(target)
-				if err != nil || e != "" {
-					msg := buildParseErrorString(target, e, err)
-					setError(w, accessLogDetails, msg, http.StatusBadRequest, uid.String())
-					logAsError = true
-					return
+		} else if config.Config.MaxParallelEvaluations > 1 {
+			// targets are evaluated concurrently, but results and errors are handled in the same order as sequentially
+			targetResults, targetErrors := expr.FetchAndEvalExpsParallel(expr.WithParallelism(evalCtx, config.Config.MaxParallelEvaluations), config.Config.Evaluator, exprs, from32, until32, values)
+			for i, target := range targets {
+				ApiMetrics.RenderRequests.Add(1)
+
+				if err := targetErrors[i]; err != nil {
+					errors[target] = err
+					if config.Config.Upstreams.RequireSuccessAll {
+						code := merry.HTTPCode(err)
+						if code != http.StatusOK && code != http.StatusNotFound {
+							break
+						}
+					}
 				}
 
+				results = append(results, targetResults[i]...)
+			}
+		} else {
+			for i, target := range targets {
+				exp := exprs[i]
+
 				ApiMetrics.RenderRequests.Add(1)
 
-				result, err := expr.FetchAndEvalExp(ctx, config.Config.Evaluator, exp, from32, until32, values)
+				result, err := expr.FetchAndEvalExp(evalCtx, config.Config.Evaluator, exp, from32, until32, values)
 				if err != nil {
 					errors[target] = merry.Wrap(err)
 					if config.Config.Upstreams.RequireSuccessAll {
@@ -334,6 +408,16 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 				results = append(results, result...)
 			}
 		}
+		accessLogDetails.MemoHits = expr.MemoHits(evalCtx)
+		for _, err := range errors {
+			complexityLimitStats(err)
+		}
+
+		if err := expr.LimitError(evalCtx); err != nil {
+			setError(w, accessLogDetails, err.Error(), http.StatusUnprocessableEntity, uid.String())
+			logAsError = true
+			return
+		}
 
 		if len(errors) == 0 && backendCacheTimeout > 0 {
 			w.Header().Set("X-Carbonapi-Backend-Cached", strconv.FormatInt(int64(backendCacheTimeout), 10))
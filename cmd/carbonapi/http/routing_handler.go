@@ -0,0 +1,89 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/lomik/zapwriter"
+
+	"github.com/go-graphite/carbonapi/carbonapipb"
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+	"github.com/go-graphite/carbonapi/zipper/routing"
+)
+
+type routingMatch struct {
+	Target  string   `json:"target"`
+	Matched bool     `json:"matched"`
+	Rule    string   `json:"rule,omitempty"`
+	Groups  []string `json:"groups,omitempty"`
+}
+
+type router interface {
+	Router() *routing.Router
+}
+
+// routingHandler shows which static routing rule matches requested targets
+func routingHandler(w http.ResponseWriter, r *http.Request) {
+	t0 := time.Now()
+	username, _, _ := r.BasicAuth()
+
+	srcIP, srcPort := splitRemoteAddr(r.RemoteAddr)
+
+	accessLogger := zapwriter.Logger("access")
+	var accessLogDetails = carbonapipb.AccessLogDetails{
+		Handler:        "routing",
+		Username:       username,
+		URL:            r.URL.RequestURI(),
+		PeerIP:         srcIP,
+		PeerPort:       srcPort,
+		Host:           r.Host,
+		Referer:        r.Referer(),
+		URI:            r.RequestURI,
+		RequestHeaders: utilctx.GetLogHeaders(r.Context()),
+	}
+
+	logAsError := false
+	defer func() {
+		deferredAccessLogging(accessLogger, &accessLogDetails, t0, logAsError)
+	}()
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest)+": "+err.Error(), http.StatusBadRequest)
+		accessLogDetails.HTTPCode = http.StatusBadRequest
+		accessLogDetails.Reason = err.Error()
+		logAsError = true
+		return
+	}
+
+	var rules *routing.Router
+	if z, ok := config.Config.ZipperInstance.(router); ok {
+		rules = z.Router()
+	}
+
+	matches := make([]routingMatch, 0, len(r.Form["target"]))
+	for _, target := range r.Form["target"] {
+		m := routingMatch{Target: target}
+		if rule := rules.Match(target); rule != nil {
+			m.Matched = true
+			m.Rule = rule.Name
+			m.Groups = rule.Groups
+		}
+		matches = append(matches, m)
+	}
+
+	b, err := json.Marshal(matches)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError)+": "+err.Error(), http.StatusInternalServerError)
+		accessLogDetails.HTTPCode = http.StatusInternalServerError
+		accessLogDetails.Reason = err.Error()
+		logAsError = true
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	_, _ = w.Write(b)
+	accessLogDetails.HTTPCode = http.StatusOK
+}
@@ -10,6 +10,7 @@ supported requests:
     /info/?target=
     /lb_check/
     /metrics/find/?query=
+    /parse/?target=
 	/render/?target=
 	/tags/autoComplete/tags/
     /tags/autoComplete/values/
@@ -0,0 +1,142 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/ansel1/merry"
+	pbv3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+const (
+	variablePrefix = "var-"
+	// variableAll is the value of variable, that Grafana sends for "All" option. Such variables are resolved by server.
+	variableAll = "$__all"
+)
+
+// requestVariables returns values of dashboard variables passed as var-<name> parameters
+func requestVariables(r *http.Request) parser.Variables {
+	var vars parser.Variables
+	for k, v := range r.Form {
+		if !strings.HasPrefix(k, variablePrefix) || len(k) == len(variablePrefix) {
+			continue
+		}
+		if vars == nil {
+			vars = make(parser.Variables)
+		}
+		vars[k[len(variablePrefix):]] = v
+	}
+	return vars
+}
+
+// variablesCacheKey returns variables in the form of request parameters sorted by name
+func variablesCacheKey(vars parser.Variables) string {
+	if len(vars) == 0 {
+		return ""
+	}
+	values := make(url.Values, len(vars))
+	for name, v := range vars {
+		values[variablePrefix+name] = v
+	}
+	return values.Encode()
+}
+
+// resolveVariables sets values of variables, that are referenced by expressions, but aren't passed by the request
+// (or are passed as $__all), by find requests with their queries from config
+func resolveVariables(ctx context.Context, vars parser.Variables, exprs []parser.Expr, from, until int64) (parser.Variables, *types.Stats, error) {
+	if len(config.Config.Variables) == 0 {
+		return vars, nil, nil
+	}
+
+	var stats *types.Stats
+	resolved := make(map[string]struct{})
+	for _, exp := range exprs {
+		for _, name := range parser.VariableRefs(exp) {
+			if values, ok := vars[name]; ok && !(len(values) == 1 && values[0] == variableAll) {
+				continue
+			}
+			if _, ok := resolved[name]; ok {
+				continue
+			}
+			// keys of maps are lowercased by config parser
+			variable, ok := config.Config.Variables[strings.ToLower(name)]
+			if !ok {
+				continue
+			}
+
+			values, s, err := findVariableValues(ctx, &variable, from, until)
+			if s != nil {
+				if stats == nil {
+					stats = new(types.Stats)
+				}
+				stats.Merge(s)
+			}
+			if err != nil {
+				return vars, stats, merry.Prepend(err, "failed to resolve variable "+name)
+			}
+			if len(values) == 0 {
+				return vars, stats, merry.Errorf("variable %s: nothing found by %s", name, variable.Query).WithHTTPCode(http.StatusNotFound)
+			}
+
+			if vars == nil {
+				vars = make(parser.Variables)
+			}
+			vars[name] = values
+			resolved[name] = struct{}{}
+		}
+	}
+	return vars, stats, nil
+}
+
+// findVariableValues returns sorted unique values of the variable found by its query
+func findVariableValues(ctx context.Context, variable *config.VariableConfig, from, until int64) ([]string, *types.Stats, error) {
+	request := pbv3.MultiGlobRequest{
+		Metrics:   []string{variable.Query},
+		StartTime: from,
+		StopTime:  until,
+	}
+	multiGlobs, stats, err := config.Config.ZipperInstance.Find(ctx, request)
+	if err != nil {
+		switch code := merry.HTTPCode(err); {
+		case code == http.StatusNotFound:
+			return nil, stats, nil
+		case code != http.StatusOK || multiGlobs == nil:
+			return nil, stats, err
+		}
+	}
+
+	seen := make(map[string]struct{})
+	var values []string
+	for _, glob := range multiGlobs.Metrics {
+		for _, m := range glob.Matches {
+			value, ok := variable.Value(m.Path)
+			if !ok {
+				continue
+			}
+			if _, ok := seen[value]; ok {
+				continue
+			}
+			seen[value] = struct{}{}
+			values = append(values, value)
+		}
+	}
+	sort.Strings(values)
+	return values, stats, nil
+}
+
+// cacheKeyTargets returns targets for cache keys: variables are appended, so responses for other values of them are
+// cached separately
+func cacheKeyTargets(targets []string, vars parser.Variables) []string {
+	key := variablesCacheKey(vars)
+	if key == "" {
+		return targets
+	}
+	return append(targets[:len(targets):len(targets)], key)
+}
@@ -17,6 +17,8 @@ import (
 	"github.com/gorilla/handlers"
 	"github.com/lomik/zapwriter"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
 	"github.com/go-graphite/carbonapi/pkg/tlsconfig"
 
@@ -216,6 +218,53 @@ func main() {
 		serve(listener, handler)
 	}
 
+	for _, listen := range config.Config.GRPC.Listeners {
+		opts := []grpc.ServerOption{
+			grpc.MaxRecvMsgSize(config.Config.GRPC.MaxMessageSize),
+			grpc.MaxSendMsgSize(config.Config.GRPC.MaxMessageSize),
+		}
+		if len(listen.ServerTLSConfig.CACertFiles) > 0 {
+			tlsConfig, warns, err := tlsconfig.ParseServerTLSConfig(&listen.ServerTLSConfig, &listen.ClientTLSConfig)
+			if err != nil {
+				logger.Fatal("failed to initialize TLS",
+					zap.Error(err),
+				)
+			}
+			if len(warns) != 0 {
+				logger.Warn("insecure ciphers are in-use",
+					zap.Strings("insecure_ciphers", warns),
+				)
+			}
+			opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		}
+		s := carbonapiHttp.NewGRPCServer(config.Config.HeadersToPass, config.Config.HeadersToLog, opts...)
+
+		l := &net.ListenConfig{Control: helper.ReusePort}
+		listener, err := l.Listen(context.Background(), "tcp", listen.Address)
+		if err != nil {
+			logger.Fatal("failed to start grpc server",
+				zap.String("address", listen.Address),
+				zap.Error(err),
+			)
+		}
+		wg.Add(1)
+		go func() {
+			if err := s.Serve(listener); err != nil {
+				logger.Error("failed to start grpc server",
+					zap.Error(err),
+				)
+			}
+			wg.Done()
+		}()
+
+		go func() {
+			stop := make(chan os.Signal, 1)
+			signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+			<-stop
+			s.GracefulStop()
+		}()
+	}
+
 	wg.Wait()
 
 	if g != nil {
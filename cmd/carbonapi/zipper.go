@@ -11,6 +11,8 @@ import (
 	util "github.com/go-graphite/carbonapi/util/ctx"
 	realZipper "github.com/go-graphite/carbonapi/zipper"
 	zipperCfg "github.com/go-graphite/carbonapi/zipper/config"
+	"github.com/go-graphite/carbonapi/zipper/divergence"
+	"github.com/go-graphite/carbonapi/zipper/routing"
 	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
 	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
 	"go.uber.org/zap"
@@ -85,6 +87,7 @@ func (z zipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*ty
 		hdrs := util.GetPassHeaders(ctx)
 		newCtx = util.SetUUID(context.Background(), uuid)
 		newCtx = util.SetPassHeaders(newCtx, hdrs)
+		newCtx = zipperTypes.WithFetchBudget(newCtx, zipperTypes.GetFetchBudget(ctx))
 	}
 
 	pbresp, stats, err := z.z.FetchProtoV3(newCtx, &request)
@@ -118,6 +121,20 @@ func (z zipper) RenderCompat(ctx context.Context, metrics []string, from, until
 	return z.Render(ctx, req)
 }
 
+func (z zipper) List(ctx context.Context) (*pb.ListMetricsResponse, *zipperTypes.Stats, merry.Error) {
+	res, stats, err := z.z.ListProtoV3(ctx)
+	z.statsSender(stats)
+
+	return res, stats, err
+}
+
+func (z zipper) Stats(ctx context.Context) (*pb.MetricDetailsResponse, *zipperTypes.Stats, merry.Error) {
+	res, stats, err := z.z.StatsProtoV3(ctx)
+	z.statsSender(stats)
+
+	return res, stats, err
+}
+
 func (z zipper) TagNames(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
 	return z.z.TagNames(ctx, query, limit)
 }
@@ -129,3 +146,15 @@ func (z zipper) TagValues(ctx context.Context, query string, limit int64) ([]str
 func (z zipper) ScaleToCommonStep() bool {
 	return z.z.ScaleToCommonStep
 }
+
+func (z zipper) PushdownFunctions() []string {
+	return z.z.PushdownFunctions()
+}
+
+func (z zipper) Router() *routing.Router {
+	return z.z.Router()
+}
+
+func (z zipper) Divergence() *divergence.Tracker {
+	return z.z.Divergence()
+}
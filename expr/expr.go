@@ -3,6 +3,7 @@ package expr
 import (
 	"context"
 	"errors"
+	"net/http"
 
 	"github.com/ansel1/merry"
 	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
@@ -25,21 +26,70 @@ type Evaluator struct {
 	limiter                limiter.SimpleLimiter
 	zipper                 zipper.CarbonZipper
 	passFunctionsToBackend bool
+	// pushdownFunctions are functions that are evaluated by backends, see PushdownFunctions
+	pushdownFunctions map[string]struct{}
 }
 
 func (eval Evaluator) Fetch(ctx context.Context, exprs []parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) (map[parser.MetricRequest][]*types.MetricData, error) {
+	// expressions could be built or changed after parsing, so complexity is checked again before anything is fetched
+	for _, exp := range exprs {
+		if err := parser.CheckLimits(exp); err != nil {
+			return nil, merry.WithHTTPCode(err, http.StatusBadRequest)
+		}
+	}
+
 	if err := eval.limiter.Enter(ctx); err != nil {
 		return nil, err
 	}
 	defer eval.limiter.Leave()
 
+	limits := getLimitsState(ctx)
+	if err := limits.check(); err != nil {
+		return nil, err
+	}
+
 	multiFetchRequest := pb.MultiFetchRequest{}
 	metricRequestCache := make(map[string]parser.MetricRequest)
 	maxDataPoints := utilctx.GetMaxDatapoints(ctx)
 	// values related to this particular `target=`
 	targetValues := make(map[parser.MetricRequest][]*types.MetricData)
+	pushdowns := planPushdowns(exprs, eval.pushdownFunctions, from, until)
+	// pushed down requests by PathExpression, that is their metric
+	pushdownsByPath := make(map[string]*pushdown)
+
+	// metric is the name of values of the request, it's the text of evaluated subtree for pushed down requests
+	addRequest := func(fetchRequest pb.FetchRequest, metric string) {
+		metricRequest := parser.MetricRequest{
+			Metric: metric,
+			From:   fetchRequest.StartTime,
+			Until:  fetchRequest.StopTime,
+		}
+
+		// avoid multiple requests in a function, E.g divideSeries(a.b, a.b)
+		if cachedMetricRequest, ok := metricRequestCache[fetchRequest.PathExpression]; ok &&
+			cachedMetricRequest.From == metricRequest.From &&
+			cachedMetricRequest.Until == metricRequest.Until {
+			return
+		}
+
+		// avoid multiple requests in a http request, E.g render?target=a.b&target=a.b
+		if _, ok := values[metricRequest]; ok {
+			targetValues[metricRequest] = nil
+			return
+		}
+
+		// avoid multiple requests from the same target, e.g. target=max(a,asPercent(holtWintersForecast(a),a))
+		if _, ok := targetValues[metricRequest]; ok {
+			return
+		}
+
+		metricRequestCache[fetchRequest.PathExpression] = metricRequest
+		targetValues[metricRequest] = nil
+		multiFetchRequest.Metrics = append(multiFetchRequest.Metrics, fetchRequest)
+	}
 
 	haveFallbackSeries := false
+	unlock := rlockValues(ctx)
 	for _, exp := range exprs {
 		for _, m := range exp.Metrics(from, until) {
 			fetchRequest := pb.FetchRequest{
@@ -49,14 +99,10 @@ func (eval Evaluator) Fetch(ctx context.Context, exprs []parser.Expr, from, unti
 				StopTime:       m.Until,
 				MaxDataPoints:  maxDataPoints,
 			}
-			metricRequest := parser.MetricRequest{
-				Metric: fetchRequest.PathExpression,
-				From:   fetchRequest.StartTime,
-				Until:  fetchRequest.StopTime,
-			}
 
 			if eval.passFunctionsToBackend && m.ConsolidationFunc != "" {
 				if _, ok := consolidateBy.ValidAggregateFunctions[m.ConsolidationFunc]; !ok {
+					unlock()
 					return nil, merry.WithMessagef(parser.ErrInvalidArg, "invalid consolidateBy argument: '%s'", m.ConsolidationFunc)
 				}
 				fetchRequest.FilterFunctions = append(fetchRequest.FilterFunctions, &pb.FilteringFunction{
@@ -69,53 +115,114 @@ func (eval Evaluator) Fetch(ctx context.Context, exprs []parser.Expr, from, unti
 				haveFallbackSeries = true
 			}
 
-			// avoid multiple requests in a function, E.g divideSeries(a.b, a.b)
-			if cachedMetricRequest, ok := metricRequestCache[m.Metric]; ok &&
-				cachedMetricRequest.From == metricRequest.From &&
-				cachedMetricRequest.Until == metricRequest.Until {
+			if p, ok := pushdowns[m.Metric]; ok {
+				pushdownsByPath[p.metric] = p
+				pushdownRequest := fetchRequest
+				pushdownRequest.FilterFunctions = append(append([]*pb.FilteringFunction{}, fetchRequest.FilterFunctions...), p.functions...)
+				addRequest(pushdownRequest, p.key)
 				continue
 			}
 
-			// avoid multiple requests in a http request, E.g render?target=a.b&target=a.b
-			if _, ok := values[metricRequest]; ok {
+			addRequest(fetchRequest, m.Metric)
+		}
+	}
+	unlock()
+
+	// fetched data is added to values at once and only if it's not there yet, as the same metrics could be fetched
+	// concurrently by evaluation of other expressions
+	fetched := make(map[parser.MetricRequest][]*types.MetricData)
+	if len(multiFetchRequest.Metrics) > 0 {
+		fetchCtx := limits.withFetchBudget(ctx)
+		metrics, _, err := eval.zipper.Render(fetchCtx, multiFetchRequest)
+		if err := limits.check(); err != nil {
+			return nil, err
+		}
+
+		// backend declines pushdown by not reporting the function as applied, such requests are fetched
+		// again as is and evaluated locally. Backend could also fail on functions, that it doesn't support, so
+		// the whole request is fetched again without them before the error is reported.
+		declined := make(map[string]bool)
+		refetchAll := false
+		if err != nil && merry.HTTPCode(err) >= 400 && len(pushdownsByPath) > 0 {
+			refetchAll = true
+			metrics = nil
+			for path := range pushdownsByPath {
+				declined[path] = true
+			}
+		}
+		for _, metric := range metrics {
+			if p, ok := pushdownsByPath[metric.PathExpression]; ok && !p.applied(metric.AppliedFunctions) {
+				declined[p.metric] = true
+			}
+		}
+		if len(declined) > 0 {
+			fallbackRequest := pb.MultiFetchRequest{}
+			for _, r := range multiFetchRequest.Metrics {
+				p, ok := pushdownsByPath[r.PathExpression]
+				if !ok || !declined[p.metric] {
+					if refetchAll {
+						fallbackRequest.Metrics = append(fallbackRequest.Metrics, r)
+					}
+					continue
+				}
+				delete(targetValues, metricRequestCache[r.PathExpression])
+				r.FilterFunctions = r.FilterFunctions[:len(r.FilterFunctions)-len(p.functions)]
+				metricRequest := parser.MetricRequest{Metric: r.PathExpression, From: r.StartTime, Until: r.StopTime}
+				metricRequestCache[r.PathExpression] = metricRequest
+				if _, ok := targetValues[metricRequest]; ok {
+					continue
+				}
 				targetValues[metricRequest] = nil
-				continue
+				fallbackRequest.Metrics = append(fallbackRequest.Metrics, r)
 			}
-
-			// avoid multiple requests from the same target, e.g. target=max(a,asPercent(holtWintersForecast(a),a))
-			if _, ok := targetValues[metricRequest]; ok {
-				continue
+			var fallbackMetrics []*types.MetricData
+			fallbackMetrics, _, err = eval.zipper.Render(fetchCtx, fallbackRequest)
+			if err := limits.check(); err != nil {
+				return nil, err
 			}
-
-			metricRequestCache[m.Metric] = metricRequest
-			targetValues[metricRequest] = nil
-			multiFetchRequest.Metrics = append(multiFetchRequest.Metrics, fetchRequest)
+			kept := metrics[:0]
+			for _, metric := range metrics {
+				if !declined[metric.PathExpression] {
+					kept = append(kept, metric)
+				}
+			}
+			metrics = append(kept, fallbackMetrics...)
 		}
-	}
 
-	if len(multiFetchRequest.Metrics) > 0 {
-		metrics, _, err := eval.zipper.Render(ctx, multiFetchRequest)
 		// If we had only partial result, we want to do our best to actually do our job
 		if err != nil && merry.HTTPCode(err) >= 400 && !haveFallbackSeries {
 			return nil, err
 		}
+
 		for _, metric := range metrics {
 			metricRequest := metricRequestCache[metric.PathExpression]
 			if metric.RequestStartTime != 0 && metric.RequestStopTime != 0 {
 				metricRequest.From = metric.RequestStartTime
 				metricRequest.Until = metric.RequestStopTime
 			}
-			data, ok := values[metricRequest]
+			data, ok := fetched[metricRequest]
 			if !ok {
 				data = make([]*types.MetricData, 0, 1)
 			}
-			values[metricRequest] = append(data, metric)
+			fetched[metricRequest] = append(data, metric)
 		}
 	}
 
+	if err := limits.addFetched(fetched); err != nil {
+		return nil, err
+	}
+
+	unlock = lockValues(ctx)
+	for m, data := range fetched {
+		if _, ok := values[m]; !ok {
+			SortMetrics(data, m)
+			values[m] = data
+		}
+	}
 	for m := range targetValues {
 		targetValues[m] = values[m]
 	}
+	unlock()
 
 	if eval.zipper.ScaleToCommonStep() {
 		targetValues = helper.ScaleValuesToCommonStep(targetValues)
@@ -126,6 +233,25 @@ func (eval Evaluator) Fetch(ctx context.Context, exprs []parser.Expr, from, unti
 
 // Eval evaluates expressions.
 func (eval Evaluator) Eval(ctx context.Context, exp parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) (results []*types.MetricData, err error) {
+	// already evaluated concurrently with other arguments of the function
+	if res, ok := getPrepared(ctx, exp, from, until); ok {
+		return res.data, res.err
+	}
+
+	return eval.evalMemoized(ctx, exp, from, until, values)
+}
+
+func (eval Evaluator) eval(ctx context.Context, exp parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) (results []*types.MetricData, err error) {
+	if len(eval.pushdownFunctions) > 0 && exp.IsFunc() {
+		// already evaluated by backend
+		unlock := rlockValues(ctx)
+		data, ok := values[parser.MetricRequest{Metric: exp.ToString(), From: from, Until: until}]
+		unlock()
+		if ok {
+			return data, nil
+		}
+	}
+
 	rewritten, targets, err := RewriteExpr(ctx, eval, exp, from, until, values)
 	if err != nil {
 		return nil, err
@@ -148,7 +274,19 @@ func (eval Evaluator) Eval(ctx context.Context, exp parser.Expr, from, until int
 		}
 		return results, nil
 	}
-	return EvalExpr(ctx, eval, exp, from, until, values)
+	if !exp.IsFunc() {
+		return EvalExpr(ctx, eval, exp, from, until, values)
+	}
+
+	ctx = eval.evalArgsParallel(ctx, exp, from, until, values)
+	results, err = EvalExpr(ctx, eval, exp, from, until, values)
+	if err != nil {
+		return results, err
+	}
+	if err = getLimitsState(ctx).addResult(exp, results); err != nil {
+		return nil, err
+	}
+	return results, nil
 }
 
 // NewEvaluator create evaluator with limiter and zipper
@@ -156,12 +294,18 @@ func NewEvaluator(limiter limiter.SimpleLimiter, zipper zipper.CarbonZipper, pas
 	if zipper == nil {
 		return nil, ErrZipperNotInit
 	}
-	return &Evaluator{limiter: limiter, zipper: zipper, passFunctionsToBackend: passFunctionsToBackend}, nil
+	eval := &Evaluator{limiter: limiter, zipper: zipper, passFunctionsToBackend: passFunctionsToBackend}
+	if passFunctionsToBackend {
+		eval.pushdownFunctions = supportedPushdownFunctions(zipper)
+	}
+	return eval, nil
 }
 
 // EvalExpr is the main expression evaluator.
 func EvalExpr(ctx context.Context, eval interfaces.Evaluator, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
 	if e.IsName() {
+		unlock := rlockValues(ctx)
+		defer unlock()
 		return values[parser.MetricRequest{Metric: e.Target(), From: from, Until: until}], nil
 	} else if e.IsConst() {
 		p := types.MetricData{
@@ -356,6 +356,16 @@ func TestEvalExpression(t *testing.T) {
 				types.MakeMetricData("metric2", []float64{0}, 1, now32),
 			},
 		},
+		{
+			"metric1.errors * 100 / metric1.requests",
+			map[parser.MetricRequest][]*types.MetricData{
+				{Metric: "metric1.errors", From: 0, Until: 1}:   {types.MakeMetricData("metric1.errors", []float64{1, 2, 3}, 1, now32)},
+				{Metric: "metric1.requests", From: 0, Until: 1}: {types.MakeMetricData("metric1.requests", []float64{10, 20, 60}, 1, now32)},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("divideSeries(scale(metric1.errors,100),metric1.requests)", []float64{10, 10, 5}, 1, now32).SetTag("scale", "100").SetNameTag("metric1.errors"),
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -127,6 +127,7 @@ func (f *aggregate) Description() map[string]types.FunctionDescription {
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
+			ParallelArgs: true, // all arguments are evaluated over the same time range
 			NameChange:   true, // name changed
 			TagsChange:   true, // name tag changed
 			ValuesChange: true, // values changed
@@ -146,6 +147,7 @@ func (f *aggregate) Description() map[string]types.FunctionDescription {
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
+			ParallelArgs: true, // all arguments are evaluated over the same time range
 			NameChange:   true, // name changed
 			TagsChange:   true, // name tag changed
 			ValuesChange: true, // values changed
@@ -165,6 +167,7 @@ func (f *aggregate) Description() map[string]types.FunctionDescription {
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
+			ParallelArgs: true, // all arguments are evaluated over the same time range
 			NameChange:   true, // name changed
 			TagsChange:   true, // name tag changed
 			ValuesChange: true, // values changed
@@ -184,6 +187,7 @@ func (f *aggregate) Description() map[string]types.FunctionDescription {
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
+			ParallelArgs: true, // all arguments are evaluated over the same time range
 			NameChange:   true, // name changed
 			TagsChange:   true, // name tag changed
 			ValuesChange: true, // values changed
@@ -203,6 +207,7 @@ func (f *aggregate) Description() map[string]types.FunctionDescription {
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
+			ParallelArgs: true, // all arguments are evaluated over the same time range
 			NameChange:   true, // name changed
 			TagsChange:   true, // name tag changed
 			ValuesChange: true, // values changed
@@ -222,6 +227,7 @@ func (f *aggregate) Description() map[string]types.FunctionDescription {
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
+			ParallelArgs: true, // all arguments are evaluated over the same time range
 			NameChange:   true, // name changed
 			TagsChange:   true, // name tag changed
 			ValuesChange: true, // values changed
@@ -241,6 +247,7 @@ func (f *aggregate) Description() map[string]types.FunctionDescription {
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
+			ParallelArgs: true, // all arguments are evaluated over the same time range
 			NameChange:   true, // name changed
 			TagsChange:   true, // name tag changed
 			ValuesChange: true, // values changed
@@ -260,6 +267,7 @@ func (f *aggregate) Description() map[string]types.FunctionDescription {
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
+			ParallelArgs: true, // all arguments are evaluated over the same time range
 			NameChange:   true, // name changed
 			TagsChange:   true, // name tag changed
 			ValuesChange: true, // values changed
@@ -279,6 +287,7 @@ func (f *aggregate) Description() map[string]types.FunctionDescription {
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
+			ParallelArgs: true, // all arguments are evaluated over the same time range
 			NameChange:   true, // name changed
 			TagsChange:   true, // name tag changed
 			ValuesChange: true, // values changed
@@ -298,6 +307,7 @@ func (f *aggregate) Description() map[string]types.FunctionDescription {
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
+			ParallelArgs: true, // all arguments are evaluated over the same time range
 			NameChange:   true, // name changed
 			TagsChange:   true, // name tag changed
 			ValuesChange: true, // values changed
@@ -317,6 +327,7 @@ func (f *aggregate) Description() map[string]types.FunctionDescription {
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
+			ParallelArgs: true, // all arguments are evaluated over the same time range
 			NameChange:   true, // name changed
 			TagsChange:   true, // name tag changed
 			ValuesChange: true, // values changed
@@ -336,6 +347,7 @@ func (f *aggregate) Description() map[string]types.FunctionDescription {
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
+			ParallelArgs: true, // all arguments are evaluated over the same time range
 			NameChange:   true, // name changed
 			TagsChange:   true, // name tag changed
 			ValuesChange: true, // values changed
@@ -355,6 +367,7 @@ func (f *aggregate) Description() map[string]types.FunctionDescription {
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
+			ParallelArgs: true, // all arguments are evaluated over the same time range
 			NameChange:   true, // name changed
 			TagsChange:   true, // name tag changed
 			ValuesChange: true, // values changed
@@ -374,6 +387,7 @@ func (f *aggregate) Description() map[string]types.FunctionDescription {
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
+			ParallelArgs: true, // all arguments are evaluated over the same time range
 			NameChange:   true, // name changed
 			TagsChange:   true, // name tag changed
 			ValuesChange: true, // values changed
@@ -393,6 +407,7 @@ func (f *aggregate) Description() map[string]types.FunctionDescription {
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
+			ParallelArgs: true, // all arguments are evaluated over the same time range
 			NameChange:   true, // name changed
 			TagsChange:   true, // name tag changed
 			ValuesChange: true, // values changed
@@ -412,6 +427,7 @@ func (f *aggregate) Description() map[string]types.FunctionDescription {
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
+			ParallelArgs: true, // all arguments are evaluated over the same time range
 			NameChange:   true, // name changed
 			TagsChange:   true, // name tag changed
 			ValuesChange: true, // values changed
@@ -431,6 +447,7 @@ func (f *aggregate) Description() map[string]types.FunctionDescription {
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
+			ParallelArgs: true, // all arguments are evaluated over the same time range
 			NameChange:   true, // name changed
 			TagsChange:   true, // name tag changed
 			ValuesChange: true, // values changed
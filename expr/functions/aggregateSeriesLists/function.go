@@ -106,6 +106,7 @@ func (f *aggregateSeriesLists) Description() map[string]types.FunctionDescriptio
 					Required: false,
 				},
 			},
+			ParallelArgs: true, // all arguments are evaluated over the same time range
 		},
 	}
 }
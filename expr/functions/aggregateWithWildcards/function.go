@@ -130,7 +130,7 @@ func (f *aggregateWithWildcards) Description() map[string]types.FunctionDescript
 				{
 					Name:     "positions",
 					Type:     types.Node,
-					Required: true,
+					Multiple: true,
 				},
 			},
 		},
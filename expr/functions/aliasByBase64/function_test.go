@@ -46,7 +46,7 @@ func TestAlias(t *testing.T) {
 				[]float64{1, 2, 3, 4, 5}, 1, now32)},
 		},
 		{
-			"alias(metric.bmFtZQ==, 2)",
+			"aliasByBase64(metric.bmFtZQ==, 2)",
 			map[parser.MetricRequest][]*types.MetricData{
 				{
 					Metric: "metric.bmFtZQ==",
@@ -445,7 +445,7 @@ func (f *asPercent) Description() map[string]types.FunctionDescription {
 				},
 				{
 					Name: "total",
-					Type: types.SeriesList,
+					Type: types.Any,
 				},
 				{
 					Multiple: true,
@@ -454,6 +454,7 @@ func (f *asPercent) Description() map[string]types.FunctionDescription {
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
+			ParallelArgs: true, // all arguments are evaluated over the same time range
 			NameChange:   true, // name changed
 			TagsChange:   true, // name tag changed
 			ValuesChange: true, // values changed
@@ -472,7 +473,7 @@ func (f *asPercent) Description() map[string]types.FunctionDescription {
 				},
 				{
 					Name: "total",
-					Type: types.SeriesList,
+					Type: types.Any,
 				},
 				{
 					Multiple: true,
@@ -481,6 +482,7 @@ func (f *asPercent) Description() map[string]types.FunctionDescription {
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
+			ParallelArgs: true, // all arguments are evaluated over the same time range
 			NameChange:   true, // name changed
 			TagsChange:   true, // name tag changed
 			ValuesChange: true, // values changed
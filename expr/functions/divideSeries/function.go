@@ -122,12 +122,12 @@ func (f *divideSeries) Description() map[string]types.FunctionDescription {
 					Type:     types.SeriesList,
 				},
 				{
-					Name:     "divisorSeries",
-					Required: true,
-					Type:     types.SeriesList,
+					Name: "divisorSeries",
+					Type: types.SeriesList,
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
+			ParallelArgs: true, // all arguments are evaluated over the same time range
 			NameChange:   true, // name changed
 			TagsChange:   true, // name tag changed
 			ValuesChange: true, // values changed
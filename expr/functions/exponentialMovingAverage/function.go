@@ -162,7 +162,7 @@ func (f *exponentialMovingAverage) Description() map[string]types.FunctionDescri
 						0.5,
 						0.7,
 					),
-					Type: types.Float,
+					Type: types.IntOrInterval,
 				},
 			},
 		},
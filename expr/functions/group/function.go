@@ -52,6 +52,7 @@ func (f *group) Description() map[string]types.FunctionDescription {
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
+			ParallelArgs: true, // all arguments are evaluated over the same time range
 		},
 	}
 }
@@ -163,9 +163,9 @@ func (f *highest) Description() map[string]types.FunctionDescription {
 					Required: true,
 				},
 				{
-					Name:     "n",
-					Type:     types.Integer,
-					Required: true,
+					Name:    "n",
+					Type:    types.Integer,
+					Default: types.NewSuggestion(1),
 				},
 				{
 					Name: "func",
@@ -192,9 +192,9 @@ func (f *highest) Description() map[string]types.FunctionDescription {
 					Type:     types.SeriesList,
 				},
 				{
-					Name:     "n",
-					Required: true,
-					Type:     types.Integer,
+					Name:    "n",
+					Type:    types.Integer,
+					Default: types.NewSuggestion(1),
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
@@ -212,9 +212,9 @@ func (f *highest) Description() map[string]types.FunctionDescription {
 					Type:     types.SeriesList,
 				},
 				{
-					Name:     "n",
-					Required: true,
-					Type:     types.Integer,
+					Name:    "n",
+					Type:    types.Integer,
+					Default: types.NewSuggestion(1),
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
@@ -232,9 +232,9 @@ func (f *highest) Description() map[string]types.FunctionDescription {
 					Type:     types.SeriesList,
 				},
 				{
-					Name:     "n",
-					Required: true,
-					Type:     types.Integer,
+					Name:    "n",
+					Type:    types.Integer,
+					Default: types.NewSuggestion(1),
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
@@ -252,9 +252,9 @@ func (f *highest) Description() map[string]types.FunctionDescription {
 					Type:     types.SeriesList,
 				},
 				{
-					Name:     "n",
-					Required: true,
-					Type:     types.Integer,
+					Name:    "n",
+					Type:    types.Integer,
+					Default: types.NewSuggestion(1),
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
@@ -272,9 +272,9 @@ func (f *highest) Description() map[string]types.FunctionDescription {
 					Required: true,
 				},
 				{
-					Name:     "n",
-					Type:     types.Integer,
-					Required: true,
+					Name:    "n",
+					Type:    types.Integer,
+					Default: types.NewSuggestion(1),
 				},
 				{
 					Name: "func",
@@ -301,9 +301,9 @@ func (f *highest) Description() map[string]types.FunctionDescription {
 					Type:     types.SeriesList,
 				},
 				{
-					Name:     "n",
-					Required: true,
-					Type:     types.Integer,
+					Name:    "n",
+					Type:    types.Integer,
+					Default: types.NewSuggestion(1),
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
@@ -321,9 +321,9 @@ func (f *highest) Description() map[string]types.FunctionDescription {
 					Type:     types.SeriesList,
 				},
 				{
-					Name:     "n",
-					Required: true,
-					Type:     types.Integer,
+					Name:    "n",
+					Type:    types.Integer,
+					Default: types.NewSuggestion(1),
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
@@ -341,9 +341,9 @@ func (f *highest) Description() map[string]types.FunctionDescription {
 					Type:     types.SeriesList,
 				},
 				{
-					Name:     "n",
-					Required: true,
-					Type:     types.Integer,
+					Name:    "n",
+					Type:    types.Integer,
+					Default: types.NewSuggestion(1),
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
@@ -361,9 +361,9 @@ func (f *highest) Description() map[string]types.FunctionDescription {
 					Type:     types.SeriesList,
 				},
 				{
-					Name:     "n",
-					Required: true,
-					Type:     types.Integer,
+					Name:    "n",
+					Type:    types.Integer,
+					Default: types.NewSuggestion(1),
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
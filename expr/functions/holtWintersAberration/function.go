@@ -113,7 +113,7 @@ func (f *holtWintersAberration) Description() map[string]types.FunctionDescripti
 	return map[string]types.FunctionDescription{
 		"holtWintersAberration": {
 			Description: "Performs a Holt-Winters forecast using the series as input data and plots the\npositive or negative deviation of the series data from the forecast.",
-			Function:    "holtWintersAberration(seriesList, delta=3, bootstrapInterval='7d')",
+			Function:    "holtWintersAberration(seriesList, delta=3, bootstrapInterval='7d', seasonality='1d')",
 			Group:       "Calculate",
 			Module:      "graphite.render.functions",
 			Name:        "holtWintersAberration",
@@ -137,6 +137,11 @@ func (f *holtWintersAberration) Description() map[string]types.FunctionDescripti
 					),
 					Type: types.Interval,
 				},
+				{
+					Default: types.NewSuggestion("1d"),
+					Name:    "seasonality",
+					Type:    types.Interval,
+				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
 			NameChange:   true, // name changed
@@ -41,7 +41,7 @@ func (f *holtWintersConfidenceArea) Description() map[string]types.FunctionDescr
 	return map[string]types.FunctionDescription{
 		"holtWintersConfidenceArea": {
 			Description: "Performs a Holt-Winters forecast using the series as input data and plots\n the area between the upper and lower bands of the predicted forecast deviations.",
-			Function:    "holtWintersConfidenceArea(seriesList, delta=3, bootstrapInterval='7d')",
+			Function:    "holtWintersConfidenceArea(seriesList, delta=3, bootstrapInterval='7d', seasonality='1d')",
 			Group:       "Calculate",
 			Module:      "graphite.render.functions",
 			Name:        "holtWintersConfidenceArea",
@@ -65,6 +65,11 @@ func (f *holtWintersConfidenceArea) Description() map[string]types.FunctionDescr
 					),
 					Type: types.Interval,
 				},
+				{
+					Default: types.NewSuggestion("1d"),
+					Name:    "seasonality",
+					Type:    types.Interval,
+				},
 			},
 		},
 	}
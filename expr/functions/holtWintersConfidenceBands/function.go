@@ -96,7 +96,7 @@ func (f *holtWintersConfidenceBands) Description() map[string]types.FunctionDesc
 	return map[string]types.FunctionDescription{
 		"holtWintersConfidenceBands": {
 			Description: "Performs a Holt-Winters forecast using the series as input data and plots\nupper and lower bands with the predicted forecast deviations.",
-			Function:    "holtWintersConfidenceBands(seriesList, delta=3, bootstrapInterval='7d')",
+			Function:    "holtWintersConfidenceBands(seriesList, delta=3, bootstrapInterval='7d', seasonality='1d')",
 			Group:       "Calculate",
 			Module:      "graphite.render.functions",
 			Name:        "holtWintersConfidenceBands",
@@ -120,6 +120,11 @@ func (f *holtWintersConfidenceBands) Description() map[string]types.FunctionDesc
 					),
 					Type: types.Interval,
 				},
+				{
+					Default: types.NewSuggestion("1d"),
+					Name:    "seasonality",
+					Type:    types.Interval,
+				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
 			NameChange:   true, // name changed
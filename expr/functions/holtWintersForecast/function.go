@@ -82,7 +82,7 @@ func (f *holtWintersForecast) Description() map[string]types.FunctionDescription
 	return map[string]types.FunctionDescription{
 		"holtWintersForecast": {
 			Description: "Performs a Holt-Winters forecast using the series as input data. Data from\n`bootstrapInterval` (one week by default) previous to the series is used to bootstrap the initial forecast.",
-			Function:    "holtWintersForecast(seriesList, bootstrapInterval='7d')",
+			Function:    "holtWintersForecast(seriesList, bootstrapInterval='7d', seasonality='1d')",
 			Group:       "Calculate",
 			Module:      "graphite.render.functions",
 			Name:        "holtWintersForecast",
@@ -101,6 +101,11 @@ func (f *holtWintersForecast) Description() map[string]types.FunctionDescription
 					),
 					Type: types.Interval,
 				},
+				{
+					Default: types.NewSuggestion("1d"),
+					Name:    "seasonality",
+					Type:    types.Interval,
+				},
 			},
 			NameChange:   true, // name changed
 			TagsChange:   true, // name tag changed
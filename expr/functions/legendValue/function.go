@@ -111,7 +111,7 @@ func (f *legendValue) Description() map[string]types.FunctionDescription {
 				{
 					Multiple: true,
 					Name:     "valuesTypes",
-					Options:  types.StringsToSuggestionList(consolidations.AvailableSummarizers),
+					Options:  types.StringsToSuggestionList(append(consolidations.AvailableSummarizers, "si", "binary")),
 					Type:     types.String,
 				},
 			},
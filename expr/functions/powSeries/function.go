@@ -97,6 +97,7 @@ func (f *powSeries) Description() map[string]types.FunctionDescription {
 					Type:     types.SeriesList,
 				},
 			},
+			ParallelArgs: true, // all arguments are evaluated over the same time range
 		},
 	}
 }
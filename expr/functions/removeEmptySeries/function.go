@@ -89,9 +89,8 @@ func (f *removeEmptySeries) Description() map[string]types.FunctionDescription {
 					Type:     types.SeriesList,
 				},
 				{
-					Name:     "xFilesFactor",
-					Required: true,
-					Type:     types.Float,
+					Name: "xFilesFactor",
+					Type: types.Float,
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
@@ -111,9 +110,8 @@ func (f *removeEmptySeries) Description() map[string]types.FunctionDescription {
 					Type:     types.SeriesList,
 				},
 				{
-					Name:     "xFilesFactor",
-					Required: true,
-					Type:     types.Float,
+					Name: "xFilesFactor",
+					Type: types.Float,
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
@@ -223,6 +223,7 @@ func (f *seriesList) Description() map[string]types.FunctionDescription {
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
+			ParallelArgs: true, // all arguments are evaluated over the same time range
 			NameChange:   true, // name changed
 			TagsChange:   true, // name tag changed
 			ValuesChange: true, // values changed
@@ -251,6 +252,7 @@ func (f *seriesList) Description() map[string]types.FunctionDescription {
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
+			ParallelArgs: true, // all arguments are evaluated over the same time range
 			NameChange:   true, // name changed
 			TagsChange:   true, // name tag changed
 			ValuesChange: true, // values changed
@@ -279,6 +281,7 @@ func (f *seriesList) Description() map[string]types.FunctionDescription {
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
+			ParallelArgs: true, // all arguments are evaluated over the same time range
 			NameChange:   true, // name changed
 			TagsChange:   true, // name tag changed
 			ValuesChange: true, // values changed
@@ -307,6 +310,7 @@ func (f *seriesList) Description() map[string]types.FunctionDescription {
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
+			ParallelArgs: true, // all arguments are evaluated over the same time range
 			NameChange:   true, // name changed
 			TagsChange:   true, // name tag changed
 			ValuesChange: true, // values changed
@@ -335,6 +339,7 @@ func (f *seriesList) Description() map[string]types.FunctionDescription {
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
+			ParallelArgs: true, // all arguments are evaluated over the same time range
 			NameChange:   true, // name changed
 			TagsChange:   true, // name tag changed
 			ValuesChange: true, // values changed
@@ -0,0 +1,202 @@
+package expr
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/ansel1/merry"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// ErrLimitExceeded is returned when evaluation of a request exceeds one of its Limits
+var ErrLimitExceeded = merry.New("limit exceeded").WithHTTPCode(http.StatusUnprocessableEntity)
+
+// Limits restricts resources used by evaluation of one request. Zero value of a limit means no limit.
+type Limits struct {
+	// MaxFetchedSeries is maximum count of series fetched from backends
+	MaxFetchedSeries int64 `mapstructure:"maxFetchedSeries"`
+	// MaxDatapoints is maximum total count of datapoints fetched from backends
+	MaxDatapoints int64 `mapstructure:"maxDatapoints"`
+	// MaxSeriesPerFunction is maximum count of series returned by a single function call
+	MaxSeriesPerFunction int64 `mapstructure:"maxSeriesPerFunction"`
+	// MaxBytes is maximum estimated size of fetched series and results of function calls
+	MaxBytes int64 `mapstructure:"maxBytes"`
+}
+
+// IsZero returns true if no limits are set
+func (l Limits) IsZero() bool {
+	return l == Limits{}
+}
+
+// Merge returns limits with values of o, that are set, replacing values of l
+func (l Limits) Merge(o Limits) Limits {
+	if o.MaxFetchedSeries != 0 {
+		l.MaxFetchedSeries = o.MaxFetchedSeries
+	}
+	if o.MaxDatapoints != 0 {
+		l.MaxDatapoints = o.MaxDatapoints
+	}
+	if o.MaxSeriesPerFunction != 0 {
+		l.MaxSeriesPerFunction = o.MaxSeriesPerFunction
+	}
+	if o.MaxBytes != 0 {
+		l.MaxBytes = o.MaxBytes
+	}
+	return l
+}
+
+// limitsState accounts resources used by one request
+type limitsState struct {
+	limits Limits
+
+	mu            sync.Mutex
+	fetchedSeries int64
+	datapoints    int64
+	bytes         int64
+	// err is set by the first exceeded limit, all further checks return it
+	err error
+}
+
+type limitsStateKey struct{}
+
+// WithLimits returns context for evaluation of one request, that is aborted with ErrLimitExceeded when fetched data
+// or results of function calls exceed limits.
+func WithLimits(ctx context.Context, limits Limits) context.Context {
+	if limits.IsZero() {
+		return ctx
+	}
+	return context.WithValue(ctx, limitsStateKey{}, &limitsState{limits: limits})
+}
+
+func getLimitsState(ctx context.Context) *limitsState {
+	state, _ := ctx.Value(limitsStateKey{}).(*limitsState)
+	return state
+}
+
+// LimitError returns error about the first limit exceeded while evaluation with the context, if any
+func LimitError(ctx context.Context) error {
+	state := getLimitsState(ctx)
+	if state == nil {
+		return nil
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return state.err
+}
+
+// estimateSize returns approximate count of bytes used by series
+func estimateSize(data []*types.MetricData) int64 {
+	var size int64
+	for _, r := range data {
+		size += int64(len(r.Values))*8 + int64(len(r.Name))
+		for k, v := range r.Tags {
+			size += int64(len(k) + len(v))
+		}
+	}
+	return size
+}
+
+func (s *limitsState) check() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// addFetched accounts series fetched from backends
+func (s *limitsState) addFetched(fetched map[parser.MetricRequest][]*types.MetricData) error {
+	if s == nil {
+		return nil
+	}
+	var series, datapoints, bytes int64
+	for _, data := range fetched {
+		series += int64(len(data))
+		for _, r := range data {
+			datapoints += int64(len(r.Values))
+		}
+		bytes += estimateSize(data)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.fetchedSeries += series
+	s.datapoints += datapoints
+	s.bytes += bytes
+	s.err = s.checkFetched(s.fetchedSeries, s.datapoints)
+	if s.err == nil && s.limits.MaxBytes > 0 && s.bytes > s.limits.MaxBytes {
+		s.err = merry.WithMessagef(ErrLimitExceeded, "limit exceeded: maxBytes is %d, estimated size of fetched data is %d bytes",
+			s.limits.MaxBytes, s.bytes)
+	}
+	return s.err
+}
+
+// checkFetched returns error if the count of fetched series or datapoints exceeds limits
+func (s *limitsState) checkFetched(series, datapoints int64) error {
+	switch {
+	case s.limits.MaxFetchedSeries > 0 && series > s.limits.MaxFetchedSeries:
+		return merry.WithMessagef(ErrLimitExceeded, "limit exceeded: maxFetchedSeries is %d, fetched %d series",
+			s.limits.MaxFetchedSeries, series)
+	case s.limits.MaxDatapoints > 0 && datapoints > s.limits.MaxDatapoints:
+		return merry.WithMessagef(ErrLimitExceeded, "limit exceeded: maxDatapoints is %d, fetched %d datapoints",
+			s.limits.MaxDatapoints, datapoints)
+	}
+	return nil
+}
+
+// fetchBudget checks series of a response, that is being gathered from backends, together with already fetched ones,
+// so fetching is cancelled as soon as limits are exceeded and not after all responses are received
+func (s *limitsState) fetchBudget(response *pb.MultiFetchResponse) merry.Error {
+	var datapoints int64
+	for i := range response.Metrics {
+		datapoints += int64(len(response.Metrics[i].Values))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = s.checkFetched(s.fetchedSeries+int64(len(response.Metrics)), s.datapoints+datapoints)
+	}
+	return merry.Wrap(s.err)
+}
+
+// withFetchBudget returns context, fetching with which is cancelled by zipper when limits are exceeded
+func (s *limitsState) withFetchBudget(ctx context.Context) context.Context {
+	if s == nil || (s.limits.MaxFetchedSeries == 0 && s.limits.MaxDatapoints == 0) {
+		return ctx
+	}
+	return zipperTypes.WithFetchBudget(ctx, s.fetchBudget)
+}
+
+// addResult accounts series returned by a function call
+func (s *limitsState) addResult(e parser.Expr, data []*types.MetricData) error {
+	if s == nil {
+		return nil
+	}
+	size := estimateSize(data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.bytes += size
+	switch {
+	case s.limits.MaxSeriesPerFunction > 0 && int64(len(data)) > s.limits.MaxSeriesPerFunction:
+		s.err = merry.WithMessagef(ErrLimitExceeded, "limit exceeded: maxSeriesPerFunction is %d, %s returned %d series",
+			s.limits.MaxSeriesPerFunction, e.Target(), len(data))
+	case s.limits.MaxBytes > 0 && s.bytes > s.limits.MaxBytes:
+		s.err = merry.WithMessagef(ErrLimitExceeded, "limit exceeded: maxBytes is %d, estimated size of series is %d bytes after %s",
+			s.limits.MaxBytes, s.bytes, e.Target())
+	}
+	return s.err
+}
@@ -0,0 +1,195 @@
+package expr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ansel1/merry"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+)
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  Limits
+		targets []string
+		// errors for each target, empty if evaluated
+		wantErrs []string
+	}{
+		{
+			name:     "not exceeded",
+			limits:   Limits{MaxFetchedSeries: 3, MaxDatapoints: 9, MaxSeriesPerFunction: 1, MaxBytes: 1000},
+			targets:  []string{"sumSeries(metric1,metric2,metric3)"},
+			wantErrs: []string{""},
+		},
+		{
+			name:     "maxFetchedSeries",
+			limits:   Limits{MaxFetchedSeries: 2},
+			targets:  []string{"sumSeries(metric1,metric2,metric3)"},
+			wantErrs: []string{"limit exceeded: maxFetchedSeries is 2, fetched 3 series"},
+		},
+		{
+			name:     "maxDatapoints",
+			limits:   Limits{MaxDatapoints: 5},
+			targets:  []string{"metric1", "metric2", "metric3"},
+			wantErrs: []string{"", "limit exceeded: maxDatapoints is 5, fetched 6 datapoints", "limit exceeded: maxDatapoints is 5, fetched 6 datapoints"},
+		},
+		{
+			name:     "maxSeriesPerFunction",
+			limits:   Limits{MaxSeriesPerFunction: 2},
+			targets:  []string{"sumSeries(group(metric1,metric2,metric3))"},
+			wantErrs: []string{"limit exceeded: maxSeriesPerFunction is 2, group returned 3 series"},
+		},
+		{
+			// metric1 is 3 points (24 bytes), name (7 bytes) and name tag (11 bytes),
+			// scale adds the same points with longer name (16 bytes) and scale tag (6 bytes)
+			name:     "maxBytes",
+			limits:   Limits{MaxBytes: 50},
+			targets:  []string{"metric1", "scale(metric1,2)"},
+			wantErrs: []string{"", "limit exceeded: maxBytes is 50, estimated size of series is 99 bytes after scale"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eval, err := NewEvaluator(nil, newSlowZipper([2]int64{0, 3}), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := WithLimits(context.Background(), tt.limits)
+			values := make(map[parser.MetricRequest][]*types.MetricData)
+			var lastErr string
+			for i, target := range tt.targets {
+				exp, _, err := parser.ParseExpr(target)
+				if err != nil {
+					t.Fatalf("failed to parse %s: %v", target, err)
+				}
+				_, err = FetchAndEvalExp(ctx, eval, exp, 0, 3, values)
+				if tt.wantErrs[i] == "" {
+					if err != nil {
+						t.Errorf("%s: unexpected error %v", target, err)
+					}
+					continue
+				}
+				if err == nil {
+					t.Errorf("%s: expected error %q", target, tt.wantErrs[i])
+					continue
+				}
+				// error of a function argument is wrapped by the function
+				if !strings.Contains(err.Error(), tt.wantErrs[i]) {
+					t.Errorf("%s: got error %q, expected %q", target, err.Error(), tt.wantErrs[i])
+				}
+				if code := merry.HTTPCode(err); code != http.StatusUnprocessableEntity {
+					t.Errorf("%s: got HTTP code %d, expected %d", target, code, http.StatusUnprocessableEntity)
+				}
+				lastErr = tt.wantErrs[i]
+			}
+
+			err = LimitError(ctx)
+			if lastErr == "" && err != nil {
+				t.Errorf("unexpected limit error %v", err)
+			} else if lastErr != "" && (err == nil || err.Error() != lastErr) {
+				t.Errorf("got limit error %v, expected %q", err, lastErr)
+			}
+		})
+	}
+}
+
+func TestLimitsMerge(t *testing.T) {
+	limits := Limits{MaxFetchedSeries: 10, MaxBytes: 100}.Merge(Limits{MaxFetchedSeries: 20, MaxDatapoints: 30})
+	expected := Limits{MaxFetchedSeries: 20, MaxDatapoints: 30, MaxBytes: 100}
+	if limits != expected {
+		t.Errorf("got %+v, expected %+v", limits, expected)
+	}
+
+	if ctx := context.Background(); WithLimits(ctx, Limits{}) != ctx {
+		t.Error("context is changed without limits")
+	}
+}
+
+func TestFetchComplexityLimits(t *testing.T) {
+	eval, err := NewEvaluator(nil, newSlowZipper([2]int64{0, 3}), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp, _, err := parser.ParseExpr("sumSeries(metric1,scale(metric2,2))")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// limits are changed after the expression is parsed
+	parser.SetLimits(parser.Limits{MaxFunctionCalls: 1})
+	defer parser.SetLimits(parser.Limits{})
+
+	_, err = FetchAndEvalExp(context.Background(), eval, exp, 0, 3, make(map[parser.MetricRequest][]*types.MetricData))
+	if !errors.Is(err, parser.ErrTooComplex) {
+		t.Fatalf("got error %v, expected %v", err, parser.ErrTooComplex)
+	}
+	if code := merry.HTTPCode(err); code != http.StatusBadRequest {
+		t.Errorf("got HTTP code %d, expected %d", code, http.StatusBadRequest)
+	}
+}
+
+// budgetZipper fetches metrics one by one and checks fetch budget after each of them, as zipper does for responses
+// of backends
+type budgetZipper struct {
+	*slowZipper
+
+	rendered int
+}
+
+func (zp *budgetZipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, merry.Error) {
+	budget := zipperTypes.GetFetchBudget(ctx)
+	var (
+		result   []*types.MetricData
+		response pb.MultiFetchResponse
+	)
+	for _, m := range request.Metrics {
+		data, _, err := zp.TestZipper.Render(ctx, pb.MultiFetchRequest{Metrics: []pb.FetchRequest{m}})
+		if err != nil {
+			return nil, nil, err
+		}
+		zp.rendered++
+		for _, d := range data {
+			result = append(result, d)
+			response.Metrics = append(response.Metrics, d.FetchResponse)
+		}
+		if budget != nil {
+			if err := budget(&response); err != nil {
+				return result, nil, zipperTypes.ErrNonFatalErrors.WithCause(err)
+			}
+		}
+	}
+	return result, nil, nil
+}
+
+func TestLimitsWhileFetching(t *testing.T) {
+	zp := &budgetZipper{slowZipper: newSlowZipper([2]int64{0, 3})}
+	eval, err := NewEvaluator(nil, zp, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp, _, err := parser.ParseExpr("sumSeries(metric1,metric2,metric3,metric4,metric5,metric6,metric7,metric8)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := WithLimits(context.Background(), Limits{MaxFetchedSeries: 2})
+	_, err = FetchAndEvalExp(ctx, eval, exp, 0, 3, make(map[parser.MetricRequest][]*types.MetricData))
+	if !merry.Is(err, ErrLimitExceeded) {
+		t.Fatalf("got error %v, expected %v", err, ErrLimitExceeded)
+	}
+	if expected := "limit exceeded: maxFetchedSeries is 2, fetched 3 series"; err.Error() != expected {
+		t.Errorf("got error %q, expected %q", err.Error(), expected)
+	}
+	if zp.rendered != 3 {
+		t.Errorf("fetched %d metrics, expected fetching to stop after 3", zp.rendered)
+	}
+}
@@ -0,0 +1,114 @@
+package expr
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+// errEvalPanic is returned to callers waiting for a memoized call, that panicked
+var errEvalPanic = errors.New("evaluation of the same subexpression panicked")
+
+// evalMemo keeps results of function calls evaluated for one request, so identical subexpressions of different
+// targets (or of the same target) are evaluated once
+type evalMemo struct {
+	mu      sync.Mutex
+	entries map[memoKey]*memoEntry
+	hits    int
+}
+
+type memoKey struct {
+	target      string
+	from, until int64
+}
+
+type memoEntry struct {
+	// done is closed when data and err are set, data is never passed to callers
+	done chan struct{}
+	data []*types.MetricData
+	err  error
+}
+
+type evalMemoKey struct{}
+
+// WithMemo returns context for evaluation of one request, that memoizes results of function calls by their text and
+// time range. Memo keeps its own copy of results and each caller gets its own copies of series with values, so
+// results could be changed in place by callers.
+func WithMemo(ctx context.Context) context.Context {
+	return context.WithValue(ctx, evalMemoKey{}, &evalMemo{entries: make(map[memoKey]*memoEntry)})
+}
+
+func getEvalMemo(ctx context.Context) *evalMemo {
+	memo, _ := ctx.Value(evalMemoKey{}).(*evalMemo)
+	return memo
+}
+
+// MemoHits returns count of function calls, that were taken from memo instead of evaluation
+func MemoHits(ctx context.Context) int {
+	memo := getEvalMemo(ctx)
+	if memo == nil {
+		return 0
+	}
+	memo.mu.Lock()
+	defer memo.mu.Unlock()
+	return memo.hits
+}
+
+// do returns memoized result for the key or calls fn to get it. Concurrent callers with the same key wait
+// for the first one.
+func (m *evalMemo) do(key memoKey, fn func() ([]*types.MetricData, error)) ([]*types.MetricData, error) {
+	m.mu.Lock()
+	entry, ok := m.entries[key]
+	if ok {
+		m.hits++
+		m.mu.Unlock()
+		<-entry.done
+		return copySeries(entry.data), entry.err
+	}
+	entry = &memoEntry{done: make(chan struct{})}
+	m.entries[key] = entry
+	m.mu.Unlock()
+
+	finished := false
+	defer func() {
+		if !finished {
+			// fn panicked, don't leave other callers waiting
+			entry.err = errEvalPanic
+			close(entry.done)
+		}
+	}()
+	data, err := fn()
+	entry.data, entry.err = copySeries(data), err
+	finished = true
+	close(entry.done)
+
+	return data, err
+}
+
+// copySeries returns copies of series with values, so callers can change them independently
+func copySeries(data []*types.MetricData) []*types.MetricData {
+	if data == nil {
+		return nil
+	}
+	res := make([]*types.MetricData, len(data))
+	for i, r := range data {
+		res[i] = r.Copy(true)
+	}
+	return res
+}
+
+// evalMemoized evaluates function call with memo from context, if any
+func (eval Evaluator) evalMemoized(ctx context.Context, exp parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	memo := getEvalMemo(ctx)
+	if memo == nil || !exp.IsFunc() {
+		return eval.eval(ctx, exp, from, until, values)
+	}
+	// names of series are built from arguments as they are written, so calls are identical only if their text is
+	key := memoKey{target: exp.ToString(), from: from, until: until}
+	return memo.do(key, func() ([]*types.MetricData, error) {
+		return eval.eval(ctx, exp, from, until, values)
+	})
+}
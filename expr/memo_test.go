@@ -0,0 +1,166 @@
+package expr
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	"github.com/go-graphite/carbonapi/tests/compare"
+)
+
+func evalTargets(t *testing.T, ctx context.Context, targets []string) [][]*types.MetricData {
+	eval, err := NewEvaluator(nil, newSlowZipper([2]int64{0, 3}), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exprs := make([]parser.Expr, 0, len(targets))
+	for _, target := range targets {
+		exp, _, err := parser.ParseExpr(target)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", target, err)
+		}
+		exprs = append(exprs, exp)
+	}
+	results, errs := FetchAndEvalExpsParallel(ctx, eval, exprs, 0, 3, make(map[parser.MetricRequest][]*types.MetricData))
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", targets[i], err)
+		}
+	}
+	return results
+}
+
+func TestEvalMemo(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []string
+		hits    int
+	}{
+		{
+			name:    "same target",
+			targets: []string{"sumSeries(metric1,metric2)", "sumSeries(metric1,metric2)"},
+			hits:    1,
+		},
+		{
+			name:    "subexpression",
+			targets: []string{"sumSeries(metric1,metric2)", "asPercent(sumSeries(metric1,metric2),metric3)"},
+			hits:    1,
+		},
+		{
+			name:    "several subexpressions",
+			targets: []string{"asPercent(scale(metric1,2),sumSeries(metric2,metric3))", "divideSeries(scale(metric1,2),sumSeries(metric2,metric3))"},
+			hits:    2,
+		},
+		{
+			// names of results would differ
+			name:    "other formatting",
+			targets: []string{"sumSeries(metric1,metric2)", "asPercent(sumSeries(metric1, metric2),metric3)"},
+			hits:    0,
+		},
+		{
+			name:    "other time range",
+			targets: []string{"scale(metric1,2)", "timeShift(scale(metric1,2),'1s')"},
+			hits:    0,
+		},
+		{
+			name:    "no common subexpressions",
+			targets: []string{"sumSeries(metric1,metric2)", "sumSeries(metric2,metric1)"},
+			hits:    0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expected := evalTargets(t, context.Background(), tt.targets)
+
+			for _, parallelism := range []int{1, 4} {
+				ctx := WithMemo(WithParallelism(context.Background(), parallelism))
+				results := evalTargets(t, ctx, tt.targets)
+				if hits := MemoHits(ctx); hits != tt.hits {
+					t.Errorf("parallelism %d: got %d memo hits, expected %d", parallelism, hits, tt.hits)
+				}
+				for i, target := range tt.targets {
+					if len(results[i]) != len(expected[i]) {
+						t.Fatalf("%s: got %d series, expected %d", target, len(results[i]), len(expected[i]))
+					}
+					for j := range results[i] {
+						if !compare.MetricDataIsEqual(results[i][j], expected[i][j], true) {
+							t.Errorf("%s: got\n%v\nexpected\n%v", target, results[i][j], expected[i][j])
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEvalMemoCopies(t *testing.T) {
+	ctx := WithMemo(context.Background())
+	results := evalTargets(t, ctx, []string{"sumSeries(metric1,metric2)", "sumSeries(metric1,metric2)"})
+	if MemoHits(ctx) != 1 {
+		t.Fatalf("got %d memo hits, expected 1", MemoHits(ctx))
+	}
+
+	first, second := results[0][0], results[1][0]
+	if first == second {
+		t.Fatal("series are shared between targets")
+	}
+	name, nameTag, valuesPerPoint, value := second.Name, second.Tags["name"], second.ValuesPerPoint, second.Values[0]
+	first.Name = "renamed"
+	first.Tags["name"] = "renamed"
+	first.SetValuesPerPoint(valuesPerPoint + 1)
+	first.Values[0] = value + 1
+	if second.Name != name || second.Tags["name"] != nameTag || second.ValuesPerPoint != valuesPerPoint || second.Values[0] != value {
+		t.Errorf("series of other target was modified: %v", second)
+	}
+}
+
+func TestEvalMemoValuesChangedInPlace(t *testing.T) {
+	memo := getEvalMemo(WithMemo(context.Background()))
+	key := memoKey{target: "sumSeries(a)", from: 0, until: 1}
+	evaluate := func() ([]*types.MetricData, error) {
+		return []*types.MetricData{types.MakeMetricData("sumSeries(a)", []float64{1, 2, 3}, 1, 0)}, nil
+	}
+
+	// both targets share sumSeries(a), the first one changes its values in place before the second one is evaluated
+	first, _ := memo.do(key, evaluate)
+	first[0].Values[0] = 100
+	second, _ := memo.do(key, evaluate)
+	if second[0].Values[0] != 1 {
+		t.Errorf("got %v for the second target, expected values of evaluated call", second[0].Values)
+	}
+
+	second[0].Values[1] = 200
+	if first[0].Values[1] != 2 {
+		t.Errorf("got %v for the first target, expected values not changed by the second one", first[0].Values)
+	}
+	third, _ := memo.do(key, evaluate)
+	if third[0].Values[0] != 1 || third[0].Values[1] != 2 {
+		t.Errorf("got %v for the third target, expected values of evaluated call", third[0].Values)
+	}
+}
+
+func TestEvalMemoPanic(t *testing.T) {
+	memo := getEvalMemo(WithMemo(context.Background()))
+	key := memoKey{target: "sumSeries(a)", from: 0, until: 1}
+
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("got panic %v, expected boom", r)
+			}
+		}()
+		_, _ = memo.do(key, func() ([]*types.MetricData, error) {
+			panic("boom")
+		})
+	}()
+
+	_, err := memo.do(key, func() ([]*types.MetricData, error) {
+		t.Error("panicked call was evaluated again")
+		return nil, nil
+	})
+	if err != errEvalPanic {
+		t.Errorf("got error %v, expected %v", err, errEvalPanic)
+	}
+}
@@ -99,6 +99,33 @@ func RegisterFunction(name string, function interfaces.Function) {
 	RegisterFunctionWithFilename(name, "", function)
 }
 
+// SetUserFunctionDescriptions replaces descriptions of user-defined functions, that were set by the previous call
+func SetUserFunctionDescriptions(descriptions map[string]types.FunctionDescription) {
+	FunctionMD.Lock()
+	defer FunctionMD.Unlock()
+
+	for name := range FunctionMD.UserFunctions {
+		group := FunctionMD.Descriptions[name].Group
+		delete(FunctionMD.Descriptions, name)
+		if grouped, ok := FunctionMD.DescriptionsGrouped[group]; ok {
+			delete(grouped, name)
+			if len(grouped) == 0 {
+				delete(FunctionMD.DescriptionsGrouped, group)
+			}
+		}
+	}
+
+	FunctionMD.UserFunctions = make(map[string]struct{}, len(descriptions))
+	for k, v := range descriptions {
+		FunctionMD.UserFunctions[k] = struct{}{}
+		FunctionMD.Descriptions[k] = v
+		if _, ok := FunctionMD.DescriptionsGrouped[v.Group]; !ok {
+			FunctionMD.DescriptionsGrouped[v.Group] = make(map[string]types.FunctionDescription)
+		}
+		FunctionMD.DescriptionsGrouped[v.Group][k] = v
+	}
+}
+
 // Metadata is a type to store global function metadata
 type Metadata struct {
 	sync.RWMutex
@@ -110,6 +137,8 @@ type Metadata struct {
 	FunctionConfigFiles       map[string]string
 	FunctionsFilenames        map[string][]string
 	RewriteFunctionsFilenames map[string][]string
+	// UserFunctions are names of user-defined functions, that are expanded by parser and have only descriptions
+	UserFunctions map[string]struct{}
 
 	evaluator interfaces.Evaluator
 }
@@ -123,4 +152,5 @@ var FunctionMD = Metadata{
 	FunctionConfigFiles:       make(map[string]string),
 	FunctionsFilenames:        make(map[string][]string),
 	RewriteFunctionsFilenames: make(map[string][]string),
+	UserFunctions:             make(map[string]struct{}),
 }
@@ -0,0 +1,187 @@
+package expr
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ansel1/merry"
+
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+// evalState is shared by all goroutines evaluating expressions of one request
+type evalState struct {
+	// values guards the values map of the request
+	values sync.RWMutex
+	// sem limits count of additional goroutines
+	sem chan struct{}
+}
+
+type evalStateKey struct{}
+
+// WithParallelism returns context for evaluation of one request, that allows to evaluate independent targets
+// (see FetchAndEvalExpsParallel) and function arguments concurrently by up to n goroutines. Values map is guarded by
+// a lock while evaluation with such context. Parallelism is disabled if n <= 1.
+func WithParallelism(ctx context.Context, n int) context.Context {
+	if n <= 1 {
+		return ctx
+	}
+	return context.WithValue(ctx, evalStateKey{}, &evalState{sem: make(chan struct{}, n-1)})
+}
+
+func getEvalState(ctx context.Context) *evalState {
+	state, _ := ctx.Value(evalStateKey{}).(*evalState)
+	return state
+}
+
+func noop() {}
+
+// rlockValues locks values map for reading if evaluation is parallel and returns unlock function
+func rlockValues(ctx context.Context) func() {
+	state := getEvalState(ctx)
+	if state == nil {
+		return noop
+	}
+	state.values.RLock()
+	return state.values.RUnlock
+}
+
+// lockValues locks values map for writing if evaluation is parallel and returns unlock function
+func lockValues(ctx context.Context) func() {
+	state := getEvalState(ctx)
+	if state == nil {
+		return noop
+	}
+	state.values.Lock()
+	return state.values.Unlock
+}
+
+// run calls fn for 0..n-1 in additional goroutines while they are available and in the current one otherwise,
+// so nested calls can't deadlock. Panic in any of goroutines is repeated in the current one.
+func (s *evalState) run(n int, fn func(i int)) {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		panicked interface{}
+	)
+	for i := 0; i < n; i++ {
+		if s != nil && i < n-1 {
+			select {
+			case s.sem <- struct{}{}:
+				wg.Add(1)
+				go func(i int) {
+					defer func() {
+						if r := recover(); r != nil {
+							mu.Lock()
+							if panicked == nil {
+								panicked = r
+							}
+							mu.Unlock()
+						}
+						<-s.sem
+						wg.Done()
+					}()
+					fn(i)
+				}(i)
+				continue
+			default:
+			}
+		}
+		fn(i)
+	}
+	wg.Wait()
+	if panicked != nil {
+		panic(panicked)
+	}
+}
+
+type preparedKey struct{}
+
+type preparedArg struct {
+	exp         parser.Expr
+	from, until int64
+}
+
+type preparedResult struct {
+	data []*types.MetricData
+	err  error
+}
+
+// parallelArgs returns true if function evaluates all its arguments over the requested time range (see
+// types.FunctionDescription.ParallelArgs), so they could be evaluated before the function itself
+func parallelArgs(name string) bool {
+	metadata.FunctionMD.RLock()
+	desc := metadata.FunctionMD.Descriptions[name]
+	metadata.FunctionMD.RUnlock()
+	return desc.ParallelArgs
+}
+
+// evalArgsParallel evaluates function arguments of e concurrently, if function allows it and there are at least two
+// of them. Results are stored in returned context and are taken from it by Eval, when the function asks for them with
+// the same time range.
+func (eval Evaluator) evalArgsParallel(ctx context.Context, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) context.Context {
+	state := getEvalState(ctx)
+	if state == nil || !parallelArgs(e.Target()) {
+		return ctx
+	}
+
+	var args []parser.Expr
+	for _, arg := range e.Args() {
+		if arg.IsFunc() {
+			args = append(args, arg)
+		}
+	}
+	if len(args) < 2 {
+		return ctx
+	}
+
+	results := make([]preparedResult, len(args))
+	state.run(len(args), func(i int) {
+		results[i].data, results[i].err = eval.Eval(ctx, args[i], from, until, values)
+	})
+
+	prepared := make(map[preparedArg]preparedResult, len(args))
+	for i, arg := range args {
+		prepared[preparedArg{exp: arg, from: from, until: until}] = results[i]
+	}
+	return context.WithValue(ctx, preparedKey{}, prepared)
+}
+
+func getPrepared(ctx context.Context, exp parser.Expr, from, until int64) (preparedResult, bool) {
+	prepared, ok := ctx.Value(preparedKey{}).(map[preparedArg]preparedResult)
+	if !ok {
+		return preparedResult{}, false
+	}
+	res, ok := prepared[preparedArg{exp: exp, from: from, until: until}]
+	return res, ok
+}
+
+// FetchAndEvalExpsParallel fetches data and evaluates expressions independently of each other, concurrently if it's
+// allowed by context (see WithParallelism). Results and errors are returned in the order of expressions.
+func FetchAndEvalExpsParallel(ctx context.Context, eval interfaces.Evaluator, exprs []parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([][]*types.MetricData, []merry.Error) {
+	results := make([][]*types.MetricData, len(exprs))
+	errs := make([]merry.Error, len(exprs))
+
+	getEvalState(ctx).run(len(exprs), func(i int) {
+		targetValues, err := eval.Fetch(ctx, []parser.Expr{exprs[i]}, from, until, values)
+		if err != nil {
+			errs[i] = merry.Wrap(err)
+			return
+		}
+		res, err := eval.Eval(ctx, exprs[i], from, until, targetValues)
+		if err != nil {
+			errs[i] = merry.Wrap(err)
+			return
+		}
+		results[i] = res
+	})
+
+	for mReq := range values {
+		SortMetrics(values[mReq], mReq)
+	}
+
+	return results, errs
+}
@@ -0,0 +1,236 @@
+package expr
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ansel1/merry"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+	"github.com/go-graphite/carbonapi/tests/compare"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// slowZipper delays responses and counts concurrent requests
+type slowZipper struct {
+	th.TestZipper
+
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+	fetched     map[string]int
+}
+
+func (zp *slowZipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, merry.Error) {
+	zp.mu.Lock()
+	zp.inFlight++
+	if zp.inFlight > zp.maxInFlight {
+		zp.maxInFlight = zp.inFlight
+	}
+	for _, m := range request.Metrics {
+		zp.fetched[m.PathExpression]++
+	}
+	zp.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	zp.mu.Lock()
+	zp.inFlight--
+	zp.mu.Unlock()
+	return zp.TestZipper.Render(ctx, request)
+}
+
+func (zp *slowZipper) reset() {
+	zp.mu.Lock()
+	zp.maxInFlight = 0
+	zp.fetched = make(map[string]int)
+	zp.mu.Unlock()
+}
+
+func newSlowZipper(ranges ...[2]int64) *slowZipper {
+	m := make(map[parser.MetricRequest][]*types.MetricData)
+	for i := 1; i <= 8; i++ {
+		name := fmt.Sprintf("metric%d", i)
+		for _, r := range ranges {
+			values := make([]float64, r[1]-r[0])
+			for j := range values {
+				values[j] = float64(i * (j + 1))
+			}
+			md := types.MakeMetricData(name, values, 1, r[0])
+			md.PathExpression = name
+			m[parser.MetricRequest{Metric: name, From: r[0], Until: r[1]}] = []*types.MetricData{md}
+		}
+	}
+	return &slowZipper{TestZipper: th.NewTestZipper(m), fetched: make(map[string]int)}
+}
+
+func TestFetchAndEvalExpsParallel(t *testing.T) {
+	targets := []string{
+		"sumSeries(scale(metric1,2),scale(metric2,3))",
+		"divideSeries(sumSeries(metric3,metric4),sumSeries(metric5))",
+		"metric1",
+		"asPercent(metric6,metric7)",
+		"alias(metric8,'x')",
+		"diffSeries(metric1,metric9)",
+	}
+	exprs := make([]parser.Expr, 0, len(targets))
+	for _, target := range targets {
+		exp, _, err := parser.ParseExpr(target)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", target, err)
+		}
+		exprs = append(exprs, exp)
+	}
+
+	evaluate := func(ctx context.Context) ([][]*types.MetricData, []merry.Error, *slowZipper) {
+		zp := newSlowZipper([2]int64{0, 3})
+		eval, err := NewEvaluator(nil, zp, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, errs := FetchAndEvalExpsParallel(ctx, eval, exprs, 0, 3, make(map[parser.MetricRequest][]*types.MetricData))
+		return results, errs, zp
+	}
+
+	expected, expectedErrs, zp := evaluate(context.Background())
+	for i, target := range targets[:5] {
+		if expectedErrs[i] != nil || len(expected[i]) == 0 {
+			t.Fatalf("%s: got no series, error %v", target, expectedErrs[i])
+		}
+	}
+	if zp.maxInFlight != 1 {
+		t.Errorf("got %d concurrent requests without parallelism", zp.maxInFlight)
+	}
+
+	for i := 0; i < 10; i++ {
+		results, errs, zp := evaluate(WithParallelism(context.Background(), 4))
+		for j, target := range targets {
+			if !merry.Is(errs[j], expectedErrs[j]) {
+				t.Errorf("%s: got error %v, expected %v", target, errs[j], expectedErrs[j])
+			}
+			if len(results[j]) != len(expected[j]) {
+				t.Errorf("%s: got %d series, expected %d", target, len(results[j]), len(expected[j]))
+				continue
+			}
+			for k := range results[j] {
+				if !compare.MetricDataIsEqual(results[j][k], expected[j][k], true) {
+					t.Errorf("%s: got\n%v\nexpected\n%v", target, results[j][k], expected[j][k])
+				}
+			}
+		}
+		if zp.maxInFlight < 2 || zp.maxInFlight > 4 {
+			t.Errorf("got %d concurrent requests, expected from 2 to 4", zp.maxInFlight)
+		}
+	}
+}
+
+func TestEvalArgsParallel(t *testing.T) {
+	zp := newSlowZipper([2]int64{10, 20}, [2]int64{8, 20})
+	eval, err := NewEvaluator(nil, zp, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// movingAverage with points window refetches its argument with an adjusted start,
+	// so the backend is requested by every argument of sumSeries
+	exp, _, err := parser.ParseExpr("sumSeries(movingAverage(metric1,2),movingAverage(metric2,2),movingAverage(metric3,2))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithParallelism(context.Background(), 3)
+	values, err := eval.Fetch(ctx, []parser.Expr{exp}, 10, 20, make(map[parser.MetricRequest][]*types.MetricData))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	zp.reset()
+
+	results, err := eval.Eval(ctx, exp, 10, 20, values)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d series, expected 1", len(results))
+	}
+	if zp.maxInFlight < 2 {
+		t.Errorf("got %d concurrent requests, expected at least 2", zp.maxInFlight)
+	}
+	for _, name := range []string{"metric1", "metric2", "metric3"} {
+		if zp.fetched[name] != 1 {
+			t.Errorf("%s was fetched %d times", name, zp.fetched[name])
+		}
+	}
+
+	sequential, err := eval.Eval(context.Background(), exp, 10, 20, values)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !compare.MetricDataIsEqual(results[0], sequential[0], true) {
+		t.Errorf("got\n%v\nexpected\n%v", results[0], sequential[0])
+	}
+}
+
+func TestEvalArgsParallelOptIn(t *testing.T) {
+	zp := newSlowZipper([2]int64{10, 20}, [2]int64{8, 20})
+	eval, err := NewEvaluator(nil, zp, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// fallbackSeries doesn't opt in to evaluation of arguments in parallel, so they are evaluated one by one
+	exp, _, err := parser.ParseExpr("fallbackSeries(movingAverage(metric1,2),movingAverage(metric2,2))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithParallelism(context.Background(), 3)
+	values, err := eval.Fetch(ctx, []parser.Expr{exp}, 10, 20, make(map[parser.MetricRequest][]*types.MetricData))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	zp.reset()
+
+	results, err := eval.Eval(ctx, exp, 10, 20, values)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d series, expected 1", len(results))
+	}
+	if zp.maxInFlight != 1 {
+		t.Errorf("got %d concurrent requests, expected 1", zp.maxInFlight)
+	}
+}
+
+func TestEvalStateRun(t *testing.T) {
+	state := getEvalState(WithParallelism(context.Background(), 2))
+
+	// nested calls don't wait for goroutines
+	var mu sync.Mutex
+	calls := 0
+	state.run(3, func(i int) {
+		state.run(3, func(j int) {
+			mu.Lock()
+			calls++
+			mu.Unlock()
+		})
+	})
+	if calls != 9 {
+		t.Errorf("got %d calls, expected 9", calls)
+	}
+
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Errorf("got panic %v, expected boom", r)
+		}
+	}()
+	state.run(2, func(i int) {
+		if i == 0 {
+			panic("boom")
+		}
+	})
+}
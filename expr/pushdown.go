@@ -0,0 +1,173 @@
+package expr
+
+import (
+	"strconv"
+
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	zipper "github.com/go-graphite/carbonapi/zipper/interfaces"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// PushdownFunctions are graphite functions that could be evaluated by backends, if they advertise them.
+// See zipperTypes.FilteringFunctions.
+var PushdownFunctions = func() map[string]struct{} {
+	res := make(map[string]struct{}, len(zipperTypes.FilteringFunctions))
+	for _, f := range zipperTypes.FilteringFunctions {
+		res[f] = struct{}{}
+	}
+	return res
+}()
+
+// supportedPushdownFunctions returns functions that are advertised by the backends of the zipper
+func supportedPushdownFunctions(z zipper.CarbonZipper) map[string]struct{} {
+	pz, ok := z.(zipper.PushdownZipper)
+	if !ok {
+		return nil
+	}
+	var res map[string]struct{}
+	for _, f := range pz.PushdownFunctions() {
+		if _, ok := PushdownFunctions[f]; ok {
+			if res == nil {
+				res = make(map[string]struct{})
+			}
+			res[f] = struct{}{}
+		}
+	}
+	return res
+}
+
+// pushdown is a subtree of the expression that is fetched already evaluated by the backend
+type pushdown struct {
+	// key is the text of the subtree, it's used as metric of the evaluated values
+	key string
+	// metric is a glob, that is fetched with functions, and PathExpression of the fetch request
+	metric    string
+	functions []*pb.FilteringFunction
+}
+
+// applied checks that backend reports all pushed functions as applied
+func (p *pushdown) applied(appliedFunctions []string) bool {
+	for _, f := range p.functions {
+		found := false
+		for _, a := range appliedFunctions {
+			if a == f.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// pushdownArgs returns arguments of the function as strings, only constants are supported
+func pushdownArgs(args []parser.Expr) ([]string, bool) {
+	res := make([]string, 0, len(args))
+	for _, a := range args {
+		switch {
+		case a.IsConst():
+			res = append(res, strconv.FormatFloat(a.FloatValue(), 'f', -1, 64))
+		case a.IsString():
+			res = append(res, a.StringValue())
+		case a.IsBool():
+			res = append(res, a.ToString())
+		default:
+			return nil, false
+		}
+	}
+	return res, true
+}
+
+// isSeriesSource checks that expression is fetched from backend as is: metric name, glob or seriesByTag
+func isSeriesSource(e parser.Expr) bool {
+	return e.IsName() || (e.IsFunc() && e.Target() == "seriesByTag")
+}
+
+// planPushdown returns pushdown if the whole expression could be evaluated by backends. Chains of supported
+// functions (e.x. scale(sumSeries(a.*), 2)) are passed as several filtering functions in order of application.
+func planPushdown(e parser.Expr, supported map[string]struct{}, from, until int64) (*pushdown, bool) {
+	if !e.IsFunc() || e.ArgsLen() == 0 || len(e.NamedArgs()) > 0 {
+		return nil, false
+	}
+	if _, ok := supported[e.Target()]; !ok {
+		return nil, false
+	}
+	args, ok := pushdownArgs(e.Args()[1:])
+	if !ok {
+		return nil, false
+	}
+
+	var p *pushdown
+	source := e.Arg(0)
+	if isSeriesSource(source) {
+		metrics := source.Metrics(from, until)
+		if len(metrics) != 1 {
+			return nil, false
+		}
+		p = &pushdown{metric: metrics[0].Metric}
+	} else if p, ok = planPushdown(source, supported, from, until); !ok {
+		return nil, false
+	}
+
+	p.key = e.ToString()
+	p.functions = append(p.functions, &pb.FilteringFunction{Name: e.Target(), Arguments: args})
+	return p, true
+}
+
+// collectPushdowns walks expression and returns subtrees that could be pushed down and metrics that are used
+// outside of them
+func collectPushdowns(e parser.Expr, supported map[string]struct{}, from, until int64, pushdowns []*pushdown, plain map[string]struct{}) []*pushdown {
+	if isSeriesSource(e) {
+		for _, m := range e.Metrics(from, until) {
+			plain[m.Metric] = struct{}{}
+		}
+		return pushdowns
+	}
+	if !e.IsFunc() {
+		return pushdowns
+	}
+	if p, ok := planPushdown(e, supported, from, until); ok {
+		return append(pushdowns, p)
+	}
+	for _, a := range e.Args() {
+		pushdowns = collectPushdowns(a, supported, from, until, pushdowns, plain)
+	}
+	for _, a := range e.NamedArgs() {
+		pushdowns = collectPushdowns(a, supported, from, until, pushdowns, plain)
+	}
+	return pushdowns
+}
+
+// planPushdowns returns pushdowns for the expressions by their base metric. Metrics that are also used without
+// supported functions are fetched as is, as they are needed anyway. Responses are matched to requests by
+// PathExpression, so metrics with different pushed down subtrees (e.x. sumSeries(a.*) and maxSeries(a.*)) are
+// fetched as is as well.
+func planPushdowns(exprs []parser.Expr, supported map[string]struct{}, from, until int64) map[string]*pushdown {
+	if len(supported) == 0 {
+		return nil
+	}
+
+	var pushdowns []*pushdown
+	plain := make(map[string]struct{})
+	for _, e := range exprs {
+		pushdowns = collectPushdowns(e, supported, from, until, pushdowns, plain)
+	}
+
+	res := make(map[string]*pushdown)
+	for _, p := range pushdowns {
+		if _, ok := plain[p.metric]; ok {
+			continue
+		}
+		if prev, ok := res[p.metric]; ok && prev.key != p.key {
+			plain[p.metric] = struct{}{}
+			delete(res, p.metric)
+			continue
+		}
+		res[p.metric] = p
+	}
+	return res
+}
@@ -0,0 +1,234 @@
+package expr
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ansel1/merry"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// pushdownZipper returns raw series by name, pushed down requests are answered with evaluated series (by the text of
+// the functions) if apply is set and fail if reject is set
+type pushdownZipper struct {
+	th.TestZipper
+	functions []string
+	apply     bool
+	reject    bool
+	evaluated map[string][]*types.MetricData
+	requests  []pb.FetchRequest
+}
+
+func filterFunctionsKey(functions []*pb.FilteringFunction) string {
+	var b strings.Builder
+	for _, f := range functions {
+		b.WriteString(f.Name + "(" + strings.Join(f.Arguments, ",") + ")")
+	}
+	return b.String()
+}
+
+func (zp *pushdownZipper) PushdownFunctions() []string {
+	return zp.functions
+}
+
+func (zp *pushdownZipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, merry.Error) {
+	var resp []*types.MetricData
+	for _, r := range request.Metrics {
+		zp.requests = append(zp.requests, r)
+		if len(r.FilterFunctions) > 0 && zp.reject {
+			return nil, nil, merry.New("bad request").WithHTTPCode(400)
+		}
+	}
+	for _, r := range request.Metrics {
+		series := zp.M[parser.MetricRequest{Metric: r.Name, From: r.StartTime, Until: r.StopTime}]
+		if len(r.FilterFunctions) > 0 && zp.apply {
+			series = zp.evaluated[filterFunctionsKey(r.FilterFunctions)]
+		}
+		for _, s := range series {
+			s = s.Copy(true)
+			s.PathExpression = r.PathExpression
+			resp = append(resp, s)
+		}
+	}
+	return resp, nil, nil
+}
+
+func TestPushdown(t *testing.T) {
+	raw := map[parser.MetricRequest][]*types.MetricData{
+		{Metric: "a.*", From: 0, Until: 1}: {
+			types.MakeMetricData("a.b", []float64{1, 2, 3}, 1, 0),
+			types.MakeMetricData("a.c", []float64{4, 5, 6}, 1, 0),
+		},
+	}
+	backendSum := types.MakeMetricData("sumSeries(a.*)", []float64{50, 70, 90}, 1, 0)
+	backendSum.AppliedFunctions = []string{"sumSeries"}
+	backendScaled := types.MakeMetricData("scale(sumSeries(a.*),2)", []float64{100, 140, 180}, 1, 0)
+	backendScaled.AppliedFunctions = []string{"sumSeries", "scale"}
+	evaluated := map[string][]*types.MetricData{
+		"sumSeries()":         {backendSum},
+		"sumSeries()scale(2)": {backendScaled},
+	}
+
+	tests := []struct {
+		name          string
+		target        string
+		functions     []string
+		passFunctions bool
+		apply         bool
+		reject        bool
+		wantRequests  []pb.FetchRequest
+		wantValues    [][]float64
+	}{
+		{
+			name:          "pushed down",
+			target:        "sumSeries(a.*)",
+			functions:     []string{"sumSeries"},
+			passFunctions: true,
+			apply:         true,
+			wantRequests: []pb.FetchRequest{
+				{Name: "a.*", PathExpression: "a.*", StopTime: 1, FilterFunctions: []*pb.FilteringFunction{{Name: "sumSeries", Arguments: []string{}}}},
+			},
+			wantValues: [][]float64{{50, 70, 90}},
+		},
+		{
+			name:          "chain of functions",
+			target:        "scale(sumSeries(a.*),2)",
+			functions:     []string{"sumSeries", "scale"},
+			passFunctions: true,
+			apply:         true,
+			wantRequests: []pb.FetchRequest{
+				{Name: "a.*", PathExpression: "a.*", StopTime: 1, FilterFunctions: []*pb.FilteringFunction{
+					{Name: "sumSeries", Arguments: []string{}},
+					{Name: "scale", Arguments: []string{"2"}},
+				}},
+			},
+			wantValues: [][]float64{{100, 140, 180}},
+		},
+		{
+			name:          "declined by backend",
+			target:        "sumSeries(a.*)",
+			functions:     []string{"sumSeries"},
+			passFunctions: true,
+			wantRequests: []pb.FetchRequest{
+				{Name: "a.*", PathExpression: "a.*", StopTime: 1, FilterFunctions: []*pb.FilteringFunction{{Name: "sumSeries", Arguments: []string{}}}},
+				{Name: "a.*", PathExpression: "a.*", StopTime: 1, FilterFunctions: []*pb.FilteringFunction{}},
+			},
+			wantValues: [][]float64{{5, 7, 9}},
+		},
+		{
+			name:          "rejected by backend",
+			target:        "sumSeries(a.*)",
+			functions:     []string{"sumSeries"},
+			passFunctions: true,
+			reject:        true,
+			wantRequests: []pb.FetchRequest{
+				{Name: "a.*", PathExpression: "a.*", StopTime: 1, FilterFunctions: []*pb.FilteringFunction{{Name: "sumSeries", Arguments: []string{}}}},
+				{Name: "a.*", PathExpression: "a.*", StopTime: 1, FilterFunctions: []*pb.FilteringFunction{}},
+			},
+			wantValues: [][]float64{{5, 7, 9}},
+		},
+		{
+			name:          "different subtrees of the same metric are evaluated locally",
+			target:        "divideSeries(sumSeries(a.*),maxSeries(a.*))",
+			functions:     []string{"sumSeries", "maxSeries"},
+			passFunctions: true,
+			apply:         true,
+			wantRequests: []pb.FetchRequest{
+				{Name: "a.*", PathExpression: "a.*", StopTime: 1},
+			},
+		},
+		{
+			name:          "only advertised functions are pushed down",
+			target:        "scale(sumSeries(a.*),2)",
+			functions:     []string{"sumSeries"},
+			passFunctions: true,
+			apply:         true,
+			wantRequests: []pb.FetchRequest{
+				{Name: "a.*", PathExpression: "a.*", StopTime: 1, FilterFunctions: []*pb.FilteringFunction{{Name: "sumSeries", Arguments: []string{}}}},
+			},
+			wantValues: [][]float64{{100, 140, 180}},
+		},
+		{
+			name:          "metric is also used as is",
+			target:        "divideSeries(sumSeries(a.*),a.*)",
+			functions:     []string{"sumSeries"},
+			passFunctions: true,
+			apply:         true,
+			wantRequests: []pb.FetchRequest{
+				{Name: "a.*", PathExpression: "a.*", StopTime: 1},
+			},
+		},
+		{
+			name:          "series selection is evaluated locally",
+			target:        "highestMax(a.*,1)",
+			functions:     []string{"sumSeries", "highestMax"},
+			passFunctions: true,
+			apply:         true,
+			wantRequests: []pb.FetchRequest{
+				{Name: "a.*", PathExpression: "a.*", StopTime: 1},
+			},
+			wantValues: [][]float64{{4, 5, 6}},
+		},
+		{
+			name:      "passing functions to backend is disabled",
+			target:    "sumSeries(a.*)",
+			functions: []string{"sumSeries"},
+			apply:     true,
+			wantRequests: []pb.FetchRequest{
+				{Name: "a.*", PathExpression: "a.*", StopTime: 1},
+			},
+			wantValues: [][]float64{{5, 7, 9}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zp := &pushdownZipper{TestZipper: th.NewTestZipper(raw), functions: tt.functions, apply: tt.apply, reject: tt.reject, evaluated: evaluated}
+			eval, err := NewEvaluator(nil, zp, tt.passFunctions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			exp, _, err := parser.ParseExpr(tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := FetchAndEvalExp(context.Background(), eval, exp, 0, 1, make(map[parser.MetricRequest][]*types.MetricData))
+			if err != nil && tt.wantValues != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			for i := range zp.requests {
+				if len(zp.requests[i].FilterFunctions) == 0 {
+					zp.requests[i].FilterFunctions = nil
+				}
+			}
+			for i := range tt.wantRequests {
+				if len(tt.wantRequests[i].FilterFunctions) == 0 {
+					tt.wantRequests[i].FilterFunctions = nil
+				}
+			}
+			if !reflect.DeepEqual(zp.requests, tt.wantRequests) {
+				t.Errorf("got requests %+v, want %+v", zp.requests, tt.wantRequests)
+			}
+
+			if tt.wantValues == nil {
+				return
+			}
+			values := make([][]float64, 0, len(res))
+			for _, r := range res {
+				values = append(values, r.Values)
+			}
+			if !reflect.DeepEqual(values, tt.wantValues) {
+				t.Errorf("got values %v, want %v", values, tt.wantValues)
+			}
+		})
+	}
+}
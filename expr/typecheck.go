@@ -0,0 +1,295 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-graphite/carbonapi/expr/consolidations"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+// typeCheckExceptions are functions, which implementations accept arguments that don't match their descriptions,
+// e.x. legacy order of arguments
+var typeCheckExceptions = map[string]struct{}{
+	"highest":     {}, // highest(seriesList, func)
+	"lowest":      {}, // lowest(seriesList, func)
+	"mostDeviant": {}, // mostDeviant(n, seriesList)
+}
+
+// TypeError describes single problem of the expression. Argument is a parameter name from the function
+// description, it's empty if problem is with the function itself. Pos is a byte offset in the target of
+// the argument (or the function) with the problem.
+type TypeError struct {
+	Function string `json:"function"`
+	Argument string `json:"argument,omitempty"`
+	Message  string `json:"message"`
+	Pos      int    `json:"position"`
+}
+
+func (e TypeError) Error() string {
+	if e.Argument == "" {
+		return fmt.Sprintf("%s: %s", e.Function, e.Message)
+	}
+	return fmt.Sprintf("%s(%s): %s", e.Function, e.Argument, e.Message)
+}
+
+// TypeErrors is a list of all problems of the expression
+type TypeErrors []TypeError
+
+func (e TypeErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// TypeCheck validates arity, named arguments, types and options of function arguments against their
+// descriptions, so invalid expressions could be rejected before anything is fetched. Functions without
+// described parameters are not checked. All the problems are returned at once.
+func TypeCheck(e parser.Expr) TypeErrors {
+	var errs TypeErrors
+	typeCheck(e, &errs)
+	return errs
+}
+
+func typeCheck(e parser.Expr, errs *TypeErrors) {
+	if !e.IsFunc() {
+		return
+	}
+	name := e.Target()
+
+	metadata.FunctionMD.RLock()
+	_, ok := metadata.FunctionMD.Functions[name]
+	if !ok {
+		_, ok = metadata.FunctionMD.RewriteFunctions[name]
+	}
+	desc, described := metadata.FunctionMD.Descriptions[name]
+	metadata.FunctionMD.RUnlock()
+
+	if !ok {
+		*errs = append(*errs, TypeError{Function: name, Message: "unknown function" + didYouMean(name, functionNames()), Pos: e.Pos()})
+		return
+	}
+
+	for _, arg := range e.Args() {
+		typeCheck(arg, errs)
+	}
+
+	if _, ok := typeCheckExceptions[name]; ok || !described || len(desc.Params) == 0 {
+		return
+	}
+	checkArgs(name, desc.Params, e, errs)
+}
+
+// CheckArgs validates arguments of the call against parameters the same way as TypeCheck does it for described
+// functions. Arguments themselves are not checked recursively.
+func CheckArgs(params []types.FunctionParam, e parser.Expr) TypeErrors {
+	var errs TypeErrors
+	checkArgs(e.Target(), params, e, &errs)
+	return errs
+}
+
+func checkArgs(name string, params []types.FunctionParam, e parser.Expr, errs *TypeErrors) {
+	provided := make([]bool, len(params))
+	for i, arg := range e.Args() {
+		idx := i
+		if idx >= len(params) {
+			if len(params) == 0 || !params[len(params)-1].Multiple {
+				*errs = append(*errs, TypeError{
+					Function: name,
+					Message:  fmt.Sprintf("too many arguments: got %d, expected at most %d", e.ArgsLen(), len(params)),
+					Pos:      arg.Pos(),
+				})
+				break
+			}
+			idx = len(params) - 1
+		}
+		provided[idx] = true
+		checkArgType(name, params[idx], arg, errs)
+	}
+
+	for argName, arg := range e.NamedArgs() {
+		idx := -1
+		for i := range params {
+			if params[i].Name == argName {
+				idx = i
+				break
+			}
+		}
+		if idx == -1 {
+			paramNames := make([]string, 0, len(params))
+			for _, p := range params {
+				paramNames = append(paramNames, p.Name)
+			}
+			*errs = append(*errs, TypeError{Function: name, Argument: argName, Message: "unknown named argument" + didYouMean(argName, paramNames), Pos: arg.Pos()})
+			continue
+		}
+		if provided[idx] {
+			*errs = append(*errs, TypeError{Function: name, Argument: argName, Message: "argument is specified both as positional and named", Pos: arg.Pos()})
+			continue
+		}
+		provided[idx] = true
+		checkArgType(name, params[idx], arg, errs)
+	}
+
+	// parameters with default values and variadic ones are described as required by graphite-web sometimes
+	for i, p := range params {
+		if p.Required && p.Default == nil && !p.Multiple && !provided[i] {
+			*errs = append(*errs, TypeError{Function: name, Argument: p.Name, Message: "missing required argument", Pos: e.Pos()})
+		}
+	}
+}
+
+// checkArgType checks argument the same way as parser.Expr getters parse it
+func checkArgType(function string, p types.FunctionParam, arg parser.Expr, errs *TypeErrors) {
+	fail := func(format string, a ...interface{}) {
+		*errs = append(*errs, TypeError{Function: function, Argument: p.Name, Message: fmt.Sprintf(format, a...), Pos: arg.Pos()})
+	}
+	expected := types.FunctionTypeToStr[p.Type]
+
+	isSeries := arg.IsName() || arg.IsFunc()
+	isNumber := arg.IsConst()
+	if arg.IsString() {
+		_, err := strconv.ParseFloat(arg.StringValue(), 64)
+		isNumber = err == nil
+	}
+	isInf := (arg.IsName() && strings.ToLower(arg.Target()) == "inf") || (arg.IsString() && strings.ToLower(arg.StringValue()) == "inf")
+
+	switch p.Type {
+	case types.Any:
+		return
+	case types.SeriesList, types.SeriesLists:
+		if !isSeries {
+			fail("expected %s, got %s", expected, argDescription(arg))
+		}
+		return
+	case types.AggOrSeriesFunc:
+		if isSeries {
+			return
+		}
+	case types.Boolean:
+		if arg.IsBool() || arg.IsConst() || arg.IsString() {
+			switch arg.StringValue() {
+			case "False", "false", "0", "True", "true", "1":
+				return
+			}
+		}
+		fail("expected %s, got %s", expected, argDescription(arg))
+		return
+	case types.Float:
+		if !isNumber && !isInf {
+			fail("expected %s, got %s", expected, argDescription(arg))
+		}
+		return
+	case types.Integer, types.Node:
+		if !isNumber {
+			fail("expected %s, got %s", expected, argDescription(arg))
+		}
+		return
+	case types.IntOrInf:
+		if !isNumber && !isInf {
+			fail("expected %s, got %s", expected, argDescription(arg))
+		}
+		return
+	case types.Interval, types.IntOrInterval:
+		if isNumber {
+			return
+		}
+		if !arg.IsString() {
+			fail("expected %s, got %s", expected, argDescription(arg))
+			return
+		}
+		if _, err := parser.IntervalString(arg.StringValue(), 1); err != nil {
+			fail("invalid interval %q", arg.StringValue())
+		}
+		return
+	case types.NodeOrTag:
+		if !isNumber && !arg.IsString() {
+			fail("expected %s, got %s", expected, argDescription(arg))
+		}
+		return
+	case types.Date:
+		if !isNumber && !arg.IsString() {
+			fail("expected %s, got %s", expected, argDescription(arg))
+		}
+		return
+	}
+
+	// string-like types: string, tag, aggFunc and aggOrSeriesFunc that isn't a series
+	if !arg.IsString() {
+		fail("expected %s, got %s", expected, argDescription(arg))
+		return
+	}
+	value := arg.StringValue()
+	switch {
+	case p.Type == types.AggFunc || p.Type == types.AggOrSeriesFunc:
+		// callbacks of groupByNode and similar functions could be other functions as well
+		if consolidations.CheckValidConsolidationFunc(value) != nil && !isFunction(value) {
+			fail("invalid aggregation function %q", value)
+		}
+	case len(p.Options) > 0:
+		for _, o := range p.Options {
+			if fmt.Sprint(o.Value) == value {
+				return
+			}
+		}
+		options := make([]string, 0, len(p.Options))
+		for _, o := range p.Options {
+			options = append(options, fmt.Sprint(o.Value))
+		}
+		fail("invalid value %q, expected one of: %s", value, strings.Join(options, ", "))
+	}
+}
+
+func isFunction(name string) bool {
+	metadata.FunctionMD.RLock()
+	defer metadata.FunctionMD.RUnlock()
+	_, ok := metadata.FunctionMD.Functions[name]
+	return ok
+}
+
+// functionNames returns names of all known functions, including rewrite and user-defined ones
+func functionNames() []string {
+	metadata.FunctionMD.RLock()
+	defer metadata.FunctionMD.RUnlock()
+	names := make([]string, 0, len(metadata.FunctionMD.Functions)+len(metadata.FunctionMD.RewriteFunctions))
+	for name := range metadata.FunctionMD.Functions {
+		names = append(names, name)
+	}
+	for name := range metadata.FunctionMD.RewriteFunctions {
+		if _, ok := metadata.FunctionMD.Functions[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	for name := range metadata.FunctionMD.UserFunctions {
+		names = append(names, name)
+	}
+	return names
+}
+
+// didYouMean returns a hint with names similar to the unknown one, or an empty string if there are none
+func didYouMean(name string, candidates []string) string {
+	suggestions := parser.Suggest(name, candidates)
+	if len(suggestions) == 0 {
+		return ""
+	}
+	return ", did you mean " + strings.Join(suggestions, ", ") + "?"
+}
+
+func argDescription(arg parser.Expr) string {
+	switch {
+	case arg.IsFunc():
+		return "function " + arg.Target()
+	case arg.IsName():
+		return "series " + arg.Target()
+	case arg.IsString():
+		return "string " + strconv.Quote(arg.StringValue())
+	case arg.IsBool():
+		return "boolean " + arg.StringValue()
+	}
+	return "number " + arg.ToString()
+}
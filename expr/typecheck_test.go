@@ -0,0 +1,207 @@
+package expr
+
+import (
+	"go/ast"
+	goparser "go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+func TestTypeCheck(t *testing.T) {
+	tests := []struct {
+		target   string
+		expected TypeErrors
+	}{
+		{target: "foo.bar"},
+		{target: "aliasByNode(foo.bar,1,'tag')"},
+		{target: "aliasByNode(foo.bar,'1')"},
+		{target: "summarize(foo.bar,'1h','sum',alignToFrom=true)"},
+		{target: "groupByNodes(foo.*,'keepLastValue',1)"},
+		{target: "asPercent(foo.bar,100)"},
+		{target: "highestCurrent(foo.*)"},
+		{target: "holtWintersForecast(foo.bar,'7d','1d')"},
+		{target: "sumSeries(foo.*,bar.*,scale(baz,2))"},
+		{
+			target: "aliasByNode(foo.bar,foo)",
+			expected: TypeErrors{
+				{Function: "aliasByNode", Argument: "nodes", Message: "expected nodeOrTag, got series foo", Pos: 20},
+			},
+		},
+		{
+			target: "movingAverage(foo.bar)",
+			expected: TypeErrors{
+				{Function: "movingAverage", Argument: "windowSize", Message: "missing required argument", Pos: 0},
+			},
+		},
+		{
+			target: "movingAverage(foo.bar,'1x')",
+			expected: TypeErrors{
+				{Function: "movingAverage", Argument: "windowSize", Message: `invalid interval "1x"`, Pos: 22},
+			},
+		},
+		{
+			target: "scale(foo.bar,2,3,4)",
+			expected: TypeErrors{
+				{Function: "scale", Message: "too many arguments: got 4, expected at most 3", Pos: 18},
+			},
+		},
+		{
+			target: "summarize(foo.bar,'1h',fnc='sum')",
+			expected: TypeErrors{
+				{Function: "summarize", Argument: "fnc", Message: "unknown named argument, did you mean func?", Pos: 23},
+			},
+		},
+		{
+			target: "summarize(foo.bar,'1h','sum',func='max')",
+			expected: TypeErrors{
+				{Function: "summarize", Argument: "func", Message: "argument is specified both as positional and named", Pos: 29},
+			},
+		},
+		{
+			target: "pearsonClosest(foo.bar,baz.*,1,'up')",
+			expected: TypeErrors{
+				{Function: "pearsonClosest", Argument: "direction", Message: `invalid value "up", expected one of: abs, pos, neg`, Pos: 31},
+			},
+		},
+		{
+			target: "sumSeries(fooBar(foo.*))",
+			expected: TypeErrors{
+				{Function: "fooBar", Message: "unknown function", Pos: 10},
+			},
+		},
+		{
+			target: "sumSeries(sumSeris(foo.*),scale(bar,'x'))",
+			expected: TypeErrors{
+				{Function: "sumSeris", Message: "unknown function, did you mean sumSeries?", Pos: 10},
+				{Function: "scale", Argument: "factor", Message: `expected float, got string "x"`, Pos: 36},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			exp, _, err := parser.ParseExpr(tt.target)
+			if err != nil {
+				t.Fatalf("failed to parse %s: %v", tt.target, err)
+			}
+			errs := TypeCheck(exp)
+			if !reflect.DeepEqual(errs, tt.expected) {
+				t.Errorf("got %v, expected %v", errs, tt.expected)
+			}
+		})
+	}
+}
+
+// functionTestTargets returns targets of test tables from expr/functions/*/function_test.go, items that expect
+// errors are skipped
+func functionTestTargets(t *testing.T) map[string][]string {
+	files, err := filepath.Glob("functions/*/function_test.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no function tests found")
+	}
+
+	targets := make(map[string][]string)
+	fset := token.NewFileSet()
+	for _, file := range files {
+		f, err := goparser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			lit, ok := n.(*ast.CompositeLit)
+			if !ok {
+				return true
+			}
+			item := testItemType(lit.Type)
+			if arr, ok := lit.Type.(*ast.ArrayType); ok {
+				item = testItemType(arr.Elt)
+			}
+			if item == "" || strings.Contains(item, "Error") {
+				return true
+			}
+
+			elts := []ast.Expr{lit}
+			if _, ok := lit.Type.(*ast.ArrayType); ok {
+				elts = lit.Elts
+			}
+			for _, elt := range elts {
+				if target, ok := testItemTarget(elt); ok {
+					targets[file] = append(targets[file], target)
+				}
+			}
+			return true
+		})
+	}
+	return targets
+}
+
+// testItemType returns name of the test item type from tests package, e.g. EvalTestItemWithRange, or empty string
+func testItemType(e ast.Expr) string {
+	if star, ok := e.(*ast.StarExpr); ok {
+		e = star.X
+	}
+	sel, ok := e.(*ast.SelectorExpr)
+	if !ok || !strings.Contains(sel.Sel.Name, "TestItem") {
+		return ""
+	}
+	return sel.Sel.Name
+}
+
+// testItemTarget returns Target of the test item literal, if it's a string constant
+func testItemTarget(e ast.Expr) (string, bool) {
+	if u, ok := e.(*ast.UnaryExpr); ok {
+		e = u.X
+	}
+	lit, ok := e.(*ast.CompositeLit)
+	if !ok || len(lit.Elts) == 0 {
+		return "", false
+	}
+	value := lit.Elts[0]
+	for _, elt := range lit.Elts {
+		if kv, ok := elt.(*ast.KeyValueExpr); ok {
+			value = nil
+			if key, ok := kv.Key.(*ast.Ident); ok && key.Name == "Target" {
+				value = kv.Value
+				break
+			}
+		}
+	}
+	s, ok := value.(*ast.BasicLit)
+	if !ok || s.Kind != token.STRING {
+		return "", false
+	}
+	target, err := strconv.Unquote(s.Value)
+	return target, err == nil
+}
+
+func TestTypeCheckFunctionTests(t *testing.T) {
+	count := 0
+	for file, targets := range functionTestTargets(t) {
+		for _, target := range targets {
+			exp, _, err := parser.ParseExpr(target)
+			if err != nil {
+				continue
+			}
+			if exp.IsFunc() && !isFunction(exp.Target()) {
+				// functions like aliasByRedis are registered only if they are configured
+				continue
+			}
+			count++
+			if errs := TypeCheck(exp); len(errs) > 0 {
+				t.Errorf("%s: %s: %v", file, target, errs)
+			}
+		}
+	}
+	if count == 0 {
+		t.Error("no targets checked, test tables weren't found")
+	}
+}
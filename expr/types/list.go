@@ -64,6 +64,12 @@ var strToFunctionType = map[string]FunctionType{
 	"intOrInf":        IntOrInf,
 }
 
+// ParseFunctionType returns type by its graphite-friendly name, e.x. seriesList
+func ParseFunctionType(s string) (FunctionType, bool) {
+	t, ok := strToFunctionType[s]
+	return t, ok
+}
+
 // FunctionTypeToStr provides a mapping between internal type constants and graphite-friendly string that have a name of a type
 var FunctionTypeToStr = map[FunctionType]string{
 	AggFunc:         "aggFunc",
@@ -284,4 +290,6 @@ type FunctionDescription struct {
 	NameChange   bool `json:"name-change,omitempty"`     // function change name, for tests and verify results in future
 	TagsChange   bool `json:"name-tag-change,omitempty"` //  function change name tag, for tests and verify results in future
 	ValuesChange bool `json:"values-change,omitempty"`   //  function change values, for tests and verify results in future
+
+	ParallelArgs bool `json:"-"` // function evaluates all arguments unconditionally over the same time range, so they could be evaluated concurrently
 }
@@ -0,0 +1,396 @@
+// Package udf provides user-defined functions: macros with typed parameters, that are loaded from a YAML file and
+// expanded to expressions by parser (see parser.SetMacros).
+//
+// File is a list of functions, e.x.
+//
+//	# functions.yaml
+//	- name: errorRatio
+//	  description: Ratio of errors to requests of the service
+//	  params:
+//	    - name: service
+//	      type: string
+//	      required: true
+//	    - name: window
+//	      type: interval
+//	      default: 1min
+//	  template: "movingAverage(divideSeries(sumSeries(services.{{.service}}.errors),sumSeries(services.{{.service}}.requests)),'{{.window}}')"
+//
+// Templates use text/template syntax with parameters as fields. Values of string-like parameters are unquoted,
+// other ones are substituted as they are written in the target. String values may contain only characters of metric
+// names (see valueRe), so they can't change structure of the expanded expression.
+package udf
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ansel1/merry"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+
+	"github.com/go-graphite/carbonapi/expr"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+// ErrInvalidFunction is returned when user-defined function can't be loaded
+var ErrInvalidFunction = merry.New("invalid user-defined function")
+
+// DefaultGroup is a group of user-defined functions in descriptions, if it's not set
+const DefaultGroup = "User-defined"
+
+var nameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// valueRe matches string arguments, that are safe to substitute unquoted: quotes, parentheses, commas, braces,
+// equal signs and spaces would allow to inject arguments or calls into the template
+var valueRe = regexp.MustCompile(`^[a-zA-Z0-9_.:*?\[\]-]*$`)
+
+// Param is a parameter of user-defined function as it's written in the file
+type Param struct {
+	Name     string        `yaml:"name"`
+	Type     string        `yaml:"type"`
+	Required bool          `yaml:"required"`
+	Default  interface{}   `yaml:"default"`
+	Options  []interface{} `yaml:"options"`
+}
+
+// Function is a user-defined function as it's written in the file
+type Function struct {
+	Name        string  `yaml:"name"`
+	Description string  `yaml:"description"`
+	Group       string  `yaml:"group"`
+	Params      []Param `yaml:"params"`
+	Template    string  `yaml:"template"`
+}
+
+// macro is a validated user-defined function
+type macro struct {
+	params []types.FunctionParam
+	tpl    *template.Template
+}
+
+// Expand checks arguments of the call against parameters and executes the template with them
+func (m *macro) Expand(e parser.Expr) (string, error) {
+	if errs := expr.CheckArgs(m.params, e); len(errs) > 0 {
+		return "", errs
+	}
+
+	data := make(map[string]string, len(m.params))
+	for i, p := range m.params {
+		var arg parser.Expr
+		if i < e.ArgsLen() {
+			arg = e.Arg(i)
+		} else {
+			arg = e.NamedArgs()[p.Name]
+		}
+		switch {
+		case arg != nil && arg.IsString():
+			if !valueRe.MatchString(arg.StringValue()) {
+				return "", expr.TypeErrors{{
+					Function: e.Target(),
+					Argument: p.Name,
+					Message:  fmt.Sprintf("invalid value %q, only letters, digits and _.:*?[]- are allowed", arg.StringValue()),
+					Pos:      arg.Pos(),
+				}}
+			}
+			data[p.Name] = arg.StringValue()
+		case arg != nil:
+			data[p.Name] = arg.ToString()
+		case p.Default != nil:
+			data[p.Name] = fmt.Sprint(p.Default.Value)
+		default:
+			data[p.Name] = ""
+		}
+	}
+
+	var b strings.Builder
+	if err := m.tpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Parse parses and validates user-defined functions. Every function is expanded with sample arguments, result must
+// be a valid expression.
+func Parse(data []byte) (parser.Macros, map[string]types.FunctionDescription, error) {
+	var functions []Function
+	if err := yaml.UnmarshalStrict(data, &functions); err != nil {
+		return nil, nil, merry.Prepend(err, "failed to parse user-defined functions")
+	}
+
+	macros := make(parser.Macros, len(functions))
+	descriptions := make(map[string]types.FunctionDescription, len(functions))
+	for _, f := range functions {
+		m, desc, err := compile(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, ok := macros[f.Name]; ok {
+			return nil, nil, ErrInvalidFunction.Here().WithMessagef("%s: function is defined twice", f.Name)
+		}
+		macros[f.Name] = m
+		descriptions[f.Name] = desc
+	}
+
+	for _, f := range functions {
+		if err := validate(f, macros); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return macros, descriptions, nil
+}
+
+func compile(f Function) (*macro, types.FunctionDescription, error) {
+	fail := func(format string, a ...interface{}) (*macro, types.FunctionDescription, error) {
+		return nil, types.FunctionDescription{}, ErrInvalidFunction.Here().WithMessagef(f.Name+": "+format, a...)
+	}
+
+	if !nameRe.MatchString(f.Name) {
+		return fail("invalid name")
+	}
+	metadata.FunctionMD.RLock()
+	_, builtin := metadata.FunctionMD.Functions[f.Name]
+	_, rewrite := metadata.FunctionMD.RewriteFunctions[f.Name]
+	metadata.FunctionMD.RUnlock()
+	if builtin || rewrite {
+		return fail("function with the same name already exists")
+	}
+	if f.Template == "" {
+		return fail("template is empty")
+	}
+	tpl, err := template.New(f.Name).Option("missingkey=error").Parse(f.Template)
+	if err != nil {
+		return fail("invalid template: %v", err)
+	}
+
+	params := make([]types.FunctionParam, 0, len(f.Params))
+	signature := make([]string, 0, len(f.Params))
+	optional := false
+	for _, p := range f.Params {
+		if !nameRe.MatchString(p.Name) {
+			return fail("invalid name of parameter %q", p.Name)
+		}
+		for _, prev := range params {
+			if prev.Name == p.Name {
+				return fail("parameter %s is defined twice", p.Name)
+			}
+		}
+		t, ok := types.ParseFunctionType(p.Type)
+		if !ok {
+			return fail("parameter %s has unknown type %q", p.Name, p.Type)
+		}
+		param := types.FunctionParam{
+			Name:     p.Name,
+			Required: p.Required,
+			Type:     t,
+		}
+		if p.Required {
+			if optional {
+				return fail("required parameter %s follows optional one", p.Name)
+			}
+			if p.Default != nil {
+				return fail("required parameter %s has default value", p.Name)
+			}
+			signature = append(signature, p.Name)
+		} else {
+			optional = true
+			if p.Default != nil {
+				param.Default = types.NewSuggestion(p.Default)
+				if param.Default.Type == types.SNone {
+					return fail("parameter %s has default value of unsupported type", p.Name)
+				}
+				signature = append(signature, fmt.Sprintf("%s=%v", p.Name, p.Default))
+			} else {
+				signature = append(signature, p.Name+"=None")
+			}
+		}
+		for _, o := range p.Options {
+			option := types.NewSuggestion(o)
+			if option.Type == types.SNone {
+				return fail("parameter %s has option of unsupported type", p.Name)
+			}
+			param.Options = append(param.Options, *option)
+		}
+		params = append(params, param)
+	}
+
+	group := f.Group
+	if group == "" {
+		group = DefaultGroup
+	}
+	desc := types.FunctionDescription{
+		Description: f.Description,
+		Function:    f.Name + "(" + strings.Join(signature, ", ") + ")",
+		Group:       group,
+		Module:      "carbonapi.udf",
+		Name:        f.Name,
+		Params:      params,
+	}
+	return &macro{params: params, tpl: tpl}, desc, nil
+}
+
+// validate expands the function with required arguments only and with all of them
+func validate(f Function, macros parser.Macros) error {
+	params := macros[f.Name].(*macro).params
+	required := make([]string, 0, len(params))
+	all := make([]string, 0, len(params))
+	for _, p := range params {
+		arg := sampleArg(p)
+		if p.Required {
+			required = append(required, arg)
+		}
+		all = append(all, arg)
+	}
+
+	for _, args := range [][]string{required, all} {
+		call := f.Name + "(" + strings.Join(args, ",") + ")"
+		exp, _, err := parser.ParseExprWithMacros(call, macros)
+		if err != nil {
+			return ErrInvalidFunction.Here().WithMessagef("%s: expansion of %s failed: %v", f.Name, call, err)
+		}
+		if errs := expr.TypeCheck(exp); len(errs) > 0 {
+			return ErrInvalidFunction.Here().WithMessagef("%s: expansion of %s is invalid: %v", f.Name, call, errs)
+		}
+	}
+	return nil
+}
+
+// sampleArg returns argument of the type, that is valid for the parameter
+func sampleArg(p types.FunctionParam) string {
+	var value interface{}
+	switch {
+	case p.Default != nil:
+		value = p.Default.Value
+	case len(p.Options) > 0:
+		value = p.Options[0].Value
+	}
+
+	switch p.Type {
+	case types.SeriesList, types.SeriesLists, types.AggOrSeriesFunc, types.Any:
+		if value != nil {
+			return quote(value)
+		}
+		return "a.b.c"
+	case types.Boolean:
+		if value != nil {
+			return fmt.Sprint(value)
+		}
+		return "true"
+	case types.Integer, types.Node, types.IntOrInf, types.IntOrInterval, types.Float:
+		if value != nil {
+			return quote(value)
+		}
+		return "1"
+	case types.Interval:
+		if value != nil {
+			return quote(value)
+		}
+		return "'1min'"
+	case types.AggFunc:
+		if value != nil {
+			return quote(value)
+		}
+		return "'sum'"
+	}
+	if value != nil {
+		return quote(value)
+	}
+	return "'x'"
+}
+
+// quote returns strings as string literals and other values as they are
+func quote(v interface{}) string {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	if strings.Contains(s, "'") {
+		return `"` + s + `"`
+	}
+	return "'" + s + "'"
+}
+
+// Load reads user-defined functions from the file and replaces current ones with them
+func Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	macros, descriptions, err := Parse(data)
+	if err != nil {
+		return merry.Prepend(err, path)
+	}
+	parser.SetMacros(macros)
+	metadata.SetUserFunctionDescriptions(descriptions)
+	return nil
+}
+
+// Watcher reloads user-defined functions when the file is changed. Invalid files are logged and ignored, so
+// previous functions are kept.
+type Watcher struct {
+	logger   *zap.Logger
+	path     string
+	interval time.Duration
+	modTime  time.Time
+	size     int64
+}
+
+func NewWatcher(logger *zap.Logger, path string, interval time.Duration) *Watcher {
+	return &Watcher{
+		logger:   logger.With(zap.String("type", "udf"), zap.String("file", path)),
+		path:     path,
+		interval: interval,
+	}
+}
+
+// Load loads functions from the file unconditionally
+func (w *Watcher) Load() error {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return err
+	}
+	w.modTime, w.size = info.ModTime(), info.Size()
+	return Load(w.path)
+}
+
+// Run checks the file for changes until context is done
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Refresh()
+		}
+	}
+}
+
+// Refresh reloads functions if modification time or size of the file is changed
+func (w *Watcher) Refresh() {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		w.logger.Warn("failed to check user-defined functions, keeping previous ones",
+			zap.Error(err),
+		)
+		return
+	}
+	if info.ModTime().Equal(w.modTime) && info.Size() == w.size {
+		return
+	}
+	if err := w.Load(); err != nil {
+		w.logger.Error("failed to reload user-defined functions, keeping previous ones",
+			zap.Error(err),
+		)
+		return
+	}
+	w.logger.Info("user-defined functions reloaded")
+}
@@ -0,0 +1,258 @@
+package udf
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/expr/functions"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/rewrite"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+func init() {
+	rewrite.New(make(map[string]string))
+	functions.New(make(map[string]string))
+}
+
+const testFunctions = `
+- name: errorRatio
+  description: Ratio of errors to requests of the service
+  params:
+    - name: service
+      type: string
+      required: true
+    - name: window
+      type: interval
+      default: 1min
+  template: "movingAverage(divideSeries(sumSeries(services.{{.service}}.errors),sumSeries(services.{{.service}}.requests)),'{{.window}}')"
+- name: errorPercent
+  group: SLO
+  params:
+    - name: service
+      type: string
+      required: true
+    - name: func
+      type: string
+      options: [avg, max]
+  template: "{{if .func}}consolidateBy({{end}}scale(errorRatio('{{.service}}'),100){{if .func}},'{{.func}}'){{end}}"
+`
+
+func TestExpand(t *testing.T) {
+	macros, descriptions, err := Parse([]byte(testFunctions))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parser.SetMacros(macros)
+	defer parser.SetMacros(nil)
+
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{
+			"errorRatio('api')",
+			"movingAverage(divideSeries(sumSeries(services.api.errors),sumSeries(services.api.requests)),'1min')",
+		},
+		{
+			"errorRatio('api', window='5min')",
+			"movingAverage(divideSeries(sumSeries(services.api.errors),sumSeries(services.api.requests)),'5min')",
+		},
+		{
+			"errorPercent('db','max')",
+			"consolidateBy(scale(errorRatio('db'),100),'max')",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			exp, _, err := parser.ParseExpr(tt.target)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assert.Equal(t, tt.want, exp.ToString())
+			// positions of the expansion point to the call
+			start, end := exp.Span()
+			assert.Equal(t, 0, start)
+			assert.Equal(t, len(tt.target), end)
+		})
+	}
+
+	// arguments are expanded as well, text of calls is kept for names of series
+	exp, _, err := parser.ParseExpr("alias(errorPercent('db'),'db')")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, "scale", exp.Arg(0).Target())
+	assert.Equal(t, "movingAverage", exp.Arg(0).Arg(0).Target())
+	assert.Equal(t, "scale(errorRatio('db'),100)", exp.Arg(0).ToString())
+
+	assert.Equal(t, "errorRatio(service, window=1min)", descriptions["errorRatio"].Function)
+	assert.Equal(t, DefaultGroup, descriptions["errorRatio"].Group)
+	assert.Equal(t, "SLO", descriptions["errorPercent"].Group)
+	assert.Equal(t, 2, len(descriptions["errorPercent"].Params[1].Options))
+}
+
+func TestExpandErrors(t *testing.T) {
+	macros, _, err := Parse([]byte(testFunctions))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parser.SetMacros(macros)
+	defer parser.SetMacros(nil)
+
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"errorRatio()", "errorRatio(service): missing required argument"},
+		{"errorRatio(1)", "errorRatio(service): expected string, got number 1"},
+		{"errorRatio('api','bogus')", `errorRatio(window): invalid interval "bogus"`},
+		{"errorPercent('api','sum')", `errorPercent(func): invalid value "sum", expected one of: avg, max`},
+		{"sumSeries(errorRatio('api',window='1min',step=1))", "errorRatio(step): unknown named argument at position 10"},
+		{"errorRatio('api.errors),sumSeries(secret.*')", `errorRatio(service): invalid value "api.errors),sumSeries(secret.*"`},
+		{`errorPercent("x'),group(secret.*),'max")`, `errorPercent(service): invalid value "x'),group(secret.*),'max"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			_, _, err := parser.ParseExpr(tt.target)
+			if err == nil {
+				t.Fatalf("expected error %q", tt.want)
+			}
+			assert.Contains(t, err.Error(), tt.want)
+			var parseErr *parser.ParseError
+			if assert.ErrorAs(t, err, &parseErr) {
+				assert.Equal(t, tt.target, parseErr.Target)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{
+			"invalid yaml",
+			"- name: a\n  tempalte: b\n",
+			"failed to parse user-defined functions",
+		},
+		{
+			"builtin name",
+			"- name: sumSeries\n  template: a.b\n",
+			"sumSeries: function with the same name already exists",
+		},
+		{
+			"duplicate",
+			"- name: a\n  template: a.b\n- name: a\n  template: a.c\n",
+			"a: function is defined twice",
+		},
+		{
+			"unknown type",
+			"- name: a\n  params: [{name: x, type: metric}]\n  template: a.b\n",
+			`a: parameter x has unknown type "metric"`,
+		},
+		{
+			"required after optional",
+			"- name: a\n  params: [{name: x, type: integer}, {name: y, type: integer, required: true}]\n  template: a.b\n",
+			"a: required parameter y follows optional one",
+		},
+		{
+			"invalid default",
+			"- name: a\n  params: [{name: x, type: interval, default: bogus}]\n  template: \"movingAverage(a.b,'{{.x}}')\"\n",
+			`a: expansion of a() is invalid: movingAverage(windowSize): invalid interval "bogus"`,
+		},
+		{
+			"invalid template",
+			"- name: a\n  template: \"{{.x\"\n",
+			"a: invalid template",
+		},
+		{
+			"unknown parameter in template",
+			"- name: a\n  template: \"{{.x}}\"\n",
+			`map has no entry for key "x"`,
+		},
+		{
+			"unknown function in template",
+			"- name: a\n  params: [{name: x, type: seriesList, required: true}]\n  template: \"sumSeriess({{.x}})\"\n",
+			"sumSeriess: unknown function, did you mean sumSeries?",
+		},
+		{
+			"optional parameter without default",
+			"- name: a\n  params: [{name: x, type: integer}]\n  template: \"movingAverage(a.b,{{.x}})\"\n",
+			"expansion of a() failed",
+		},
+		{
+			"recursion",
+			"- name: a\n  template: \"sumSeries(b())\"\n- name: b\n  template: \"sumSeries(a())\"\n",
+			"too deep expansion",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Parse([]byte(tt.data))
+			if err == nil {
+				t.Fatalf("expected error %q", tt.want)
+			}
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	defer parser.SetMacros(nil)
+	defer metadata.SetUserFunctionDescriptions(nil)
+
+	path := filepath.Join(t.TempDir(), "udf.yaml")
+	write := func(data string, modTime time.Time) {
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	described := func(name string) bool {
+		metadata.FunctionMD.RLock()
+		defer metadata.FunctionMD.RUnlock()
+		_, ok := metadata.FunctionMD.Descriptions[name]
+		_, grouped := metadata.FunctionMD.DescriptionsGrouped[DefaultGroup][name]
+		return ok && grouped
+	}
+	expand := func(target string) string {
+		exp, _, err := parser.ParseExpr(target)
+		if err != nil {
+			return err.Error()
+		}
+		return exp.ToString()
+	}
+
+	now := time.Now()
+	write("- name: firstFunction\n  template: a.b\n", now)
+	w := NewWatcher(zap.NewNop(), path, time.Second)
+	if err := w.Load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, "a.b", expand("firstFunction()"))
+	assert.True(t, described("firstFunction"))
+
+	write("- name: second\n  template: a.c\n", now.Add(time.Second))
+	w.Refresh()
+	assert.Equal(t, "a.c", expand("second()"))
+	assert.Equal(t, "firstFunction()", expand("firstFunction()"))
+	assert.False(t, described("firstFunction"))
+	assert.True(t, described("second"))
+
+	// invalid file is ignored
+	write("- name: sumSeries\n  template: a.d\n", now.Add(2*time.Second))
+	w.Refresh()
+	assert.Equal(t, "a.c", expand("second()"))
+	assert.True(t, strings.HasPrefix(expand("sumSeries(a.b)"), "sumSeries"))
+}
@@ -20,6 +20,7 @@ require (
 	github.com/evmar/gocairo v0.0.0-20160222165215-ddd30f837497
 	github.com/go-graphite/protocol v1.0.0
 	github.com/golang/protobuf v1.5.4
+	github.com/golang/snappy v0.0.4
 	github.com/gomodule/redigo v1.9.2
 	github.com/gorilla/handlers v1.5.2
 	github.com/lib/pq v1.10.9
@@ -30,6 +31,7 @@ require (
 	github.com/msaf1980/go-metrics v0.0.14
 	github.com/msaf1980/go-stringutils v0.1.6
 	github.com/natefinch/atomic v1.0.1
+	github.com/prometheus/prometheus v0.48.1
 	github.com/rs/dnscache v0.0.0-20230804202142-fc85eb664529
 	github.com/satori/go.uuid v1.2.0
 	github.com/spf13/viper v1.18.2
@@ -42,6 +44,7 @@ require (
 	go.uber.org/zap v1.27.0
 	golang.org/x/sys v0.19.0
 	gonum.org/v1/gonum v0.15.0
+	google.golang.org/grpc v1.59.0
 	gopkg.in/yaml.v2 v2.4.0
 )
 
@@ -71,8 +74,10 @@ require (
 	github.com/yuin/gopher-lua v0.0.0-20210529063254-f4c35e4016d9 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
 	golang.org/x/exp v0.0.0-20240416160154-fe59bbe5cc7f // indirect
+	golang.org/x/net v0.19.0 // indirect
 	golang.org/x/sync v0.7.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20231120223509-83a465c0220f // indirect
 	google.golang.org/protobuf v1.33.0 // indirect
 	gopkg.in/ini.v1 v1.67.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
@@ -3,6 +3,8 @@ package dns
 import (
 	"context"
 	"net"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lomik/zapwriter"
@@ -63,3 +65,17 @@ func UseDNSCache(dnsRefreshTime time.Duration) {
 		zap.Duration("refreshTime", dnsRefreshTime),
 	)
 }
+
+// LookupSRV resolves SRV record, e.x. _carbonserver._tcp.example.com, targets are returned as host:port sorted
+// by priority and randomized by weight
+func LookupSRV(ctx context.Context, name string) ([]string, error) {
+	_, srvs, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0, len(srvs))
+	for _, srv := range srvs {
+		res = append(res, net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port))))
+	}
+	return res, nil
+}
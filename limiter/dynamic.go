@@ -0,0 +1,124 @@
+package limiter
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type serverSlot struct {
+	ch       chan struct{}
+	inFlight int64
+}
+
+// DynamicLimiter limits amount of requests per server, servers are added on the first request. It also tracks
+// requests in flight, so removed servers could be drained.
+type DynamicLimiter struct {
+	mu  sync.RWMutex
+	m   map[string]*serverSlot
+	cap int
+}
+
+// NewDynamicServerLimiter creates a limiter for servers that are not known in advance, l <= 0 means no limit
+func NewDynamicServerLimiter(l int) *DynamicLimiter {
+	if l < 0 {
+		l = 0
+	}
+	return &DynamicLimiter{
+		m:   make(map[string]*serverSlot),
+		cap: l,
+	}
+}
+
+func (sl *DynamicLimiter) Capacity() int {
+	return sl.cap
+}
+
+func (sl *DynamicLimiter) slot(s string) *serverSlot {
+	sl.mu.RLock()
+	slot, ok := sl.m[s]
+	if ok {
+		atomic.AddInt64(&slot.inFlight, 1)
+		sl.mu.RUnlock()
+		return slot
+	}
+	sl.mu.RUnlock()
+
+	sl.mu.Lock()
+	slot, ok = sl.m[s]
+	if !ok {
+		slot = &serverSlot{}
+		if sl.cap > 0 {
+			slot.ch = make(chan struct{}, sl.cap)
+		}
+		sl.m[s] = slot
+	}
+	atomic.AddInt64(&slot.inFlight, 1)
+	sl.mu.Unlock()
+	return slot
+}
+
+// Enter claims one of free slots or blocks until there is one.
+func (sl *DynamicLimiter) Enter(ctx context.Context, s string) error {
+	slot := sl.slot(s)
+	if slot.ch == nil {
+		return nil
+	}
+
+	select {
+	case slot.ch <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		atomic.AddInt64(&slot.inFlight, -1)
+		return ErrTimeout
+	}
+}
+
+// Frees a slot in limiter
+func (sl *DynamicLimiter) Leave(ctx context.Context, s string) {
+	sl.mu.RLock()
+	slot, ok := sl.m[s]
+	sl.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	if slot.ch != nil {
+		<-slot.ch
+	}
+	atomic.AddInt64(&slot.inFlight, -1)
+}
+
+// InFlight returns amount of requests to the server, that are waiting for a slot or in progress
+func (sl *DynamicLimiter) InFlight(s string) int64 {
+	sl.mu.RLock()
+	defer sl.mu.RUnlock()
+	if slot, ok := sl.m[s]; ok {
+		return atomic.LoadInt64(&slot.inFlight)
+	}
+	return 0
+}
+
+// Drain waits until there are no requests to the server and forgets it. It returns ErrTimeout if context
+// is done earlier.
+func (sl *DynamicLimiter) Drain(ctx context.Context, s string) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		sl.mu.Lock()
+		slot, ok := sl.m[s]
+		if !ok || atomic.LoadInt64(&slot.inFlight) == 0 {
+			delete(sl.m, s)
+			sl.mu.Unlock()
+			return nil
+		}
+		sl.mu.Unlock()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ErrTimeout
+		}
+	}
+}
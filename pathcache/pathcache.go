@@ -1,6 +1,8 @@
 package pathcache
 
 import (
+	"sync"
+
 	"github.com/dgryski/go-expirecache"
 	"github.com/go-graphite/carbonapi/zipper/types"
 
@@ -10,6 +12,8 @@ import (
 // PathCache provides general interface to cache find and search queries
 type PathCache struct {
 	ec *expirecache.Cache
+	// keys that were set, expirecache can't be iterated, so they are tracked to invalidate removed backends
+	keys *sync.Map
 
 	expireDelaySec int32
 }
@@ -19,6 +23,7 @@ func NewPathCache(ExpireDelaySec int32) PathCache {
 
 	p := PathCache{
 		ec:             expirecache.New(0),
+		keys:           &sync.Map{},
 		expireDelaySec: ExpireDelaySec,
 	}
 
@@ -46,6 +51,7 @@ func (p *PathCache) Set(k string, v []types.BackendServer) {
 	}
 
 	p.ec.Set(k, v, size, p.expireDelaySec)
+	p.keys.Store(k, struct{}{})
 }
 
 // Get returns an an element by key. If not successful - returns also false in second var.
@@ -56,3 +62,36 @@ func (p *PathCache) Get(k string) ([]types.BackendServer, bool) {
 
 	return nil, false
 }
+
+// Add appends backend to the element, e.x. for the server that was discovered after the cache was filled
+func (p *PathCache) Add(k string, backend types.BackendServer) {
+	v, _ := p.Get(k)
+	for _, b := range v {
+		if b == backend {
+			return
+		}
+	}
+	p.Set(k, append(append([]types.BackendServer{}, v...), backend))
+}
+
+// RemoveBackends removes backends with given names from all elements
+func (p *PathCache) RemoveBackends(names map[string]struct{}) {
+	p.keys.Range(func(key, _ interface{}) bool {
+		k := key.(string)
+		v, ok := p.Get(k)
+		if !ok {
+			p.keys.Delete(k)
+			return true
+		}
+		filtered := make([]types.BackendServer, 0, len(v))
+		for _, b := range v {
+			if _, removed := names[b.Name()]; !removed {
+				filtered = append(filtered, b)
+			}
+		}
+		if len(filtered) != len(v) {
+			p.Set(k, filtered)
+		}
+		return true
+	})
+}
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"strings"
+	"sync/atomic"
 	"text/template"
 )
 
@@ -26,51 +27,101 @@ func (d *defineStruct) define(name, tmpl string) error {
 	return err
 }
 
-func (d *defineStruct) expandExpr(exp *expr) (*expr, error) {
+// maxExpandDepth limits nesting of templates and macros expansions, so recursive ones can't loop forever
+const maxExpandDepth = 32
+
+// Macro expands a call of user-defined function to the text of expression, see SetMacros
+type Macro interface {
+	Expand(e Expr) (string, error)
+}
+
+// Macros are user-defined functions by name
+type Macros map[string]Macro
+
+var macros atomic.Value
+
+// SetMacros replaces user-defined functions, that are expanded by ParseExpr after templates of Define. It's safe to
+// call it while other expressions are parsed.
+func SetMacros(m Macros) {
+	macros.Store(m)
+}
+
+func currentMacros() Macros {
+	m, _ := macros.Load().(Macros)
+	return m
+}
+
+// expandCall returns expansion of the template or macro call, or nil if exp isn't a call of them
+func (d *defineStruct) expandCall(exp *expr, macros Macros) (*expr, error) {
+	var text string
+	if t := d.tpl.Lookup(exp.target); t != nil {
+		var b strings.Builder
+		args := make([]string, len(exp.args))
+		for i := 0; i < len(exp.args); i++ {
+			args[i] = exp.args[i].ToString()
+		}
+		kwargs := make(map[string]string)
+		for k, v := range exp.namedArgs {
+			kwargs[k] = v.ToString()
+		}
+		data := map[string]interface{}{
+			"argString": exp.argString,
+			"args":      args,
+			"kwargs":    kwargs,
+		}
+		if err := t.Execute(&b, data); err != nil {
+			return nil, err
+		}
+		text = b.String()
+	} else if m, ok := macros[exp.target]; ok && exp.etype == EtFunc {
+		var err error
+		text, err = m.Expand(exp)
+		if err != nil {
+			return nil, &ParseError{Err: err, Pos: exp.pos}
+		}
+	} else {
+		return nil, nil
+	}
+
+	newExp, _, err := parseExprInner(text)
+	if err != nil {
+		return nil, err
+	}
+	// expanded expression has no place in the target, so it points to the template call
+	setSpan(newExp.(*expr), exp.pos, exp.end)
+	return newExp.(*expr), nil
+}
+
+func (d *defineStruct) expandExpr(exp *expr, macros Macros, depth int) (*expr, error) {
 	if exp == nil {
 		return exp, nil
 	}
 
-	var err error
-
-	if exp.etype == EtName || exp.etype == EtFunc {
-		t := d.tpl.Lookup(exp.target)
-		if t != nil {
-			var b strings.Builder
-			args := make([]string, len(exp.args))
-			for i := 0; i < len(exp.args); i++ {
-				args[i] = exp.args[i].ToString()
-			}
-			kwargs := make(map[string]string)
-			for k, v := range exp.namedArgs {
-				kwargs[k] = v.ToString()
-			}
-			data := map[string]interface{}{
-				"argString": exp.argString,
-				"args":      args,
-				"kwargs":    kwargs,
-			}
-			err = t.Execute(&b, data)
-			if err != nil {
-				return exp, err
-			}
-			newExp, _, err := parseExprInner(b.String())
-			if err != nil {
-				return exp, err
-			}
-			exp = newExp.(*expr)
+	for exp.etype == EtName || exp.etype == EtFunc {
+		newExp, err := d.expandCall(exp, macros)
+		if err != nil {
+			return exp, err
 		}
+		if newExp == nil {
+			break
+		}
+		depth++
+		if depth > maxExpandDepth {
+			return exp, &ParseError{Err: ErrExpandTooDeep, Pos: exp.pos}
+		}
+		exp = newExp
 	}
 
+	var err error
 	for i := 0; i < len(exp.args); i++ {
-		exp.args[i], err = d.expandExpr(exp.args[i])
+		exp.args[i], err = d.expandExpr(exp.args[i], macros, depth)
 		if err != nil {
 			return exp, err
 		}
 	}
 
 	for k, v := range exp.namedArgs {
-		exp.namedArgs[k], err = d.expandExpr(v)
+		exp.namedArgs[k], err = d.expandExpr(v, macros, depth)
 		if err != nil {
 			return exp, err
 		}
@@ -84,5 +135,5 @@ func (d *defineStruct) Expand(v Expr) (Expr, error) {
 	if !ok {
 		return v, nil
 	}
-	return d.expandExpr(exp)
+	return d.expandExpr(exp, currentMacros(), 0)
 }
@@ -116,6 +116,16 @@ func TestDefineExpand(t *testing.T) {
 			continue
 		}
 
+		setSpan(e.(*expr), 0, 0)
 		assert.Equal(tt.e, e, tt.s)
 	}
 }
+
+func TestDefineExpandTooDeep(t *testing.T) {
+	defer defineCleanUp()
+
+	assert.NoError(t, Define("loop", "sumSeries(loop({{.argString}}))"))
+
+	_, _, err := ParseExpr("loop(a.b)")
+	assert.ErrorIs(t, err, ErrExpandTooDeep)
+}
@@ -0,0 +1,41 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ParseError is an error of parsing the target with position (byte offset) where it happened.
+// Original error (e.x. ErrMissingComma) could be checked with errors.Is or merry.Is.
+type ParseError struct {
+	Err    error
+	Target string
+	Pos    int
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Err.Error(), e.Pos)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Snippet returns the target with a caret under the position of the error
+func (e *ParseError) Snippet() string {
+	return Snippet(e.Target, e.Pos)
+}
+
+// Snippet returns the target with a caret under the character at the position (byte offset), e.x.
+//
+//	sumSeries(foo.bar baz)
+//	                  ^
+func Snippet(target string, pos int) string {
+	if pos < 0 {
+		pos = 0
+	} else if pos > len(target) {
+		pos = len(target)
+	}
+	return target + "\n" + strings.Repeat(" ", utf8.RuneCountInString(target[:pos])) + "^"
+}
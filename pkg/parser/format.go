@@ -0,0 +1,82 @@
+package parser
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Format returns canonical form of the expression: strings are single-quoted, numbers are normalized, named arguments
+// follow positional ones sorted by name. Calls that have other calls as arguments are split to one argument per line
+// with two spaces indentation, e.x.
+//
+//	divideSeries(
+//	  sumSeries(a.*.errors),
+//	  sumSeries(a.*.requests)
+//	)
+func Format(e Expr) string {
+	var b strings.Builder
+	format(&b, e, "")
+	return b.String()
+}
+
+func format(b *strings.Builder, e Expr, indent string) {
+	switch e.Type() {
+	case EtFunc:
+	case EtConst:
+		b.WriteString(strconv.FormatFloat(e.FloatValue(), 'g', -1, 64))
+		return
+	case EtBool:
+		b.WriteString(e.StringValue())
+		return
+	default:
+		b.WriteString(e.ToString())
+		return
+	}
+
+	args := e.Args()
+	namedArgs := e.NamedArgs()
+	names := make([]string, 0, len(namedArgs))
+	for name := range namedArgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	multiline := false
+	for _, arg := range args {
+		if arg.IsFunc() {
+			multiline = true
+			break
+		}
+	}
+
+	sep, argIndent := ", ", indent
+	if multiline {
+		argIndent = indent + "  "
+		sep = ",\n" + argIndent
+	}
+
+	b.WriteString(e.Target())
+	b.WriteByte('(')
+	if multiline {
+		b.WriteString("\n" + argIndent)
+	}
+	for i, arg := range args {
+		if i > 0 {
+			b.WriteString(sep)
+		}
+		format(b, arg, argIndent)
+	}
+	for i, name := range names {
+		if i > 0 || len(args) > 0 {
+			b.WriteString(sep)
+		}
+		b.WriteString(name)
+		b.WriteByte('=')
+		format(b, namedArgs[name], argIndent)
+	}
+	if multiline {
+		b.WriteString("\n" + indent)
+	}
+	b.WriteByte(')')
+}
@@ -0,0 +1,42 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected string
+	}{
+		{"foo.bar", "foo.bar"},
+		{"42", "42"},
+		{`alias(foo.bar,"baz")`, "alias(foo.bar, 'baz')"},
+		{"movingAverage(foo.bar, 1e1, xFilesFactor=0.5)", "movingAverage(foo.bar, 10, xFilesFactor=0.5)"},
+		{"f(foo, z=1, a=True)", "f(foo, a=true, z=1)"},
+		{"keepLastValue()", "keepLastValue()"},
+		{
+			"a.*.errors / a.*.requests | alias('ratio')",
+			"divideSeries(\n  a.*.errors,\n  alias(a.*.requests, 'ratio')\n)",
+		},
+		{
+			"divideSeries(sumSeries(a.*.errors),sumSeries(a.*.requests))",
+			"divideSeries(\n  sumSeries(a.*.errors),\n  sumSeries(a.*.requests)\n)",
+		},
+		{
+			"alias(sumSeries(scale(foo,2),bar),'x')",
+			"alias(\n  sumSeries(\n    scale(foo, 2),\n    bar\n  ),\n  'x'\n)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			e, _, err := ParseExpr(tt.s)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.expected, Format(e))
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Infix arithmetic is desugared into regular function calls:
+//
+//	a + b  -> sumSeries(a,b)        a + 1  -> offset(a,1)     1 + a  -> offset(a,1)
+//	a - b  -> diffSeries(a,b)       a - 1  -> offset(a,-1)    1 - a  -> offset(scale(a,-1),1)
+//	a * b  -> multiplySeries(a,b)   a * 2  -> scale(a,2)      2 * a  -> scale(a,2)
+//	a / b  -> divideSeries(a,b)     a / 2  -> scale(a,0.5)    2 / a  -> scale(invert(a),2)
+//
+// `*` and `/` bind tighter than `+` and `-`, operators of the same precedence are left-associative,
+// chains of `+`, `-` and `*` are merged into a single call (a + b + c -> sumSeries(a,b,c)).
+// Operators must be separated from operands by whitespace, as `-`, `*` and `/` are valid characters of metric names.
+// Pipes bind tighter than operators: `a + b | alias('b')` is `a + alias(b,'b')`.
+
+var infixFunctions = map[byte]string{
+	'+': "sumSeries",
+	'-': "diffSeries",
+	'*': "multiplySeries",
+	'/': "divideSeries",
+}
+
+// operand is a parsed operand of infix expression
+type operand struct {
+	exp *expr
+	// op is an operator the expression was desugared from, when it's a call that could take more operands
+	op byte
+	// desugared is true when the expression doesn't appear in the target as is
+	desugared bool
+}
+
+func infixPrecedence(op byte) int {
+	switch op {
+	case '+', '-':
+		return 1
+	case '*', '/':
+		return 2
+	}
+	return 0
+}
+
+// infixOperator returns the operator at the start of e and the rest after it. Whitespace before the operator
+// is already skipped by pipe, but an operand always ends before it, so only whitespace after it is checked.
+func infixOperator(e string) (byte, string) {
+	t := skipWhitespace(e)
+	if len(t) < 2 || infixPrecedence(t[0]) == 0 || !unicode.IsSpace(rune(t[1])) {
+		return 0, e
+	}
+	return t[0], t[1:]
+}
+
+// parseInfix parses expression with operators of at least minPrecedence
+func parseInfix(e string, minPrecedence int) (operand, string, error) {
+	lhs, e, err := parseOperand(e)
+	if err != nil {
+		return lhs, e, err
+	}
+
+	for {
+		op, rest := infixOperator(e)
+		if op == 0 || infixPrecedence(op) < minPrecedence {
+			return lhs, e, nil
+		}
+		opStart := skipWhitespace(e)
+		pos := len(opStart)
+
+		var rhs operand
+		rhs, e, err = parseInfix(rest, infixPrecedence(op)+1)
+		if err != nil {
+			return rhs, e, err
+		}
+
+		lhs, err = applyInfix(op, pos, lhs, rhs)
+		if err != nil {
+			// point to the operator
+			return lhs, opStart, err
+		}
+	}
+}
+
+// parseOperand parses single operand: parenthesized infix expression or expression with pipes
+func parseOperand(e string) (operand, string, error) {
+	t := skipWhitespace(e)
+	if t == "" || t[0] != '(' {
+		exp, e, err := parseExprWithoutPipe(e)
+		if err != nil {
+			return operand{}, e, err
+		}
+		exp, e, err = pipe(exp.(*expr), e)
+		return operand{exp: exp.(*expr)}, e, err
+	}
+
+	inner, e, err := parseInfix(t[1:], 1)
+	if err != nil {
+		return inner, e, err
+	}
+	e = skipWhitespace(e)
+	if e == "" || e[0] != ')' {
+		return inner, e, ErrMissingParenthesis
+	}
+	exp, e, err := pipe(inner.exp, e[1:])
+	return operand{exp: exp, desugared: true}, e, err
+}
+
+func applyInfix(op byte, pos int, lhs, rhs operand) (operand, error) {
+	isSeries := func(o operand) bool { return o.exp.IsName() || o.exp.IsFunc() }
+	if !isSeries(lhs) && !lhs.exp.IsConst() || !isSeries(rhs) && !rhs.exp.IsConst() {
+		return operand{}, ErrBadType
+	}
+	if op == '/' && rhs.exp.IsConst() && rhs.exp.val == 0 {
+		return operand{}, ErrDivisionByZero
+	}
+
+	switch {
+	case lhs.exp.IsConst() && rhs.exp.IsConst():
+		a, b := lhs.exp.val, rhs.exp.val
+		var v float64
+		switch op {
+		case '+':
+			v = a + b
+		case '-':
+			v = a - b
+		case '*':
+			v = a * b
+		case '/':
+			v = a / b
+		}
+		return operand{exp: newInfixConst(v, lhs.exp.pos, rhs.exp.end), desugared: true}, nil
+	case isSeries(lhs) && isSeries(rhs):
+		if lhs.op == op && op != '/' {
+			lhs.exp.args = append(lhs.exp.args, rhs.exp)
+			lhs.exp.argString += "," + rhs.exp.ToString()
+			if rhs.exp.end < lhs.exp.end {
+				lhs.exp.end = rhs.exp.end
+			}
+			return lhs, nil
+		}
+		return operand{exp: newInfixFunc(infixFunctions[op], pos, lhs.exp, rhs.exp), op: op, desugared: true}, nil
+	case isSeries(lhs):
+		c := rhs.exp
+		switch op {
+		case '+':
+			return operand{exp: newInfixFunc("offset", pos, lhs.exp, c), desugared: true}, nil
+		case '-':
+			return operand{exp: newInfixFunc("offset", pos, lhs.exp, newInfixConst(-c.val, c.pos, c.end)), desugared: true}, nil
+		case '*':
+			return operand{exp: newInfixFunc("scale", pos, lhs.exp, c), desugared: true}, nil
+		default:
+			return operand{exp: newInfixFunc("scale", pos, lhs.exp, newInfixConst(1/c.val, c.pos, c.end)), desugared: true}, nil
+		}
+	default:
+		c := lhs.exp
+		switch op {
+		case '+':
+			return operand{exp: newInfixFunc("offset", pos, rhs.exp, c), desugared: true}, nil
+		case '-':
+			negated := newInfixFunc("scale", pos, rhs.exp, newInfixConst(-1, c.pos, c.end))
+			return operand{exp: newInfixFunc("offset", pos, negated, c), desugared: true}, nil
+		case '*':
+			return operand{exp: newInfixFunc("scale", pos, rhs.exp, c), desugared: true}, nil
+		default:
+			return operand{exp: newInfixFunc("scale", pos, newInfixFunc("invert", pos, rhs.exp), c), desugared: true}, nil
+		}
+	}
+}
+
+// newInfixFunc creates a call for the operator at pos. While parsing positions are lengths of the rest of the target,
+// so the call ends where the rest is the shortest.
+func newInfixFunc(name string, pos int, args ...*expr) *expr {
+	argStrs := make([]string, 0, len(args))
+	end := pos
+	for _, arg := range args {
+		argStrs = append(argStrs, arg.ToString())
+		if arg.end < end {
+			end = arg.end
+		}
+	}
+	return &expr{
+		target:    name,
+		etype:     EtFunc,
+		args:      args,
+		argString: strings.Join(argStrs, ","),
+		pos:       pos,
+		end:       end,
+	}
+}
+
+func newInfixConst(v float64, pos, end int) *expr {
+	return &expr{
+		val:    v,
+		etype:  EtConst,
+		valStr: strconv.FormatFloat(v, 'g', -1, 64),
+		pos:    pos,
+		end:    end,
+	}
+}
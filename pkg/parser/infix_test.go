@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExprInfix(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected string
+	}{
+		{"a.*.errors / a.*.requests", "divideSeries(a.*.errors,a.*.requests)"},
+		{"sumSeries(a.*.errors) / sumSeries(a.*.requests)", "divideSeries(sumSeries(a.*.errors),sumSeries(a.*.requests))"},
+		{"a + b + c", "sumSeries(a,b,c)"},
+		{"a - b - c", "diffSeries(a,b,c)"},
+		{"a * b * c", "multiplySeries(a,b,c)"},
+		{"a / b / c", "divideSeries(divideSeries(a,b),c)"},
+		{"a + b * c", "sumSeries(a,multiplySeries(b,c))"},
+		{"(a + b) * c", "multiplySeries(sumSeries(a,b),c)"},
+		{"a + (b + c)", "sumSeries(a,sumSeries(b,c))"},
+		{"a - b + c", "sumSeries(diffSeries(a,b),c)"},
+		{"a + 1", "offset(a,1)"},
+		{"1 + a", "offset(a,1)"},
+		{"a - 1", "offset(a,-1)"},
+		{"1 - a", "offset(scale(a,-1),1)"},
+		{"a * 2", "scale(a,2)"},
+		{"2 * a", "scale(a,2)"},
+		{"a / 4", "scale(a,0.25)"},
+		{"2 / a", "scale(invert(a),2)"},
+		{"a + 1 + b", "sumSeries(offset(a,1),b)"},
+		{"a * 100 / 1024", "scale(scale(a,100),0.0009765625)"},
+		{"a / (2 * 4)", "scale(a,0.125)"},
+		{"a.b-c.*", "a.b-c.*"},
+		{"a | scale(2) + b", "sumSeries(scale(a,2),b)"},
+		{"(a + b) | alias('x')", "alias(sumSeries(a,b),'x')"},
+		{"alias(a * 100 / b, 'ratio')", "alias(divideSeries(scale(a,100),b), 'ratio')"},
+		{"movingAverage(a, 2 * 5)", "movingAverage(a,10)"},
+		{"movingAverage(a, windowSize=2 * 5)", "movingAverage(a,windowSize=10)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			assert := assert.New(t)
+
+			e, rest, err := ParseExpr(tt.s)
+			if !assert.NoError(err) {
+				return
+			}
+			assert.Empty(rest)
+			assert.Equal(tt.expected, e.ToString())
+
+			// desugared form is parsed to the same expression
+			e2, _, err := ParseExpr(e.ToString())
+			if assert.NoError(err) {
+				assert.Equal(tt.expected, e2.ToString())
+			}
+		})
+	}
+}
+
+func TestParseExprInfixErrors(t *testing.T) {
+	tests := []struct {
+		s           string
+		expectedErr error
+		pos         int
+	}{
+		{"(a + b", ErrMissingParenthesis, 6},
+		{"a / 0", ErrDivisionByZero, 2},
+		{"a + 'b'", ErrBadType, 2},
+		{"a + ", ErrMissingExpr, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			assert := assert.New(t)
+
+			_, _, err := ParseExpr(tt.s)
+			assert.ErrorIs(err, tt.expectedErr)
+			var parseErr *ParseError
+			if assert.ErrorAs(err, &parseErr) {
+				assert.Equal(tt.pos, parseErr.Pos)
+			}
+		})
+	}
+}
+
+func TestParseExprInfixPos(t *testing.T) {
+	assert := assert.New(t)
+
+	e, _, err := ParseExpr("a.b / (c.d - 1)")
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(4, e.Pos(), "/")
+	assert.Equal(0, e.Arg(0).Pos(), "a.b")
+	assert.Equal(11, e.Arg(1).Pos(), "-")
+	assert.Equal(7, e.Arg(1).Arg(0).Pos(), "c.d")
+	assert.Equal(13, e.Arg(1).Arg(1).Pos(), "-1")
+}
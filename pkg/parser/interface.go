@@ -39,6 +39,16 @@ var (
 	ErrMissingQuote = errors.New("missing quote")
 	// ErrUnexpectedCharacter is a parse error returned when an expression contains an unexpected character.
 	ErrUnexpectedCharacter = errors.New("unexpected character")
+	// ErrMissingParenthesis is a parse error returned when a parenthesized arithmetic expression is not closed.
+	ErrMissingParenthesis = errors.New("missing closing parenthesis")
+	// ErrDivisionByZero is a parse error returned when an arithmetic expression is divided by zero constant.
+	ErrDivisionByZero = errors.New("division by zero")
+	// ErrExpandTooDeep is a parse error returned when templates or user-defined functions are expanded recursively.
+	ErrExpandTooDeep = errors.New("too deep expansion of templates or user-defined functions")
+	// ErrTooComplex is a parse error returned when an expression exceeds limits of complexity, see ComplexityError.
+	ErrTooComplex = errors.New("expression is too complex")
+	// ErrInvalidVariable is returned when a value of dashboard variable can't be substituted, see SubstituteVariables.
+	ErrInvalidVariable = errors.New("invalid variable value")
 	// ErrBadType is an eval error returned when a argument has wrong type.
 	ErrBadType = errors.New("bad type")
 	// ErrMissingArgument is an eval error returned when a argument is missing.
@@ -91,6 +101,10 @@ type Expr interface {
 	MutateTarget(string) Expr
 	// ToString returns string representation of expression
 	ToString() string
+	// Pos returns byte offset of the expression in the parsed target
+	Pos() int
+	// Span returns byte offsets of the start and the end of the expression (including piped and infix operands) in the parsed target
+	Span() (int, int)
 
 	// FloatValue returns float value for expression.
 	FloatValue() float64
@@ -0,0 +1,159 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// Names of Limits, see ComplexityError
+const (
+	LimitMaxDepth         = "maxDepth"
+	LimitMaxNodes         = "maxNodes"
+	LimitMaxFunctionCalls = "maxFunctionCalls"
+	LimitMaxGlobs         = "maxGlobs"
+)
+
+// Limits restricts complexity of a target, so it can't exhaust stack or CPU of the parser and the evaluator. Zero
+// value of a limit means no limit.
+type Limits struct {
+	// MaxDepth is maximum nesting depth of parentheses and function calls
+	MaxDepth int `mapstructure:"maxDepth"`
+	// MaxNodes is maximum count of nodes: function calls, metric names and other arguments
+	MaxNodes int `mapstructure:"maxNodes"`
+	// MaxFunctionCalls is maximum count of function calls
+	MaxFunctionCalls int `mapstructure:"maxFunctionCalls"`
+	// MaxGlobs is maximum count of metric names with wildcards and seriesByTag queries
+	MaxGlobs int `mapstructure:"maxGlobs"`
+}
+
+// ComplexityError is returned (as Err of ParseError) when a target exceeds one of Limits. It matches ErrTooComplex
+// with errors.Is.
+type ComplexityError struct {
+	// Limit is the name of exceeded limit, e.x. LimitMaxDepth
+	Limit string
+	// Max is the value of exceeded limit
+	Max int
+}
+
+func (e *ComplexityError) Error() string {
+	return fmt.Sprintf("%s: %s is %d", ErrTooComplex.Error(), e.Limit, e.Max)
+}
+
+func (e *ComplexityError) Is(target error) bool {
+	return target == ErrTooComplex
+}
+
+var limits atomic.Value
+
+// SetLimits replaces limits of complexity, that are checked by ParseExpr and CheckLimits. It's safe to call it while
+// other expressions are parsed.
+func SetLimits(l Limits) {
+	limits.Store(l)
+}
+
+func currentLimits() Limits {
+	l, _ := limits.Load().(Limits)
+	return l
+}
+
+// checkNesting checks depth of parentheses in the target before it's parsed, as parser recurses into them
+func checkNesting(target string, maxDepth int) *ParseError {
+	if maxDepth <= 0 {
+		return nil
+	}
+	depth := 0
+	var quote byte
+	for i := 0; i < len(target); i++ {
+		c := target[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+			if depth > maxDepth {
+				return &ParseError{Err: &ComplexityError{Limit: LimitMaxDepth, Max: maxDepth}, Target: target, Pos: i}
+			}
+		case c == ')':
+			depth--
+		}
+	}
+	return nil
+}
+
+// CheckLimits checks complexity of the expression (e.x. after templates, user-defined functions or rewrite functions
+// are expanded) with limits set by SetLimits. Error is *ParseError with *ComplexityError and position of the first
+// node, that exceeds a limit.
+func CheckLimits(e Expr) error {
+	exp, ok := e.(*expr)
+	if !ok {
+		return nil
+	}
+	l := currentLimits()
+	if l == (Limits{}) {
+		return nil
+	}
+	c := complexity{limits: l}
+	return c.check(exp, 0)
+}
+
+// complexity counts nodes of the expression
+type complexity struct {
+	limits Limits
+	nodes  int
+	calls  int
+	globs  int
+}
+
+func (c *complexity) check(exp *expr, depth int) error {
+	fail := func(limit string, max int) error {
+		return &ParseError{Err: &ComplexityError{Limit: limit, Max: max}, Pos: exp.pos}
+	}
+
+	c.nodes++
+	if c.limits.MaxNodes > 0 && c.nodes > c.limits.MaxNodes {
+		return fail(LimitMaxNodes, c.limits.MaxNodes)
+	}
+	switch exp.etype {
+	case EtName:
+		if isGlob(exp.target) {
+			c.globs++
+			if c.limits.MaxGlobs > 0 && c.globs > c.limits.MaxGlobs {
+				return fail(LimitMaxGlobs, c.limits.MaxGlobs)
+			}
+		}
+		return nil
+	case EtFunc:
+	default:
+		return nil
+	}
+
+	depth++
+	if c.limits.MaxDepth > 0 && depth > c.limits.MaxDepth {
+		return fail(LimitMaxDepth, c.limits.MaxDepth)
+	}
+	c.calls++
+	if c.limits.MaxFunctionCalls > 0 && c.calls > c.limits.MaxFunctionCalls {
+		return fail(LimitMaxFunctionCalls, c.limits.MaxFunctionCalls)
+	}
+	for _, arg := range exp.args {
+		if err := c.check(arg, depth); err != nil {
+			return err
+		}
+	}
+	for _, arg := range exp.namedArgs {
+		if err := c.check(arg, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isGlob checks if metric name is fetched by a query: it has wildcards or it's seriesByTag
+func isGlob(name string) bool {
+	return strings.HasPrefix(name, seriesByTagPrefix) || strings.ContainsAny(name, "*?[{")
+}
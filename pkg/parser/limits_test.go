@@ -0,0 +1,120 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimits(t *testing.T) {
+	defer SetLimits(Limits{})
+	defer defineCleanUp()
+	assert.NoError(t, Define("twice", "sumSeries({{.argString}},{{.argString}})"))
+
+	tests := []struct {
+		name   string
+		limits Limits
+		s      string
+		// empty if parsed
+		limit string
+		pos   int
+	}{
+		{
+			name:   "not exceeded",
+			limits: Limits{MaxDepth: 2, MaxNodes: 5, MaxFunctionCalls: 2, MaxGlobs: 1},
+			s:      "sumSeries(scale(a.*, 2), b.c)",
+		},
+		{
+			name:   "maxDepth",
+			limits: Limits{MaxDepth: 2},
+			s:      "sumSeries(scale(absolute(a.b), 2))",
+			limit:  LimitMaxDepth,
+			pos:    24,
+		},
+		{
+			name:   "maxDepth of parentheses",
+			limits: Limits{MaxDepth: 2},
+			s:      "(((a.b)))",
+			limit:  LimitMaxDepth,
+			pos:    2,
+		},
+		{
+			name:   "parentheses in strings",
+			limits: Limits{MaxDepth: 1},
+			s:      "alias(a.b, '((x))')",
+		},
+		{
+			name:   "maxDepth of pipes",
+			limits: Limits{MaxDepth: 2},
+			s:      "a.b|scale(2)|absolute()|alias('x')",
+			limit:  LimitMaxDepth,
+			pos:    4,
+		},
+		{
+			name:   "maxNodes",
+			limits: Limits{MaxNodes: 4},
+			s:      "sumSeries(a.b, c.d, scale(e.f, 2))",
+			limit:  LimitMaxNodes,
+			pos:    26,
+		},
+		{
+			name:   "maxFunctionCalls",
+			limits: Limits{MaxFunctionCalls: 2},
+			s:      "sumSeries(scale(a.b, 2), absolute(c.d))",
+			limit:  LimitMaxFunctionCalls,
+			pos:    25,
+		},
+		{
+			name:   "maxGlobs",
+			limits: Limits{MaxGlobs: 2},
+			s:      "sumSeries(a.*, b.c, d.{e,f}, seriesByTag('name=g'))",
+			limit:  LimitMaxGlobs,
+			pos:    29,
+		},
+		{
+			// expanded expression points to the call
+			name:   "maxFunctionCalls after expansion",
+			limits: Limits{MaxFunctionCalls: 2},
+			s:      "twice(twice(a.b))",
+			limit:  LimitMaxFunctionCalls,
+			pos:    0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetLimits(tt.limits)
+			_, _, err := ParseExpr(tt.s)
+			if tt.limit == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.ErrorIs(t, err, ErrTooComplex)
+			var complexityErr *ComplexityError
+			if assert.True(t, errors.As(err, &complexityErr), "error is %v", err) {
+				assert.Equal(t, tt.limit, complexityErr.Limit)
+			}
+			var parseErr *ParseError
+			if assert.True(t, errors.As(err, &parseErr)) {
+				assert.Equal(t, tt.s, parseErr.Target)
+				assert.Equal(t, tt.pos, parseErr.Pos)
+			}
+		})
+	}
+}
+
+func TestCheckLimits(t *testing.T) {
+	defer SetLimits(Limits{})
+
+	e, _, err := ParseExpr("sumSeries(a.*, b.*)")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, CheckLimits(e))
+
+	SetLimits(Limits{MaxGlobs: 1})
+	err = CheckLimits(e)
+	assert.EqualError(t, err, "expression is too complex: maxGlobs is 1 at position 15")
+}
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"regexp"
 	"strconv"
@@ -25,6 +26,8 @@ type expr struct {
 	args      []*expr // positional
 	namedArgs map[string]*expr
 	argString string
+	pos       int // byte offset of the expression in the target, for named arguments - of the argument name
+	end       int // byte offset of the end of the expression in the target
 }
 
 func (e *expr) IsName() bool {
@@ -47,6 +50,29 @@ func (e *expr) IsBool() bool {
 	return e.etype == EtBool
 }
 
+func (e *expr) Pos() int {
+	return e.pos
+}
+
+func (e *expr) Span() (int, int) {
+	start, end := e.pos, e.end
+	for _, arg := range e.args {
+		argStart, argEnd := arg.Span()
+		if argStart < start {
+			start = argStart
+		}
+		if argEnd > end {
+			end = argEnd
+		}
+	}
+	for _, arg := range e.namedArgs {
+		if _, argEnd := arg.Span(); argEnd > end {
+			end = argEnd
+		}
+	}
+	return start, end
+}
+
 func (e *expr) Type() ExprType {
 	return e.etype
 }
@@ -594,17 +620,20 @@ func parseExprWithoutPipe(e string) (Expr, string, error) {
 		return nil, "", ErrMissingExpr
 	}
 
+	// until the whole target is parsed, position is the length of the rest of it, see resolvePos
+	pos := len(e)
+
 	if '0' <= e[0] && e[0] <= '9' || e[0] == '-' || e[0] == '+' {
 		val, valStr, e, err := parseConst(e)
 		r, _ := utf8.DecodeRuneInString(e)
 		if !unicode.IsLetter(r) {
-			return &expr{val: val, etype: EtConst, valStr: valStr}, e, err
+			return &expr{val: val, etype: EtConst, valStr: valStr, pos: pos, end: len(e)}, e, err
 		}
 	}
 
 	if e[0] == '\'' || e[0] == '"' {
 		val, e, err := parseString(e)
-		return &expr{valStr: val, etype: EtString}, e, err
+		return &expr{valStr: val, etype: EtString, pos: pos, end: len(e)}, e, err
 	}
 
 	name, e := parseName(e)
@@ -615,46 +644,89 @@ func parseExprWithoutPipe(e string) (Expr, string, error) {
 
 	nameLower := strings.ToLower(name)
 	if nameLower == "false" || nameLower == "true" {
-		return &expr{valStr: nameLower, etype: EtBool, target: nameLower}, e, nil
+		return &expr{valStr: nameLower, etype: EtBool, target: nameLower, pos: pos, end: len(e)}, e, nil
 	}
 
 	if e != "" && e[0] == '(' {
 		// TODO(civil): Tags: make it a proper Expression
 		if name == "seriesByTag" {
 			argString, _, _, e, err := parseArgList(e)
-			return &expr{target: name + "(" + argString + ")", etype: EtName}, e, err
+			return &expr{target: name + "(" + argString + ")", etype: EtName, pos: pos, end: len(e)}, e, err
 		}
-		exp := &expr{target: name, etype: EtFunc}
+		exp := &expr{target: name, etype: EtFunc, pos: pos}
 
 		argString, posArgs, namedArgs, e, err := parseArgList(e)
 		exp.argString = argString
 		exp.args = posArgs
 		exp.namedArgs = namedArgs
+		exp.end = len(e)
 
 		return exp, e, err
 	}
 
-	return &expr{target: name}, e, nil
+	return &expr{target: name, pos: pos, end: len(e)}, e, nil
 }
 
 func parseExprInner(e string) (Expr, string, error) {
-	exp, e, err := parseExprWithoutPipe(e)
+	o, e, err := parseInfix(e, 1)
 	if err != nil {
-		return exp, e, err
+		return nil, e, err
 	}
-	return pipe(exp.(*expr), e)
+	return o.exp, e, nil
 }
 
-// ParseExpr actually do all the parsing. It returns expression, original string and error (if any)
+// ParseExpr actually do all the parsing. It returns expression, original string and error (if any).
+// Parse errors are returned as *ParseError with the position of the problem in the target.
 func ParseExpr(e string) (Expr, string, error) {
+	return ParseExprWithMacros(e, currentMacros())
+}
+
+// ParseExprWithMacros is ParseExpr, that expands the given user-defined functions instead of ones set by SetMacros
+func ParseExprWithMacros(e string, macros Macros) (Expr, string, error) {
+	target := e
+	if err := checkNesting(e, currentLimits().MaxDepth); err != nil {
+		return nil, e[err.Pos:], err
+	}
 	exp, e, err := parseExprInner(e)
 	if err != nil {
-		return exp, e, err
+		return exp, e, &ParseError{Err: err, Target: target, Pos: len(target) - len(e)}
+	}
+	resolvePos(exp.(*expr), len(target))
+	exp, err = defineMap.expandExpr(exp.(*expr), macros, 0)
+	if err == nil {
+		err = CheckLimits(exp)
+	}
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) && parseErr.Target == "" {
+		parseErr.Target = target
 	}
-	exp, err = defineMap.expandExpr(exp.(*expr))
 	return exp, e, err
 }
 
+// resolvePos converts lengths of the rest of the target, recorded while parsing, to offsets from its start
+func resolvePos(exp *expr, targetLen int) {
+	exp.pos = targetLen - exp.pos
+	exp.end = targetLen - exp.end
+	for _, arg := range exp.args {
+		resolvePos(arg, targetLen)
+	}
+	for _, arg := range exp.namedArgs {
+		resolvePos(arg, targetLen)
+	}
+}
+
+// setSpan sets the same position and end for the expression and all its arguments
+func setSpan(exp *expr, pos, end int) {
+	exp.pos = pos
+	exp.end = end
+	for _, arg := range exp.args {
+		setSpan(arg, pos, end)
+	}
+	for _, arg := range exp.namedArgs {
+		setSpan(arg, pos, end)
+	}
+}
+
 func pipe(exp *expr, e string) (*expr, string, error) {
 	e = skipWhitespace(e)
 
@@ -728,10 +800,12 @@ func parseArgList(e string) (string, []*expr, map[string]*expr, string, error) {
 		charNum++
 
 		argString := e
-		arg, e, err = parseExprInner(e)
+		argPos := len(skipWhitespace(e))
+		o, rest, err := parseInfix(e, 1)
 		if err != nil {
-			return "", nil, nil, e, err
+			return "", nil, nil, rest, err
 		}
+		arg, e = o.exp, rest
 
 		if e == "" {
 			return "", nil, nil, "", ErrMissingComma
@@ -740,10 +814,11 @@ func parseArgList(e string) (string, []*expr, map[string]*expr, string, error) {
 		// we now know we're parsing a key-value pair
 		if arg.IsName() && e[0] == '=' {
 			e = e[1:]
-			argCont, eCont, errCont := parseExprInner(e)
+			oCont, eCont, errCont := parseInfix(e, 1)
 			if errCont != nil {
 				return "", nil, nil, eCont, errCont
 			}
+			argCont := oCont.exp
 
 			if eCont == "" {
 				return "", nil, nil, "", ErrMissingComma
@@ -762,6 +837,8 @@ func parseArgList(e string) (string, []*expr, map[string]*expr, string, error) {
 				val:    argCont.FloatValue(),
 				valStr: argCont.StringValue(),
 				target: argCont.Target(),
+				pos:    argPos,
+				end:    argCont.end,
 			}
 			namedArgs[arg.Target()] = exp
 
@@ -769,7 +846,11 @@ func parseArgList(e string) (string, []*expr, map[string]*expr, string, error) {
 			if argStringBuffer.Len() > 0 {
 				argStringBuffer.WriteByte(',')
 			}
-			argStringBuffer.WriteString(argString[:len(argString)-len(e)])
+			if oCont.desugared {
+				argStringBuffer.WriteString(arg.Target() + "=" + argCont.ToString())
+			} else {
+				argStringBuffer.WriteString(argString[:len(argString)-len(e)])
+			}
 			charNum += len(argString) - len(e)
 		} else {
 			exp := arg.toExpr().(*expr)
@@ -778,7 +859,7 @@ func parseArgList(e string) (string, []*expr, map[string]*expr, string, error) {
 			if argStringBuffer.Len() > 0 {
 				argStringBuffer.WriteByte(',')
 			}
-			if exp.IsFunc() {
+			if exp.IsFunc() || o.desugared {
 				expString := exp.ToString()
 				argStringBuffer.WriteString(expString)
 				charNum += len(expString)
@@ -796,7 +877,7 @@ func parseArgList(e string) (string, []*expr, map[string]*expr, string, error) {
 		}
 
 		if e[0] != ',' && e[0] != ' ' {
-			return "", nil, nil, "", merry.Wrap(ErrUnexpectedCharacter).WithUserMessagef("string_to_parse=`%v`, character_number=%v, character=`%v`", eOrig, charNum, string(e[0]))
+			return "", nil, nil, e, merry.Wrap(ErrUnexpectedCharacter).WithUserMessagef("string_to_parse=`%v`, character_number=%v, character=`%v`", eOrig, charNum, string(e[0]))
 		}
 
 		e = e[1:]
@@ -813,7 +894,7 @@ func parseConst(s string) (float64, string, string, error) {
 
 	v, err := strconv.ParseFloat(s[:i], 64)
 	if err != nil {
-		return 0, "", "", err
+		return 0, "", s, err
 	}
 
 	return v, s[:i], s[i:], err
@@ -934,6 +1015,7 @@ func parseString(s string) (string, string, error) {
 	}
 
 	match := s[0]
+	orig := s
 
 	s = s[1:]
 
@@ -943,8 +1025,7 @@ func parseString(s string) (string, string, error) {
 	}
 
 	if i == len(s) {
-		return "", "", ErrMissingQuote
-
+		return "", orig, ErrMissingQuote
 	}
 
 	return s[:i], s[i+1:], nil
@@ -487,12 +487,99 @@ func TestParseExpr(t *testing.T) {
 
 			e, _, err := ParseExpr(tt.s)
 			if assert.NoError(err) {
+				// positions are checked by TestParseExprPos and TestParseExprSpan
+				setSpan(e.(*expr), 0, 0)
 				assert.Equal(tt.e, e, tt.s)
 			}
 		})
 	}
 }
 
+func TestParseExprPos(t *testing.T) {
+	assert := assert.New(t)
+
+	e, _, err := ParseExpr("sumSeries(foo.bar, scale(baz, 2), func='avg') | alias('x')")
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.Equal(48, e.Pos(), "alias")
+	assert.Equal(0, e.Arg(0).Pos(), "sumSeries")
+	assert.Equal(54, e.Arg(1).Pos(), "'x'")
+
+	sum := e.Arg(0)
+	assert.Equal(10, sum.Arg(0).Pos(), "foo.bar")
+	assert.Equal(19, sum.Arg(1).Pos(), "scale")
+	assert.Equal(25, sum.Arg(1).Arg(0).Pos(), "baz")
+	assert.Equal(30, sum.Arg(1).Arg(1).Pos(), "2")
+	namedArg, _ := sum.NamedArg("func")
+	assert.Equal(34, namedArg.Pos(), "func=")
+}
+
+func TestParseExprErrors(t *testing.T) {
+	tests := []struct {
+		s           string
+		expectedErr error
+		pos         int
+		snippet     string
+	}{
+		{
+			s:           "sumSeries(foo.bar",
+			expectedErr: ErrMissingComma,
+			pos:         17,
+			snippet:     "sumSeries(foo.bar\n                 ^",
+		},
+		{
+			s:           "sumSeries(foo.bar baz)",
+			expectedErr: ErrUnexpectedCharacter,
+			pos:         18,
+			snippet:     "sumSeries(foo.bar baz)\n                  ^",
+		},
+		{
+			s:           "alias(foo.bar, 'baz)",
+			expectedErr: ErrMissingQuote,
+			pos:         15,
+			snippet:     "alias(foo.bar, 'baz)\n               ^",
+		},
+		{
+			s:           "scale(foo.bar,)",
+			expectedErr: ErrMissingArgument,
+			pos:         14,
+			snippet:     "scale(foo.bar,)\n              ^",
+		},
+		{
+			s:           "foo.bar|",
+			expectedErr: ErrMissingExpr,
+			pos:         8,
+			snippet:     "foo.bar|\n        ^",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			assert := assert.New(t)
+
+			_, _, err := ParseExpr(tt.s)
+			assert.ErrorIs(err, tt.expectedErr)
+			var parseErr *ParseError
+			if assert.ErrorAs(err, &parseErr) {
+				assert.Equal(tt.pos, parseErr.Pos)
+				assert.Equal(tt.snippet, parseErr.Snippet())
+			}
+		})
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"sumSeries", "sum", "summarize", "sortByName", "averageSeries", "diffSeries"}
+
+	assert.Equal(t, []string{"sumSeries"}, Suggest("sumSeris", candidates))
+	assert.Equal(t, []string{"sumSeries"}, Suggest("sumseries", candidates))
+	assert.Equal(t, []string{"sum"}, Suggest("sun", candidates))
+	assert.Equal(t, []string{"sumSeries", "diffSeries"}, Suggest("dumSeries", candidates))
+	assert.Empty(t, Suggest("movingAverage", candidates))
+}
+
 func TestDoGetBoolVar(t *testing.T) {
 	tests := []struct {
 		s string
@@ -1070,3 +1157,31 @@ func TestMetrics(t *testing.T) {
 		})
 	}
 }
+
+func TestParseExprSpan(t *testing.T) {
+	assert := assert.New(t)
+
+	target := "sumSeries(foo.bar, key='x') | alias('y') "
+	e, _, err := ParseExpr(target)
+	if !assert.NoError(err) {
+		return
+	}
+
+	span := func(e Expr) string {
+		start, end := e.Span()
+		return target[start:end]
+	}
+	assert.Equal("sumSeries(foo.bar, key='x') | alias('y')", span(e))
+	assert.Equal("sumSeries(foo.bar, key='x')", span(e.Arg(0)))
+	assert.Equal("foo.bar", span(e.Arg(0).Arg(0)))
+	key, _ := e.Arg(0).NamedArg("key")
+	assert.Equal("key='x'", span(key))
+	assert.Equal("'y'", span(e.Arg(1)))
+
+	target = "a.b * 2 - c"
+	e, _, err = ParseExpr(target)
+	if assert.NoError(err) {
+		assert.Equal(target, span(e))
+		assert.Equal("a.b * 2", span(e.Arg(0)))
+	}
+}
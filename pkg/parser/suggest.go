@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"sort"
+	"strings"
+)
+
+// maxSuggestions is a maximum count of names returned by Suggest
+const maxSuggestions = 3
+
+// Suggest returns up to 3 candidates most similar to the name (by edit distance, case-insensitive), closest first.
+// Candidates that need more edits than a third of the name length (but at least 2) are not suggested.
+func Suggest(name string, candidates []string) []string {
+	type suggestion struct {
+		name     string
+		distance int
+	}
+
+	lowerName := strings.ToLower(name)
+	maxDistance := len(name) / 3
+	if maxDistance < 2 {
+		maxDistance = 2
+	}
+
+	var suggestions []suggestion
+	for _, c := range candidates {
+		if c == name {
+			continue
+		}
+		if d := editDistance(lowerName, strings.ToLower(c)); d <= maxDistance {
+			suggestions = append(suggestions, suggestion{name: c, distance: d})
+		}
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].distance == suggestions[j].distance {
+			return suggestions[i].name < suggestions[j].name
+		}
+		return suggestions[i].distance < suggestions[j].distance
+	})
+
+	if len(suggestions) > maxSuggestions {
+		suggestions = suggestions[:maxSuggestions]
+	}
+	res := make([]string, 0, len(suggestions))
+	for _, s := range suggestions {
+		res = append(res, s.name)
+	}
+	return res
+}
+
+// editDistance is a Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
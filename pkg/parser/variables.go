@@ -0,0 +1,245 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Variables are values of dashboard variables by name, see SubstituteVariables
+type Variables map[string][]string
+
+// variableRe matches references to variables: $name or ${name}
+var variableRe = regexp.MustCompile(`\$(?:\{([a-zA-Z_][a-zA-Z0-9_]*)\}|([a-zA-Z_][a-zA-Z0-9_]*))`)
+
+const seriesByTagPrefix = "seriesByTag("
+
+// VariableRefs returns sorted names of variables, that are referenced by metric names and strings of the expression
+func VariableRefs(e Expr) []string {
+	refs := make(map[string]struct{})
+	variableRefs(e, refs)
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func variableRefs(e Expr, refs map[string]struct{}) {
+	var s string
+	switch e.Type() {
+	case EtName:
+		s = e.Target()
+	case EtString:
+		s = e.StringValue()
+	case EtFunc:
+		for _, arg := range e.Args() {
+			variableRefs(arg, refs)
+		}
+		for _, arg := range e.NamedArgs() {
+			variableRefs(arg, refs)
+		}
+		return
+	default:
+		return
+	}
+	for _, m := range variableRe.FindAllStringSubmatch(s, -1) {
+		refs[m[1]+m[2]] = struct{}{}
+	}
+}
+
+// globMetacharacters can't be used in values of variables, as they would change globs, that values are joined to
+const globMetacharacters = ",{}*?[]"
+
+// SubstituteVariables replaces references to variables ($name or ${name}) in metric names and strings of
+// the parsed expression with their values. Variables with several values become globs ({a,b}), in tag expressions
+// of seriesByTag they become regular expressions ('host=$host' becomes 'host=~^(a|b)$'). References to unknown
+// variables are kept as they are. Expression is changed in place, text of changed calls is rebuilt from their
+// arguments, so names of series contain the values. ErrInvalidVariable is returned, if values of referenced variables
+// contain glob metacharacters.
+func SubstituteVariables(e Expr, vars Variables) (Expr, error) {
+	exp, ok := e.(*expr)
+	if !ok || len(vars) == 0 {
+		return e, nil
+	}
+	for _, name := range VariableRefs(e) {
+		for _, value := range vars[name] {
+			if strings.ContainsAny(value, globMetacharacters) {
+				return e, fmt.Errorf("%w: value %q of variable %s contains one of %s", ErrInvalidVariable, value, name, globMetacharacters)
+			}
+		}
+	}
+	substituteVariables(exp, vars)
+	return exp, nil
+}
+
+func substituteVariables(exp *expr, vars Variables) bool {
+	switch exp.etype {
+	case EtName:
+		var changed bool
+		if strings.HasPrefix(exp.target, seriesByTagPrefix) {
+			exp.target, changed = substituteSeriesByTag(exp.target, vars)
+		} else {
+			exp.target, changed = replaceVariables(exp.target, vars, globValues, nil)
+		}
+		return changed
+	case EtString:
+		var changed bool
+		exp.valStr, changed = replaceVariables(exp.valStr, vars, globValues, nil)
+		return changed
+	case EtFunc:
+	default:
+		return false
+	}
+
+	changed := false
+	for _, arg := range exp.args {
+		if substituteVariables(arg, vars) {
+			changed = true
+		}
+	}
+	for _, arg := range exp.namedArgs {
+		if substituteVariables(arg, vars) {
+			changed = true
+		}
+	}
+	if changed {
+		exp.argString = joinArgs(exp)
+	}
+	return changed
+}
+
+// joinArgs returns text of arguments of the call, named ones follow positional ones sorted by name
+func joinArgs(exp *expr) string {
+	args := make([]string, 0, len(exp.args)+len(exp.namedArgs))
+	for _, arg := range exp.args {
+		args = append(args, arg.ToString())
+	}
+	names := make([]string, 0, len(exp.namedArgs))
+	for name := range exp.namedArgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, name+"="+exp.namedArgs[name].ToString())
+	}
+	return strings.Join(args, ",")
+}
+
+// substituteSeriesByTag substitutes variables in tag expressions of seriesByTag('tag=value',...) target
+func substituteSeriesByTag(target string, vars Variables) (string, bool) {
+	_, args, _, rest, err := parseArgList(target[len(seriesByTagPrefix)-1:])
+	if err != nil || rest != "" {
+		// invalid target is reported by backends as is
+		return target, false
+	}
+
+	changed := false
+	exprs := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg.etype == EtString {
+			var argChanged bool
+			arg.valStr, argChanged = substituteTagExpr(arg.valStr, vars)
+			changed = changed || argChanged
+		}
+		exprs = append(exprs, arg.ToString())
+	}
+	if !changed {
+		return target, false
+	}
+	return seriesByTagPrefix + strings.Join(exprs, ",") + ")", true
+}
+
+// substituteTagExpr substitutes variables in the value of tag expression (tag=value, tag!=value, tag=~regex or
+// tag!=~regex). Several values of a variable turn equality to regular expression matching.
+func substituteTagExpr(s string, vars Variables) (string, bool) {
+	i := strings.IndexByte(s, '=')
+	if i < 0 {
+		return s, false
+	}
+	tag, op, value := s[:i], "=", s[i+1:]
+	if strings.HasSuffix(tag, "!") {
+		tag, op = tag[:len(tag)-1], "!="
+	}
+	if strings.HasPrefix(value, "~") {
+		op, value = op+"~", value[1:]
+	}
+
+	var changed bool
+	switch {
+	case strings.HasSuffix(op, "~"):
+		value, changed = replaceVariables(value, vars, regexValues, nil)
+	case hasSeveralValues(value, vars):
+		value, changed = replaceVariables(value, vars, regexValues, regexp.QuoteMeta)
+		op, value = op+"~", "^"+value+"$"
+	default:
+		value, changed = replaceVariables(value, vars, globValues, nil)
+	}
+	if !changed {
+		return s, false
+	}
+	return tag + op + value, true
+}
+
+// hasSeveralValues checks if any variable referenced by s doesn't have exactly one value
+func hasSeveralValues(s string, vars Variables) bool {
+	for _, m := range variableRe.FindAllStringSubmatch(s, -1) {
+		if values, ok := vars[m[1]+m[2]]; ok && len(values) != 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceVariables replaces references to known variables in s with their values formatted by format, the rest of
+// s is passed through literal, if it's set
+func replaceVariables(s string, vars Variables, format func([]string) string, literal func(string) string) (string, bool) {
+	if literal == nil {
+		literal = func(s string) string { return s }
+	}
+
+	var b strings.Builder
+	changed := false
+	last := 0
+	for _, m := range variableRe.FindAllStringSubmatchIndex(s, -1) {
+		var name string
+		if m[2] >= 0 {
+			name = s[m[2]:m[3]]
+		} else {
+			name = s[m[4]:m[5]]
+		}
+		values, ok := vars[name]
+		if !ok {
+			continue
+		}
+		b.WriteString(literal(s[last:m[0]]))
+		b.WriteString(format(values))
+		last = m[1]
+		changed = true
+	}
+	if !changed {
+		return s, false
+	}
+	b.WriteString(literal(s[last:]))
+	return b.String(), true
+}
+
+func globValues(values []string) string {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return "{" + strings.Join(values, ",") + "}"
+}
+
+func regexValues(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = regexp.QuoteMeta(v)
+	}
+	if len(quoted) == 1 {
+		return quoted[0]
+	}
+	return "(" + strings.Join(quoted, "|") + ")"
+}
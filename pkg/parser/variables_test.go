@@ -0,0 +1,118 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubstituteVariables(t *testing.T) {
+	vars := Variables{
+		"host":   {"web1"},
+		"hosts":  {"web1", "web2"},
+		"dc":     {"eu-1"},
+		"region": {"eu.west", "us"},
+	}
+
+	tests := []struct {
+		s        string
+		expected string
+		refs     []string
+	}{
+		{"servers.$host.cpu", "servers.web1.cpu", []string{"host"}},
+		{"servers.${hosts}.cpu", "servers.{web1,web2}.cpu", []string{"hosts"}},
+		{"servers.${host}_$dc.cpu", "servers.web1_eu-1.cpu", []string{"dc", "host"}},
+		{"servers.$unknown.cpu", "servers.$unknown.cpu", []string{"unknown"}},
+		{"servers.cpu", "servers.cpu", []string{}},
+		{
+			"sumSeries(servers.$hosts.cpu, servers.$host.mem)",
+			"sumSeries(servers.{web1,web2}.cpu,servers.web1.mem)",
+			[]string{"host", "hosts"},
+		},
+		{
+			// text of calls without variables is kept
+			"alias(sumSeries(servers.$host.cpu), 'cpu of $host')|scale(2,  xFilesFactor=0)",
+			"scale(alias(sumSeries(servers.web1.cpu),'cpu of web1'),2,xFilesFactor=0)",
+			[]string{"host"},
+		},
+		{
+			"sumSeries(servers.*.cpu, servers.*.mem)",
+			"sumSeries(servers.*.cpu, servers.*.mem)",
+			[]string{},
+		},
+		{
+			"seriesByTag('name=cpu', 'host=$host', 'dc!=$dc')",
+			"seriesByTag('name=cpu','host=web1','dc!=eu-1')",
+			[]string{"dc", "host"},
+		},
+		{
+			"seriesByTag('name=cpu','host=$hosts','region!=$region')",
+			`seriesByTag('name=cpu','host=~^(web1|web2)$','region!=~^(eu\\.west|us)$')`,
+			[]string{"hosts", "region"},
+		},
+		{
+			"seriesByTag('name=cpu','host=~$hosts.*','region=~${region}')",
+			`seriesByTag('name=cpu','host=~(web1|web2).*','region=~(eu\\.west|us)')`,
+			[]string{"hosts", "region"},
+		},
+		{
+			"seriesByTag('name=cpu','host=prod.$hosts')",
+			`seriesByTag('name=cpu','host=~^prod\\.(web1|web2)$')`,
+			[]string{"hosts"},
+		},
+		{
+			"seriesByTag('name=cpu','host=$unknown')",
+			"seriesByTag('name=cpu','host=$unknown')",
+			[]string{"unknown"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			e, _, err := ParseExpr(tt.s)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tt.refs, VariableRefs(e))
+			e, err = SubstituteVariables(e, vars)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.expected, e.ToString())
+			}
+		})
+	}
+}
+
+func TestSubstituteVariablesInvalid(t *testing.T) {
+	vars := Variables{
+		"host":  {"web1"},
+		"hosts": {"web1", "web2,secret"},
+		"glob":  {"*"},
+	}
+
+	tests := []struct {
+		s     string
+		valid bool
+	}{
+		{"servers.$host.cpu", true},
+		{"servers.$hosts.cpu", false},
+		{"servers.$glob.cpu", false},
+		{"seriesByTag('name=cpu','host=$hosts')", false},
+		// values of variables, that aren't referenced, aren't checked
+		{"servers.$unknown.cpu", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			e, _, err := ParseExpr(tt.s)
+			if !assert.NoError(t, err) {
+				return
+			}
+			_, err = SubstituteVariables(e, vars)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidVariable)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+// Package seriesbytag contains conformance cases for translation of graphite seriesByTag to other query languages.
+// They are shared by the tests of backend protocols.
+package seriesbytag
+
+// PromQLCase is expected PromQL selector for the seriesByTag target
+type PromQLCase struct {
+	Name   string
+	Target string
+	Query  string
+	Step   string // __step__ pseudo-tag, empty if not set
+	Err    bool
+}
+
+var PromQLCases = []PromQLCase{
+	{
+		Name:   "name only",
+		Target: "seriesByTag('name=http_requests')",
+		Query:  `http_requests`,
+	},
+	{
+		Name:   "name and equality",
+		Target: "seriesByTag('name=http_requests','job=api')",
+		Query:  `http_requests{job="api"}`,
+	},
+	{
+		Name:   "__name__ is the same as name",
+		Target: "seriesByTag('__name__=http_requests','job=api')",
+		Query:  `http_requests{job="api"}`,
+	},
+	{
+		Name:   "double quotes",
+		Target: `seriesByTag("name=http_requests", "job=api")`,
+		Query:  `http_requests{job="api"}`,
+	},
+	{
+		Name:   "name that is not a valid identifier",
+		Target: "seriesByTag('name=http.requests','job=api')",
+		Query:  `{__name__="http.requests", job="api"}`,
+	},
+	{
+		Name:   "name by regex",
+		Target: "seriesByTag('name=~http_','job=api')",
+		Query:  `{__name__=~"http_.*", job="api"}`,
+	},
+	{
+		Name:   "not equal",
+		Target: "seriesByTag('name=up','job!=api')",
+		Query:  `up{job!="api"}`,
+	},
+	{
+		Name:   "regex is anchored at the start only",
+		Target: "seriesByTag('name=up','job=~ap')",
+		Query:  `up{job=~"ap.*"}`,
+	},
+	{
+		Name:   "regex with explicit anchors",
+		Target: "seriesByTag('name=up','job=~^api$')",
+		Query:  `up{job=~"api"}`,
+	},
+	{
+		Name:   "regex with alternation",
+		Target: "seriesByTag('name=up','job=~api|web')",
+		Query:  `up{job=~"(?:api|web).*"}`,
+	},
+	{
+		Name:   "regex ending with .*",
+		Target: "seriesByTag('name=up','job=~a.*')",
+		Query:  `up{job=~"a.*"}`,
+	},
+	{
+		Name:   "not matching regex",
+		Target: "seriesByTag('name=up','job!=~ap')",
+		Query:  `up{job!~"ap.*"}`,
+	},
+	{
+		Name:   "empty value is absent tag",
+		Target: "seriesByTag('name=up','job=')",
+		Query:  `up{job=""}`,
+	},
+	{
+		Name:   "not equal to empty value is present tag",
+		Target: "seriesByTag('job!=')",
+		Query:  `{job!=""}`,
+	},
+	{
+		Name:   "multiple expressions on the same tag",
+		Target: "seriesByTag('name=up','job=~a','job!=api')",
+		Query:  `up{job=~"a.*", job!="api"}`,
+	},
+	{
+		Name:   "quotes and backslashes are escaped",
+		Target: `seriesByTag('name=up','path=C:\dir "x"','host=~web\.\d+')`,
+		Query:  `up{path="C:\\dir \"x\"", host=~"web\\.\\d+.*"}`,
+	},
+	{
+		Name:   "step pseudo-tag",
+		Target: "seriesByTag('name=up','__step__=60')",
+		Query:  `up`,
+		Step:   "60",
+	},
+	{
+		Name:   "all expressions match empty value",
+		Target: "seriesByTag('job=','env=~.*')",
+		Err:    true,
+	},
+	{
+		Name:   "invalid regex",
+		Target: "seriesByTag('name=up','job=~a(')",
+		Err:    true,
+	},
+	{
+		Name:   "expression without operator",
+		Target: "seriesByTag('name=up','job')",
+		Err:    true,
+	},
+	{
+		Name:   "unterminated quote",
+		Target: "seriesByTag('name=up)",
+		Err:    true,
+	},
+}
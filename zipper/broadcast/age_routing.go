@@ -0,0 +1,197 @@
+package broadcast
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ansel1/merry"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// WithAgeWindows enables routing of fetch requests based on retention of the child groups.
+// Map is keyed by child's name, children without window are considered to contain all the data.
+func WithAgeWindows(windows map[string]types.AgeWindow) Option {
+	return func(bg *BroadcastGroup) {
+		bg.ageWindows = nil
+		for k, w := range windows {
+			if w.IsZero() {
+				continue
+			}
+			if bg.ageWindows == nil {
+				bg.ageWindows = make(map[string]types.AgeWindow)
+			}
+			bg.ageWindows[k] = w
+		}
+	}
+}
+
+var timeNow = time.Now
+
+type ageTier struct {
+	window   types.AgeWindow
+	backends []types.BackendServer
+}
+
+type ageRoutes struct {
+	backends []types.BackendServer
+	requests map[string]*protov3.MultiFetchRequest
+	origins  pieceOrigins
+}
+
+func (r *ageRoutes) add(backend types.BackendServer, metric protov3.FetchRequest, from, until int64) {
+	req, ok := r.requests[backend.Name()]
+	if !ok {
+		req = &protov3.MultiFetchRequest{}
+		r.requests[backend.Name()] = req
+		r.backends = append(r.backends, backend)
+	}
+	r.origins.add(metric.PathExpression, from, until, metric.StartTime, metric.StopTime)
+	metric.StartTime = from
+	metric.StopTime = until
+	req.Metrics = append(req.Metrics, metric)
+}
+
+// ageTiers groups backends with identical retention, freshest tiers go first. Backends without retention are returned separately.
+func (bg *BroadcastGroup) ageTiers(backends []types.BackendServer) ([]ageTier, []types.BackendServer) {
+	var tiers []ageTier
+	var unrestricted []types.BackendServer
+	for _, backend := range backends {
+		w, ok := bg.ageWindows[backend.Name()]
+		if !ok {
+			unrestricted = append(unrestricted, backend)
+			continue
+		}
+		found := false
+		for i := range tiers {
+			if tiers[i].window == w {
+				tiers[i].backends = append(tiers[i].backends, backend)
+				found = true
+				break
+			}
+		}
+		if !found {
+			tiers = append(tiers, ageTier{window: w, backends: []types.BackendServer{backend}})
+		}
+	}
+
+	sort.SliceStable(tiers, func(i, j int) bool {
+		if tiers[i].window.MinAge != tiers[j].window.MinAge {
+			return tiers[i].window.MinAge < tiers[j].window.MinAge
+		}
+		return tiers[i].window.MaxAge < tiers[j].window.MaxAge
+	})
+
+	return tiers, unrestricted
+}
+
+// routeByAge decides what part of each metric's time range should be requested from which backend
+func (bg *BroadcastGroup) routeByAge(request *protov3.MultiFetchRequest, backends []types.BackendServer) *ageRoutes {
+	routes := &ageRoutes{
+		requests: make(map[string]*protov3.MultiFetchRequest),
+		origins:  make(pieceOrigins),
+	}
+
+	now := timeNow().Unix()
+	tiers, unrestricted := bg.ageTiers(backends)
+	for _, metric := range request.Metrics {
+		if metric.PathExpression == "" {
+			metric.PathExpression = metric.Name
+		}
+
+		for _, backend := range unrestricted {
+			routes.add(backend, metric, metric.StartTime, metric.StopTime)
+		}
+
+		if len(tiers) == 0 {
+			continue
+		}
+
+		covered := false
+		for _, tier := range tiers {
+			if tier.window.Covers(now, metric.StartTime, metric.StopTime) {
+				for _, backend := range tier.backends {
+					routes.add(backend, metric, metric.StartTime, metric.StopTime)
+				}
+				covered = true
+				break
+			}
+		}
+		if covered {
+			continue
+		}
+
+		// Split request between the tiers, starting from the freshest one
+		until := metric.StopTime
+		sent := false
+		for _, tier := range tiers {
+			if until <= metric.StartTime {
+				break
+			}
+			lo, hi := tier.window.Bounds(now)
+			pieceFrom := max(metric.StartTime, lo)
+			pieceUntil := min(until, hi)
+			if pieceFrom >= pieceUntil {
+				continue
+			}
+			for _, backend := range tier.backends {
+				routes.add(backend, metric, pieceFrom, pieceUntil)
+			}
+			sent = true
+			until = pieceFrom
+		}
+
+		// Nobody have the data for that range, let the tier with the longest retention answer
+		if !sent {
+			for _, backend := range tiers[len(tiers)-1].backends {
+				routes.add(backend, metric, metric.StartTime, metric.StopTime)
+			}
+		}
+	}
+
+	return routes
+}
+
+// doAgeRoutedRequest sends each backend only the parts of the request it have data for and stitches the pieces back together
+func (bg *BroadcastGroup) doAgeRoutedRequest(ctx context.Context, logger *zap.Logger, backends []types.BackendServer, result types.ServerFetcherResponse, request *protov3.MultiFetchRequest, fetcher types.Fetcher) (types.ServerFetcherResponse, int) {
+	routes := bg.routeByAge(request, backends)
+
+	routedBackends := make([]types.BackendServer, 0, len(routes.backends))
+	for _, backend := range routes.backends {
+		routedBackends = append(routedBackends, &pieceBackend{BackendServer: backend})
+	}
+
+	routedFetcher := func(ctx context.Context, logger *zap.Logger, backend types.BackendServer, _ interface{}, resCh chan types.ServerFetcherResponse) {
+		fetcher(ctx, logger, backend, routes.requests[backend.Name()], resCh)
+	}
+
+	if budget := types.GetFetchBudget(ctx); budget != nil {
+		// pieces of a metric are fetched from different tiers, budget is checked for the stitched ones, so a metric
+		// is counted once
+		ctx = types.WithFetchBudget(ctx, func(response *protov3.MultiFetchResponse) merry.Error {
+			return budget(&protov3.MultiFetchResponse{Metrics: routes.origins.stitch(response.Metrics)})
+		})
+	}
+
+	resultNew, responseCount := types.DoRequest(ctx, logger, routedBackends, result, request, routedFetcher)
+	if res, ok := resultNew.Self().(*types.ServerFetchResponse); ok && res.Response != nil {
+		res.Response.Metrics = routes.origins.stitch(res.Response.Metrics)
+	}
+
+	return resultNew, responseCount
+}
+
+// pieceBackend makes sure that responses carry time range of the piece they were requested for,
+// so pieces from different tiers won't be merged together.
+type pieceBackend struct {
+	types.BackendServer
+}
+
+func (b *pieceBackend) Fetch(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, merry.Error) {
+	res, stats, err := b.BackendServer.Fetch(ctx, request)
+	setPieceRanges(request, res)
+	return res, stats, err
+}
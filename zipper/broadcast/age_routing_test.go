@@ -0,0 +1,202 @@
+package broadcast
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ansel1/merry"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+
+	"github.com/go-graphite/carbonapi/zipper/dummy"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+func newAgeRoutedGroup(t *testing.T, servers []types.BackendServer) *BroadcastGroup {
+	b, err := New(
+		WithLogger(logger),
+		WithGroupName("root"),
+		WithSplitMultipleRequests(false),
+		WithBackends(servers),
+		WithPathCache(60),
+		WithTimeouts(timeouts),
+		WithTLDCache(false),
+		WithAgeWindows(map[string]types.AgeWindow{
+			"raw":    {MaxAge: 100 * time.Second},
+			"rollup": {MinAge: 80 * time.Second},
+		}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return b
+}
+
+func TestRouteByAge(t *testing.T) {
+	timeNow = func() time.Time { return time.Unix(1000, 0) }
+	defer func() { timeNow = time.Now }()
+
+	servers := []types.BackendServer{
+		dummy.NewDummyClient("raw", []string{"backend1"}, 1),
+		dummy.NewDummyClient("rollup", []string{"backend2"}, 1),
+		dummy.NewDummyClient("everything", []string{"backend3"}, 1),
+	}
+	b := newAgeRoutedGroup(t, servers)
+
+	tests := []struct {
+		name     string
+		from     int64
+		until    int64
+		expected map[string][2]int64
+	}{
+		{
+			name:  "fresh data",
+			from:  950,
+			until: 1000,
+			expected: map[string][2]int64{
+				"raw":        {950, 1000},
+				"everything": {950, 1000},
+			},
+		},
+		{
+			name:  "old data",
+			from:  100,
+			until: 900,
+			expected: map[string][2]int64{
+				"rollup":     {100, 900},
+				"everything": {100, 900},
+			},
+		},
+		{
+			name:  "spans both windows",
+			from:  800,
+			until: 1000,
+			expected: map[string][2]int64{
+				"raw":        {900, 1000},
+				"rollup":     {800, 900},
+				"everything": {800, 1000},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routes := b.routeByAge(&protov3.MultiFetchRequest{
+				Metrics: []protov3.FetchRequest{{Name: "foo", PathExpression: "foo", StartTime: tt.from, StopTime: tt.until}},
+			}, b.Children())
+
+			if len(routes.requests) != len(tt.expected) {
+				t.Fatalf("unexpected amount of routed backends %v, expected %v", len(routes.requests), len(tt.expected))
+			}
+			for name, r := range tt.expected {
+				req, ok := routes.requests[name]
+				if !ok {
+					t.Fatalf("backend %v didn't get request", name)
+				}
+				if len(req.Metrics) != 1 || req.Metrics[0].StartTime != r[0] || req.Metrics[0].StopTime != r[1] {
+					t.Errorf("backend %v got %+v, expected range %v", name, req.Metrics, r)
+				}
+			}
+		})
+	}
+}
+
+// newTieredClients returns backends with pieces of metric foo, that is requested for 800-1000 at 1000
+func newTieredClients() []types.BackendServer {
+	raw := dummy.NewDummyClient("raw", []string{"backend1"}, 1)
+	rollup := dummy.NewDummyClient("rollup", []string{"backend2"}, 1)
+	raw.AddFetchResponse(
+		&protov3.MultiFetchRequest{Metrics: []protov3.FetchRequest{{Name: "foo", StartTime: 900, StopTime: 1000}}},
+		&protov3.MultiFetchResponse{Metrics: []protov3.FetchResponse{{
+			Name:              "foo",
+			PathExpression:    "foo",
+			ConsolidationFunc: "avg",
+			StartTime:         900,
+			StopTime:          1000,
+			StepTime:          10,
+			Values:            []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+		}}},
+		&types.Stats{}, nil,
+	)
+	rollup.AddFetchResponse(
+		&protov3.MultiFetchRequest{Metrics: []protov3.FetchRequest{{Name: "foo", StartTime: 800, StopTime: 900}}},
+		&protov3.MultiFetchResponse{Metrics: []protov3.FetchResponse{{
+			Name:              "foo",
+			PathExpression:    "foo",
+			ConsolidationFunc: "avg",
+			StartTime:         800,
+			StopTime:          900,
+			StepTime:          50,
+			Values:            []float64{100, math.NaN()},
+		}}},
+		&types.Stats{}, nil,
+	)
+	return []types.BackendServer{raw, rollup}
+}
+
+func TestFetchAgeRoutedStitching(t *testing.T) {
+	timeNow = func() time.Time { return time.Unix(1000, 0) }
+	defer func() { timeNow = time.Now }()
+
+	b := newAgeRoutedGroup(t, newTieredClients())
+	res, _, err := b.Fetch(context.Background(), &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{Name: "foo", PathExpression: "foo", StartTime: 800, StopTime: 1000}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if len(res.Metrics) != 1 {
+		t.Fatalf("unexpected amount of metrics %v, expected 1", len(res.Metrics))
+	}
+	m := res.Metrics[0]
+	if m.StartTime != 800 || m.StopTime != 1000 || m.StepTime != 50 {
+		t.Errorf("unexpected start/stop/step %v/%v/%v, expected 800/1000/50", m.StartTime, m.StopTime, m.StepTime)
+	}
+	if m.RequestStartTime != 800 || m.RequestStopTime != 1000 {
+		t.Errorf("unexpected request range %v-%v, expected 800-1000", m.RequestStartTime, m.RequestStopTime)
+	}
+	expected := []float64{100, math.NaN(), 3, 8}
+	if len(m.Values) != len(expected) {
+		t.Fatalf("unexpected values %v, expected %v", m.Values, expected)
+	}
+	for i := range expected {
+		if m.Values[i] != expected[i] && !(math.IsNaN(m.Values[i]) && math.IsNaN(expected[i])) {
+			t.Fatalf("unexpected values %v, expected %v", m.Values, expected)
+		}
+	}
+}
+
+func TestFetchAgeRoutedBudget(t *testing.T) {
+	timeNow = func() time.Time { return time.Unix(1000, 0) }
+	defer func() { timeNow = time.Now }()
+
+	// foo crosses the tier boundary, so it is fetched as two pieces and must be counted as one series
+	var series, datapoints int
+	ctx := types.WithFetchBudget(context.Background(), func(response *protov3.MultiFetchResponse) merry.Error {
+		series, datapoints = len(response.Metrics), 0
+		for _, m := range response.Metrics {
+			datapoints += len(m.Values)
+		}
+		if series > 1 {
+			return merry.Errorf("limit exceeded: fetched %d series", series)
+		}
+		return nil
+	})
+
+	b := newAgeRoutedGroup(t, newTieredClients())
+	res, _, err := b.Fetch(ctx, &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{Name: "foo", PathExpression: "foo", StartTime: 800, StopTime: 1000}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(res.Metrics) != 1 {
+		t.Fatalf("unexpected amount of metrics %v, expected 1", len(res.Metrics))
+	}
+	if series != 1 || datapoints != len(res.Metrics[0].Values) {
+		t.Errorf("budget was checked for %d series with %d datapoints, expected 1 series with %d datapoints",
+			series, datapoints, len(res.Metrics[0].Values))
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"net"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/ansel1/merry"
 	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
@@ -14,7 +16,9 @@ import (
 	"github.com/go-graphite/carbonapi/limiter"
 	"github.com/go-graphite/carbonapi/pathcache"
 	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+	"github.com/go-graphite/carbonapi/zipper/divergence"
 	"github.com/go-graphite/carbonapi/zipper/helper"
+	"github.com/go-graphite/carbonapi/zipper/routing"
 	"github.com/go-graphite/carbonapi/zipper/types"
 
 	"go.uber.org/zap"
@@ -31,11 +35,23 @@ type BroadcastGroup struct {
 	tldCacheDisabled          bool
 	concurrencyLimit          int
 	requireSuccessAll         bool
+	ageWindows                map[string]types.AgeWindow
+	sliceWindows              map[string]int64
+	sliceConcurrency          int
+	mergeStrategy             types.MergeStrategy
+	replicas                  bool
+	divergence                *divergence.Tracker
+	router                    *routing.Router
 
 	fetcher   types.Fetcher
 	pathCache pathcache.PathCache
 	logger    *zap.Logger
 	dialer    *net.Dialer
+
+	// backends and servers are replaced by UpdateBackends if group is dynamic
+	mu           sync.RWMutex
+	dynamic      bool
+	drainTimeout time.Duration
 }
 
 type Option func(group *BroadcastGroup)
@@ -119,6 +135,37 @@ func WithSuccess(requireSuccessAll bool) Option {
 	}
 }
 
+// WithMergeStrategy sets how responses from different children for the same metric are merged
+func WithMergeStrategy(strategy types.MergeStrategy) Option {
+	return func(bg *BroadcastGroup) {
+		bg.mergeStrategy = strategy
+	}
+}
+
+// WithReplicas marks backends of the group as replicas that store the same data. Only such groups could push down
+// functions to the backends, as results of other groups are merged, not evaluated over the whole set of series.
+func WithReplicas(replicas bool) Option {
+	return func(bg *BroadcastGroup) {
+		bg.replicas = replicas
+	}
+}
+
+// WithDynamicBackends allows to add and remove backends at runtime with UpdateBackends. Requests in flight to
+// removed backends are waited for at most drainTimeout.
+func WithDynamicBackends(drainTimeout time.Duration) Option {
+	return func(bg *BroadcastGroup) {
+		bg.dynamic = true
+		bg.drainTimeout = drainTimeout
+	}
+}
+
+// WithRouter sets static routing rules, that are evaluated before TLD-based routing
+func WithRouter(router *routing.Router) Option {
+	return func(bg *BroadcastGroup) {
+		bg.router = router
+	}
+}
+
 func New(opts ...Option) (*BroadcastGroup, merry.Error) {
 	bg := &BroadcastGroup{
 		limiter: limiter.NoopLimiter{},
@@ -139,7 +186,9 @@ func New(opts ...Option) (*BroadcastGroup, merry.Error) {
 		return nil, types.ErrNoServersSpecified
 	}
 
-	if bg.concurrencyLimit != 0 {
+	if bg.dynamic {
+		bg.limiter = limiter.NewDynamicServerLimiter(bg.concurrencyLimit)
+	} else if bg.concurrencyLimit != 0 {
 		bg.limiter = limiter.NewServerLimiter(bg.servers, bg.concurrencyLimit)
 	}
 
@@ -147,9 +196,44 @@ func New(opts ...Option) (*BroadcastGroup, merry.Error) {
 }
 
 func (bg *BroadcastGroup) Children() []types.BackendServer {
+	bg.mu.RLock()
+	defer bg.mu.RUnlock()
 	return bg.backends
 }
 
+// PushdownFunctions returns functions that could be evaluated by the backends of the group. Group with several
+// backends supports only functions common to all of them and only if they are replicas: responses are merged,
+// so partial results of the shards would be wrong. Backends with time sliced requests don't support pushdown.
+func (bg *BroadcastGroup) PushdownFunctions() []string {
+	children := bg.Children()
+	if len(children) > 1 && !bg.replicas {
+		return nil
+	}
+
+	var res []string
+	for i, b := range children {
+		if _, ok := bg.sliceWindows[b.Name()]; ok {
+			return nil
+		}
+		funcs := types.PushdownFunctions(b)
+		if i == 0 {
+			res = funcs
+			continue
+		}
+		common := make([]string, 0, len(res))
+		for _, f := range res {
+			for _, f2 := range funcs {
+				if f == f2 {
+					common = append(common, f)
+					break
+				}
+			}
+		}
+		res = common
+	}
+	return res
+}
+
 func (bg *BroadcastGroup) SetDoMultipleRequestIfSplit(v bool) {
 	bg.doMultipleRequestsIfSplit = v
 	if v {
@@ -174,11 +258,13 @@ func NewBroadcastGroup(logger *zap.Logger, groupName string, doMultipleRequestsI
 	)
 }
 
-func (bg BroadcastGroup) Name() string {
+func (bg *BroadcastGroup) Name() string {
 	return bg.groupName
 }
 
-func (bg BroadcastGroup) Backends() []string {
+func (bg *BroadcastGroup) Backends() []string {
+	bg.mu.RLock()
+	defer bg.mu.RUnlock()
 	return bg.servers
 }
 
@@ -219,7 +305,53 @@ func (bg *BroadcastGroup) filterServersByTLD(requests []string, backends []types
 	return filteredBackends
 }
 
-func (bg BroadcastGroup) MaxMetricsPerRequest() int {
+func filterServersByGroups(groups map[string]struct{}, backends []types.BackendServer) []types.BackendServer {
+	var filteredBackends []types.BackendServer
+	for _, k := range backends {
+		if _, ok := groups[k.Name()]; ok {
+			filteredBackends = append(filteredBackends, k)
+		}
+	}
+
+	return filteredBackends
+}
+
+// filterServersByRules returns backends selected by static routing rules, second value is false if rules are not applicable to the requests
+func (bg *BroadcastGroup) filterServersByRules(requests []string, backends []types.BackendServer) ([]types.BackendServer, bool) {
+	groups, ok := bg.router.Groups(requests)
+	if !ok {
+		return backends, false
+	}
+
+	filteredBackends := filterServersByGroups(groups, backends)
+	if len(filteredBackends) == 0 {
+		return backends, false
+	}
+
+	return filteredBackends, true
+}
+
+// filterServersByTagRules returns backends selected by static routing rules for tag autocomplete query
+func (bg *BroadcastGroup) filterServersByTagRules(query string, backends []types.BackendServer) []types.BackendServer {
+	rule := bg.router.MatchTagQuery(query)
+	if rule == nil {
+		return backends
+	}
+
+	groups := make(map[string]struct{}, len(rule.Groups))
+	for _, g := range rule.Groups {
+		groups[g] = struct{}{}
+	}
+
+	filteredBackends := filterServersByGroups(groups, backends)
+	if len(filteredBackends) == 0 {
+		return backends
+	}
+
+	return filteredBackends
+}
+
+func (bg *BroadcastGroup) MaxMetricsPerRequest() int {
 	return bg.maxMetricsPerRequest
 }
 
@@ -494,14 +626,34 @@ func (bg *BroadcastGroup) Fetch(ctx context.Context, request *protov3.MultiFetch
 	logger := bg.logger.With(zap.String("type", "fetch"), zap.Strings("request", requestNames), zap.String("carbonapi_uuid", utilctx.GetUUID(ctx)))
 	logger.Debug("will try to fetch data")
 
-	backends := bg.filterServersByTLD(requestNames, bg.Children())
+	backends, routed := bg.filterServersByRules(requestNames, bg.Children())
+	if !routed {
+		backends = bg.filterServersByTLD(requestNames, backends)
+	}
 
 	result := types.NewServerFetchResponse()
+	result.MergeStrategy = bg.mergeStrategy
 
 	ctxNew, cancel := context.WithTimeout(ctx, bg.timeout.Render)
 	defer cancel()
 
-	resultNew, responseCount := types.DoRequest(ctxNew, logger, backends, result, request, bg.fetcher)
+	sample := bg.divergence.Sample()
+	if sample != nil {
+		backends = sampledBackends(backends, sample)
+	}
+
+	fetcher := bg.fetcher
+	if len(bg.sliceWindows) > 0 {
+		fetcher = bg.doTimeSlicedFetch
+	}
+
+	var resultNew types.ServerFetcherResponse
+	var responseCount int
+	if len(bg.ageWindows) > 0 {
+		resultNew, responseCount = bg.doAgeRoutedRequest(ctxNew, logger, backends, result, request, fetcher)
+	} else {
+		resultNew, responseCount = types.DoRequest(ctxNew, logger, backends, result, request, fetcher)
+	}
 
 	result, ok := resultNew.Self().(*types.ServerFetchResponse)
 	if !ok {
@@ -512,6 +664,10 @@ func (bg *BroadcastGroup) Fetch(ctx context.Context, request *protov3.MultiFetch
 		)
 	}
 
+	if sample != nil {
+		result.Stats.ReplicaDivergences = append(result.Stats.ReplicaDivergences, bg.divergence.Compare(sample)...)
+	}
+
 	if len(result.Response.Metrics) == 0 || (bg.requireSuccessAll && len(result.Err) > 0) {
 		code, errors := helper.MergeHttpErrors(result.Err)
 		if len(errors) > 0 {
@@ -603,7 +759,7 @@ func (bg *BroadcastGroup) doFind(ctx context.Context, logger *zap.Logger, backen
 func (bg *BroadcastGroup) Find(ctx context.Context, request *protov3.MultiGlobRequest) (*protov3.MultiGlobResponse, *types.Stats, merry.Error) {
 	logger := bg.logger.With(zap.String("type", "find"), zap.Strings("request", request.Metrics))
 
-	backends := bg.Children()
+	backends, _ := bg.filterServersByRules(request.Metrics, bg.Children())
 
 	logger.Debug("will do query with timeout",
 		zap.Any("backends", backends),
@@ -704,7 +860,7 @@ func (bg *BroadcastGroup) Info(ctx context.Context, request *protov3.MultiMetric
 
 	ctxNew, cancel := context.WithTimeout(ctx, bg.timeout.Render)
 	defer cancel()
-	backends := bg.Children()
+	backends, _ := bg.filterServersByRules(request.Names, bg.Children())
 	result := types.NewServerInfoResponse()
 	result.Server = bg.Name()
 	result.Stats.ZipperRequests = uint64(len(backends))
@@ -818,7 +974,7 @@ func (bg *BroadcastGroup) tagEverything(ctx context.Context, isTagName bool, que
 	ctxNew, cancel := context.WithTimeout(ctx, bg.timeout.Find)
 	defer cancel()
 
-	backends := bg.Children()
+	backends := bg.filterServersByTagRules(query, bg.Children())
 	result := types.NewServerTagResponse()
 	result.Server = bg.Name()
 
@@ -1170,3 +1170,129 @@ func TestFetchRequests(t *testing.T) {
 		})
 	}
 }
+
+// pushdownClient is a dummy client that advertises pushdown functions
+type pushdownClient struct {
+	*dummy.DummyClient
+	functions []string
+}
+
+func (c pushdownClient) PushdownFunctions() []string {
+	return c.functions
+}
+
+func TestPushdownFunctions(t *testing.T) {
+	tests := []struct {
+		name         string
+		servers      []types.BackendServer
+		replicas     bool
+		sliceWindows map[string]time.Duration
+		want         []string
+	}{
+		{
+			name: "common functions of replicas",
+			servers: []types.BackendServer{
+				pushdownClient{dummy.NewDummyClient("client1", []string{"backend1"}, 0), []string{"sumSeries", "scale", "maxSeries"}},
+				pushdownClient{dummy.NewDummyClient("client2", []string{"backend2"}, 0), []string{"maxSeries", "sumSeries"}},
+			},
+			replicas: true,
+			want:     []string{"sumSeries", "maxSeries"},
+		},
+		{
+			name: "replica without pushdown",
+			servers: []types.BackendServer{
+				pushdownClient{dummy.NewDummyClient("client1", []string{"backend1"}, 0), []string{"sumSeries"}},
+				dummy.NewDummyClient("client2", []string{"backend2"}, 0),
+			},
+			replicas: true,
+			want:     []string{},
+		},
+		{
+			name: "shards",
+			servers: []types.BackendServer{
+				pushdownClient{dummy.NewDummyClient("client1", []string{"backend1"}, 0), []string{"sumSeries"}},
+				pushdownClient{dummy.NewDummyClient("client2", []string{"backend2"}, 0), []string{"sumSeries"}},
+			},
+			want: nil,
+		},
+		{
+			name: "single backend",
+			servers: []types.BackendServer{
+				pushdownClient{dummy.NewDummyClient("client1", []string{"backend1"}, 0), []string{"sumSeries"}},
+			},
+			want: []string{"sumSeries"},
+		},
+		{
+			name: "time sliced backend",
+			servers: []types.BackendServer{
+				pushdownClient{dummy.NewDummyClient("client1", []string{"backend1"}, 0), []string{"sumSeries"}},
+			},
+			sliceWindows: map[string]time.Duration{"client1": time.Hour},
+			want:         nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := New(
+				WithLogger(logger),
+				WithGroupName(tt.name),
+				WithSplitMultipleRequests(true),
+				WithBackends(tt.servers),
+				WithPathCache(60),
+				WithLimiter(500),
+				WithMaxMetricsPerRequest(100),
+				WithTimeouts(timeouts),
+				WithReplicas(tt.replicas),
+				WithTimeSliceWindows(tt.sliceWindows),
+			)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if got := b.PushdownFunctions(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchBudget(t *testing.T) {
+	request := &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{Name: "foo", StartTime: 0, StopTime: 120, PathExpression: "foo"}},
+	}
+	fast := dummy.NewDummyClient("client1", []string{"backend1"}, 1)
+	fast.AddFetchResponse(request, &protov3.MultiFetchResponse{
+		Metrics: []protov3.FetchResponse{{Name: "foo", PathExpression: "foo", StartTime: 0, StopTime: 120, StepTime: 60, Values: []float64{0, 1}}},
+	}, &types.Stats{}, nil)
+	slow := dummy.NewDummyClientWithTimeout("client2", []string{"backend2"}, 1, 5*time.Second)
+
+	b, err := New(
+		WithLogger(logger),
+		WithGroupName("budget"),
+		WithSplitMultipleRequests(false),
+		WithBackends([]types.BackendServer{fast, slow}),
+		WithPathCache(60),
+		WithLimiter(500),
+		WithMaxMetricsPerRequest(100),
+		WithTimeouts(timeouts),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	exceeded := merry.New("budget exceeded")
+	ctx := types.WithFetchBudget(context.Background(), func(response *protov3.MultiFetchResponse) merry.Error {
+		if len(response.Metrics) > 0 {
+			return exceeded
+		}
+		return nil
+	})
+	start := time.Now()
+	_, _, err = b.Fetch(ctx, request)
+	if err == nil {
+		t.Error("expected error")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("fetch wasn't stopped when budget was exceeded, took %v", d)
+	}
+}
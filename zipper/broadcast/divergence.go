@@ -0,0 +1,41 @@
+package broadcast
+
+import (
+	"context"
+
+	"github.com/ansel1/merry"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+
+	"github.com/go-graphite/carbonapi/zipper/divergence"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// WithDivergenceTracker enables comparison of children responses for a share of fetch requests
+func WithDivergenceTracker(tracker *divergence.Tracker) Option {
+	return func(bg *BroadcastGroup) {
+		bg.divergence = tracker
+	}
+}
+
+// sampledBackend saves responses of the backend to the sample, so they can be compared with other replicas before merge
+type sampledBackend struct {
+	types.BackendServer
+	sample *divergence.Sample
+}
+
+func (b *sampledBackend) Fetch(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, merry.Error) {
+	res, stats, err := b.BackendServer.Fetch(ctx, request)
+	if res != nil {
+		setPieceRanges(request, res)
+		b.sample.Add(b.Name(), res.Metrics)
+	}
+	return res, stats, err
+}
+
+func sampledBackends(backends []types.BackendServer, sample *divergence.Sample) []types.BackendServer {
+	res := make([]types.BackendServer, 0, len(backends))
+	for _, backend := range backends {
+		res = append(res, &sampledBackend{BackendServer: backend, sample: sample})
+	}
+	return res
+}
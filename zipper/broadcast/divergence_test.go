@@ -0,0 +1,73 @@
+package broadcast
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+
+	"github.com/go-graphite/carbonapi/zipper/divergence"
+	"github.com/go-graphite/carbonapi/zipper/dummy"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+func TestFetchReplicaDivergence(t *testing.T) {
+	request := &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{Name: "foo.bar", PathExpression: "foo.bar", StartTime: 0, StopTime: 30}},
+	}
+
+	var clients []types.BackendServer
+	for name, values := range map[string][]float64{
+		"client1": {1, 2, 3},
+		"client2": {1, math.NaN(), 3},
+	} {
+		client := dummy.NewDummyClient(name, []string{name}, 1)
+		client.AddFetchResponse(request, &protov3.MultiFetchResponse{Metrics: []protov3.FetchResponse{{
+			Name:              "foo.bar",
+			PathExpression:    "foo.bar",
+			ConsolidationFunc: "avg",
+			StartTime:         0,
+			StopTime:          30,
+			StepTime:          10,
+			Values:            values,
+		}}}, &types.Stats{}, nil)
+		clients = append(clients, client)
+	}
+
+	tracker := divergence.New(types.DivergenceConfig{SampleRate: 1})
+	b, err := New(
+		WithLogger(logger),
+		WithGroupName("replicas"),
+		WithSplitMultipleRequests(false),
+		WithBackends(clients),
+		WithPathCache(60),
+		WithLimiter(2),
+		WithTimeouts(timeouts),
+		WithTLDCache(false),
+		WithDivergenceTracker(tracker),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	res, stats, err := b.Fetch(context.Background(), request)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if len(res.Metrics) != 1 || !reflect.DeepEqual(res.Metrics[0].Values, []float64{1, 2, 3}) {
+		t.Errorf("unexpected response %+v", res.Metrics)
+	}
+
+	expected := []types.ReplicaDivergence{{Server: "client2", Prefix: "foo", Points: 1}}
+	if !reflect.DeepEqual(stats.ReplicaDivergences, expected) {
+		t.Errorf("got divergences %+v, expected %+v", stats.ReplicaDivergences, expected)
+	}
+
+	recent := tracker.Recent()
+	if len(recent) != 1 || recent[0].Name != "foo.bar" {
+		t.Errorf("unexpected recent metrics %+v", recent)
+	}
+}
@@ -0,0 +1,115 @@
+package broadcast
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/limiter"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// UpdateBackends adds and removes backends of the dynamic group. Added backends are probed for top-level domains,
+// removed backends are dropped from the path cache and requests in flight to them are allowed to finish, their
+// idle connections are closed after that.
+func (bg *BroadcastGroup) UpdateBackends(added []types.BackendServer, removed []string) {
+	logger := bg.logger.With(zap.String("function", "UpdateBackends"))
+	if !bg.dynamic {
+		logger.Error("group doesn't support dynamic backends")
+		return
+	}
+
+	removedSet := make(map[string]struct{}, len(removed))
+	for _, name := range removed {
+		removedSet[name] = struct{}{}
+	}
+
+	bg.mu.Lock()
+	backends := make([]types.BackendServer, 0, len(bg.backends)+len(added))
+	removedBackends := make([]types.BackendServer, 0, len(removed))
+	for _, b := range bg.backends {
+		if _, ok := removedSet[b.Name()]; ok {
+			removedBackends = append(removedBackends, b)
+		} else {
+			backends = append(backends, b)
+		}
+	}
+	backends = append(backends, added...)
+	servers := make([]string, 0, len(backends))
+	for _, b := range backends {
+		servers = append(servers, b.Name())
+	}
+	bg.backends = backends
+	bg.servers = servers
+	bg.mu.Unlock()
+
+	addedNames := make([]string, 0, len(added))
+	for _, b := range added {
+		addedNames = append(addedNames, b.Name())
+	}
+	logger.Info("backends changed",
+		zap.Strings("added", addedNames),
+		zap.Strings("removed", removed),
+		zap.Strings("servers", servers),
+	)
+
+	if len(removedSet) > 0 {
+		bg.pathCache.RemoveBackends(removedSet)
+		for _, b := range removedBackends {
+			go bg.drain(b)
+		}
+	}
+
+	if !bg.tldCacheDisabled {
+		for _, b := range added {
+			go bg.probeBackend(b)
+		}
+	}
+}
+
+// drain waits for requests in flight to the removed backend and closes its idle connections
+func (bg *BroadcastGroup) drain(b types.BackendServer) {
+	defer types.CloseIdleConnections(b)
+
+	l, ok := bg.limiter.(*limiter.DynamicLimiter)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), bg.drainTimeout)
+	defer cancel()
+
+	name := b.Name()
+	start := time.Now()
+	if err := l.Drain(ctx, name); err != nil {
+		bg.logger.Warn("requests to removed backend are still in flight",
+			zap.String("backend", name),
+			zap.Int64("in_flight", l.InFlight(name)),
+			zap.Duration("drain_timeout", bg.drainTimeout),
+		)
+		return
+	}
+	bg.logger.Debug("removed backend drained",
+		zap.String("backend", name),
+		zap.Duration("runtime", time.Since(start)),
+	)
+}
+
+// probeBackend adds top-level domains of the new backend to the path cache
+func (bg *BroadcastGroup) probeBackend(b types.BackendServer) {
+	ctx, cancel := context.WithTimeout(context.Background(), bg.timeout.Find)
+	defer cancel()
+
+	tlds, err := b.ProbeTLDs(ctx)
+	if err != nil {
+		bg.logger.Warn("failed to probe new backend",
+			zap.String("backend", b.Name()),
+			zap.Error(err),
+		)
+		return
+	}
+	for _, tld := range tlds {
+		bg.pathCache.Add(tld, b)
+	}
+}
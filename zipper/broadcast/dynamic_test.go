@@ -0,0 +1,80 @@
+package broadcast
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/zipper/dummy"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+func backendNames(backends []types.BackendServer) []string {
+	res := make([]string, 0, len(backends))
+	for _, b := range backends {
+		res = append(res, b.Name())
+	}
+	sort.Strings(res)
+	return res
+}
+
+func TestUpdateBackends(t *testing.T) {
+	client1 := dummy.NewDummyClient("client1", []string{"backend1"}, 1)
+	client1.SetTLDResponse(dummy.ProbeResponse{Response: []string{"a", "b"}})
+	client2 := dummy.NewDummyClient("client2", []string{"backend2"}, 1)
+	client2.SetTLDResponse(dummy.ProbeResponse{Response: []string{"a", "c"}})
+	client3 := dummy.NewDummyClient("client3", []string{"backend3"}, 1)
+	client3.SetTLDResponse(dummy.ProbeResponse{Response: []string{"a", "d"}})
+
+	bg, err := New(
+		WithLogger(logger),
+		WithGroupName("dynamic"),
+		WithBackends([]types.BackendServer{client1, client2}),
+		WithPathCache(60),
+		WithLimiter(10),
+		WithTimeouts(timeouts),
+		WithTLDCache(true),
+		WithDynamicBackends(time.Second),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if _, err := bg.ProbeTLDs(context.Background()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	bg.UpdateBackends([]types.BackendServer{client3}, []string{"client2"})
+
+	if got, want := bg.Backends(), []string{"client1", "client3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got backends %v, expected %v", got, want)
+	}
+	if got, want := backendNames(bg.Children()), []string{"client1", "client3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got children %v, expected %v", got, want)
+	}
+
+	if cached, _ := bg.pathCache.Get("c"); len(cached) != 0 {
+		t.Errorf("removed backend is still cached: %v", backendNames(cached))
+	}
+
+	// new backend is probed in background
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cached, _ := bg.pathCache.Get("a")
+		names := backendNames(cached)
+		if reflect.DeepEqual(names, []string{"client1", "client3"}) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got cached backends for 'a' %v, expected [client1 client3]", names)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	got := backendNames(bg.filterServersByTLD([]string{"d.metric"}, bg.Children()))
+	if want := []string{"client3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got backends for 'd.metric' %v, expected %v", got, want)
+	}
+}
@@ -0,0 +1,93 @@
+package broadcast
+
+import (
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// piece identifies part of the fetch request, that was split by time
+type piece struct {
+	pathExpression string
+	from           int64
+	until          int64
+}
+
+// pieceOrigins maps every piece that was sent to backends to the original request's time range
+type pieceOrigins map[piece]piece
+
+func (o pieceOrigins) add(pathExpression string, from, until, origFrom, origUntil int64) {
+	o[piece{pathExpression: pathExpression, from: from, until: until}] = piece{pathExpression: pathExpression, from: origFrom, until: origUntil}
+}
+
+type stitchKey struct {
+	name   string
+	origin piece
+}
+
+// stitch combines pieces of the same metric back together, metrics that are not pieces are returned as is
+func (o pieceOrigins) stitch(metrics []protov3.FetchResponse) []protov3.FetchResponse {
+	idx := make(map[stitchKey]int)
+	var keys []stitchKey
+	var pieces [][]protov3.FetchResponse
+	var res []protov3.FetchResponse
+
+	for _, m := range metrics {
+		origin, ok := o[piece{pathExpression: m.PathExpression, from: m.RequestStartTime, until: m.RequestStopTime}]
+		if !ok {
+			res = append(res, m)
+			continue
+		}
+		key := stitchKey{name: m.Name, origin: origin}
+		i, ok := idx[key]
+		if !ok {
+			i = len(pieces)
+			idx[key] = i
+			keys = append(keys, key)
+			pieces = append(pieces, nil)
+		}
+		pieces[i] = append(pieces[i], m)
+	}
+
+	for i := range pieces {
+		m := types.StitchFetchResponses(pieces[i])
+		m.RequestStartTime = keys[i].origin.from
+		m.RequestStopTime = keys[i].origin.until
+		res = append(res, m)
+	}
+
+	return res
+}
+
+// setPieceRanges makes sure that responses carry time range of the piece they were requested for,
+// as not all the backends fill RequestStartTime and RequestStopTime.
+func setPieceRanges(request *protov3.MultiFetchRequest, res *protov3.MultiFetchResponse) {
+	if res == nil {
+		return
+	}
+
+	ranges := make(map[string][]piece)
+	for _, m := range request.Metrics {
+		ranges[m.PathExpression] = append(ranges[m.PathExpression], piece{from: m.StartTime, until: m.StopTime})
+	}
+
+	for i := range res.Metrics {
+		m := &res.Metrics[i]
+		candidates := ranges[m.PathExpression]
+		if len(candidates) == 0 {
+			continue
+		}
+		matched := candidates[0]
+		for _, c := range candidates {
+			if c.from == m.RequestStartTime && c.until == m.RequestStopTime {
+				matched = c
+				break
+			}
+			if m.StartTime >= c.from && m.StartTime <= c.until {
+				matched = c
+			}
+		}
+		m.RequestStartTime = matched.from
+		m.RequestStopTime = matched.until
+	}
+}
@@ -0,0 +1,168 @@
+package broadcast
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ansel1/merry"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// WithTimeSliceWindows enables splitting of long fetch requests into parallel requests by time.
+// Map is keyed by child's name, value is the longest time range that would be sent in a single request.
+func WithTimeSliceWindows(windows map[string]time.Duration) Option {
+	return func(bg *BroadcastGroup) {
+		bg.sliceWindows = nil
+		for k, w := range windows {
+			if w < time.Second {
+				continue
+			}
+			if bg.sliceWindows == nil {
+				bg.sliceWindows = make(map[string]int64)
+			}
+			bg.sliceWindows[k] = int64(w / time.Second)
+		}
+	}
+}
+
+// defaultSliceConcurrency is the amount of slices of a single request that are fetched at the same time, if not set explicitly
+const defaultSliceConcurrency = 4
+
+// WithTimeSliceConcurrency limits the amount of slices of a single request that are fetched in parallel.
+func WithTimeSliceConcurrency(concurrency int) Option {
+	return func(bg *BroadcastGroup) {
+		bg.sliceConcurrency = concurrency
+	}
+}
+
+// sliceRequests splits every metric in requests to pieces that are not longer than window. Slices are aligned to window.
+func sliceRequests(requests []*protov3.MultiFetchRequest, window int64) ([]*protov3.MultiFetchRequest, pieceOrigins) {
+	origins := make(pieceOrigins)
+	var slices []*protov3.MultiFetchRequest
+	for _, req := range requests {
+		// i-th slice of every metric from the request goes to the same sub-request
+		var reqSlices []*protov3.MultiFetchRequest
+		for _, metric := range req.Metrics {
+			if metric.PathExpression == "" {
+				metric.PathExpression = metric.Name
+			}
+			if metric.StopTime-metric.StartTime <= window {
+				if len(reqSlices) == 0 {
+					reqSlices = append(reqSlices, &protov3.MultiFetchRequest{})
+				}
+				reqSlices[0].Metrics = append(reqSlices[0].Metrics, metric)
+				continue
+			}
+
+			i := 0
+			for from := metric.StartTime; from < metric.StopTime; i++ {
+				until := min(from-from%window+window, metric.StopTime)
+				if i == len(reqSlices) {
+					reqSlices = append(reqSlices, &protov3.MultiFetchRequest{})
+				}
+				m := metric
+				m.StartTime = from
+				m.StopTime = until
+				reqSlices[i].Metrics = append(reqSlices[i].Metrics, m)
+				origins.add(metric.PathExpression, from, until, metric.StartTime, metric.StopTime)
+				from = until
+			}
+		}
+		slices = append(slices, reqSlices...)
+	}
+
+	return slices, origins
+}
+
+// doTimeSlicedFetch fetches long requests in parallel slices, that are stitched back together before they are returned
+func (bg *BroadcastGroup) doTimeSlicedFetch(ctx context.Context, logger *zap.Logger, backend types.BackendServer, reqs interface{}, resCh chan types.ServerFetcherResponse) {
+	window, ok := bg.sliceWindows[backend.Name()]
+	if !ok {
+		bg.fetcher(ctx, logger, backend, reqs, resCh)
+		return
+	}
+
+	logger = logger.With(zap.Bool("time_sliced_fetch", true), zap.String("backend_name", backend.Name()))
+	request, ok := reqs.(*protov3.MultiFetchRequest)
+	if !ok {
+		logger.Fatal("unhandled error in doTimeSlicedFetch",
+			zap.Stack("stack"),
+			zap.String("got_type", fmt.Sprintf("%T", reqs)),
+			zap.String("expected_type", fmt.Sprintf("%T", request)),
+		)
+	}
+
+	response := types.NewServerFetchResponse()
+	response.Server = backend.Name()
+
+	requests, splitErr := bg.splitRequest(ctx, request, backend)
+	response.AddError(splitErr)
+	if len(requests) == 0 {
+		resCh <- response
+		return
+	}
+
+	slices, origins := sliceRequests(requests, window)
+
+	concurrency := bg.sliceConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultSliceConcurrency
+	}
+	concurrency = min(concurrency, len(slices))
+
+	logger.Debug("sending time sliced requests",
+		zap.Int64("window", window),
+		zap.Int("slices", len(slices)),
+		zap.Int("slice_concurrency", concurrency),
+		zap.Int("max_connections", bg.limiter.Capacity()),
+	)
+
+	reqCh := make(chan *protov3.MultiFetchRequest, len(slices))
+	for _, req := range slices {
+		reqCh <- req
+	}
+	close(reqCh)
+
+	sliceCh := make(chan *types.ServerFetchResponse, len(slices))
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			for req := range reqCh {
+				sliceCh <- bg.fetchSlice(ctx, logger, backend, req)
+			}
+		}()
+	}
+
+	for range slices {
+		_ = response.Merge(<-sliceCh)
+	}
+	response.Response.Metrics = origins.stitch(response.Response.Metrics)
+
+	logger.Debug("got response (after stitching)",
+		zap.Int("metrics_in_response", len(response.Response.Metrics)),
+		zap.Int("errors_count", len(response.Err)),
+	)
+
+	resCh <- response
+}
+
+// fetchSlice sends a single slice of the request to the backend
+func (bg *BroadcastGroup) fetchSlice(ctx context.Context, logger *zap.Logger, backend types.BackendServer, req *protov3.MultiFetchRequest) *types.ServerFetchResponse {
+	r := types.NewServerFetchResponse()
+	r.Server = backend.Name()
+
+	if err := bg.limiter.Enter(ctx, backend.Name()); err != nil {
+		logger.Debug("timeout waiting for a slot")
+		return r.NonFatalError(merry.Prepend(err, "timeout waiting for slot"))
+	}
+	defer bg.limiter.Leave(ctx, backend.Name())
+
+	var err merry.Error
+	r.Response, r.Stats, err = backend.Fetch(ctx, req)
+	r.AddError(err)
+	setPieceRanges(req, r.Response)
+	return r
+}
@@ -0,0 +1,161 @@
+package broadcast
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ansel1/merry"
+
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+
+	"github.com/go-graphite/carbonapi/zipper/dummy"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+func TestSliceRequests(t *testing.T) {
+	slices, origins := sliceRequests([]*protov3.MultiFetchRequest{
+		{
+			Metrics: []protov3.FetchRequest{
+				{Name: "foo", PathExpression: "foo", StartTime: 50, StopTime: 250},
+				{Name: "bar", PathExpression: "bar", StartTime: 150, StopTime: 160},
+			},
+		},
+	}, 100)
+
+	expected := [][]protov3.FetchRequest{
+		{
+			{Name: "foo", PathExpression: "foo", StartTime: 50, StopTime: 100},
+			{Name: "bar", PathExpression: "bar", StartTime: 150, StopTime: 160},
+		},
+		{{Name: "foo", PathExpression: "foo", StartTime: 100, StopTime: 200}},
+		{{Name: "foo", PathExpression: "foo", StartTime: 200, StopTime: 250}},
+	}
+
+	if len(slices) != len(expected) {
+		t.Fatalf("unexpected amount of slices %v, expected %v", len(slices), len(expected))
+	}
+	for i := range expected {
+		if len(slices[i].Metrics) != len(expected[i]) {
+			t.Fatalf("slice %v: got %+v, expected %+v", i, slices[i].Metrics, expected[i])
+		}
+		for j := range expected[i] {
+			if !slices[i].Metrics[j].Equal(&expected[i][j]) {
+				t.Errorf("slice %v: got %+v, expected %+v", i, slices[i].Metrics[j], expected[i][j])
+			}
+		}
+	}
+
+	if len(origins) != 3 {
+		t.Errorf("unexpected amount of pieces %v, expected 3", len(origins))
+	}
+}
+
+func TestFetchTimeSliced(t *testing.T) {
+	client := dummy.NewDummyClient("client1", []string{"backend1"}, 1)
+	for _, r := range [][2]int64{{0, 100}, {100, 200}, {200, 250}} {
+		values := make([]float64, 0, (r[1]-r[0])/10)
+		for ts := r[0]; ts < r[1]; ts += 10 {
+			values = append(values, float64(ts))
+		}
+		client.AddFetchResponse(
+			&protov3.MultiFetchRequest{Metrics: []protov3.FetchRequest{{Name: "foo", StartTime: r[0], StopTime: r[1]}}},
+			&protov3.MultiFetchResponse{Metrics: []protov3.FetchResponse{{
+				Name:              "foo",
+				PathExpression:    "foo",
+				ConsolidationFunc: "avg",
+				StartTime:         r[0],
+				StopTime:          r[1],
+				StepTime:          10,
+				Values:            values,
+			}}},
+			&types.Stats{}, nil,
+		)
+	}
+
+	b, err := New(
+		WithLogger(logger),
+		WithGroupName("root"),
+		WithSplitMultipleRequests(false),
+		WithBackends([]types.BackendServer{client}),
+		WithPathCache(60),
+		WithLimiter(2),
+		WithTimeouts(timeouts),
+		WithTLDCache(false),
+		WithTimeSliceWindows(map[string]time.Duration{"client1": 100 * time.Second}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	res, _, err := b.Fetch(context.Background(), &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{Name: "foo", PathExpression: "foo", StartTime: 0, StopTime: 250}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if len(res.Metrics) != 1 {
+		t.Fatalf("unexpected amount of metrics %v, expected 1", len(res.Metrics))
+	}
+	m := res.Metrics[0]
+	if m.StartTime != 0 || m.StopTime != 250 || m.StepTime != 10 || m.RequestStartTime != 0 || m.RequestStopTime != 250 {
+		t.Errorf("unexpected time range %+v", m)
+	}
+	if len(m.Values) != 25 {
+		t.Fatalf("unexpected amount of values %v, expected 25", len(m.Values))
+	}
+	for i, v := range m.Values {
+		if v != float64(i*10) {
+			t.Fatalf("unexpected values %v", m.Values)
+		}
+	}
+}
+
+type concurrencyCountingClient struct {
+	*dummy.DummyClient
+	running    int32
+	maxRunning int32
+}
+
+func (c *concurrencyCountingClient) Fetch(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, merry.Error) {
+	running := atomic.AddInt32(&c.running, 1)
+	defer atomic.AddInt32(&c.running, -1)
+	for {
+		maxRunning := atomic.LoadInt32(&c.maxRunning)
+		if running <= maxRunning || atomic.CompareAndSwapInt32(&c.maxRunning, maxRunning, running) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	return c.DummyClient.Fetch(ctx, request)
+}
+
+func TestFetchTimeSlicedConcurrency(t *testing.T) {
+	client := &concurrencyCountingClient{DummyClient: dummy.NewDummyClient("client1", []string{"backend1"}, 1)}
+
+	// concurrencyLimitPerServer is not set, so only slice concurrency limits parallel requests
+	b, err := New(
+		WithLogger(logger),
+		WithGroupName("root"),
+		WithSplitMultipleRequests(false),
+		WithBackends([]types.BackendServer{client}),
+		WithPathCache(60),
+		WithTimeouts(timeouts),
+		WithTLDCache(false),
+		WithTimeSliceWindows(map[string]time.Duration{"client1": 10 * time.Second}),
+		WithTimeSliceConcurrency(2),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	_, _, _ = b.Fetch(context.Background(), &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{Name: "foo", PathExpression: "foo", StartTime: 0, StopTime: 100}},
+	})
+
+	if maxRunning := atomic.LoadInt32(&client.maxRunning); maxRunning != 2 {
+		t.Errorf("unexpected amount of parallel slice requests %v, expected 2", maxRunning)
+	}
+}
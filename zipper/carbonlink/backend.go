@@ -0,0 +1,47 @@
+package carbonlink
+
+import (
+	"context"
+
+	"github.com/ansel1/merry"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// Backend overlays points from carbon-cache onto responses of the backend group
+type Backend struct {
+	types.BackendServer
+	client *Client
+}
+
+// Wrap attaches carbonlink client to the backend group
+func Wrap(backend types.BackendServer, client *Client) *Backend {
+	return &Backend{
+		BackendServer: backend,
+		client:        client,
+	}
+}
+
+func (b *Backend) Children() []types.BackendServer {
+	return []types.BackendServer{b}
+}
+
+func (b *Backend) Fetch(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, merry.Error) {
+	res, stats, err := b.BackendServer.Fetch(ctx, request)
+	if res == nil || len(res.Metrics) == 0 {
+		return res, stats, err
+	}
+
+	names := make([]string, 0, len(res.Metrics))
+	for i := range res.Metrics {
+		names = append(names, res.Metrics[i].Name)
+	}
+
+	cached := b.client.Query(ctx, names)
+	for i := range res.Metrics {
+		Overlay(&res.Metrics[i], cached[res.Metrics[i].Name])
+	}
+
+	return res, stats, err
+}
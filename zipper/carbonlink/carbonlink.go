@@ -0,0 +1,265 @@
+package carbonlink
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ansel1/merry"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	pickle "github.com/lomik/og-rek"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+const defaultTimeout = time.Second
+
+var (
+	ErrNoHosts         = merry.New("no carbonlink hosts specified")
+	ErrInvalidHost     = merry.New("invalid carbonlink host")
+	ErrInvalidResponse = merry.New("invalid carbonlink response")
+)
+
+// Datapoint is a point stored in carbon-cache
+type Datapoint struct {
+	Timestamp int64
+	Value     float64
+}
+
+// Client queries carbon-cache instances over carbonlink protocol (length-prefixed pickle over TCP)
+type Client struct {
+	ring    *hashRing
+	addrs   map[node]string
+	timeout time.Duration
+	logger  *zap.Logger
+}
+
+// New creates carbonlink client. Hosts are in graphite-web's CARBONLINK_HOSTS format: host:port[:instance]
+func New(logger *zap.Logger, cfg types.CarbonlinkConfig) (*Client, merry.Error) {
+	if len(cfg.Hosts) == 0 {
+		return nil, ErrNoHosts.Here()
+	}
+
+	c := &Client{
+		addrs:   make(map[node]string),
+		timeout: cfg.Timeout,
+		logger:  logger.With(zap.String("type", "carbonlink")),
+	}
+	if c.timeout <= 0 {
+		c.timeout = defaultTimeout
+	}
+
+	nodes := make([]node, 0, len(cfg.Hosts))
+	for _, h := range cfg.Hosts {
+		parts := strings.Split(h, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			return nil, ErrInvalidHost.Here().WithValue("host", h)
+		}
+		n := node{host: parts[0]}
+		if len(parts) == 3 {
+			n.instance = parts[2]
+		}
+		if _, ok := c.addrs[n]; ok {
+			return nil, ErrInvalidHost.Here().WithMessagef("duplicate carbonlink host '%s'", h)
+		}
+		c.addrs[n] = net.JoinHostPort(parts[0], parts[1])
+		nodes = append(nodes, n)
+	}
+	c.ring = newHashRing(nodes)
+
+	return c, nil
+}
+
+func writeRequest(w io.Writer, metric string) error {
+	var buf bytes.Buffer
+	if err := pickle.NewEncoder(&buf).Encode(map[string]interface{}{
+		"type":   "cache-query",
+		"metric": metric,
+	}); err != nil {
+		return err
+	}
+
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(buf.Len()))
+	if _, err := w.Write(length[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	case float64:
+		return int64(n), true
+	case *big.Int:
+		return n.Int64(), n.IsInt64()
+	}
+	return 0, false
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(n).Float64()
+		return f, true
+	}
+	return 0, false
+}
+
+func readResponse(r io.Reader) ([]Datapoint, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	body := make([]byte, binary.BigEndian.Uint32(length[:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	v, err := pickle.NewDecoder(bytes.NewReader(body)).Decode()
+	if err != nil {
+		return nil, ErrInvalidResponse.Here().WithCause(err)
+	}
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrInvalidResponse.Here().WithMessagef("expected dict, got %T", v)
+	}
+	if e, ok := m["error"]; ok {
+		return nil, ErrInvalidResponse.Here().WithMessagef("carbon-cache returned an error: %v", e)
+	}
+
+	list, ok := m["datapoints"].([]interface{})
+	if !ok {
+		return nil, ErrInvalidResponse.Here().WithMessagef("expected list of datapoints, got %T", m["datapoints"])
+	}
+	points := make([]Datapoint, 0, len(list))
+	for _, item := range list {
+		var pair []interface{}
+		switch p := item.(type) {
+		case pickle.Tuple:
+			pair = p
+		case []interface{}:
+			pair = p
+		}
+		if len(pair) != 2 {
+			return nil, ErrInvalidResponse.Here().WithMessagef("invalid datapoint %v", item)
+		}
+		ts, ok1 := toInt64(pair[0])
+		value, ok2 := toFloat64(pair[1])
+		if !ok1 || !ok2 {
+			return nil, ErrInvalidResponse.Here().WithMessagef("invalid datapoint %v", item)
+		}
+		points = append(points, Datapoint{Timestamp: ts, Value: value})
+	}
+
+	return points, nil
+}
+
+// queryHost sends cache queries for all metrics over a single connection
+func (c *Client) queryHost(ctx context.Context, addr string, metrics []string) (map[string][]Datapoint, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	res := make(map[string][]Datapoint, len(metrics))
+	r := bufio.NewReader(conn)
+	for _, metric := range metrics {
+		if err := writeRequest(conn, metric); err != nil {
+			return res, err
+		}
+		points, err := readResponse(r)
+		if err != nil {
+			return res, err
+		}
+		if len(points) > 0 {
+			res[metric] = points
+		}
+	}
+
+	return res, nil
+}
+
+// Query returns cached points for metrics. Cache is optional source of data, so failed hosts are only logged.
+func (c *Client) Query(ctx context.Context, metrics []string) map[string][]Datapoint {
+	byHost := make(map[string][]string)
+	for _, metric := range metrics {
+		addr := c.addrs[c.ring.get(metric)]
+		byHost[addr] = append(byHost[addr], metric)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	res := make(map[string][]Datapoint)
+	for addr, names := range byHost {
+		wg.Add(1)
+		go func(addr string, names []string) {
+			defer wg.Done()
+			points, err := c.queryHost(ctx, addr, names)
+			if err != nil {
+				c.logger.Warn("failed to query carbon-cache",
+					zap.String("host", addr),
+					zap.Int("metrics", len(names)),
+					zap.Error(err),
+				)
+			}
+			mu.Lock()
+			for k, v := range points {
+				res[k] = v
+			}
+			mu.Unlock()
+		}(addr, names)
+	}
+	wg.Wait()
+
+	return res
+}
+
+// Overlay replaces values of the response with cached points. Points that fall into the same interval are aggregated
+// with consolidation function of the response, as cache contains raw points and response might be from lower precision archive.
+func Overlay(m *protov3.FetchResponse, points []Datapoint) {
+	if m.StepTime <= 0 || len(points) == 0 {
+		return
+	}
+
+	buckets := make(map[int][]float64)
+	for _, p := range points {
+		interval := p.Timestamp - p.Timestamp%m.StepTime
+		i := (interval - m.StartTime) / m.StepTime
+		if interval < m.StartTime || i >= int64(len(m.Values)) {
+			continue
+		}
+		buckets[int(i)] = append(buckets[int(i)], p.Value)
+	}
+
+	for i, values := range buckets {
+		m.Values[i] = types.ConsolidatePoints(m.ConsolidationFunc, values)
+	}
+}
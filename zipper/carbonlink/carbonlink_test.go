@@ -0,0 +1,211 @@
+package carbonlink
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"reflect"
+	"testing"
+
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	pickle "github.com/lomik/og-rek"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/zipper/dummy"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+func TestHashRing(t *testing.T) {
+	// Expected nodes are calculated by carbon's ConsistentHashRing
+	ring := newHashRing([]node{{"127.0.0.1", "a"}, {"127.0.0.1", "b"}, {"10.0.0.1", ""}})
+
+	tests := []struct {
+		metric string
+		want   node
+	}{
+		{"foo.bar", node{"10.0.0.1", ""}},
+		{"carbon.agents.host.cpu", node{"127.0.0.1", "a"}},
+		{"a", node{"127.0.0.1", "a"}},
+		{"servers.web01.load", node{"10.0.0.1", ""}},
+		{"x.y.z", node{"127.0.0.1", "b"}},
+		{"metric;tag=value", node{"10.0.0.1", ""}},
+	}
+
+	for _, tt := range tests {
+		if got := ring.get(tt.metric); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.metric, got, tt.want)
+		}
+	}
+}
+
+func TestNewInvalidHosts(t *testing.T) {
+	for _, hosts := range [][]string{nil, {"127.0.0.1"}, {"127.0.0.1:7002:a:b"}, {"h:1:a", "h:2:a"}} {
+		if _, err := New(zap.NewNop(), types.CarbonlinkConfig{Hosts: hosts}); err == nil {
+			t.Errorf("%v: expected error", hosts)
+		}
+	}
+}
+
+// startCache starts fake carbon-cache that answers cache queries with the provided points
+func startCache(t *testing.T, cache map[string][]Datapoint) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				for {
+					var length [4]byte
+					if _, err := io.ReadFull(conn, length[:]); err != nil {
+						return
+					}
+					body := make([]byte, binary.BigEndian.Uint32(length[:]))
+					if _, err := io.ReadFull(conn, body); err != nil {
+						return
+					}
+					req, err := pickle.NewDecoder(bytes.NewReader(body)).Decode()
+					if err != nil {
+						return
+					}
+					metric, _ := req.(map[interface{}]interface{})["metric"].(string)
+
+					points := make([]interface{}, 0)
+					for _, p := range cache[metric] {
+						points = append(points, pickle.Tuple{p.Timestamp, p.Value})
+					}
+					var buf bytes.Buffer
+					if err := pickle.NewEncoder(&buf).Encode(map[string]interface{}{"datapoints": points}); err != nil {
+						return
+					}
+					binary.BigEndian.PutUint32(length[:], uint32(buf.Len()))
+					_, _ = conn.Write(append(length[:], buf.Bytes()...))
+				}
+			}(conn)
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func TestQuery(t *testing.T) {
+	addr := startCache(t, map[string][]Datapoint{
+		"foo": {{Timestamp: 60, Value: 1}, {Timestamp: 120, Value: 2.5}},
+		"bar": {{Timestamp: 60, Value: 3}},
+	})
+
+	c, err := New(zap.NewNop(), types.CarbonlinkConfig{Hosts: []string{addr + ":a"}})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	got := c.Query(context.Background(), []string{"foo", "bar", "baz"})
+	expected := map[string][]Datapoint{
+		"foo": {{Timestamp: 60, Value: 1}, {Timestamp: 120, Value: 2.5}},
+		"bar": {{Timestamp: 60, Value: 3}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %+v, want %+v", got, expected)
+	}
+}
+
+func TestQueryUnavailableHost(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	c, _ := New(zap.NewNop(), types.CarbonlinkConfig{Hosts: []string{addr}})
+	if got := c.Query(context.Background(), []string{"foo"}); len(got) != 0 {
+		t.Errorf("expected empty result, got %+v", got)
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		name   string
+		cf     string
+		points []Datapoint
+		want   []float64
+	}{
+		{
+			name:   "fill and replace",
+			cf:     "average",
+			points: []Datapoint{{Timestamp: 120, Value: 5}, {Timestamp: 180, Value: 6}, {Timestamp: 600, Value: 7}},
+			want:   []float64{1, 5, 6},
+		},
+		{
+			name:   "aggregate raw points",
+			cf:     "sum",
+			points: []Datapoint{{Timestamp: 130, Value: 1}, {Timestamp: 150, Value: 2}},
+			want:   []float64{1, 3, nan},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := protov3.FetchResponse{
+				ConsolidationFunc: tt.cf,
+				StartTime:         60,
+				StopTime:          240,
+				StepTime:          60,
+				Values:            []float64{1, 2, nan},
+			}
+			Overlay(&m, tt.points)
+			for i := range tt.want {
+				if m.Values[i] != tt.want[i] && !(math.IsNaN(m.Values[i]) && math.IsNaN(tt.want[i])) {
+					t.Fatalf("got %v, want %v", m.Values, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBackendFetch(t *testing.T) {
+	addr := startCache(t, map[string][]Datapoint{
+		"foo": {{Timestamp: 180, Value: 42}},
+	})
+	c, err := New(zap.NewNop(), types.CarbonlinkConfig{Hosts: []string{addr}})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	request := &protov3.MultiFetchRequest{Metrics: []protov3.FetchRequest{{Name: "foo", StartTime: 60, StopTime: 240}}}
+	client := dummy.NewDummyClient("files", []string{"files"}, 1)
+	client.AddFetchResponse(request, &protov3.MultiFetchResponse{Metrics: []protov3.FetchResponse{{
+		Name:              "foo",
+		ConsolidationFunc: "average",
+		StartTime:         60,
+		StopTime:          240,
+		StepTime:          60,
+		Values:            []float64{1, 2, math.NaN()},
+	}}}, &types.Stats{}, nil)
+
+	b := Wrap(client, c)
+	if b.Name() != "files" || len(b.Children()) != 1 || b.Children()[0] != b {
+		t.Errorf("wrapper doesn't represent the group")
+	}
+
+	res, _, e := b.Fetch(context.Background(), request)
+	if e != nil {
+		t.Fatalf("unexpected error %v", e)
+	}
+	if !reflect.DeepEqual(res.Metrics[0].Values, []float64{1, 2, 42}) {
+		t.Errorf("unexpected values %v", res.Metrics[0].Values)
+	}
+}
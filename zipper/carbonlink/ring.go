@@ -0,0 +1,73 @@
+package carbonlink
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+const replicaCount = 100
+
+type node struct {
+	host     string
+	instance string
+}
+
+// key is a python representation of (host, instance) tuple, which is used by carbon to place the node on the ring
+func (n node) key() string {
+	if n.instance == "" {
+		return fmt.Sprintf("('%s', None)", n.host)
+	}
+	return fmt.Sprintf("('%s', '%s')", n.host, n.instance)
+}
+
+type ringEntry struct {
+	position int
+	node     int
+}
+
+// hashRing is a port of carbon's ConsistentHashRing (carbon_ch hashing), so the same carbon-cache is selected for the
+// metric as by carbon-relay and graphite-web
+type hashRing struct {
+	nodes   []node
+	entries []ringEntry
+}
+
+func ringPosition(key string) int {
+	sum := md5.Sum([]byte(key))
+	position, _ := strconv.ParseInt(hex.EncodeToString(sum[:2]), 16, 64)
+	return int(position)
+}
+
+func newHashRing(nodes []node) *hashRing {
+	r := &hashRing{nodes: nodes}
+	used := make(map[int]struct{})
+	for i, n := range nodes {
+		for j := 0; j < replicaCount; j++ {
+			position := ringPosition(fmt.Sprintf("%s:%d", n.key(), j))
+			for {
+				if _, ok := used[position]; !ok {
+					break
+				}
+				position++
+			}
+			used[position] = struct{}{}
+			r.entries = append(r.entries, ringEntry{position: position, node: i})
+		}
+	}
+
+	sort.Slice(r.entries, func(i, j int) bool {
+		return r.entries[i].position < r.entries[j].position
+	})
+	return r
+}
+
+func (r *hashRing) get(metric string) node {
+	position := ringPosition(metric)
+	i := sort.Search(len(r.entries), func(i int) bool {
+		return r.entries[i].position >= position
+	})
+	return r.nodes[r.entries[i%len(r.entries)].node]
+}
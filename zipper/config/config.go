@@ -36,6 +36,12 @@ type Config struct {
 	// ScaleToCommonStep controls if metrics in one target should be aggregated to common step
 	ScaleToCommonStep bool `mapstructure:"scaleToCommonStep"`
 
+	// RoutingRules are evaluated before TLD-based routing and allows to statically map requests to backend groups
+	RoutingRules []types.RoutingRule `mapstructure:"routingRules"`
+
+	// ReplicaDivergence enables sampling of replicas' responses in broadcast groups to find inconsistent data
+	ReplicaDivergence types.DivergenceConfig `mapstructure:"replicaDivergence"`
+
 	isSanitized bool
 }
 
@@ -130,6 +136,14 @@ func SanitizeConfig(logger *zap.Logger, oldConfig Config) *Config {
 		}
 		timeouts := sanitizeTimeouts(*(newConfig.BackendsV2.Backends[i].Timeouts), newConfig.BackendsV2.Timeouts)
 		newConfig.BackendsV2.Backends[i].Timeouts = &timeouts
+		if b := newConfig.BackendsV2.Backends[i]; b.MaxAge > 0 && b.MinAge >= b.MaxAge {
+			logger.Fatal("invalid retention for backend group",
+				zap.String("groupName", b.GroupName),
+				zap.Duration("minAge", b.MinAge),
+				zap.Duration("maxAge", b.MaxAge),
+				zap.String("reason", "minAge must be less than maxAge"),
+			)
+		}
 		if newConfig.BackendsV2.Backends[i].IdleConnectionTimeout == nil {
 			newConfig.BackendsV2.Backends[i].IdleConnectionTimeout = &defaultIdleConnTimeout
 		}
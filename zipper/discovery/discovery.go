@@ -0,0 +1,216 @@
+// Package discovery provides server lists of backend groups that change at runtime: from DNS SRV records
+// or from Prometheus file_sd files.
+package discovery
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ansel1/merry"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+
+	"github.com/go-graphite/carbonapi/internal/dns"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+var (
+	ErrUnknownType         = merry.New("unknown discovery type")
+	ErrNoServersDiscovered = merry.New("no servers discovered")
+)
+
+// Source returns current list of servers
+type Source interface {
+	Servers(ctx context.Context) ([]string, error)
+}
+
+// New returns source for the config, config must be filled with defaults
+func New(cfg types.DiscoveryConfig) (Source, merry.Error) {
+	switch cfg.Type {
+	case "dns_srv", "srv":
+		if cfg.Name == "" {
+			return nil, ErrUnknownType.WithMessage("SRV record name is not specified")
+		}
+		return &srvSource{name: cfg.Name, scheme: cfg.Scheme, lookup: dns.LookupSRV}, nil
+	case "file", "file_sd":
+		if cfg.File == "" {
+			return nil, ErrUnknownType.WithMessage("file is not specified")
+		}
+		return &fileSource{path: cfg.File, scheme: cfg.Scheme}, nil
+	}
+	return nil, ErrUnknownType.WithValue("type", cfg.Type)
+}
+
+// normalize adds scheme to host:port targets, sorts them and removes duplicates
+func normalize(targets []string, scheme string) []string {
+	res := make([]string, 0, len(targets))
+	seen := make(map[string]struct{}, len(targets))
+	for _, t := range targets {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if !strings.Contains(t, "://") {
+			t = scheme + "://" + t
+		}
+		if _, ok := seen[t]; ok {
+			continue
+		}
+		seen[t] = struct{}{}
+		res = append(res, t)
+	}
+	sort.Strings(res)
+	return res
+}
+
+type srvSource struct {
+	name   string
+	scheme string
+	lookup func(ctx context.Context, name string) ([]string, error)
+}
+
+func (s *srvSource) Servers(ctx context.Context) ([]string, error) {
+	targets, err := s.lookup(ctx, s.name)
+	if err != nil {
+		return nil, err
+	}
+	return normalize(targets, s.scheme), nil
+}
+
+// targetGroup is an element of Prometheus file_sd file, labels are ignored
+type targetGroup struct {
+	Targets []string          `yaml:"targets"`
+	Labels  map[string]string `yaml:"labels"`
+}
+
+type fileSource struct {
+	path   string
+	scheme string
+}
+
+// Servers reads the file, JSON is parsed as YAML, as it's a subset of it
+func (s *fileSource) Servers(ctx context.Context) ([]string, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	var groups []targetGroup
+	if err := yaml.Unmarshal(data, &groups); err != nil {
+		return nil, merry.Prepend(err, "failed to parse "+s.path)
+	}
+	var targets []string
+	for _, g := range groups {
+		targets = append(targets, g.Targets...)
+	}
+	return normalize(targets, s.scheme), nil
+}
+
+// Diff returns servers that are present only in the next or only in the previous sorted list
+func Diff(prev, next []string) (added, removed []string) {
+	i, j := 0, 0
+	for i < len(prev) || j < len(next) {
+		switch {
+		case j == len(next) || (i < len(prev) && prev[i] < next[j]):
+			removed = append(removed, prev[i])
+			i++
+		case i == len(prev) || next[j] < prev[i]:
+			added = append(added, next[j])
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+	return added, removed
+}
+
+// OnChangeFunc applies changes of the server list to the group and returns servers that the group actually uses
+// after that. Servers that weren't applied are retried on the next refresh.
+type OnChangeFunc func(added, removed []string) ([]string, merry.Error)
+
+// Watcher polls the source and reports changes of the server list. Errors and empty lists are ignored, so
+// group keeps its servers if discovery is temporary unavailable.
+type Watcher struct {
+	logger   *zap.Logger
+	source   Source
+	interval time.Duration
+	servers  []string
+	onChange OnChangeFunc
+}
+
+func NewWatcher(logger *zap.Logger, source Source, interval time.Duration, servers []string, onChange OnChangeFunc) *Watcher {
+	return &Watcher{
+		logger:   logger.With(zap.String("type", "discovery")),
+		source:   source,
+		interval: interval,
+		servers:  servers,
+		onChange: onChange,
+	}
+}
+
+// Run polls the source until context is done
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Refresh(ctx)
+		}
+	}
+}
+
+// Refresh gets servers from the source and calls onChange if they differ from applied ones
+func (w *Watcher) Refresh(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, w.interval)
+	defer cancel()
+
+	servers, err := w.source.Servers(ctx)
+	if err != nil {
+		w.logger.Warn("failed to discover servers, keeping previous ones",
+			zap.Strings("servers", w.servers),
+			zap.Error(err),
+		)
+		return
+	}
+	if len(servers) == 0 {
+		w.logger.Warn("no servers discovered, keeping previous ones",
+			zap.Strings("servers", w.servers),
+		)
+		return
+	}
+
+	added, removed := Diff(w.servers, servers)
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+	applied, err := w.onChange(added, removed)
+	if err != nil {
+		w.logger.Warn("failed to apply discovered servers, will retry on the next refresh",
+			zap.Strings("servers", servers),
+			zap.Strings("applied", applied),
+			zap.Error(err),
+		)
+	}
+	if applied != nil {
+		w.servers = append([]string(nil), applied...)
+		sort.Strings(w.servers)
+	}
+}
+
+// Discover returns initial list of servers, it's an error if there are none
+func Discover(ctx context.Context, source Source) ([]string, merry.Error) {
+	servers, err := source.Servers(ctx)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if len(servers) == 0 {
+		return nil, ErrNoServersDiscovered
+	}
+	return servers, nil
+}
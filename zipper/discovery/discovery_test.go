@@ -0,0 +1,248 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ansel1/merry"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name    string
+		prev    []string
+		next    []string
+		added   []string
+		removed []string
+	}{
+		{
+			name: "same",
+			prev: []string{"http://a:8080", "http://b:8080"},
+			next: []string{"http://a:8080", "http://b:8080"},
+		},
+		{
+			name:  "added",
+			prev:  []string{"http://b:8080"},
+			next:  []string{"http://a:8080", "http://b:8080", "http://c:8080"},
+			added: []string{"http://a:8080", "http://c:8080"},
+		},
+		{
+			name:    "removed",
+			prev:    []string{"http://a:8080", "http://b:8080", "http://c:8080"},
+			next:    []string{"http://b:8080"},
+			removed: []string{"http://a:8080", "http://c:8080"},
+		},
+		{
+			name:    "replaced",
+			prev:    []string{"http://a:8080", "http://b:8080"},
+			next:    []string{"http://b:8080", "http://c:8080"},
+			added:   []string{"http://c:8080"},
+			removed: []string{"http://a:8080"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, removed := Diff(tt.prev, tt.next)
+			if !reflect.DeepEqual(added, tt.added) {
+				t.Errorf("got added %v, expected %v", added, tt.added)
+			}
+			if !reflect.DeepEqual(removed, tt.removed) {
+				t.Errorf("got removed %v, expected %v", removed, tt.removed)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         types.DiscoveryConfig
+		expectedErr merry.Error
+	}{
+		{
+			name: "dns_srv",
+			cfg:  types.DiscoveryConfig{Type: "dns_srv", Name: "_carbonserver._tcp.example.com"},
+		},
+		{
+			name:        "dns_srv without name",
+			cfg:         types.DiscoveryConfig{Type: "dns_srv"},
+			expectedErr: ErrUnknownType,
+		},
+		{
+			name: "file",
+			cfg:  types.DiscoveryConfig{Type: "file", File: "/etc/carbonapi/backends.json"},
+		},
+		{
+			name:        "unknown",
+			cfg:         types.DiscoveryConfig{Type: "consul"},
+			expectedErr: ErrUnknownType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.cfg)
+			if !merry.Is(err, tt.expectedErr) {
+				t.Errorf("got error %v, expected %v", err, tt.expectedErr)
+			}
+		})
+	}
+}
+
+func TestSRVSource(t *testing.T) {
+	s := &srvSource{
+		name:   "_carbonserver._tcp.example.com",
+		scheme: "http",
+		lookup: func(ctx context.Context, name string) ([]string, error) {
+			if name != "_carbonserver._tcp.example.com" {
+				t.Errorf("unexpected name %v", name)
+			}
+			return []string{"b.example.com:8080", "a.example.com:8080", "b.example.com:8080"}, nil
+		},
+	}
+
+	servers, err := s.Servers(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := []string{"http://a.example.com:8080", "http://b.example.com:8080"}
+	if !reflect.DeepEqual(servers, expected) {
+		t.Errorf("got %v, expected %v", servers, expected)
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name:    "backends.json",
+			content: `[{"targets": ["b:8080", "a:8080"], "labels": {"dc": "1"}}, {"targets": ["https://c:8443"]}]`,
+		},
+		{
+			name: "backends.yaml",
+			content: `- targets:
+    - b:8080
+    - a:8080
+  labels:
+    dc: "1"
+- targets:
+    - https://c:8443
+`,
+		},
+	}
+
+	expected := []string{"http://a:8080", "http://b:8080", "https://c:8443"}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := New(types.DiscoveryConfig{Type: "file", File: path, Scheme: "http"})
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			servers, err2 := s.Servers(context.Background())
+			if err2 != nil {
+				t.Fatalf("unexpected error %v", err2)
+			}
+			if !reflect.DeepEqual(servers, expected) {
+				t.Errorf("got %v, expected %v", servers, expected)
+			}
+		})
+	}
+}
+
+type staticSource struct {
+	servers []string
+	err     error
+}
+
+func (s *staticSource) Servers(ctx context.Context) ([]string, error) {
+	return s.servers, s.err
+}
+
+func TestWatcherRefresh(t *testing.T) {
+	source := &staticSource{servers: []string{"http://a:8080", "http://b:8080"}}
+
+	var added, removed []string
+	calls := 0
+	w := NewWatcher(zap.NewNop(), source, time.Second, source.servers, func(a, r []string) ([]string, merry.Error) {
+		calls++
+		added, removed = a, r
+		return source.servers, nil
+	})
+
+	w.Refresh(context.Background())
+	if calls != 0 {
+		t.Fatalf("onChange called without changes")
+	}
+
+	source.servers = []string{"http://b:8080", "http://c:8080"}
+	w.Refresh(context.Background())
+	if calls != 1 || !reflect.DeepEqual(added, []string{"http://c:8080"}) || !reflect.DeepEqual(removed, []string{"http://a:8080"}) {
+		t.Fatalf("got calls=%v added=%v removed=%v", calls, added, removed)
+	}
+
+	// failed or empty discovery keeps known servers
+	source.servers, source.err = nil, errors.New("lookup failed")
+	w.Refresh(context.Background())
+	source.err = nil
+	w.Refresh(context.Background())
+	if calls != 1 {
+		t.Fatalf("onChange called for failed discovery")
+	}
+	if !reflect.DeepEqual(w.servers, []string{"http://b:8080", "http://c:8080"}) {
+		t.Errorf("got servers %v", w.servers)
+	}
+}
+
+func TestWatcherRetriesNotApplied(t *testing.T) {
+	source := &staticSource{servers: []string{"http://a:8080"}}
+
+	fail := true
+	var added [][]string
+	w := NewWatcher(zap.NewNop(), source, time.Second, source.servers, func(a, r []string) ([]string, merry.Error) {
+		added = append(added, a)
+		if fail {
+			return []string{"http://a:8080"}, types.ErrFailed
+		}
+		return []string{"http://b:8080", "http://a:8080"}, nil
+	})
+
+	source.servers = []string{"http://a:8080", "http://b:8080"}
+	w.Refresh(context.Background())
+	if !reflect.DeepEqual(w.servers, []string{"http://a:8080"}) {
+		t.Fatalf("got servers %v, failed server must not be applied", w.servers)
+	}
+
+	fail = false
+	w.Refresh(context.Background())
+	w.Refresh(context.Background())
+	if !reflect.DeepEqual(added, [][]string{{"http://b:8080"}, {"http://b:8080"}}) {
+		t.Fatalf("got added %v, expected failed server to be retried once", added)
+	}
+	if !reflect.DeepEqual(w.servers, []string{"http://a:8080", "http://b:8080"}) {
+		t.Errorf("got servers %v", w.servers)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	_, err := Discover(context.Background(), &staticSource{})
+	if !merry.Is(err, ErrNoServersDiscovered) {
+		t.Errorf("got error %v, expected %v", err, ErrNoServersDiscovered)
+	}
+}
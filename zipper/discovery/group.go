@@ -0,0 +1,197 @@
+package discovery
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ansel1/merry"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// BuildFunc creates backend group for the list of servers
+type BuildFunc func(servers []string) (types.BackendServer, merry.Error)
+
+type generation struct {
+	backend  types.BackendServer
+	servers  []string
+	inFlight sync.WaitGroup
+}
+
+// Group is a round-robin backend group, that is recreated when its servers change. Requests in flight to the
+// previous group are allowed to finish, it's dropped after that.
+type Group struct {
+	name         string
+	build        BuildFunc
+	drainTimeout time.Duration
+	logger       *zap.Logger
+
+	mu      sync.RWMutex
+	current *generation
+}
+
+func NewGroup(logger *zap.Logger, name string, servers []string, drainTimeout time.Duration, build BuildFunc) (*Group, merry.Error) {
+	backend, err := build(servers)
+	if err != nil {
+		return nil, err
+	}
+	return &Group{
+		name:         name,
+		build:        build,
+		drainTimeout: drainTimeout,
+		logger:       logger.With(zap.String("type", "discoveryGroup"), zap.String("name", name)),
+		current:      &generation{backend: backend, servers: servers},
+	}, nil
+}
+
+// acquire returns current generation, caller must call inFlight.Done when request is finished
+func (g *Group) acquire() *generation {
+	g.mu.RLock()
+	gen := g.current
+	gen.inFlight.Add(1)
+	g.mu.RUnlock()
+	return gen
+}
+
+// UpdateServers recreates the group with changed list of servers and returns servers of the current group,
+// previous servers are kept if the group can't be created
+func (g *Group) UpdateServers(added, removed []string) ([]string, merry.Error) {
+	g.mu.RLock()
+	prev := g.current
+	g.mu.RUnlock()
+
+	removedSet := make(map[string]struct{}, len(removed))
+	for _, s := range removed {
+		removedSet[s] = struct{}{}
+	}
+	servers := make([]string, 0, len(prev.servers)+len(added))
+	for _, s := range prev.servers {
+		if _, ok := removedSet[s]; !ok {
+			servers = append(servers, s)
+		}
+	}
+	servers = append(servers, added...)
+
+	backend, err := g.build(servers)
+	if err != nil {
+		g.logger.Error("failed to create group for discovered servers, keeping previous ones",
+			zap.Strings("servers", servers),
+			zap.Error(err),
+		)
+		return prev.servers, err
+	}
+
+	g.mu.Lock()
+	g.current = &generation{backend: backend, servers: servers}
+	g.mu.Unlock()
+
+	g.logger.Info("servers changed",
+		zap.Strings("added", added),
+		zap.Strings("removed", removed),
+		zap.Strings("servers", servers),
+	)
+
+	go g.drain(prev)
+
+	return servers, nil
+}
+
+// drain waits for requests in flight to the previous generation of the group and closes its idle connections
+func (g *Group) drain(gen *generation) {
+	done := make(chan struct{})
+	go func() {
+		gen.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		g.logger.Debug("previous servers drained",
+			zap.Strings("servers", gen.servers),
+		)
+	case <-time.After(g.drainTimeout):
+		g.logger.Warn("requests to previous servers are still in flight",
+			zap.Strings("servers", gen.servers),
+			zap.Duration("drain_timeout", g.drainTimeout),
+		)
+	}
+	types.CloseIdleConnections(gen.backend)
+}
+
+func (g *Group) Name() string {
+	return g.name
+}
+
+func (g *Group) Backends() []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.current.servers
+}
+
+func (g *Group) MaxMetricsPerRequest() int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.current.backend.MaxMetricsPerRequest()
+}
+
+func (g *Group) Children() []types.BackendServer {
+	return []types.BackendServer{g}
+}
+
+// PushdownFunctions returns functions advertised by the current group
+func (g *Group) PushdownFunctions() []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return types.PushdownFunctions(g.current.backend)
+}
+
+func (g *Group) Fetch(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, merry.Error) {
+	gen := g.acquire()
+	defer gen.inFlight.Done()
+	return gen.backend.Fetch(ctx, request)
+}
+
+func (g *Group) Find(ctx context.Context, request *protov3.MultiGlobRequest) (*protov3.MultiGlobResponse, *types.Stats, merry.Error) {
+	gen := g.acquire()
+	defer gen.inFlight.Done()
+	return gen.backend.Find(ctx, request)
+}
+
+func (g *Group) Info(ctx context.Context, request *protov3.MultiMetricsInfoRequest) (*protov3.ZipperInfoResponse, *types.Stats, merry.Error) {
+	gen := g.acquire()
+	defer gen.inFlight.Done()
+	return gen.backend.Info(ctx, request)
+}
+
+func (g *Group) List(ctx context.Context) (*protov3.ListMetricsResponse, *types.Stats, merry.Error) {
+	gen := g.acquire()
+	defer gen.inFlight.Done()
+	return gen.backend.List(ctx)
+}
+
+func (g *Group) Stats(ctx context.Context) (*protov3.MetricDetailsResponse, *types.Stats, merry.Error) {
+	gen := g.acquire()
+	defer gen.inFlight.Done()
+	return gen.backend.Stats(ctx)
+}
+
+func (g *Group) ProbeTLDs(ctx context.Context) ([]string, merry.Error) {
+	gen := g.acquire()
+	defer gen.inFlight.Done()
+	return gen.backend.ProbeTLDs(ctx)
+}
+
+func (g *Group) TagNames(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
+	gen := g.acquire()
+	defer gen.inFlight.Done()
+	return gen.backend.TagNames(ctx, query, limit)
+}
+
+func (g *Group) TagValues(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
+	gen := g.acquire()
+	defer gen.inFlight.Done()
+	return gen.backend.TagValues(ctx, query, limit)
+}
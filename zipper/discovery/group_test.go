@@ -0,0 +1,102 @@
+package discovery
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ansel1/merry"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/zipper/dummy"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+func TestGroupUpdateServers(t *testing.T) {
+	var built [][]string
+	build := func(servers []string) (types.BackendServer, merry.Error) {
+		built = append(built, servers)
+		if len(servers) == 0 {
+			return nil, types.ErrNoServersSpecified
+		}
+		c := dummy.NewDummyClient("group", servers, 1)
+		c.SetTLDResponse(dummy.ProbeResponse{Response: servers})
+		return c, nil
+	}
+
+	g, err := NewGroup(zap.NewNop(), "group", []string{"http://a:8080", "http://b:8080"}, time.Second, build)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	applied, err := g.UpdateServers([]string{"http://c:8080"}, []string{"http://a:8080"})
+	expected := []string{"http://b:8080", "http://c:8080"}
+	if err != nil || !reflect.DeepEqual(applied, expected) {
+		t.Errorf("got applied servers %v and error %v, expected %v", applied, err, expected)
+	}
+	if got := g.Backends(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got servers %v, expected %v", got, expected)
+	}
+	tlds, err := g.ProbeTLDs(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(tlds, expected) {
+		t.Errorf("requests are sent to %v, expected %v", tlds, expected)
+	}
+
+	// group is kept if it can't be rebuilt
+	applied, err = g.UpdateServers(nil, expected)
+	if !merry.Is(err, types.ErrNoServersSpecified) || !reflect.DeepEqual(applied, expected) {
+		t.Errorf("got applied servers %v and error %v, expected previous servers", applied, err)
+	}
+	if got := g.Backends(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got servers %v, expected %v", got, expected)
+	}
+	if len(built) != 3 {
+		t.Errorf("group was built %v times, expected 3", len(built))
+	}
+}
+
+type closingClient struct {
+	*dummy.DummyClient
+	closed chan struct{}
+}
+
+func (c *closingClient) CloseIdleConnections() {
+	close(c.closed)
+}
+
+func TestGroupDrainClosesConnections(t *testing.T) {
+	var clients []*closingClient
+	build := func(servers []string) (types.BackendServer, merry.Error) {
+		c := &closingClient{DummyClient: dummy.NewDummyClient("group", servers, 1), closed: make(chan struct{})}
+		clients = append(clients, c)
+		return c, nil
+	}
+
+	g, err := NewGroup(zap.NewNop(), "group", []string{"http://a:8080"}, time.Second, build)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// request in flight to the first generation
+	gen := g.acquire()
+	if _, err = g.UpdateServers([]string{"http://b:8080"}, []string{"http://a:8080"}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	select {
+	case <-clients[0].closed:
+		t.Fatalf("connections are closed with request in flight")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	gen.inFlight.Done()
+	select {
+	case <-clients[0].closed:
+	case <-time.After(time.Second):
+		t.Fatalf("connections of the previous generation are not closed")
+	}
+}
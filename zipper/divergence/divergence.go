@@ -0,0 +1,312 @@
+package divergence
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+const (
+	defaultPrefixDepth = 1
+	defaultRecentSize  = 100
+	defaultMaxPrefixes = 100
+
+	// OtherPrefix is used for divergences of metrics, which prefixes are not tracked because of MaxPrefixes limit
+	OtherPrefix = "_other"
+)
+
+// Entry describes metric which responses from replicas did not match
+type Entry struct {
+	Name    string    `json:"name"`
+	Servers []string  `json:"servers"`
+	Points  uint64    `json:"points"`
+	Time    time.Time `json:"time"`
+}
+
+type counterKey struct {
+	server string
+	prefix string
+}
+
+// Tracker compares sampled responses of replicas and keeps statistics about their disagreements
+type Tracker struct {
+	sampleRate  float64
+	prefixDepth int
+	maxPrefixes int
+	random      func() float64
+
+	mu       sync.Mutex
+	counters map[counterKey]uint64
+	prefixes map[string]struct{}
+	recent   []Entry
+	next     int
+}
+
+// New creates Tracker, nil is returned if sampling is disabled
+func New(cfg types.DivergenceConfig) *Tracker {
+	if cfg.SampleRate <= 0 {
+		return nil
+	}
+	if cfg.PrefixDepth <= 0 {
+		cfg.PrefixDepth = defaultPrefixDepth
+	}
+	if cfg.RecentSize <= 0 {
+		cfg.RecentSize = defaultRecentSize
+	}
+	if cfg.MaxPrefixes <= 0 {
+		cfg.MaxPrefixes = defaultMaxPrefixes
+	}
+
+	return &Tracker{
+		sampleRate:  cfg.SampleRate,
+		prefixDepth: cfg.PrefixDepth,
+		maxPrefixes: cfg.MaxPrefixes,
+		random:      rand.Float64,
+		counters:    make(map[counterKey]uint64),
+		prefixes:    make(map[string]struct{}),
+		recent:      make([]Entry, 0, cfg.RecentSize),
+	}
+}
+
+// Sample decides if request should be checked and returns container for replicas' responses or nil
+func (t *Tracker) Sample() *Sample {
+	if t == nil || t.random() >= t.sampleRate {
+		return nil
+	}
+
+	return &Sample{
+		responses: make(map[coordinates]map[string]protov3.FetchResponse),
+	}
+}
+
+type coordinates struct {
+	name  string
+	from  int64
+	until int64
+}
+
+// Sample collects responses of different servers for a single request
+type Sample struct {
+	mu        sync.Mutex
+	done      bool
+	responses map[coordinates]map[string]protov3.FetchResponse
+}
+
+// Add stores a copy of the server's response. Responses that arrive after the sample was compared are ignored.
+func (s *Sample) Add(server string, metrics []protov3.FetchResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.done {
+		return
+	}
+	for i := range metrics {
+		m := metrics[i]
+		m.Values = append([]float64(nil), m.Values...)
+		c := coordinates{name: m.Name, from: m.RequestStartTime, until: m.RequestStopTime}
+		if s.responses[c] == nil {
+			s.responses[c] = make(map[string]protov3.FetchResponse)
+		}
+		s.responses[c][server] = m
+	}
+}
+
+// prefix returns first nodes of metric name, tags are ignored
+func (t *Tracker) prefix(name string) string {
+	if i := strings.IndexByte(name, ';'); i >= 0 {
+		name = name[:i]
+	}
+	nodes := strings.SplitN(name, ".", t.prefixDepth+1)
+	if len(nodes) > t.prefixDepth {
+		nodes = nodes[:t.prefixDepth]
+	}
+	return strings.Join(nodes, ".")
+}
+
+// trackedPrefix returns prefix if it is already tracked or there is a room for it, OtherPrefix otherwise.
+// Must be called with t.mu held.
+func (t *Tracker) trackedPrefix(prefix string) string {
+	if _, ok := t.prefixes[prefix]; ok {
+		return prefix
+	}
+	if len(t.prefixes) >= t.maxPrefixes {
+		return OtherPrefix
+	}
+	t.prefixes[prefix] = struct{}{}
+	return prefix
+}
+
+// comparePoints returns amount of points where every server disagrees with the majority of replicas.
+// Missing point is considered to be a disagreement if other replicas have the value.
+func comparePoints(responses map[string]protov3.FetchResponse) map[string]uint64 {
+	servers := make([]string, 0, len(responses))
+	var step, from, until int64
+	for server, r := range responses {
+		if r.StepTime <= 0 {
+			return nil
+		}
+		stop := r.StartTime + int64(len(r.Values))*r.StepTime
+		if len(servers) == 0 {
+			step, from, until = r.StepTime, r.StartTime, stop
+		} else if r.StepTime != step || (r.StartTime-from)%step != 0 {
+			// Replicas with different retention can't be compared point by point
+			return nil
+		}
+		from = max(from, r.StartTime)
+		until = min(until, stop)
+		servers = append(servers, server)
+	}
+	sort.Strings(servers)
+
+	diverged := make(map[string]uint64)
+	values := make([]float64, len(servers))
+	for ts := from; ts < until; ts += step {
+		for i, server := range servers {
+			r := responses[server]
+			values[i] = r.Values[(ts-r.StartTime)/step]
+		}
+
+		// Reference is the most common non-NaN value, if there is no single one, nobody could be trusted
+		var reference float64
+		best, ties := 0, 0
+		for i, v := range values {
+			if math.IsNaN(v) {
+				continue
+			}
+			n := 0
+			for _, v2 := range values[i:] {
+				if v2 == v {
+					n++
+				}
+			}
+			switch {
+			case n > best:
+				reference, best, ties = v, n, 1
+			case n == best && v != reference:
+				ties++
+			}
+		}
+		if best == 0 {
+			continue
+		}
+
+		for i, v := range values {
+			if ties > 1 || v != reference {
+				diverged[servers[i]]++
+			}
+		}
+	}
+
+	return diverged
+}
+
+// Compare checks sampled responses and updates tracker's statistics. Divergences found in the sample are returned.
+func (t *Tracker) Compare(s *Sample) []types.ReplicaDivergence {
+	if t == nil || s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	s.done = true
+	s.mu.Unlock()
+
+	found := make(map[counterKey]uint64)
+	var entries []Entry
+	now := time.Now()
+	for c, responses := range s.responses {
+		if len(responses) < 2 {
+			continue
+		}
+		diverged := comparePoints(responses)
+		if len(diverged) == 0 {
+			continue
+		}
+
+		e := Entry{Name: c.name, Time: now}
+		prefix := t.prefix(c.name)
+		for server, points := range diverged {
+			e.Servers = append(e.Servers, server)
+			e.Points += points
+			found[counterKey{server: server, prefix: prefix}] += points
+		}
+		sort.Strings(e.Servers)
+		entries = append(entries, e)
+	}
+
+	if len(found) == 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	tracked := make(map[counterKey]uint64, len(found))
+	for k, points := range found {
+		k.prefix = t.trackedPrefix(k.prefix)
+		t.counters[k] += points
+		tracked[k] += points
+	}
+	res := make([]types.ReplicaDivergence, 0, len(tracked))
+	for k, points := range tracked {
+		res = append(res, types.ReplicaDivergence{Server: k.server, Prefix: k.prefix, Points: points})
+	}
+	for _, e := range entries {
+		if len(t.recent) < cap(t.recent) {
+			t.recent = append(t.recent, e)
+		} else {
+			t.recent[t.next] = e
+		}
+		t.next = (t.next + 1) % cap(t.recent)
+	}
+	t.mu.Unlock()
+
+	sortDivergences(res)
+	return res
+}
+
+func sortDivergences(d []types.ReplicaDivergence) {
+	sort.Slice(d, func(i, j int) bool {
+		if d[i].Server != d[j].Server {
+			return d[i].Server < d[j].Server
+		}
+		return d[i].Prefix < d[j].Prefix
+	})
+}
+
+// Counters returns total amount of diverged points per server and metric prefix
+func (t *Tracker) Counters() []types.ReplicaDivergence {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	res := make([]types.ReplicaDivergence, 0, len(t.counters))
+	for k, points := range t.counters {
+		res = append(res, types.ReplicaDivergence{Server: k.server, Prefix: k.prefix, Points: points})
+	}
+	t.mu.Unlock()
+
+	sortDivergences(res)
+	return res
+}
+
+// Recent returns recently diverged metrics, newest first
+func (t *Tracker) Recent() []Entry {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	res := make([]Entry, 0, len(t.recent))
+	for i := 1; i <= len(t.recent); i++ {
+		res = append(res, t.recent[(t.next-i+len(t.recent))%len(t.recent)])
+	}
+	return res
+}
@@ -0,0 +1,171 @@
+package divergence
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+func TestNewDisabled(t *testing.T) {
+	tracker := New(types.DivergenceConfig{})
+	if tracker != nil {
+		t.Fatalf("expected disabled tracker, got %+v", tracker)
+	}
+	if s := tracker.Sample(); s != nil {
+		t.Errorf("disabled tracker returned sample")
+	}
+	if d := tracker.Compare(nil); d != nil {
+		t.Errorf("disabled tracker returned divergences %+v", d)
+	}
+}
+
+func TestSampleRate(t *testing.T) {
+	tracker := New(types.DivergenceConfig{SampleRate: 0.5})
+	tracker.random = func() float64 { return 0.7 }
+	if tracker.Sample() != nil {
+		t.Errorf("request should not be sampled")
+	}
+	tracker.random = func() float64 { return 0.3 }
+	if tracker.Sample() == nil {
+		t.Errorf("request should be sampled")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	nan := math.NaN()
+	metric := func(name string, start int64, values ...float64) []protov3.FetchResponse {
+		return []protov3.FetchResponse{{
+			Name:      name,
+			StartTime: start,
+			StopTime:  start + int64(len(values))*60,
+			StepTime:  60,
+			Values:    values,
+		}}
+	}
+
+	tests := []struct {
+		name      string
+		responses map[string][]protov3.FetchResponse
+		want      []types.ReplicaDivergence
+	}{
+		{
+			name: "equal replicas",
+			responses: map[string][]protov3.FetchResponse{
+				"a": metric("foo.bar", 0, 1, 2, nan),
+				"b": metric("foo.bar", 0, 1, 2, nan),
+			},
+		},
+		{
+			name: "missing points",
+			responses: map[string][]protov3.FetchResponse{
+				"a": metric("foo.bar", 0, 1, nan, nan),
+				"b": metric("foo.bar", 0, 1, 2, 3),
+			},
+			want: []types.ReplicaDivergence{{Server: "a", Prefix: "foo", Points: 2}},
+		},
+		{
+			name: "majority wins",
+			responses: map[string][]protov3.FetchResponse{
+				"a": metric("foo.bar;tag=x", 0, 1, 2, 3),
+				"b": metric("foo.bar;tag=x", 0, 1, 5, 3),
+				"c": metric("foo.bar;tag=x", 0, 1, 2, 3),
+			},
+			want: []types.ReplicaDivergence{{Server: "b", Prefix: "foo", Points: 1}},
+		},
+		{
+			name: "no majority",
+			responses: map[string][]protov3.FetchResponse{
+				"a": metric("foo", 0, 1, 2),
+				"b": metric("foo", 0, 1, 5),
+			},
+			want: []types.ReplicaDivergence{
+				{Server: "a", Prefix: "foo", Points: 1},
+				{Server: "b", Prefix: "foo", Points: 1},
+			},
+		},
+		{
+			name: "only overlapping range is compared",
+			responses: map[string][]protov3.FetchResponse{
+				"a": metric("foo", 0, 7, 1, 2),
+				"b": metric("foo", 60, 1, 3, 8),
+			},
+			want: []types.ReplicaDivergence{{Server: "a", Prefix: "foo", Points: 1}, {Server: "b", Prefix: "foo", Points: 1}},
+		},
+		{
+			name: "single replica",
+			responses: map[string][]protov3.FetchResponse{
+				"a": metric("foo", 0, 1, 2),
+				"b": metric("bar", 0, 1, nan),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := New(types.DivergenceConfig{SampleRate: 1})
+			sample := tracker.Sample()
+			for server, metrics := range tt.responses {
+				sample.Add(server, metrics)
+			}
+
+			got := tracker.Compare(sample)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if !reflect.DeepEqual(tracker.Counters(), append([]types.ReplicaDivergence{}, tt.want...)) {
+				t.Errorf("counters %+v, want %+v", tracker.Counters(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRecent(t *testing.T) {
+	tracker := New(types.DivergenceConfig{SampleRate: 1, RecentSize: 2})
+	for _, name := range []string{"a", "b", "c"} {
+		sample := tracker.Sample()
+		sample.Add("s1", []protov3.FetchResponse{{Name: name, StepTime: 60, StopTime: 60, Values: []float64{1}}})
+		sample.Add("s2", []protov3.FetchResponse{{Name: name, StepTime: 60, StopTime: 60, Values: []float64{2}}})
+		tracker.Compare(sample)
+
+		// Responses that came after comparison are ignored
+		sample.Add("s3", []protov3.FetchResponse{{Name: "late", StepTime: 60, StopTime: 60, Values: []float64{1}}})
+	}
+
+	recent := tracker.Recent()
+	names := make([]string, 0, len(recent))
+	for _, e := range recent {
+		names = append(names, e.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"c", "b"}) {
+		t.Errorf("unexpected recent metrics %v", names)
+	}
+	if !reflect.DeepEqual(recent[0].Servers, []string{"s1", "s2"}) {
+		t.Errorf("unexpected servers %v", recent[0].Servers)
+	}
+}
+
+func TestMaxPrefixes(t *testing.T) {
+	tracker := New(types.DivergenceConfig{SampleRate: 1, MaxPrefixes: 2})
+	for _, name := range []string{"a.x", "b.x", "c.x", "d.x", "a.y"} {
+		sample := tracker.Sample()
+		sample.Add("s1", []protov3.FetchResponse{{Name: name, StepTime: 60, StopTime: 60, Values: []float64{1}}})
+		sample.Add("s2", []protov3.FetchResponse{{Name: name, StepTime: 60, StopTime: 60, Values: []float64{2}}})
+		tracker.Compare(sample)
+	}
+
+	want := []types.ReplicaDivergence{
+		{Server: "s1", Prefix: OtherPrefix, Points: 2},
+		{Server: "s1", Prefix: "a", Points: 2},
+		{Server: "s1", Prefix: "b", Points: 1},
+		{Server: "s2", Prefix: OtherPrefix, Points: 2},
+		{Server: "s2", Prefix: "a", Points: 2},
+		{Server: "s2", Prefix: "b", Points: 1},
+	}
+	if got := tracker.Counters(); !reflect.DeepEqual(got, want) {
+		t.Errorf("counters %+v, want %+v", got, want)
+	}
+}
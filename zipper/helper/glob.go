@@ -0,0 +1,97 @@
+package helper
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/ansel1/merry"
+)
+
+var ErrInvalidGlob = merry.New("invalid glob")
+
+// HasGlob checks if metric name or it's node contains wildcards
+func HasGlob(s string) bool {
+	return strings.ContainsAny(s, "*?[{")
+}
+
+// ValidateGlob checks that all brackets and braces of the glob are closed
+func ValidateGlob(glob string) error {
+	inBraces := false
+	for i := 0; i < len(glob); i++ {
+		switch glob[i] {
+		case '[':
+			j := strings.IndexByte(glob[i:], ']')
+			if j < 0 {
+				return ErrInvalidGlob.Here().WithMessagef("unclosed '[' in '%s'", glob)
+			}
+			i += j
+		case '{':
+			if inBraces {
+				return ErrInvalidGlob.Here().WithMessagef("nested '{' in '%s'", glob)
+			}
+			inBraces = true
+		case '}':
+			if !inBraces {
+				return ErrInvalidGlob.Here().WithMessagef("unexpected '}' in '%s'", glob)
+			}
+			inBraces = false
+		}
+	}
+	if inBraces {
+		return ErrInvalidGlob.Here().WithMessagef("unclosed '{' in '%s'", glob)
+	}
+	return nil
+}
+
+// GlobToRegex converts graphite glob to unanchored regex, that is understood both by Go and by POSIX regex engines of
+// databases. anyChar is used for the wildcards, e.x. `[^.]` to stay within a single node. Unclosed brackets and braces
+// are matched literally.
+func GlobToRegex(glob string, anyChar string) string {
+	var sb strings.Builder
+	for {
+		n := strings.IndexAny(glob, "*?[{")
+		if n < 0 {
+			sb.WriteString(regexp.QuoteMeta(glob))
+			return sb.String()
+		}
+		sb.WriteString(regexp.QuoteMeta(glob[:n]))
+		ch := glob[n]
+		glob = glob[n+1:]
+
+		switch ch {
+		case '*':
+			sb.WriteString(anyChar + "*")
+		case '?':
+			sb.WriteString(anyChar)
+		case '[':
+			n = strings.IndexByte(glob, ']')
+			if n < 0 {
+				sb.WriteString(regexp.QuoteMeta("[" + glob))
+				return sb.String()
+			}
+			sb.WriteString("[" + glob[:n+1])
+			glob = glob[n+1:]
+		case '{':
+			n = strings.IndexByte(glob, '}')
+			if n < 0 {
+				sb.WriteString(regexp.QuoteMeta("{" + glob))
+				return sb.String()
+			}
+			alts := strings.Split(glob[:n], ",")
+			for i := range alts {
+				alts[i] = GlobToRegex(alts[i], anyChar)
+			}
+			sb.WriteString("(" + strings.Join(alts, "|") + ")")
+			glob = glob[n+1:]
+		}
+	}
+}
+
+// GlobRegexp compiles anchored regex for the glob, invalid glob is matched literally
+func GlobRegexp(glob string, anyChar string) *regexp.Regexp {
+	re, err := regexp.Compile("^" + GlobToRegex(glob, anyChar) + "$")
+	if err != nil {
+		return regexp.MustCompile("^" + regexp.QuoteMeta(glob) + "$")
+	}
+	return re
+}
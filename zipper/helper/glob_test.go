@@ -0,0 +1,37 @@
+package helper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGlobToRegex(t *testing.T) {
+	tests := []struct {
+		glob string
+		want string
+	}{
+		{"foo.bar", `foo\.bar`},
+		{"foo.*", `foo\.[^.]*`},
+		{"foo.ba?", `foo\.ba[^.]`},
+		{"foo.[ab]c", `foo\.[ab]c`},
+		{"foo.{a,b*}", `foo\.(a|b[^.]*)`},
+		{"foo,bar", `foo,bar`},
+		{"foo.{a,b", `foo\.\{a,b`},
+		{"foo.[ab", `foo\.\[ab`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.glob, func(t *testing.T) {
+			assert.Equal(t, tt.want, GlobToRegex(tt.glob, "[^.]"))
+		})
+	}
+}
+
+func TestValidateGlob(t *testing.T) {
+	for _, glob := range []string{"foo.*", "foo.{a,b}[cd]", "foo"} {
+		assert.NoError(t, ValidateGlob(glob), glob)
+	}
+	for _, glob := range []string{"foo.{a,b", "foo.[ab", "foo}", "{a,{b}}"} {
+		assert.Error(t, ValidateGlob(glob), glob)
+	}
+}
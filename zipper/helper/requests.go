@@ -80,6 +80,12 @@ func stripHtmlTags(s string, maxLen int) string {
 	return s
 }
 
+// PostRequest is a request that is sent with POST method and additional headers, e.x. for protocols with compressed body
+type PostRequest interface {
+	types.Request
+	Headers() map[string]string
+}
+
 type ServerResponse struct {
 	Server   string
 	Response []byte
@@ -107,6 +113,11 @@ func NewHttpQuery(groupName string, servers []string, maxTries int, limiter limi
 	}
 }
 
+// CloseIdleConnections closes idle connections to the servers
+func (c *HttpQuery) CloseIdleConnections() {
+	c.client.CloseIdleConnections()
+}
+
 func (c *HttpQuery) pickServer(logger *zap.Logger) string {
 	if len(c.servers) == 1 {
 		// No need to do heavy operations here
@@ -152,13 +163,24 @@ func (c *HttpQuery) doRequest(ctx context.Context, logger *zap.Logger, server, u
 		zap.String("uri", u.String()),
 	)
 
+	method := "GET"
+	postRequest, isPost := r.(PostRequest)
+	if isPost {
+		method = "POST"
+	}
+
 	// TODO: change to NewRequestWithContext
-	req, err := http.NewRequest("GET", u.String(), reader)
+	req, err := http.NewRequest(method, u.String(), reader)
 	if err != nil {
 		return nil, merry.Here(err).WithValue("server", server)
 	}
 
 	req.Header.Set("Accept", c.encoding)
+	if isPost {
+		for k, v := range postRequest.Headers() {
+			req.Header.Set(k, v)
+		}
+	}
 	req = util.MarshalPassHeaders(ctx, util.MarshalCtx(ctx, util.MarshalCtx(ctx, req, util.HeaderUUIDZipper), util.HeaderUUIDAPI))
 
 	logger.Debug("trying to get slot",
@@ -0,0 +1,107 @@
+package helper
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/ansel1/merry"
+)
+
+var ErrInvalidTagExpr = merry.New("invalid tag expression")
+
+var tagExprRe = regexp.MustCompile(`'([^']*)'|"([^"]*)"`)
+
+// TagExpressions extracts tag expressions from seriesByTag query
+func TagExpressions(query string) []string {
+	var exprs []string
+	for _, m := range tagExprRe.FindAllStringSubmatch(query, -1) {
+		e := m[1]
+		if e == "" {
+			e = m[2]
+		}
+		exprs = append(exprs, strings.TrimSpace(e))
+	}
+
+	return exprs
+}
+
+// TagExpr is a single seriesByTag expression: tag=value, tag!=value, tag=~regex or tag!=~regex
+type TagExpr struct {
+	Tag   string
+	Op    string
+	Value string
+	// Re is compiled Value for regex operators, it's anchored to the beginning of the value as graphite does
+	Re *regexp.Regexp
+}
+
+// ParseTagExpr parses single seriesByTag expression
+func ParseTagExpr(s string) (TagExpr, error) {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 {
+		return TagExpr{}, ErrInvalidTagExpr.Here().WithMessagef("invalid tag expression '%s'", s)
+	}
+
+	e := TagExpr{Tag: s[:i], Op: "="}
+	if s[i-1] == '!' {
+		e.Tag = s[:i-1]
+		e.Op = "!="
+	}
+	e.Value = s[i+1:]
+	if strings.HasPrefix(e.Value, "~") {
+		e.Op += "~"
+		e.Value = e.Value[1:]
+		re, err := regexp.Compile("^(?:" + e.Value + ")")
+		if err != nil {
+			return TagExpr{}, ErrInvalidTagExpr.Here().WithCause(err).WithValue("expression", s)
+		}
+		e.Re = re
+	}
+	if e.Tag == "" {
+		return TagExpr{}, ErrInvalidTagExpr.Here().WithMessagef("invalid tag expression '%s'", s)
+	}
+
+	return e, nil
+}
+
+// ParseTagExprs parses all expressions of seriesByTag query
+func ParseTagExprs(exprs []string) ([]TagExpr, error) {
+	res := make([]TagExpr, 0, len(exprs))
+	for _, s := range exprs {
+		e, err := ParseTagExpr(s)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+	return res, nil
+}
+
+// Match checks value of the tag against expression
+func (e TagExpr) Match(v string) bool {
+	switch e.Op {
+	case "=":
+		return v == e.Value
+	case "!=":
+		return v != e.Value
+	case "=~":
+		return e.Re.MatchString(v)
+	case "!=~":
+		return !e.Re.MatchString(v)
+	}
+	return false
+}
+
+// MatchTags checks series' tags, absent tag is treated as empty value as graphite does
+func (e TagExpr) MatchTags(tags map[string]string) bool {
+	return e.Match(tags[e.Tag])
+}
+
+// MatchAllTags checks series' tags against all expressions
+func MatchAllTags(exprs []TagExpr, tags map[string]string) bool {
+	for _, e := range exprs {
+		if !e.MatchTags(tags) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,37 @@
+package helper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagExpressions(t *testing.T) {
+	assert.Equal(t, []string{"name=cpu", "dc=~ams.*"}, TagExpressions(`seriesByTag('name=cpu', "dc=~ams.*")`))
+}
+
+func TestParseTagExprs(t *testing.T) {
+	exprs, err := ParseTagExprs([]string{"name=cpu", "dc!=ams", "host=~web", "env!=~prod|stage"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tests := []struct {
+		tags map[string]string
+		want bool
+	}{
+		{map[string]string{"name": "cpu", "dc": "fra", "host": "web01", "env": "dev"}, true},
+		{map[string]string{"name": "cpu", "host": "web01"}, true},
+		{map[string]string{"name": "cpu", "dc": "ams", "host": "web01"}, false},
+		{map[string]string{"name": "cpu", "host": "db01"}, false},
+		{map[string]string{"name": "cpu", "host": "web01", "env": "production"}, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, MatchAllTags(exprs, tt.tags), tt.tags)
+	}
+
+	for _, s := range []string{"=cpu", "name", "!=cpu", "host=~("} {
+		_, err := ParseTagExpr(s)
+		assert.Error(t, err, s)
+	}
+}
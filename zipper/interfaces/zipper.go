@@ -21,3 +21,16 @@ type CarbonZipper interface {
 	TagValues(ctx context.Context, query string, limit int64) ([]string, merry.Error)
 	ScaleToCommonStep() bool
 }
+
+// PushdownZipper is implemented by zippers whose backends could evaluate some graphite functions
+// passed as FilterFunctions of the fetch request
+type PushdownZipper interface {
+	// PushdownFunctions returns functions that are supported by all backends
+	PushdownFunctions() []string
+}
+
+// MetricsZipper is implemented by zippers that could list all metrics of backends and their details
+type MetricsZipper interface {
+	List(ctx context.Context) (*pb.ListMetricsResponse, *zipperTypes.Stats, merry.Error)
+	Stats(ctx context.Context) (*pb.MetricDetailsResponse, *zipperTypes.Stats, merry.Error)
+}
@@ -0,0 +1,738 @@
+package influxdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ansel1/merry"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/limiter"
+	"github.com/go-graphite/carbonapi/zipper/helper"
+	"github.com/go-graphite/carbonapi/zipper/httpHeaders"
+	"github.com/go-graphite/carbonapi/zipper/metadata"
+	"github.com/go-graphite/carbonapi/zipper/protocols/prometheus/helpers"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+func init() {
+	aliases := []string{"influxdb", "influxql"}
+	metadata.Metadata.Lock()
+	for _, name := range aliases {
+		metadata.Metadata.SupportedProtocols[name] = struct{}{}
+		metadata.Metadata.ProtocolInits[name] = New
+		metadata.Metadata.ProtocolInitsWithLimiter[name] = NewWithLimiter
+	}
+	defer metadata.Metadata.Unlock()
+}
+
+// aggregations maps InfluxQL aggregation functions to graphite consolidation functions
+var aggregations = map[string]string{
+	"mean":   "average",
+	"median": "median",
+	"sum":    "sum",
+	"min":    "min",
+	"max":    "max",
+	"first":  "first",
+	"last":   "last",
+}
+
+// InfluxDBGroup reads metrics from InfluxDB 1.x (InfluxQL), implements BackendServer interface.
+// Graphite paths are mapped to measurements, tags and fields with the templates of InfluxDB graphite input.
+type InfluxDBGroup struct {
+	groupName            string
+	servers              []string
+	maxMetricsPerRequest int
+
+	database    string
+	username    string
+	password    string
+	templates   []*template
+	separator   string
+	field       string
+	aggregation string
+
+	step              int64
+	maxPointsPerQuery int64
+
+	limiter   limiter.ServerLimiter
+	logger    *zap.Logger
+	httpQuery *helper.HttpQuery
+}
+
+func stringOption(logger *zap.Logger, config types.BackendV2, name string, value *string) {
+	opt, ok := config.BackendOptions[name]
+	if !ok {
+		return
+	}
+	s, ok := opt.(string)
+	if !ok {
+		logger.Fatal("failed to parse "+name,
+			zap.String("type_parsed", fmt.Sprintf("%T", opt)),
+			zap.String("type_expected", "string"),
+		)
+	}
+	*value = s
+}
+
+func NewWithLimiter(logger *zap.Logger, config types.BackendV2, tldCacheDisabled, requireSuccessAll bool, limiter limiter.ServerLimiter) (types.BackendServer, merry.Error) {
+	logger = logger.With(zap.String("type", "influxdb"), zap.String("protocol", config.Protocol), zap.String("name", config.GroupName))
+
+	logger.Warn("support for this backend protocol is experimental, use with caution")
+	httpClient := helper.GetHTTPClient(logger, config)
+
+	c := &InfluxDBGroup{
+		groupName:            config.GroupName,
+		servers:              config.Servers,
+		maxMetricsPerRequest: *config.MaxBatchSize,
+
+		separator:         ".",
+		field:             "value",
+		aggregation:       "mean",
+		step:              60,
+		maxPointsPerQuery: 11000,
+
+		limiter: limiter,
+		logger:  logger,
+	}
+
+	stringOption(logger, config, "influxdb_database", &c.database)
+	if c.database == "" {
+		logger.Fatal("influxdb_database is not set")
+	}
+	stringOption(logger, config, "influxdb_username", &c.username)
+	stringOption(logger, config, "influxdb_password", &c.password)
+	stringOption(logger, config, "influxdb_separator", &c.separator)
+	stringOption(logger, config, "influxdb_field", &c.field)
+	stringOption(logger, config, "influxdb_aggregation", &c.aggregation)
+	if _, ok := aggregations[c.aggregation]; !ok {
+		logger.Fatal("unsupported influxdb_aggregation",
+			zap.String("aggregation", c.aggregation),
+		)
+	}
+
+	var step string
+	stringOption(logger, config, "influxdb_step", &step)
+	if step != "" {
+		d, err := time.ParseDuration(step)
+		if err != nil || d < time.Second {
+			logger.Fatal("failed to parse influxdb_step",
+				zap.String("value_provided", step),
+				zap.String("type_expected", "time.Duration"),
+			)
+		}
+		c.step = int64(d.Seconds())
+	}
+
+	if mppqI, ok := config.BackendOptions["max_points_per_query"]; ok {
+		mppq, ok := mppqI.(int)
+		if !ok {
+			logger.Fatal("failed to parse max_points_per_query",
+				zap.String("type_parsed", fmt.Sprintf("%T", mppqI)),
+				zap.String("type_expected", "int"),
+			)
+		}
+		c.maxPointsPerQuery = int64(mppq)
+	}
+
+	templates := []string{defaultTemplate}
+	if templatesI, ok := config.BackendOptions["influxdb_templates"]; ok {
+		list, ok := templatesI.([]interface{})
+		if !ok {
+			logger.Fatal("failed to parse influxdb_templates",
+				zap.String("type_parsed", fmt.Sprintf("%T", templatesI)),
+				zap.String("type_expected", "[]string"),
+			)
+		}
+		templates = templates[:0]
+		for _, v := range list {
+			s, ok := v.(string)
+			if !ok {
+				logger.Fatal("failed to parse influxdb_templates",
+					zap.String("type_parsed", fmt.Sprintf("%T", v)),
+					zap.String("type_expected", "string"),
+				)
+			}
+			templates = append(templates, s)
+		}
+	}
+	var defaults []*template
+	for _, s := range templates {
+		t, err := parseTemplate(s)
+		if err != nil {
+			logger.Fatal("failed to parse influxdb_templates",
+				zap.String("template", s),
+				zap.Error(err),
+			)
+		}
+		// templates with filters take precedence over the default ones
+		if t.filter == nil {
+			defaults = append(defaults, t)
+		} else {
+			c.templates = append(c.templates, t)
+		}
+	}
+	c.templates = append(c.templates, defaults...)
+
+	c.httpQuery = helper.NewHttpQuery(config.GroupName, config.Servers, *config.MaxTries, limiter, httpClient, httpHeaders.ContentTypeJSON)
+
+	return c, nil
+}
+
+func New(logger *zap.Logger, config types.BackendV2, tldCacheDisabled, requireSuccessAll bool) (types.BackendServer, merry.Error) {
+	if config.ConcurrencyLimit == nil {
+		return nil, types.ErrConcurrencyLimitNotSet
+	}
+	if len(config.Servers) == 0 {
+		return nil, types.ErrNoServersSpecified
+	}
+	l := limiter.NewServerLimiter(config.Servers, *config.ConcurrencyLimit)
+
+	return NewWithLimiter(logger, config, tldCacheDisabled, requireSuccessAll, l)
+}
+
+func (c *InfluxDBGroup) Children() []types.BackendServer {
+	return []types.BackendServer{c}
+}
+
+func (c *InfluxDBGroup) CloseIdleConnections() {
+	c.httpQuery.CloseIdleConnections()
+}
+
+func (c InfluxDBGroup) MaxMetricsPerRequest() int {
+	return c.maxMetricsPerRequest
+}
+
+func (c InfluxDBGroup) Name() string {
+	return c.groupName
+}
+
+func (c InfluxDBGroup) Backends() []string {
+	return c.servers
+}
+
+type influxSeries struct {
+	Name    string            `json:"name"`
+	Tags    map[string]string `json:"tags"`
+	Columns []string          `json:"columns"`
+	Values  [][]interface{}   `json:"values"`
+}
+
+type influxResponse struct {
+	Results []struct {
+		Series []influxSeries `json:"series"`
+		Error  string         `json:"error"`
+	} `json:"results"`
+	Error string `json:"error"`
+}
+
+// query runs InfluxQL statement, timestamps are requested in seconds
+func (c *InfluxDBGroup) query(ctx context.Context, logger *zap.Logger, q string) ([]influxSeries, merry.Error) {
+	v := url.Values{
+		"db":    []string{c.database},
+		"q":     []string{q},
+		"epoch": []string{"s"},
+	}
+	if c.username != "" {
+		v.Set("u", c.username)
+		v.Set("p", c.password)
+	}
+	rewrite, _ := url.Parse("http://127.0.0.1/query")
+	rewrite.RawQuery = v.Encode()
+
+	logger.Debug("will do query", zap.String("query", q))
+	res, e := c.httpQuery.DoQuery(ctx, logger, rewrite.RequestURI(), nil)
+	if e != nil {
+		return nil, e.WithValue("query", q)
+	}
+
+	var r influxResponse
+	if err := json.Unmarshal(res.Response, &r); err != nil {
+		return nil, types.ErrFailedToFetch.Here().WithCause(err).WithValue("query", q)
+	}
+	if r.Error != "" {
+		return nil, types.ErrFailedToFetch.Here().WithMessage(r.Error).WithValue("query", q)
+	}
+
+	var series []influxSeries
+	for _, result := range r.Results {
+		if result.Error != "" {
+			return nil, types.ErrFailedToFetch.Here().WithMessage(result.Error).WithValue("query", q)
+		}
+		series = append(series, result.Series...)
+	}
+	return series, nil
+}
+
+// stringValues returns i-th column of the series as strings
+func stringValues(s influxSeries, i int) []string {
+	res := make([]string, 0, len(s.Values))
+	for _, v := range s.Values {
+		if i < len(v) {
+			if str, ok := v[i].(string); ok {
+				res = append(res, str)
+			}
+		}
+	}
+	return res
+}
+
+// fetchQuery is a statement for a single fetch request and the way to name its results
+type fetchQuery struct {
+	statement string
+	name      func(s influxSeries, column string) (string, bool)
+}
+
+func (c *InfluxDBGroup) timeRange(start, stop int64) string {
+	return "time >= " + strconv.FormatInt(start, 10) + "s AND time < " + strconv.FormatInt(stop, 10) + "s"
+}
+
+func (c *InfluxDBGroup) tagFetchQuery(target string, start, stop, step int64) (*fetchQuery, error) {
+	tq, err := newTagQuery(helper.TagExpressions(target))
+	if err != nil {
+		return nil, err
+	}
+
+	conds := append([]string{c.timeRange(start, stop)}, tq.conditions...)
+	stmt := fmt.Sprintf("SELECT %s(%s) FROM %s WHERE %s GROUP BY time(%ds), * fill(none)",
+		c.aggregation, quoteIdent(c.field), tq.from, strings.Join(conds, " AND "), step)
+
+	return &fetchQuery{
+		statement: stmt,
+		name: func(s influxSeries, column string) (string, bool) {
+			if !tq.matchName(s.Name) {
+				return "", false
+			}
+			return taggedName(s.Name, s.Tags), true
+		},
+	}, nil
+}
+
+func (c *InfluxDBGroup) pathFetchQueries(target string, start, stop, step int64) []fetchQuery {
+	nodes := strings.Split(target, ".")
+
+	var res []fetchQuery
+	for _, t := range c.templates {
+		ok, exact := t.matchFilter(nodes, false)
+		if !ok || len(nodes) < len(t.nodes) || (len(nodes) > len(t.nodes) && !t.greedy()) {
+			continue
+		}
+		t := t
+
+		field := c.field
+		if t.hasField() {
+			field = t.field(nodes, c.separator)
+		}
+		selector := quoteIdent(field)
+		if helper.HasGlob(field) {
+			selector = quoteRegex("^" + helper.GlobToRegex(field, ".") + "$")
+		}
+
+		conds := append([]string{c.timeRange(start, stop)}, globConditions(t.tagPatterns(nodes, len(nodes)), t.tags)...)
+		groupBy := []string{fmt.Sprintf("time(%ds)", step)}
+		for _, tag := range t.tagKeys() {
+			groupBy = append(groupBy, quoteIdent(tag))
+		}
+		stmt := fmt.Sprintf("SELECT %s(%s) FROM %s WHERE %s GROUP BY %s fill(none)",
+			c.aggregation, selector, measurementSource(t.measurementRegex(nodes, c.separator, false)),
+			strings.Join(conds, " AND "), strings.Join(groupBy, ", "))
+
+		res = append(res, fetchQuery{
+			statement: stmt,
+			name: func(s influxSeries, column string) (string, bool) {
+				f := field
+				if helper.HasGlob(field) {
+					f = strings.TrimPrefix(column, c.aggregation+"_")
+				}
+				if !t.hasField() && f != c.field {
+					return "", false
+				}
+				name, _, ok := t.name(row{measurement: s.Name, tags: s.Tags, field: f}, nodes, c.separator, 0)
+				if !ok {
+					return "", false
+				}
+				return strings.Join(name, "."), true
+			},
+		})
+		if exact {
+			break
+		}
+	}
+	return res
+}
+
+func (c *InfluxDBGroup) Fetch(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, merry.Error) {
+	logger := c.logger.With(zap.String("type", "fetch"), zap.String("request", request.String()))
+	stats := &types.Stats{}
+
+	var r protov3.MultiFetchResponse
+	var e merry.Error
+	for _, m := range request.Metrics {
+		pathExpr := m.PathExpression
+		if pathExpr == "" {
+			pathExpr = m.Name
+		}
+
+		maxPointsPerQuery := c.maxPointsPerQuery
+		if m.MaxDataPoints != 0 {
+			maxPointsPerQuery = m.MaxDataPoints
+		}
+		step := helpers.AdjustStep(m.StartTime, m.StopTime, maxPointsPerQuery, c.step, 0)
+		start := m.StartTime - m.StartTime%step
+		points := (m.StopTime - start + step - 1) / step
+
+		var queries []fetchQuery
+		if strings.HasPrefix(m.Name, "seriesByTag") {
+			q, err := c.tagFetchQuery(m.Name, m.StartTime, m.StopTime, step)
+			if err != nil {
+				stats.RenderErrors++
+				e = types.ErrFailedToFetch.Here().WithCause(err).WithValue("target", m.Name)
+				continue
+			}
+			queries = append(queries, *q)
+		} else {
+			queries = c.pathFetchQueries(m.Name, m.StartTime, m.StopTime, step)
+		}
+
+		seen := make(map[string]struct{})
+		for _, q := range queries {
+			stats.RenderRequests++
+			series, err := c.query(ctx, logger, q.statement)
+			if err != nil {
+				stats.RenderErrors++
+				if merry.Is(err, types.ErrTimeoutExceeded) {
+					stats.Timeouts++
+					stats.RenderTimeouts++
+				}
+				if e == nil {
+					e = err
+				} else {
+					e = e.WithCause(err)
+				}
+				continue
+			}
+
+			for _, s := range series {
+				for col := 1; col < len(s.Columns); col++ {
+					name, ok := q.name(s, s.Columns[col])
+					if !ok {
+						continue
+					}
+					if _, ok := seen[name]; ok {
+						continue
+					}
+					seen[name] = struct{}{}
+
+					values := make([]float64, points)
+					for i := range values {
+						values[i] = math.NaN()
+					}
+					for _, v := range s.Values {
+						ts, ok1 := v[0].(float64)
+						value, ok2 := v[col].(float64)
+						i := (int64(ts) - start) / step
+						if !ok1 || !ok2 || i < 0 || i >= points {
+							continue
+						}
+						values[i] = value
+					}
+
+					r.Metrics = append(r.Metrics, protov3.FetchResponse{
+						Name:              name,
+						PathExpression:    pathExpr,
+						ConsolidationFunc: aggregations[c.aggregation],
+						StartTime:         start,
+						StopTime:          start + points*step,
+						StepTime:          step,
+						Values:            values,
+						RequestStartTime:  m.StartTime,
+						RequestStopTime:   m.StopTime,
+					})
+				}
+			}
+		}
+	}
+
+	if e != nil {
+		stats.FailedServers = []string{c.groupName}
+		logger.Error("errors occurred while getting results",
+			zap.Any("errors", e),
+		)
+		return &r, stats, e
+	}
+	if len(r.Metrics) == 0 {
+		return &r, stats, types.ErrNotFound
+	}
+	return &r, stats, nil
+}
+
+// findRows returns series that could match the query. Statement depends on the kind of the last node of the query:
+// measurements for measurement, tag values for tag and field keys for field, skipped node doesn't need any. If the query has globs in the tags or
+// fields before the last node, the combinations are taken from the series.
+func (c *InfluxDBGroup) findRows(ctx context.Context, logger *zap.Logger, t *template, query []string) ([]row, merry.Error) {
+	last := len(query) - 1
+	target, ok := t.node(last)
+	if !ok {
+		return nil, nil
+	}
+
+	globBefore := false
+	for i := 0; i < last && i < len(t.nodes); i++ {
+		k := t.nodes[i].kind
+		if (k == nodeTag || k == nodeField) && helper.HasGlob(query[i]) {
+			globBefore = true
+		}
+	}
+
+	from := measurementSource(t.measurementRegex(query, c.separator, true))
+	where := ""
+	if conds := globConditions(t.tagPatterns(query, len(query)), t.tags); len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var rows []row
+	switch {
+	case target.kind == nodeSkip:
+		// value of the node is taken from the filter of the template
+		rows = append(rows, row{})
+	case globBefore:
+		series, err := c.query(ctx, logger, "SHOW SERIES FROM "+from+where)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range series {
+			for _, key := range stringValues(s, 0) {
+				rows = append(rows, seriesKey(key))
+			}
+		}
+	case target.kind == nodeMeasurement || target.kind == nodeMeasurementGreedy:
+		stmt := "SHOW MEASUREMENTS WITH MEASUREMENT =~ " + quoteRegex("^"+t.measurementRegex(query, c.separator, true)+"$") + where
+		series, err := c.query(ctx, logger, stmt)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range series {
+			for _, m := range stringValues(s, 0) {
+				rows = append(rows, row{measurement: m})
+			}
+		}
+	case target.kind == nodeTag:
+		series, err := c.query(ctx, logger, "SHOW TAG VALUES FROM "+from+" WITH KEY = "+quoteIdent(target.tag)+where)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range series {
+			for _, v := range stringValues(s, 1) {
+				rows = append(rows, row{measurement: s.Name, tags: map[string]string{target.tag: v}})
+			}
+		}
+	case target.kind == nodeField || target.kind == nodeFieldGreedy:
+		series, err := c.query(ctx, logger, "SHOW FIELD KEYS FROM "+from)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range series {
+			for _, f := range stringValues(s, 0) {
+				rows = append(rows, row{measurement: s.Name, field: f})
+			}
+		}
+	}
+	return rows, nil
+}
+
+func (c *InfluxDBGroup) find(ctx context.Context, logger *zap.Logger, query string) ([]protov3.GlobMatch, merry.Error) {
+	nodes := strings.Split(query, ".")
+	patterns := make([]string, len(nodes))
+	for i := range nodes {
+		patterns[i] = "^" + helper.GlobToRegex(nodes[i], "[^.]") + "$"
+	}
+
+	seen := make(map[protov3.GlobMatch]struct{})
+	res := make([]protov3.GlobMatch, 0)
+	for _, t := range c.templates {
+		ok, exact := t.matchFilter(nodes, true)
+		if !ok {
+			continue
+		}
+		rows, err := c.findRows(ctx, logger, t, nodes)
+		if err != nil {
+			return nil, err
+		}
+
+	ROWS:
+		for _, r := range rows {
+			name, total, ok := t.name(r, nodes, c.separator, len(nodes))
+			if !ok || len(name) < len(nodes) {
+				continue
+			}
+			for i := range name {
+				if !helper.GlobRegexp(nodes[i], "[^.]").MatchString(name[i]) {
+					continue ROWS
+				}
+			}
+			m := protov3.GlobMatch{Path: strings.Join(name, "."), IsLeaf: total == len(nodes)}
+			if _, ok := seen[m]; ok {
+				continue
+			}
+			seen[m] = struct{}{}
+			res = append(res, m)
+		}
+		if exact {
+			break
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Path < res[j].Path
+	})
+	return res, nil
+}
+
+func (c *InfluxDBGroup) Find(ctx context.Context, request *protov3.MultiGlobRequest) (*protov3.MultiGlobResponse, *types.Stats, merry.Error) {
+	logger := c.logger.With(zap.String("type", "find"), zap.Strings("request", request.Metrics))
+	stats := &types.Stats{}
+
+	r := protov3.MultiGlobResponse{
+		Metrics: make([]protov3.GlobResponse, 0),
+	}
+	var e merry.Error
+	for _, query := range request.Metrics {
+		stats.FindRequests++
+		matches, err := c.find(ctx, logger, query)
+		if err != nil {
+			stats.FindErrors++
+			if merry.Is(err, types.ErrTimeoutExceeded) {
+				stats.Timeouts++
+				stats.FindTimeouts++
+			}
+			if e == nil {
+				e = err
+			} else {
+				e = e.WithCause(err)
+			}
+			continue
+		}
+		r.Metrics = append(r.Metrics, protov3.GlobResponse{
+			Name:    query,
+			Matches: matches,
+		})
+	}
+
+	if e != nil {
+		stats.FailedServers = []string{c.groupName}
+		logger.Error("errors occurred while getting results",
+			zap.Any("errors", e),
+		)
+		return &r, stats, e
+	}
+	return &r, stats, nil
+}
+
+func (c *InfluxDBGroup) Info(ctx context.Context, request *protov3.MultiMetricsInfoRequest) (*protov3.ZipperInfoResponse, *types.Stats, merry.Error) {
+	return nil, nil, types.ErrNotSupportedByBackend
+}
+
+func (c *InfluxDBGroup) List(ctx context.Context) (*protov3.ListMetricsResponse, *types.Stats, merry.Error) {
+	return nil, nil, types.ErrNotImplementedYet
+}
+func (c *InfluxDBGroup) Stats(ctx context.Context) (*protov3.MetricDetailsResponse, *types.Stats, merry.Error) {
+	return nil, nil, types.ErrNotSupportedByBackend
+}
+
+func (c *InfluxDBGroup) doTagQuery(ctx context.Context, isTagName bool, query string, limit int64) ([]string, merry.Error) {
+	logger := c.logger.With(zap.String("type", "tagValues"))
+	if isTagName {
+		logger = c.logger.With(zap.String("type", "tagName"))
+	}
+
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return []string{}, merry.Wrap(err)
+	}
+	tq, err := newTagQuery(params["expr"])
+	if err != nil {
+		return []string{}, merry.Wrap(err)
+	}
+
+	var stmt, prefix string
+	column := 0
+	switch {
+	case isTagName:
+		stmt = "SHOW TAG KEYS FROM " + tq.from + tq.where()
+		prefix = params.Get("tagPrefix")
+	case params.Get("tag") == "":
+		return []string{}, types.ErrNoTagSpecified
+	case params.Get("tag") == "name":
+		stmt = "SHOW MEASUREMENTS" + tq.where()
+		prefix = params.Get("valuePrefix")
+	default:
+		stmt = "SHOW TAG VALUES FROM " + tq.from + " WITH KEY = " + quoteIdent(params.Get("tag")) + tq.where()
+		prefix = params.Get("valuePrefix")
+		column = 1
+	}
+
+	series, e := c.query(ctx, logger, stmt)
+	if e != nil {
+		return []string{}, e
+	}
+
+	uniq := make(map[string]struct{})
+	if isTagName && strings.HasPrefix("name", prefix) {
+		uniq["name"] = struct{}{}
+	}
+	for _, s := range series {
+		// SHOW MEASUREMENTS returns single series, the rest are grouped by measurement
+		if params.Get("tag") != "name" && !tq.matchName(s.Name) {
+			continue
+		}
+		for _, v := range stringValues(s, column) {
+			if params.Get("tag") == "name" && !tq.matchName(v) {
+				continue
+			}
+			if strings.HasPrefix(v, prefix) {
+				uniq[v] = struct{}{}
+			}
+		}
+	}
+
+	res := make([]string, 0, len(uniq))
+	for v := range uniq {
+		res = append(res, v)
+	}
+	sort.Strings(res)
+	if limit > 0 && int64(len(res)) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+func (c *InfluxDBGroup) TagNames(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
+	return c.doTagQuery(ctx, true, query, limit)
+}
+
+func (c *InfluxDBGroup) TagValues(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
+	return c.doTagQuery(ctx, false, query, limit)
+}
+
+func (c *InfluxDBGroup) ProbeTLDs(ctx context.Context) ([]string, merry.Error) {
+	res, _, err := c.Find(ctx, &protov3.MultiGlobRequest{Metrics: []string{"*"}})
+	if err != nil {
+		return nil, err
+	}
+
+	var tlds []string
+	for _, m := range res.Metrics {
+		for _, v := range m.Matches {
+			tlds = append(tlds, v.Path)
+		}
+	}
+	return tlds, nil
+}
@@ -0,0 +1,228 @@
+package influxdb
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// stubServer answers InfluxQL statements with the predefined responses and records all statements
+type stubServer struct {
+	sync.Mutex
+	responses  map[string]string
+	statements []string
+}
+
+func (s *stubServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if r.URL.Path != "/query" || q.Get("db") != "graphite" || q.Get("epoch") != "s" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.Lock()
+	s.statements = append(s.statements, q.Get("q"))
+	s.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if res, ok := s.responses[q.Get("q")]; ok {
+		_, _ = w.Write([]byte(res))
+		return
+	}
+	_, _ = w.Write([]byte(`{"results":[{"statement_id":0}]}`))
+}
+
+func newTestGroup(t *testing.T, responses map[string]string) (types.BackendServer, *stubServer) {
+	t.Helper()
+
+	stub := &stubServer{responses: responses}
+	srv := httptest.NewServer(stub)
+	t.Cleanup(srv.Close)
+
+	concurrencyLimit := 10
+	maxBatchSize := 100
+	maxTries := 1
+	maxIdleConns := 10
+	idleTimeout := time.Minute
+	keepAlive := time.Minute
+	b, err := New(zap.NewNop(), types.BackendV2{
+		GroupName:             "influx",
+		Protocol:              "influxdb",
+		Servers:               []string{srv.URL},
+		ConcurrencyLimit:      &concurrencyLimit,
+		MaxBatchSize:          &maxBatchSize,
+		MaxTries:              &maxTries,
+		MaxIdleConnsPerHost:   &maxIdleConns,
+		IdleConnectionTimeout: &idleTimeout,
+		KeepAliveInterval:     &keepAlive,
+		Timeouts:              &types.Timeouts{Find: time.Second, Render: time.Second, Connect: time.Second},
+		BackendOptions: map[string]interface{}{
+			"influxdb_database":  "graphite",
+			"influxdb_templates": []interface{}{"measurement*", "servers.* .host.measurement.field dc=ams"},
+		},
+	}, true, false)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return b, stub
+}
+
+func TestFetch(t *testing.T) {
+	nan := math.NaN()
+	b, stub := newTestGroup(t, map[string]string{
+		`SELECT mean("idle") FROM "cpu" WHERE time >= 1000s AND time < 1180s AND "dc" = 'ams' AND "host" = 'a' GROUP BY time(60s), "host" fill(none)`: `{"results":[{"statement_id":0,"series":[
+			{"name":"cpu","tags":{"host":"a"},"columns":["time","mean"],"values":[[960,1],[1080,2.5]]}
+		]}]}`,
+		`SELECT mean(/^.*$/) FROM "cpu" WHERE time >= 1000s AND time < 1180s AND "dc" = 'ams' GROUP BY time(60s), "host" fill(none)`: `{"results":[{"statement_id":0,"series":[
+			{"name":"cpu","tags":{"host":"b"},"columns":["time","mean_idle","mean_user"],"values":[[1020,3,null],[1140,4,5]]},
+			{"name":"cpu","tags":{"host":""},"columns":["time","mean_idle"],"values":[[1020,6]]}
+		]}]}`,
+		`SELECT mean("value") FROM "cpu" WHERE time >= 1000s AND time < 1180s AND "dc" =~ /^(?:am)/ AND "host" != 'b' GROUP BY time(60s), * fill(none)`: `{"results":[{"statement_id":0,"series":[
+			{"name":"cpu","tags":{"dc":"ams","host":"a"},"columns":["time","mean"],"values":[[1080,7]]}
+		]}]}`,
+	})
+
+	tests := []struct {
+		target string
+		want   map[string][]float64
+	}{
+		{
+			target: "servers.a.cpu.idle",
+			want:   map[string][]float64{"servers.a.cpu.idle": {1, nan, 2.5, nan}},
+		},
+		{
+			target: "servers.*.cpu.*",
+			want: map[string][]float64{
+				"servers.b.cpu.idle": {nan, 3, nan, 4},
+				"servers.b.cpu.user": {nan, nan, nan, 5},
+			},
+		},
+		{
+			target: "seriesByTag('name=cpu','dc=~am','host!=b')",
+			want:   map[string][]float64{"cpu;dc=ams;host=a": {nan, nan, 7, nan}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			res, _, err := b.Fetch(context.Background(), &protov3.MultiFetchRequest{
+				Metrics: []protov3.FetchRequest{{Name: tt.target, PathExpression: tt.target, StartTime: 1000, StopTime: 1180}},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %v, statements %q", err, stub.statements)
+			}
+			if len(res.Metrics) != len(tt.want) {
+				t.Fatalf("unexpected response %+v", res.Metrics)
+			}
+			for _, m := range res.Metrics {
+				want, ok := tt.want[m.Name]
+				if !ok {
+					t.Fatalf("unexpected metric %s", m.Name)
+				}
+				if m.PathExpression != tt.target || m.StartTime != 960 || m.StopTime != 1200 || m.StepTime != 60 || m.ConsolidationFunc != "average" {
+					t.Errorf("unexpected metadata %+v", m)
+				}
+				if len(m.Values) != len(want) {
+					t.Fatalf("%s: got %v, want %v", m.Name, m.Values, want)
+				}
+				for i := range want {
+					if m.Values[i] != want[i] && !(math.IsNaN(m.Values[i]) && math.IsNaN(want[i])) {
+						t.Fatalf("%s: got %v, want %v", m.Name, m.Values, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	b, _ := newTestGroup(t, map[string]string{
+		`SHOW MEASUREMENTS WITH MEASUREMENT =~ /^[^\.]*(?:\..*)?$/`: `{"results":[{"statement_id":0,"series":[
+			{"name":"measurements","columns":["name"],"values":[["carbon.agents.a"],["collectd"]]}
+		]}]}`,
+		`SHOW TAG VALUES FROM /^[^\.]+$/ WITH KEY = "host" WHERE "dc" = 'ams'`: `{"results":[{"statement_id":0,"series":[
+			{"name":"cpu","columns":["key","value"],"values":[["host","a"],["host","b"]]},
+			{"name":"mem","columns":["key","value"],"values":[["host","a"]]}
+		]}]}`,
+		`SHOW MEASUREMENTS WITH MEASUREMENT =~ /^[^\.]*$/ WHERE "dc" = 'ams' AND "host" = 'a'`: `{"results":[{"statement_id":0,"series":[
+			{"name":"measurements","columns":["name"],"values":[["cpu"],["mem"]]}
+		]}]}`,
+		`SHOW FIELD KEYS FROM "cpu"`: `{"results":[{"statement_id":0,"series":[
+			{"name":"cpu","columns":["fieldKey","fieldType"],"values":[["idle","float"],["user","float"]]}
+		]}]}`,
+	})
+
+	tests := []struct {
+		query string
+		want  []protov3.GlobMatch
+	}{
+		{
+			query: "*",
+			want:  []protov3.GlobMatch{{Path: "carbon"}, {Path: "collectd", IsLeaf: true}, {Path: "servers"}},
+		},
+		{
+			query: "servers.*",
+			want:  []protov3.GlobMatch{{Path: "servers.a"}, {Path: "servers.b"}},
+		},
+		{
+			query: "servers.a.*",
+			want:  []protov3.GlobMatch{{Path: "servers.a.cpu"}, {Path: "servers.a.mem"}},
+		},
+		{
+			query: "servers.a.cpu.i*",
+			want:  []protov3.GlobMatch{{Path: "servers.a.cpu.idle", IsLeaf: true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			res, _, err := b.Find(context.Background(), &protov3.MultiGlobRequest{Metrics: []string{tt.query}})
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if len(res.Metrics) != 1 || !reflect.DeepEqual(res.Metrics[0].Matches, tt.want) {
+				t.Errorf("got %+v, want %+v", res.Metrics, tt.want)
+			}
+		})
+	}
+}
+
+func TestTags(t *testing.T) {
+	b, _ := newTestGroup(t, map[string]string{
+		`SHOW TAG KEYS FROM "cpu"`: `{"results":[{"statement_id":0,"series":[
+			{"name":"cpu","columns":["tagKey"],"values":[["dc"],["host"]]}
+		]}]}`,
+		`SHOW TAG VALUES FROM /.*/ WITH KEY = "dc" WHERE "host" = 'a'`: `{"results":[{"statement_id":0,"series":[
+			{"name":"cpu","columns":["key","value"],"values":[["dc","ams"]]},
+			{"name":"mem","columns":["key","value"],"values":[["dc","fra"]]}
+		]}]}`,
+		`SHOW MEASUREMENTS WHERE "dc" = 'ams'`: `{"results":[{"statement_id":0,"series":[
+			{"name":"measurements","columns":["name"],"values":[["cpu"],["mem"]]}
+		]}]}`,
+	})
+
+	names, err := b.TagNames(context.Background(), "tagPrefix=h&expr=name%3Dcpu", 0)
+	if err != nil || !reflect.DeepEqual(names, []string{"host"}) {
+		t.Errorf("unexpected tag names %v, error %v", names, err)
+	}
+
+	values, err := b.TagValues(context.Background(), "tag=dc&expr=host%3Da&expr=name!%3Dmem", 0)
+	if err != nil || !reflect.DeepEqual(values, []string{"ams"}) {
+		t.Errorf("unexpected tag values %v, error %v", values, err)
+	}
+
+	values, err = b.TagValues(context.Background(), "tag=name&expr=dc%3Dams", 1)
+	if err != nil || !reflect.DeepEqual(values, []string{"cpu"}) {
+		t.Errorf("unexpected tag values %v, error %v", values, err)
+	}
+}
@@ -0,0 +1,185 @@
+package influxdb
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/go-graphite/carbonapi/zipper/helper"
+)
+
+// quoteIdent quotes identifier (measurement, tag key or field key)
+func quoteIdent(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// quoteString quotes string literal (tag value)
+func quoteString(s string) string {
+	return `'` + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + `'`
+}
+
+// quoteRegex makes regex literal
+func quoteRegex(re string) string {
+	return "/" + strings.ReplaceAll(re, "/", `\/`) + "/"
+}
+
+// measurementSource returns FROM clause for the measurement regex, exact measurement is quoted as identifier
+func measurementSource(re string) string {
+	if unquoted := unquoteMeta(re); unquoted != nil {
+		return quoteIdent(*unquoted)
+	}
+	return quoteRegex("^" + re + "$")
+}
+
+// unquoteMeta returns literal value of the regex if it doesn't contain any metacharacters
+func unquoteMeta(re string) *string {
+	var sb strings.Builder
+	for i := 0; i < len(re); i++ {
+		c := re[i]
+		if c == '\\' && i+1 < len(re) {
+			i++
+			sb.WriteByte(re[i])
+			continue
+		}
+		if strings.IndexByte(`.+*?()|[]{}^$`, c) >= 0 {
+			return nil
+		}
+		sb.WriteByte(c)
+	}
+	s := sb.String()
+	return &s
+}
+
+// globCondition translates glob pattern of the tag to InfluxQL condition
+func globCondition(tag, glob string) string {
+	if !helper.HasGlob(glob) {
+		return quoteIdent(tag) + " = " + quoteString(glob)
+	}
+	return quoteIdent(tag) + " =~ " + quoteRegex("^"+helper.GlobToRegex(glob, ".")+"$")
+}
+
+// globConditions translates patterns of the tags to sorted InfluxQL conditions
+func globConditions(patterns map[string]string, static map[string]string) []string {
+	conds := make([]string, 0, len(patterns)+len(static))
+	for tag, v := range static {
+		conds = append(conds, quoteIdent(tag)+" = "+quoteString(v))
+	}
+	for tag, glob := range patterns {
+		if glob == "*" {
+			continue
+		}
+		conds = append(conds, globCondition(tag, glob))
+	}
+	sort.Strings(conds)
+	return conds
+}
+
+// tagCondition translates expression to InfluxQL condition. Graphite regexes are matched from the beginning of the value.
+func tagCondition(e helper.TagExpr) string {
+	switch e.Op {
+	case "=":
+		return quoteIdent(e.Tag) + " = " + quoteString(e.Value)
+	case "!=":
+		return quoteIdent(e.Tag) + " != " + quoteString(e.Value)
+	case "=~":
+		return quoteIdent(e.Tag) + " =~ " + quoteRegex("^(?:"+e.Value+")")
+	default:
+		return quoteIdent(e.Tag) + " !~ " + quoteRegex("^(?:"+e.Value+")")
+	}
+}
+
+// tagQuery is seriesByTag expressions translated to InfluxQL: measurements and conditions on tags. Negative expressions
+// on the name can't be expressed in FROM clause, so they are checked on the results.
+type tagQuery struct {
+	from       string
+	conditions []string
+	names      []helper.TagExpr
+}
+
+func newTagQuery(exprs []string) (*tagQuery, error) {
+	q := &tagQuery{from: "/.*/"}
+	for _, s := range exprs {
+		e, err := helper.ParseTagExpr(s)
+		if err != nil {
+			return nil, err
+		}
+		if e.Tag != "name" {
+			q.conditions = append(q.conditions, tagCondition(e))
+			continue
+		}
+		switch e.Op {
+		case "=":
+			q.from = quoteIdent(e.Value)
+		case "=~":
+			q.from = quoteRegex("^(?:" + e.Value + ")")
+		}
+		q.names = append(q.names, e)
+	}
+	return q, nil
+}
+
+func (q *tagQuery) matchName(name string) bool {
+	for _, e := range q.names {
+		if !e.Match(name) {
+			return false
+		}
+	}
+	return true
+}
+
+func (q *tagQuery) where() string {
+	if len(q.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(q.conditions, " AND ")
+}
+
+// taggedName builds graphite name of the tagged series
+func taggedName(measurement string, tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k, v := range tags {
+		if v != "" && k != "name" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString(measurement)
+	for _, k := range keys {
+		sb.WriteString(";" + k + "=" + tags[k])
+	}
+	return sb.String()
+}
+
+// seriesKey parses series key returned by SHOW SERIES, e.x. "cpu,host=a,region=us\ west"
+func seriesKey(key string) row {
+	parts := splitUnescaped(key, ',')
+	r := row{measurement: unescapeKey(parts[0]), tags: make(map[string]string)}
+	for _, p := range parts[1:] {
+		kv := splitUnescaped(p, '=')
+		if len(kv) == 2 {
+			r.tags[unescapeKey(kv[0])] = unescapeKey(kv[1])
+		}
+	}
+	return r
+}
+
+func splitUnescaped(s string, sep byte) []string {
+	var res []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == sep {
+			res = append(res, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(res, s[start:])
+}
+
+func unescapeKey(s string) string {
+	return strings.NewReplacer(`\,`, ",", `\=`, "=", `\ `, " ").Replace(s)
+}
@@ -0,0 +1,310 @@
+package influxdb
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/ansel1/merry"
+
+	"github.com/go-graphite/carbonapi/zipper/helper"
+)
+
+var ErrInvalidTemplate = merry.New("invalid influxdb template")
+
+const defaultTemplate = "measurement*"
+
+type nodeKind int
+
+const (
+	nodeSkip nodeKind = iota
+	nodeMeasurement
+	nodeMeasurementGreedy
+	nodeTag
+	nodeField
+	nodeFieldGreedy
+)
+
+type templateNode struct {
+	kind nodeKind
+	tag  string
+}
+
+// template is a graphite template of InfluxDB graphite input ("[filter] template [tag=value,...]"), used in the opposite
+// direction: graphite path is translated to measurement, tags and field, and the series are named back by the template.
+type template struct {
+	filter []string
+	nodes  []templateNode
+	tags   map[string]string
+}
+
+// parseTemplate parses template in the format of InfluxDB graphite input, e.x. "servers.* .host.measurement.field* dc=ams"
+func parseTemplate(s string) (*template, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 3 {
+		return nil, ErrInvalidTemplate.Here().WithMessagef("invalid template '%s'", s)
+	}
+
+	t := &template{tags: make(map[string]string)}
+	if last := fields[len(fields)-1]; len(fields) > 1 && strings.Contains(last, "=") {
+		for _, kv := range strings.Split(last, ",") {
+			k, v, ok := strings.Cut(kv, "=")
+			if !ok || k == "" || v == "" {
+				return nil, ErrInvalidTemplate.Here().WithMessagef("invalid tag '%s' in template '%s'", kv, s)
+			}
+			t.tags[k] = v
+		}
+		fields = fields[:len(fields)-1]
+	}
+	switch len(fields) {
+	case 2:
+		t.filter = strings.Split(fields[0], ".")
+		fields = fields[1:]
+	case 3:
+		return nil, ErrInvalidTemplate.Here().WithMessagef("invalid template '%s'", s)
+	}
+
+	hasMeasurement := false
+	hasField := false
+	parts := strings.Split(fields[0], ".")
+	for i, p := range parts {
+		var n templateNode
+		switch p {
+		case "":
+			n.kind = nodeSkip
+		case "measurement":
+			n.kind = nodeMeasurement
+		case "measurement*":
+			n.kind = nodeMeasurementGreedy
+		case "field":
+			n.kind = nodeField
+		case "field*":
+			n.kind = nodeFieldGreedy
+		default:
+			n.kind = nodeTag
+			n.tag = p
+		}
+		if (n.kind == nodeMeasurementGreedy || n.kind == nodeFieldGreedy) && i != len(parts)-1 {
+			return nil, ErrInvalidTemplate.Here().WithMessagef("'%s' must be the last node of template '%s'", p, s)
+		}
+		if n.kind == nodeField || n.kind == nodeFieldGreedy {
+			if hasField {
+				return nil, ErrInvalidTemplate.Here().WithMessagef("multiple field nodes in template '%s'", s)
+			}
+			hasField = true
+		}
+		if n.kind == nodeMeasurement || n.kind == nodeMeasurementGreedy {
+			hasMeasurement = true
+		}
+		t.nodes = append(t.nodes, n)
+	}
+	if !hasMeasurement {
+		return nil, ErrInvalidTemplate.Here().WithMessagef("no measurement in template '%s'", s)
+	}
+
+	return t, nil
+}
+
+func (t *template) greedy() bool {
+	k := t.nodes[len(t.nodes)-1].kind
+	return k == nodeMeasurementGreedy || k == nodeFieldGreedy
+}
+
+func (t *template) hasField() bool {
+	for _, n := range t.nodes {
+		if n.kind == nodeField || n.kind == nodeFieldGreedy {
+			return true
+		}
+	}
+	return false
+}
+
+// node returns template node for i-th node of the path
+func (t *template) node(i int) (templateNode, bool) {
+	if i < len(t.nodes) {
+		return t.nodes[i], true
+	}
+	if t.greedy() {
+		return t.nodes[len(t.nodes)-1], true
+	}
+	return templateNode{}, false
+}
+
+// matchFilter checks if the filter of the template could match the paths of the query. Nodes with globs in the query
+// could match any filter. When partial is set, query could be shorter than the filter. Exact is set when the filter
+// definitely matches all the paths, so that other templates are not used, as InfluxDB does.
+func (t *template) matchFilter(query []string, partial bool) (ok, exact bool) {
+	exact = t.filter != nil && len(query) >= len(t.filter)
+	for i := 0; i < len(t.filter) && i < len(query); i++ {
+		if helper.HasGlob(query[i]) {
+			exact = false
+			continue
+		}
+		if !helper.GlobRegexp(t.filter[i], ".").MatchString(query[i]) {
+			return false, false
+		}
+	}
+	return partial || len(query) >= len(t.filter), exact
+}
+
+// measurementRegex builds regex for the measurements of the query. Measurement nodes that are not in the query match
+// any value. When partial is set, greedy measurement can have more nodes than the query has.
+func (t *template) measurementRegex(query []string, separator string, partial bool) string {
+	anyNode := "[^" + regexp.QuoteMeta(separator) + "]"
+	if len(separator) != 1 {
+		anyNode = "."
+	}
+	sep := regexp.QuoteMeta(separator)
+
+	var parts []string
+	for i, n := range t.nodes {
+		switch n.kind {
+		case nodeMeasurement:
+			if i < len(query) {
+				parts = append(parts, helper.GlobToRegex(query[i], anyNode))
+			} else {
+				parts = append(parts, anyNode+"+")
+			}
+		case nodeMeasurementGreedy:
+			if i >= len(query) {
+				parts = append(parts, ".+")
+				break
+			}
+			for _, q := range query[i:] {
+				parts = append(parts, helper.GlobToRegex(q, anyNode))
+			}
+			if partial {
+				parts[len(parts)-1] += "(?:" + sep + ".*)?"
+			}
+		}
+	}
+
+	return strings.Join(parts, sep)
+}
+
+// field returns field pattern of the query, empty if template has no field or query doesn't reach it
+func (t *template) field(query []string, separator string) string {
+	for i, n := range t.nodes {
+		switch n.kind {
+		case nodeField:
+			if i < len(query) {
+				return query[i]
+			}
+		case nodeFieldGreedy:
+			if i < len(query) {
+				return strings.Join(query[i:], separator)
+			}
+		}
+	}
+	return ""
+}
+
+// tagPatterns returns patterns of the tags from the first n nodes of the query
+func (t *template) tagPatterns(query []string, n int) map[string]string {
+	res := make(map[string]string)
+	for i := 0; i < n && i < len(t.nodes) && i < len(query); i++ {
+		if t.nodes[i].kind == nodeTag {
+			res[t.nodes[i].tag] = query[i]
+		}
+	}
+	return res
+}
+
+// tagKeys returns the tags used by the template
+func (t *template) tagKeys() []string {
+	var res []string
+	for _, n := range t.nodes {
+		if n.kind == nodeTag {
+			res = append(res, n.tag)
+		}
+	}
+	return res
+}
+
+// row is a series (or a part of it) returned by InfluxDB
+type row struct {
+	measurement string
+	tags        map[string]string
+	field       string
+}
+
+// name builds graphite path of the row. Only first limit nodes are built (all if limit <= 0), values of skipped nodes
+// are taken from the query or the filter, unknown tags from the query. Returns path nodes and total amount of nodes
+// of the full path.
+func (t *template) name(r row, query []string, separator string, limit int) ([]string, int, bool) {
+	var measurement []string
+	if r.measurement != "" {
+		measurement = strings.Split(r.measurement, separator)
+	}
+	field := r.field
+
+	var res []string
+	total := 0
+	for i, n := range t.nodes {
+		var values []string
+		switch n.kind {
+		case nodeSkip:
+			switch {
+			case i < len(query) && !helper.HasGlob(query[i]):
+				values = []string{query[i]}
+			case i < len(t.filter) && !helper.HasGlob(t.filter[i]):
+				values = []string{t.filter[i]}
+			case limit > 0 && i >= limit:
+				values = []string{""}
+			default:
+				return nil, 0, false
+			}
+		case nodeMeasurement, nodeMeasurementGreedy:
+			if len(measurement) == 0 {
+				if limit > 0 && i >= limit {
+					values = []string{""}
+					break
+				}
+				return nil, 0, false
+			}
+			if n.kind == nodeMeasurement {
+				values, measurement = measurement[:1], measurement[1:]
+			} else {
+				values, measurement = measurement, nil
+			}
+		case nodeTag:
+			v, ok := r.tags[n.tag]
+			if !ok && i < len(query) && !helper.HasGlob(query[i]) {
+				v, ok = query[i], true
+			}
+			if !ok || v == "" {
+				if limit > 0 && i >= limit {
+					values = []string{""}
+					break
+				}
+				return nil, 0, false
+			}
+			values = []string{v}
+		case nodeField, nodeFieldGreedy:
+			if field == "" && n.kind == nodeField && i < len(query) && !helper.HasGlob(query[i]) {
+				field = query[i]
+			}
+			if field == "" {
+				if limit > 0 && i >= limit {
+					values = []string{""}
+					break
+				}
+				return nil, 0, false
+			}
+			if n.kind == nodeField {
+				values = []string{field}
+			} else {
+				values = strings.Split(field, separator)
+			}
+		}
+		total += len(values)
+		res = append(res, values...)
+	}
+	if len(measurement) > 0 {
+		return nil, 0, false
+	}
+
+	if limit > 0 && len(res) > limit {
+		res = res[:limit]
+	}
+	return res, total, true
+}
@@ -0,0 +1,158 @@
+package influxdb
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTemplate(t *testing.T) {
+	tests := []struct {
+		template  string
+		wantError bool
+		filter    []string
+		nodes     []templateNode
+		tags      map[string]string
+	}{
+		{
+			template: "measurement*",
+			nodes:    []templateNode{{kind: nodeMeasurementGreedy}},
+			tags:     map[string]string{},
+		},
+		{
+			template: "servers.* .host.measurement.field* dc=ams,env=prod",
+			filter:   []string{"servers", "*"},
+			nodes:    []templateNode{{kind: nodeSkip}, {kind: nodeTag, tag: "host"}, {kind: nodeMeasurement}, {kind: nodeFieldGreedy}},
+			tags:     map[string]string{"dc": "ams", "env": "prod"},
+		},
+		{
+			template:  "host.field",
+			wantError: true,
+		},
+		{
+			template:  "measurement*.host",
+			wantError: true,
+		},
+		{
+			template:  "measurement.field.field*",
+			wantError: true,
+		},
+		{
+			template:  "a b c d",
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			got, err := parseTemplate(tt.template)
+			if tt.wantError {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(got.filter, tt.filter) || !reflect.DeepEqual(got.nodes, tt.nodes) || !reflect.DeepEqual(got.tags, tt.tags) {
+				t.Errorf("got %+v, want filter %v nodes %v tags %v", got, tt.filter, tt.nodes, tt.tags)
+			}
+		})
+	}
+}
+
+func TestTemplateName(t *testing.T) {
+	tests := []struct {
+		template  string
+		separator string
+		row       row
+		query     string
+		limit     int
+		want      string
+		wantTotal int
+		wantOk    bool
+	}{
+		{
+			template:  "measurement*",
+			separator: ".",
+			row:       row{measurement: "carbon.agents.cpu"},
+			query:     "carbon.*",
+			limit:     2,
+			want:      "carbon.agents",
+			wantTotal: 3,
+			wantOk:    true,
+		},
+		{
+			template:  "servers.* .host.measurement.field*",
+			separator: "_",
+			row:       row{measurement: "cpu", tags: map[string]string{"host": "a"}, field: "usage_idle"},
+			query:     "*.*.cpu.usage.idle",
+			want:      "servers.a.cpu.usage.idle",
+			wantTotal: 5,
+			wantOk:    true,
+		},
+		{
+			template:  "host.measurement.field",
+			separator: ".",
+			row:       row{measurement: "cpu"},
+			query:     "a.*",
+			limit:     2,
+			want:      "a.cpu",
+			wantTotal: 3,
+			wantOk:    true,
+		},
+		{
+			template:  "host.measurement",
+			separator: ".",
+			row:       row{measurement: "cpu.load", tags: map[string]string{"host": "a"}},
+			query:     "*.*",
+		},
+		{
+			template:  "host.measurement",
+			separator: ".",
+			row:       row{measurement: "cpu", tags: map[string]string{"host": ""}},
+			query:     "*.*",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template+" "+tt.query, func(t *testing.T) {
+			tmpl, err := parseTemplate(tt.template)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			got, total, ok := tmpl.name(tt.row, strings.Split(tt.query, "."), tt.separator, tt.limit)
+			if ok != tt.wantOk {
+				t.Fatalf("got ok %v, want %v", ok, tt.wantOk)
+			}
+			if ok && (strings.Join(got, ".") != tt.want || total != tt.wantTotal) {
+				t.Errorf("got %v (%d nodes), want %v (%d nodes)", got, total, tt.want, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestMeasurementRegex(t *testing.T) {
+	tests := []struct {
+		template string
+		query    string
+		partial  bool
+		want     string
+	}{
+		{"measurement*", "carbon.*", false, `carbon\.[^\.]*`},
+		{"measurement*", "carbon.{a,b}", true, `carbon\.(a|b)(?:\..*)?`},
+		{"host.measurement.measurement.field", "*.cpu", true, `cpu\.[^\.]+`},
+		{".host.measurement*", "servers.a", true, `.+`},
+	}
+
+	for _, tt := range tests {
+		tmpl, err := parseTemplate(tt.template)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if got := tmpl.measurementRegex(strings.Split(tt.query, "."), ".", tt.partial); got != tt.want {
+			t.Errorf("%s %s: got %s, want %s", tt.template, tt.query, got, tt.want)
+		}
+	}
+}
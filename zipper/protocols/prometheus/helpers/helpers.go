@@ -2,14 +2,22 @@ package helpers
 
 import (
 	"math"
+	"net/http"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/ansel1/merry"
+
 	"github.com/go-graphite/carbonapi/zipper/protocols/prometheus/types"
 )
 
+var ErrInvalidSeriesByTag = merry.New("invalid seriesByTag expression").WithHTTPCode(http.StatusBadRequest)
+
+var metricNameRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
 // ConvertGraphiteTargetToPromQL - converts graphite target string to PromQL friendly format
 func ConvertGraphiteTargetToPromQL(query string) string {
 	var sb strings.Builder
@@ -210,40 +218,155 @@ func PromMetricToGraphite(metric map[string]string) string {
 	return res.String()
 }
 
-// SeriesByTagToPromQL converts graphite SeriesByTag to PromQL
-// will return step if __step__ is passed
-func SeriesByTagToPromQL(step, target string) (string, string) {
-	firstTag := true
-	var queryBuilder strings.Builder
-	tagsString := target[len("seriesByTag(") : len(target)-1]
-	tvs := SplitTagValues(tagsString)
-	// It's ok to have empty "__name__"
-	if v, ok := tvs["__name__"]; ok {
-		if v.OP == "=" {
-			queryBuilder.WriteString(v.TagValue)
-		} else {
-			firstTag = false
-			queryBuilder.WriteByte('{')
-			queryBuilder.WriteString("__name__" + v.OP + "\"" + v.TagValue + "\"")
+// TagMatcher is a PromQL label matcher, translated from graphite tag expression
+type TagMatcher struct {
+	Label string
+	OP    string // one of =, !=, =~, !~
+	Value string
+}
+
+// String returns matcher in PromQL syntax, value is quoted and escaped
+func (m TagMatcher) String() string {
+	return m.Label + m.OP + strconv.Quote(m.Value)
+}
+
+// matchesEmpty returns true if matcher selects series without the label
+func (m TagMatcher) matchesEmpty() (bool, error) {
+	switch m.OP {
+	case "=":
+		return m.Value == "", nil
+	case "!=":
+		return m.Value != "", nil
+	}
+	re, err := regexp.Compile("^(?:" + m.Value + ")$")
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString("") == (m.OP == "=~"), nil
+}
+
+// parseSeriesByTagArgs returns quoted arguments of seriesByTag('a=b', "c=d")
+func parseSeriesByTagArgs(target string) ([]string, error) {
+	if !strings.HasPrefix(target, "seriesByTag(") || !strings.HasSuffix(target, ")") {
+		return nil, ErrInvalidSeriesByTag.Here().WithMessagef("invalid seriesByTag target '%s'", target)
+	}
+	s := target[len("seriesByTag(") : len(target)-1]
+	var args []string
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return args, nil
+		}
+		if len(args) > 0 {
+			if s[0] != ',' {
+				return nil, ErrInvalidSeriesByTag.Here().WithMessagef("expected ',' in '%s'", target)
+			}
+			s = strings.TrimLeft(s[1:], " \t")
 		}
+		if s == "" || (s[0] != '\'' && s[0] != '"') {
+			return nil, ErrInvalidSeriesByTag.Here().WithMessagef("expected quoted tag expression in '%s'", target)
+		}
+		end := strings.IndexByte(s[1:], s[0])
+		if end < 0 {
+			return nil, ErrInvalidSeriesByTag.Here().WithMessagef("unterminated quote in '%s'", target)
+		}
+		args = append(args, s[1:end+1])
+		s = s[end+2:]
+	}
+}
 
-		delete(tvs, "__name__")
+// anchorRegex converts graphite regex, that is anchored only at the start, to fully anchored PromQL one
+func anchorRegex(re string) string {
+	re = strings.TrimPrefix(re, "^")
+	switch {
+	case strings.Contains(re, "|"):
+		return "(?:" + re + ").*"
+	case strings.HasSuffix(re, "$") && !strings.HasSuffix(re, `\$`):
+		return re[:len(re)-1]
+	case strings.HasSuffix(re, ".*") && !strings.HasSuffix(re, `\.*`):
+		return re
 	}
-	for tagName, t := range tvs {
-		if tagName == "__step__" {
+	return re + ".*"
+}
+
+// TagExpressionToMatcher converts single graphite tag expression (tag=value, tag!=value, tag=~regex, tag!=~regex)
+// to PromQL label matcher
+func TagExpressionToMatcher(expr string) (TagMatcher, error) {
+	name, t := PromethizeTagValue(expr)
+	if name == "" || t.OP == "" {
+		return TagMatcher{}, ErrInvalidSeriesByTag.Here().WithMessagef("invalid tag expression '%s'", expr)
+	}
+	if name == "name" {
+		name = "__name__"
+	}
+	m := TagMatcher{Label: name, OP: t.OP, Value: t.TagValue}
+	if m.OP == "=~" || m.OP == "!~" {
+		m.Value = anchorRegex(m.Value)
+	}
+	return m, nil
+}
+
+// SeriesByTagMatchers converts expressions of graphite seriesByTag to PromQL label matchers, following graphite
+// semantics: 'name' tag is '__name__', regexps are anchored at the start only, empty value (tag=) matches series
+// without the tag, several expressions on the same tag are all applied. As in graphite, at least one expression
+// must not match empty value. Pseudo-tag __step__ is not a matcher, it's returned as step.
+func SeriesByTagMatchers(target string) ([]TagMatcher, string, error) {
+	args, err := parseSeriesByTagArgs(target)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var step string
+	matchers := make([]TagMatcher, 0, len(args))
+	nonEmpty := false
+	for _, arg := range args {
+		name, t := PromethizeTagValue(arg)
+		if name == "__step__" {
 			step = t.TagValue
 			continue
 		}
-		if firstTag {
-			firstTag = false
-			queryBuilder.WriteByte('{')
-			queryBuilder.WriteString(tagName + t.OP + "\"" + t.TagValue + "\"")
-		} else {
-			queryBuilder.WriteString(", " + tagName + t.OP + "\"" + t.TagValue + "\"")
+		m, err := TagExpressionToMatcher(arg)
+		if err != nil {
+			return nil, "", err
+		}
+		matchesEmpty, err := m.matchesEmpty()
+		if err != nil {
+			return nil, "", ErrInvalidSeriesByTag.Here().WithCause(err).WithMessagef("invalid regex in tag expression '%s'", arg)
+		}
+		nonEmpty = nonEmpty || !matchesEmpty
+		matchers = append(matchers, m)
+	}
+	if !nonEmpty {
+		return nil, "", ErrInvalidSeriesByTag.Here().WithMessagef("at least one tag expression must not match empty value in '%s'", target)
+	}
+	return matchers, step, nil
+}
+
+// SeriesByTagToPromQL converts graphite SeriesByTag to PromQL
+// will return step if __step__ is passed
+func SeriesByTagToPromQL(step, target string) (string, string, error) {
+	matchers, tagStep, err := SeriesByTagMatchers(target)
+	if err != nil {
+		return step, "", err
+	}
+	if tagStep != "" {
+		step = tagStep
+	}
+
+	var queryBuilder strings.Builder
+	selectors := make([]string, 0, len(matchers))
+	nameWritten := false
+	for _, m := range matchers {
+		// metric name could be used as is only if it's a valid identifier
+		if !nameWritten && m.Label == "__name__" && m.OP == "=" && metricNameRe.MatchString(m.Value) {
+			queryBuilder.WriteString(m.Value)
+			nameWritten = true
+			continue
 		}
+		selectors = append(selectors, m.String())
 	}
-	if !firstTag {
-		queryBuilder.WriteByte('}')
+	if len(selectors) > 0 {
+		queryBuilder.WriteString("{" + strings.Join(selectors, ", ") + "}")
 	}
-	return step, queryBuilder.String()
+	return step, queryBuilder.String(), nil
 }
@@ -5,7 +5,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ansel1/merry"
+
 	"github.com/go-graphite/carbonapi/tests/compare"
+	"github.com/go-graphite/carbonapi/tests/seriesbytag"
 	"github.com/go-graphite/carbonapi/zipper/protocols/prometheus/types"
 	"github.com/stretchr/testify/assert"
 )
@@ -250,3 +253,23 @@ func TestPromethizeTagValue(t *testing.T) {
 	}
 
 }
+
+func TestSeriesByTagToPromQL(t *testing.T) {
+	for _, tt := range seriesbytag.PromQLCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			step, query, err := SeriesByTagToPromQL("15", tt.Target)
+			if tt.Err {
+				assert.Error(t, err)
+				assert.True(t, merry.Is(err, ErrInvalidSeriesByTag))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.Query, query)
+			wantStep := tt.Step
+			if wantStep == "" {
+				wantStep = "15"
+			}
+			assert.Equal(t, wantStep, step)
+		})
+	}
+}
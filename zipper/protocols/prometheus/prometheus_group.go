@@ -213,6 +213,10 @@ func (c *PrometheusGroup) Children() []types.BackendServer {
 	return []types.BackendServer{c}
 }
 
+func (c *PrometheusGroup) CloseIdleConnections() {
+	c.httpQuery.CloseIdleConnections()
+}
+
 func (c PrometheusGroup) MaxMetricsPerRequest() int {
 	return c.maxMetricsPerRequest
 }
@@ -259,7 +263,17 @@ func (c *PrometheusGroup) Fetch(ctx context.Context, request *protov3.MultiFetch
 			// Make local copy
 			stepLocalStr := stepStr
 			if strings.HasPrefix(target, "seriesByTag") {
-				stepLocalStr, target = helpers.SeriesByTagToPromQL(stepLocalStr, target)
+				var err error
+				stepLocalStr, target, err = helpers.SeriesByTagToPromQL(stepLocalStr, target)
+				if err != nil {
+					stats.RenderErrors++
+					if e == nil {
+						e = merry.Wrap(err)
+					} else {
+						e = e.WithCause(err)
+					}
+					continue
+				}
 			} else {
 				reQuery := helpers.ConvertGraphiteTargetToPromQL(target)
 				target = fmt.Sprintf("{__name__=~%q}", reQuery)
@@ -575,8 +589,11 @@ func (c *PrometheusGroup) doComplexTagQuery(ctx context.Context, isTagName bool,
 
 	matches := make([]string, 0, len(params["expr"]))
 	for _, e := range params["expr"] {
-		name, t := helpers.PromethizeTagValue(e)
-		matches = append(matches, "{"+name+t.OP+"\""+t.TagValue+"\"}")
+		m, err := helpers.TagExpressionToMatcher(e)
+		if err != nil {
+			return []string{}, merry.Wrap(err)
+		}
+		matches = append(matches, "{"+m.String()+"}")
 	}
 
 	rewrite, _ = url.Parse("http://127.0.0.1/api/v1/series")
@@ -0,0 +1,79 @@
+package prometheus
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/tests/seriesbytag"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// queryRecorder records PromQL queries and answers with empty result
+type queryRecorder struct {
+	sync.Mutex
+	queries []string
+}
+
+func (s *queryRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	s.queries = append(s.queries, r.URL.Query().Get("query"))
+	s.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[]}}`))
+}
+
+func TestFetchSeriesByTag(t *testing.T) {
+	recorder := &queryRecorder{}
+	srv := httptest.NewServer(recorder)
+	defer srv.Close()
+
+	concurrencyLimit := 0
+	maxBatchSize := 100
+	maxTries := 1
+	maxIdleConns := 10
+	idleTimeout := time.Minute
+	keepAlive := time.Minute
+	b, err := New(zap.NewNop(), types.BackendV2{
+		GroupName:             "prometheus",
+		Protocol:              "prometheus",
+		Servers:               []string{srv.URL},
+		ConcurrencyLimit:      &concurrencyLimit,
+		MaxBatchSize:          &maxBatchSize,
+		MaxTries:              &maxTries,
+		MaxIdleConnsPerHost:   &maxIdleConns,
+		IdleConnectionTimeout: &idleTimeout,
+		KeepAliveInterval:     &keepAlive,
+		Timeouts:              &types.Timeouts{Find: time.Second, Render: time.Second, Connect: time.Second},
+	}, true, false)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	for _, tt := range seriesbytag.PromQLCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			recorder.queries = nil
+			_, _, err := b.Fetch(context.Background(), &protov3.MultiFetchRequest{
+				Metrics: []protov3.FetchRequest{{Name: tt.Target, PathExpression: tt.Target, StartTime: 1000, StopTime: 1600}},
+			})
+			if tt.Err {
+				if err == nil || len(recorder.queries) != 0 {
+					t.Errorf("expected error without queries, got %v, queries %v", err, recorder.queries)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if len(recorder.queries) != 1 || recorder.queries[0] != tt.Query {
+				t.Errorf("got queries %q, want %q", recorder.queries, tt.Query)
+			}
+		})
+	}
+}
@@ -0,0 +1,329 @@
+package remoteread
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ansel1/merry"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/limiter"
+	"github.com/go-graphite/carbonapi/zipper/helper"
+	"github.com/go-graphite/carbonapi/zipper/httpHeaders"
+	"github.com/go-graphite/carbonapi/zipper/metadata"
+	"github.com/go-graphite/carbonapi/zipper/protocols/prometheus"
+	"github.com/go-graphite/carbonapi/zipper/protocols/prometheus/helpers"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+func init() {
+	aliases := []string{"prometheus_remote_read", "remote_read"}
+	metadata.Metadata.Lock()
+	for _, name := range aliases {
+		metadata.Metadata.SupportedProtocols[name] = struct{}{}
+		metadata.Metadata.ProtocolInits[name] = New
+		metadata.Metadata.ProtocolInitsWithLimiter[name] = NewWithLimiter
+	}
+	defer metadata.Metadata.Unlock()
+}
+
+// maxDecodedLen limits size of the decompressed response, same as default limit of Prometheus remote-read handler
+const maxDecodedLen = 1 << 30
+
+var ErrResponseTooLarge = merry.New("decoded remote-read response is too large")
+
+// readRequest is a snappy-compressed protobuf ReadRequest, as expected by remote-read endpoint
+type readRequest struct {
+	prompb.ReadRequest
+}
+
+func (r *readRequest) Marshal() ([]byte, merry.Error) {
+	data, err := r.ReadRequest.Marshal()
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return snappy.Encode(nil, data), nil
+}
+
+func (r *readRequest) LogInfo() interface{} {
+	return r.Queries
+}
+
+func (r *readRequest) Headers() map[string]string {
+	return map[string]string{
+		"Content-Encoding":                 "snappy",
+		"Content-Type":                     "application/x-protobuf",
+		"X-Prometheus-Remote-Read-Version": "0.1.0",
+	}
+}
+
+// RemoteReadGroup fetches raw samples with Prometheus remote-read API and consolidates them to the graphite step.
+// Find and tags requests are served by the Prometheus HTTP API of the same servers.
+type RemoteReadGroup struct {
+	types.BackendServer
+
+	groupName string
+
+	logger *zap.Logger
+
+	path              string
+	step              int64
+	maxPointsPerQuery int64
+
+	httpQuery *helper.HttpQuery
+}
+
+func NewWithLimiter(logger *zap.Logger, config types.BackendV2, tldCacheDisabled, requireSuccessAll bool, limiter limiter.ServerLimiter) (types.BackendServer, merry.Error) {
+	prom, err := prometheus.NewWithLimiter(logger, config, tldCacheDisabled, requireSuccessAll, limiter)
+	if err != nil {
+		return nil, err
+	}
+
+	logger = logger.With(zap.String("type", "prometheus_remote_read"), zap.String("protocol", config.Protocol), zap.String("name", config.GroupName))
+
+	c := &RemoteReadGroup{
+		BackendServer: prom,
+		groupName:     config.GroupName,
+		logger:        logger,
+
+		path:              "/api/v1/read",
+		step:              15,
+		maxPointsPerQuery: 11000,
+	}
+
+	pathI, ok := config.BackendOptions["remote_read_path"]
+	if ok {
+		path, ok := pathI.(string)
+		if !ok {
+			logger.Fatal("failed to parse remote_read_path",
+				zap.String("type_parsed", fmt.Sprintf("%T", pathI)),
+				zap.String("type_expected", "string"),
+			)
+		}
+		c.path = path
+	}
+
+	// step and max_points_per_query are already validated by prometheus group
+	if stepI, ok := config.BackendOptions["step"]; ok {
+		step := stepI.(string)
+		if step[len(step)-1] >= '0' && step[len(step)-1] <= '9' {
+			step += "s"
+		}
+		d, _ := time.ParseDuration(step)
+		c.step = int64(d.Seconds())
+	}
+	if mppqI, ok := config.BackendOptions["max_points_per_query"]; ok {
+		c.maxPointsPerQuery = int64(mppqI.(int))
+	}
+
+	httpClient := helper.GetHTTPClient(logger, config)
+	c.httpQuery = helper.NewHttpQuery(config.GroupName, config.Servers, *config.MaxTries, limiter, httpClient, httpHeaders.ContentTypeCarbonAPIv2PB)
+
+	return c, nil
+}
+
+func New(logger *zap.Logger, config types.BackendV2, tldCacheDisabled, requireSuccessAll bool) (types.BackendServer, merry.Error) {
+	if config.ConcurrencyLimit == nil {
+		return nil, types.ErrConcurrencyLimitNotSet
+	}
+	if len(config.Servers) == 0 {
+		return nil, types.ErrNoServersSpecified
+	}
+	l := limiter.NewServerLimiter(config.Servers, *config.ConcurrencyLimit)
+
+	return NewWithLimiter(logger, config, tldCacheDisabled, requireSuccessAll, l)
+}
+
+func (c *RemoteReadGroup) Children() []types.BackendServer {
+	return []types.BackendServer{c}
+}
+
+func (c *RemoteReadGroup) CloseIdleConnections() {
+	c.httpQuery.CloseIdleConnections()
+}
+
+// decodeReadResponse decompresses and unmarshals ReadResponse
+func decodeReadResponse(body []byte) (*prompb.ReadResponse, error) {
+	n, err := snappy.DecodedLen(body)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxDecodedLen {
+		return nil, ErrResponseTooLarge.Here().WithValue("decoded_len", n)
+	}
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp prompb.ReadResponse
+	if err := resp.Unmarshal(data); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// targetMatchers converts graphite target to remote-read label matchers
+func targetMatchers(target string) ([]*prompb.LabelMatcher, error) {
+	if !strings.HasPrefix(target, "seriesByTag") {
+		return []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_RE, Name: "__name__", Value: helpers.ConvertGraphiteTargetToPromQL(target)}}, nil
+	}
+
+	tagMatchers, _, err := helpers.SeriesByTagMatchers(target)
+	if err != nil {
+		return nil, err
+	}
+	matchers := make([]*prompb.LabelMatcher, 0, len(tagMatchers))
+	for _, t := range tagMatchers {
+		m := &prompb.LabelMatcher{Name: t.Label, Value: t.Value}
+		switch t.OP {
+		case "=":
+			m.Type = prompb.LabelMatcher_EQ
+		case "!=":
+			m.Type = prompb.LabelMatcher_NEQ
+		case "=~":
+			m.Type = prompb.LabelMatcher_RE
+		default:
+			m.Type = prompb.LabelMatcher_NRE
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers, nil
+}
+
+// consolidationFunc returns function passed with consolidateBy, average by default
+func consolidationFunc(m *protov3.FetchRequest) string {
+	for _, f := range m.FilterFunctions {
+		if f != nil && f.Name == "consolidateBy" && len(f.Arguments) > 0 {
+			return f.Arguments[0]
+		}
+	}
+	return "average"
+}
+
+func (c *RemoteReadGroup) Fetch(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, merry.Error) {
+	logger := c.logger.With(zap.String("type", "fetch"), zap.String("request", request.String()))
+	stats := &types.Stats{}
+
+	var r protov3.MultiFetchResponse
+	if len(request.Metrics) == 0 {
+		return &r, stats, types.ErrNotFound
+	}
+
+	req := &readRequest{prompb.ReadRequest{Queries: make([]*prompb.Query, 0, len(request.Metrics))}}
+	for _, m := range request.Metrics {
+		matchers, err := targetMatchers(m.Name)
+		if err != nil {
+			stats.RenderErrors++
+			return &r, stats, merry.Wrap(err)
+		}
+		req.Queries = append(req.Queries, &prompb.Query{
+			StartTimestampMs: m.StartTime * 1000,
+			EndTimestampMs:   m.StopTime * 1000,
+			Matchers:         matchers,
+		})
+	}
+
+	stats.RenderRequests++
+	res, err := c.httpQuery.DoQuery(ctx, logger, c.path, req)
+	var results []*prompb.QueryResult
+	if err == nil {
+		resp, err2 := decodeReadResponse(res.Response)
+		if err2 != nil {
+			err = types.ErrFailedToFetch.WithCause(err2).WithValue("server", res.Server)
+		} else {
+			results = resp.Results
+		}
+	}
+	if err != nil {
+		stats.RenderErrors++
+		if merry.Is(err, types.ErrTimeoutExceeded) {
+			stats.Timeouts++
+			stats.RenderTimeouts++
+		}
+		stats.FailedServers = []string{c.groupName}
+		logger.Error("errors occurred while getting results",
+			zap.Any("errors", err),
+		)
+		return &r, stats, err
+	}
+
+	for i, m := range request.Metrics {
+		if i >= len(results) {
+			break
+		}
+		pathExpr := m.PathExpression
+		if pathExpr == "" {
+			pathExpr = m.Name
+		}
+
+		maxPointsPerQuery := c.maxPointsPerQuery
+		if m.MaxDataPoints != 0 {
+			maxPointsPerQuery = m.MaxDataPoints
+		}
+		step := helpers.AdjustStep(m.StartTime, m.StopTime, maxPointsPerQuery, c.step, 0)
+		start := m.StartTime - m.StartTime%step
+		points := (m.StopTime - start + step - 1) / step
+		cf := consolidationFunc(&m)
+
+		series := results[i].GetTimeseries()
+		names := make([]string, len(series))
+		for j, ts := range series {
+			labels := make(map[string]string, len(ts.GetLabels()))
+			for _, l := range ts.GetLabels() {
+				labels[l.Name] = l.Value
+			}
+			names[j] = helpers.PromMetricToGraphite(labels)
+		}
+		order := make([]int, len(series))
+		for j := range order {
+			order[j] = j
+		}
+		sort.Slice(order, func(a, b int) bool { return names[order[a]] < names[order[b]] })
+
+		for _, j := range order {
+			if len(series[j].GetSamples()) == 0 {
+				continue
+			}
+			buckets := make([][]float64, points)
+			for _, s := range series[j].Samples {
+				ts := s.Timestamp / 1000
+				idx := (ts - start) / step
+				if ts < start || idx >= points {
+					continue
+				}
+				buckets[idx] = append(buckets[idx], s.Value)
+			}
+			values := make([]float64, points)
+			for k, b := range buckets {
+				values[k] = math.NaN()
+				if len(b) > 0 {
+					values[k] = types.ConsolidatePoints(cf, b)
+				}
+			}
+			r.Metrics = append(r.Metrics, protov3.FetchResponse{
+				Name:              names[j],
+				PathExpression:    pathExpr,
+				ConsolidationFunc: cf,
+				StartTime:         start,
+				StopTime:          start + points*step,
+				StepTime:          step,
+				Values:            values,
+				RequestStartTime:  m.StartTime,
+				RequestStopTime:   m.StopTime,
+			})
+		}
+	}
+
+	if len(r.Metrics) == 0 {
+		return &r, stats, types.ErrNotFound
+	}
+	return &r, stats, nil
+}
@@ -0,0 +1,151 @@
+package remoteread
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+type testServer struct {
+	queries []*prompb.Query
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if r.Method != http.MethodPost || r.URL.Path != "/api/v1/read" || r.Header.Get("Content-Encoding") != "snappy" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var req prompb.ReadRequest
+	data, err := snappy.Decode(nil, body)
+	if err == nil {
+		err = req.Unmarshal(data)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.queries = req.Queries
+
+	var resp prompb.ReadResponse
+	for range s.queries {
+		resp.Results = append(resp.Results, &prompb.QueryResult{Timeseries: []*prompb.TimeSeries{
+			{
+				Labels:  []prompb.Label{{Name: "__name__", Value: "http_requests"}, {Name: "job", Value: "api"}},
+				Samples: []prompb.Sample{{Value: 1, Timestamp: 1000000}, {Value: 3, Timestamp: 1030000}, {Value: 5, Timestamp: 1065000}, {Value: 7, Timestamp: 1200000}},
+			},
+			{Labels: []prompb.Label{{Name: "__name__", Value: "empty"}}},
+		}})
+	}
+	data, err = resp.Marshal()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Header().Set("Content-Encoding", "snappy")
+	_, _ = w.Write(snappy.Encode(nil, data))
+}
+
+func TestFetch(t *testing.T) {
+	stub := &testServer{}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	concurrencyLimit := 10
+	maxBatchSize := 100
+	maxTries := 1
+	maxIdleConns := 10
+	idleTimeout := time.Minute
+	keepAlive := time.Minute
+	b, err := New(zap.NewNop(), types.BackendV2{
+		GroupName:             "prometheus",
+		Protocol:              "prometheus_remote_read",
+		Servers:               []string{srv.URL},
+		ConcurrencyLimit:      &concurrencyLimit,
+		MaxBatchSize:          &maxBatchSize,
+		MaxTries:              &maxTries,
+		MaxIdleConnsPerHost:   &maxIdleConns,
+		IdleConnectionTimeout: &idleTimeout,
+		KeepAliveInterval:     &keepAlive,
+		Timeouts:              &types.Timeouts{Find: time.Second, Render: time.Second, Connect: time.Second},
+		BackendOptions:        map[string]interface{}{"step": "60"},
+	}, true, false)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	target := "seriesByTag('name=http_requests','job=~ap','instance!=a','dc!=~x')"
+	res, _, err := b.Fetch(context.Background(), &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{
+			Name:            target,
+			PathExpression:  target,
+			StartTime:       1000,
+			StopTime:        1180,
+			FilterFunctions: []*protov3.FilteringFunction{{Name: "consolidateBy", Arguments: []string{"sum"}}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	wantQueries := []*prompb.Query{{
+		StartTimestampMs: 1000000,
+		EndTimestampMs:   1180000,
+		Matchers: []*prompb.LabelMatcher{
+			{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "http_requests"},
+			{Type: prompb.LabelMatcher_RE, Name: "job", Value: "ap.*"},
+			{Type: prompb.LabelMatcher_NEQ, Name: "instance", Value: "a"},
+			{Type: prompb.LabelMatcher_NRE, Name: "dc", Value: "x.*"},
+		},
+	}}
+	if !reflect.DeepEqual(stub.queries, wantQueries) {
+		t.Errorf("got queries %+v, want %+v", stub.queries, wantQueries)
+	}
+
+	if len(res.Metrics) != 1 {
+		t.Fatalf("unexpected response %+v", res.Metrics)
+	}
+	m := res.Metrics[0]
+	nan := math.NaN()
+	want := []float64{1, 8, nan, nan}
+	if m.Name != "http_requests;job=api" || m.StartTime != 960 || m.StopTime != 1200 || m.StepTime != 60 || m.ConsolidationFunc != "sum" {
+		t.Errorf("unexpected metadata %+v", m)
+	}
+	for i := range want {
+		if len(m.Values) != len(want) || (m.Values[i] != want[i] && !(math.IsNaN(m.Values[i]) && math.IsNaN(want[i]))) {
+			t.Fatalf("got %v, want %v", m.Values, want)
+		}
+	}
+
+	_, _, err = b.Fetch(context.Background(), &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{Name: "http_requests", StartTime: 1000, StopTime: 1180}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(stub.queries) != 1 || !reflect.DeepEqual(stub.queries[0].Matchers, []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_RE, Name: "__name__", Value: "http_requests"}}) {
+		t.Errorf("unexpected queries %+v", stub.queries)
+	}
+}
+
+func TestDecodeReadResponse(t *testing.T) {
+	if _, err := decodeReadResponse([]byte{0xff, 0xff, 0xff, 0xff, 0x7f}); err == nil {
+		t.Errorf("expected error for too large response")
+	}
+	if _, err := decodeReadResponse([]byte{5, 0}); err == nil {
+		t.Errorf("expected error for corrupt response")
+	}
+}
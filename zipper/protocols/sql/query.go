@@ -0,0 +1,88 @@
+package sql
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ansel1/merry"
+
+	"github.com/go-graphite/carbonapi/zipper/helper"
+)
+
+var ErrInvalidQuery = merry.New("invalid sql query template")
+
+// query is SQL template with named parameters (:name) converted to positional placeholders of the driver
+type query struct {
+	text   string
+	params []string
+}
+
+// compileQuery replaces named parameters with placeholders ($1 or ?). Casts (::type), string literals and quoted
+// identifiers are left as is. Only allowed parameters could be used.
+func compileQuery(q string, questionPlaceholder bool, allowed ...string) (*query, error) {
+	res := &query{}
+	var sb strings.Builder
+	for i := 0; i < len(q); i++ {
+		c := q[i]
+		switch {
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(q[i+1:], c)
+			if end < 0 {
+				return nil, ErrInvalidQuery.Here().WithMessagef("unterminated quote in query '%s'", q)
+			}
+			sb.WriteString(q[i : i+end+2])
+			i += end + 1
+		case c == ':' && i+1 < len(q) && q[i+1] == ':':
+			sb.WriteString("::")
+			i++
+		case c == ':' && i+1 < len(q) && isIdentChar(q[i+1]):
+			j := i + 1
+			for j < len(q) && isIdentChar(q[j]) {
+				j++
+			}
+			name := q[i+1 : j]
+			ok := false
+			for _, a := range allowed {
+				ok = ok || a == name
+			}
+			if !ok {
+				return nil, ErrInvalidQuery.Here().WithMessagef("unknown parameter ':%s', supported are %v", name, allowed)
+			}
+			res.params = append(res.params, name)
+			if questionPlaceholder {
+				sb.WriteByte('?')
+			} else {
+				sb.WriteString("$" + strconv.Itoa(len(res.params)))
+			}
+			i = j - 1
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	res.text = sb.String()
+	return res, nil
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// args returns arguments of the query in the order of placeholders
+func (q *query) args(values map[string]interface{}) []interface{} {
+	res := make([]interface{}, 0, len(q.params))
+	for _, p := range q.params {
+		res = append(res, values[p])
+	}
+	return res
+}
+
+// taggedPattern returns regex for tagged series names, narrowed by the name if it's set by equality
+func taggedPattern(exprs []helper.TagExpr) string {
+	for _, e := range exprs {
+		if e.Tag == "name" && e.Op == "=" {
+			return "^" + regexp.QuoteMeta(e.Value) + ";"
+		}
+	}
+	return ";"
+}
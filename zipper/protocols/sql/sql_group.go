@@ -0,0 +1,625 @@
+package sql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ansel1/merry"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	_ "github.com/lib/pq" // postgres driver, the default one
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/expr/tags"
+	"github.com/go-graphite/carbonapi/limiter"
+	"github.com/go-graphite/carbonapi/zipper/helper"
+	"github.com/go-graphite/carbonapi/zipper/metadata"
+	"github.com/go-graphite/carbonapi/zipper/protocols/prometheus/helpers"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+func init() {
+	aliases := []string{"sql", "postgres", "timescaledb"}
+	metadata.Metadata.Lock()
+	for _, name := range aliases {
+		metadata.Metadata.SupportedProtocols[name] = struct{}{}
+		metadata.Metadata.ProtocolInits[name] = New
+		metadata.Metadata.ProtocolInitsWithLimiter[name] = NewWithLimiter
+	}
+	defer metadata.Metadata.Unlock()
+}
+
+var ErrInvalidRow = merry.New("invalid row returned by sql query")
+
+// globAnyChar is used for wildcards in regexes sent to the database, tagged series are never matched by globs
+const globAnyChar = "[^.;]"
+
+// SQLGroup reads metrics from SQL database with configurable queries, implements BackendServer interface.
+// Every server of the group is a data source name of the database, servers are tried in order. Passwords are
+// redacted from the names of the group and of the servers, as they are logged and reported in stats.
+type SQLGroup struct {
+	groupName            string
+	servers              []string
+	maxMetricsPerRequest int
+
+	dbs        []*dbsql.DB
+	fetchQuery *query
+	findQuery  *query
+
+	nameColumn    string
+	timeColumn    string
+	valueColumn   string
+	consolidation string
+
+	step              int64
+	maxPointsPerQuery int64
+
+	limiter limiter.ServerLimiter
+	logger  *zap.Logger
+}
+
+func stringOption(logger *zap.Logger, config types.BackendV2, name string, value *string) {
+	opt, ok := config.BackendOptions[name]
+	if !ok {
+		return
+	}
+	s, ok := opt.(string)
+	if !ok {
+		logger.Fatal("failed to parse "+name,
+			zap.String("type_parsed", fmt.Sprintf("%T", opt)),
+			zap.String("type_expected", "string"),
+		)
+	}
+	*value = s
+}
+
+func NewWithLimiter(logger *zap.Logger, config types.BackendV2, tldCacheDisabled, requireSuccessAll bool, limiter limiter.ServerLimiter) (types.BackendServer, merry.Error) {
+	groupName := types.RedactServer(config.GroupName)
+	logger = logger.With(zap.String("type", "sql"), zap.String("protocol", config.Protocol), zap.String("name", groupName))
+
+	c := &SQLGroup{
+		groupName:            groupName,
+		servers:              types.RedactServers(config.Servers),
+		maxMetricsPerRequest: *config.MaxBatchSize,
+
+		nameColumn:        "name",
+		timeColumn:        "time",
+		valueColumn:       "value",
+		consolidation:     "average",
+		step:              60,
+		maxPointsPerQuery: 11000,
+
+		limiter: limiter,
+		logger:  logger,
+	}
+
+	driver := "postgres"
+	placeholder := "dollar"
+	var fetchQuery, findQuery, step string
+	stringOption(logger, config, "sql_driver", &driver)
+	stringOption(logger, config, "sql_placeholder", &placeholder)
+	stringOption(logger, config, "sql_fetch_query", &fetchQuery)
+	stringOption(logger, config, "sql_find_query", &findQuery)
+	stringOption(logger, config, "sql_name_column", &c.nameColumn)
+	stringOption(logger, config, "sql_time_column", &c.timeColumn)
+	stringOption(logger, config, "sql_value_column", &c.valueColumn)
+	stringOption(logger, config, "sql_consolidation", &c.consolidation)
+	stringOption(logger, config, "sql_step", &step)
+
+	if placeholder != "dollar" && placeholder != "question" {
+		logger.Fatal("unsupported sql_placeholder",
+			zap.String("placeholder", placeholder),
+			zap.Strings("supported", []string{"dollar", "question"}),
+		)
+	}
+
+	var err error
+	if c.fetchQuery, err = compileQuery(fetchQuery, placeholder == "question", "pattern", "from", "until", "step"); err != nil || fetchQuery == "" {
+		logger.Fatal("failed to parse sql_fetch_query",
+			zap.String("query", fetchQuery),
+			zap.Error(err),
+		)
+	}
+	if c.findQuery, err = compileQuery(findQuery, placeholder == "question", "pattern"); err != nil || findQuery == "" {
+		logger.Fatal("failed to parse sql_find_query",
+			zap.String("query", findQuery),
+			zap.Error(err),
+		)
+	}
+
+	if step != "" {
+		d, err := time.ParseDuration(step)
+		if err != nil || d < time.Second {
+			logger.Fatal("failed to parse sql_step",
+				zap.String("value_provided", step),
+				zap.String("type_expected", "time.Duration"),
+			)
+		}
+		c.step = int64(d.Seconds())
+	}
+
+	if mppqI, ok := config.BackendOptions["max_points_per_query"]; ok {
+		mppq, ok := mppqI.(int)
+		if !ok {
+			logger.Fatal("failed to parse max_points_per_query",
+				zap.String("type_parsed", fmt.Sprintf("%T", mppqI)),
+				zap.String("type_expected", "int"),
+			)
+		}
+		c.maxPointsPerQuery = int64(mppq)
+	}
+
+	for _, dsn := range config.Servers {
+		db, err := dbsql.Open(driver, dsn)
+		if err != nil {
+			logger.Fatal("failed to open database",
+				zap.String("driver", driver),
+				zap.Error(err),
+			)
+		}
+		if *config.ConcurrencyLimit > 0 {
+			db.SetMaxOpenConns(*config.ConcurrencyLimit)
+		}
+		c.dbs = append(c.dbs, db)
+	}
+
+	return c, nil
+}
+
+func New(logger *zap.Logger, config types.BackendV2, tldCacheDisabled, requireSuccessAll bool) (types.BackendServer, merry.Error) {
+	if config.ConcurrencyLimit == nil {
+		return nil, types.ErrConcurrencyLimitNotSet
+	}
+	if len(config.Servers) == 0 {
+		return nil, types.ErrNoServersSpecified
+	}
+	l := limiter.NewServerLimiter(types.RedactServers(config.Servers), *config.ConcurrencyLimit)
+
+	return NewWithLimiter(logger, config, tldCacheDisabled, requireSuccessAll, l)
+}
+
+func (c *SQLGroup) Children() []types.BackendServer {
+	return []types.BackendServer{c}
+}
+
+func (c SQLGroup) MaxMetricsPerRequest() int {
+	return c.maxMetricsPerRequest
+}
+
+func (c SQLGroup) Name() string {
+	return c.groupName
+}
+
+func (c SQLGroup) Backends() []string {
+	return c.servers
+}
+
+// query runs the query on the first server that answers, rows are read by the callback
+func (c *SQLGroup) query(ctx context.Context, logger *zap.Logger, q *query, values map[string]interface{}, read func(rows *dbsql.Rows) error) merry.Error {
+	var e merry.Error
+	for i, db := range c.dbs {
+		server := c.servers[i]
+		if err := c.limiter.Enter(ctx, server); err != nil {
+			return types.ErrTimeoutExceeded.Here().WithCause(err).WithValue("server", server)
+		}
+
+		err := func() error {
+			defer c.limiter.Leave(ctx, server)
+			rows, err := db.QueryContext(ctx, q.text, q.args(values)...)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			if err := read(rows); err != nil {
+				return err
+			}
+			return rows.Err()
+		}()
+		if err == nil {
+			return nil
+		}
+
+		logger.Debug("query failed",
+			zap.Int("server_index", i),
+			zap.String("query", q.text),
+			zap.Error(err),
+		)
+		if ctx.Err() != nil {
+			return types.ErrTimeoutExceeded.Here().WithCause(err)
+		}
+		e = types.ErrFailedToFetch.Here().WithCause(err).WithValue("query", q.text)
+		if merry.Is(err, ErrInvalidRow) {
+			return e
+		}
+	}
+	return e
+}
+
+// columnIndex returns positions of the named columns
+func columnIndex(rows *dbsql.Rows, names ...string) ([]int, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]int, len(names))
+	for i, name := range names {
+		res[i] = -1
+		for j, col := range columns {
+			if strings.EqualFold(col, name) {
+				res[i] = j
+			}
+		}
+		if res[i] < 0 {
+			return nil, ErrInvalidRow.Here().WithMessagef("column '%s' is not found in %v", name, columns)
+		}
+	}
+	return res, nil
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case []byte:
+		f, err := strconv.ParseFloat(string(n), 64)
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func toTimestamp(v interface{}) (int64, bool) {
+	if t, ok := v.(time.Time); ok {
+		return t.Unix(), true
+	}
+	f, ok := toFloat64(v)
+	return int64(f), ok
+}
+
+func toString(v interface{}) (string, bool) {
+	switch s := v.(type) {
+	case string:
+		return s, true
+	case []byte:
+		return string(s), true
+	}
+	return "", false
+}
+
+// findNames returns names of the series that match the regex
+func (c *SQLGroup) findNames(ctx context.Context, logger *zap.Logger, pattern string) ([]string, merry.Error) {
+	var names []string
+	e := c.query(ctx, logger, c.findQuery, map[string]interface{}{"pattern": pattern}, func(rows *dbsql.Rows) error {
+		idx, err := columnIndex(rows, c.nameColumn)
+		if err != nil {
+			return err
+		}
+		cols, _ := rows.Columns()
+		dest := make([]interface{}, len(cols))
+		for i := range dest {
+			dest[i] = new(interface{})
+		}
+		for rows.Next() {
+			if err := rows.Scan(dest...); err != nil {
+				return err
+			}
+			if name, ok := toString(*dest[idx[0]].(*interface{})); ok {
+				names = append(names, name)
+			}
+		}
+		return nil
+	})
+	return names, e
+}
+
+// fetchPattern returns regex for the series of the target, seriesByTag is resolved to the list of the names
+func (c *SQLGroup) fetchPattern(ctx context.Context, logger *zap.Logger, target string) (string, merry.Error) {
+	if !strings.HasPrefix(target, "seriesByTag") {
+		return "^" + helper.GlobToRegex(target, globAnyChar) + "$", nil
+	}
+
+	exprs, err := helper.ParseTagExprs(helper.TagExpressions(target))
+	if err != nil {
+		return "", merry.Wrap(err)
+	}
+	names, e := c.findNames(ctx, logger, taggedPattern(exprs))
+	if e != nil {
+		return "", e
+	}
+
+	var matched []string
+	for _, name := range names {
+		if helper.MatchAllTags(exprs, tags.ExtractTags(name)) {
+			matched = append(matched, regexp.QuoteMeta(name))
+		}
+	}
+	if len(matched) == 0 {
+		return "", nil
+	}
+	return "^(" + strings.Join(matched, "|") + ")$", nil
+}
+
+func (c *SQLGroup) Fetch(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, merry.Error) {
+	logger := c.logger.With(zap.String("type", "fetch"), zap.String("request", request.String()))
+	stats := &types.Stats{}
+
+	var r protov3.MultiFetchResponse
+	var e merry.Error
+	for _, m := range request.Metrics {
+		stats.RenderRequests++
+		pathExpr := m.PathExpression
+		if pathExpr == "" {
+			pathExpr = m.Name
+		}
+
+		maxPointsPerQuery := c.maxPointsPerQuery
+		if m.MaxDataPoints != 0 {
+			maxPointsPerQuery = m.MaxDataPoints
+		}
+		step := helpers.AdjustStep(m.StartTime, m.StopTime, maxPointsPerQuery, c.step, 0)
+		start := m.StartTime - m.StartTime%step
+		points := (m.StopTime - start + step - 1) / step
+
+		pattern, err := c.fetchPattern(ctx, logger, m.Name)
+		if err == nil && pattern == "" {
+			continue
+		}
+
+		buckets := make(map[string][][]float64)
+		if err == nil {
+			values := map[string]interface{}{
+				"pattern": pattern,
+				"from":    m.StartTime,
+				"until":   m.StopTime,
+				"step":    step,
+			}
+			err = c.query(ctx, logger, c.fetchQuery, values, func(rows *dbsql.Rows) error {
+				idx, err := columnIndex(rows, c.nameColumn, c.timeColumn, c.valueColumn)
+				if err != nil {
+					return err
+				}
+				cols, _ := rows.Columns()
+				dest := make([]interface{}, len(cols))
+				for i := range dest {
+					dest[i] = new(interface{})
+				}
+				for rows.Next() {
+					if err := rows.Scan(dest...); err != nil {
+						return err
+					}
+					name, ok1 := toString(*dest[idx[0]].(*interface{}))
+					ts, ok2 := toTimestamp(*dest[idx[1]].(*interface{}))
+					if !ok1 || !ok2 {
+						return ErrInvalidRow.Here().WithMessagef("can't parse name or time of the row")
+					}
+					value, ok := toFloat64(*dest[idx[2]].(*interface{}))
+					i := (ts - start) / step
+					if !ok || ts < start || i >= points {
+						continue
+					}
+					if buckets[name] == nil {
+						buckets[name] = make([][]float64, points)
+					}
+					buckets[name][i] = append(buckets[name][i], value)
+				}
+				return nil
+			})
+		}
+		if err != nil {
+			stats.RenderErrors++
+			if merry.Is(err, types.ErrTimeoutExceeded) {
+				stats.Timeouts++
+				stats.RenderTimeouts++
+			}
+			if e == nil {
+				e = err
+			} else {
+				e = e.WithCause(err)
+			}
+			continue
+		}
+
+		names := make([]string, 0, len(buckets))
+		for name := range buckets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			values := make([]float64, points)
+			for i, b := range buckets[name] {
+				values[i] = math.NaN()
+				if len(b) > 0 {
+					values[i] = types.ConsolidatePoints(c.consolidation, b)
+				}
+			}
+			r.Metrics = append(r.Metrics, protov3.FetchResponse{
+				Name:              name,
+				PathExpression:    pathExpr,
+				ConsolidationFunc: c.consolidation,
+				StartTime:         start,
+				StopTime:          start + points*step,
+				StepTime:          step,
+				Values:            values,
+				RequestStartTime:  m.StartTime,
+				RequestStopTime:   m.StopTime,
+			})
+		}
+	}
+
+	if e != nil {
+		stats.FailedServers = []string{c.groupName}
+		logger.Error("errors occurred while getting results",
+			zap.Any("errors", e),
+		)
+		return &r, stats, e
+	}
+	if len(r.Metrics) == 0 {
+		return &r, stats, types.ErrNotFound
+	}
+	return &r, stats, nil
+}
+
+func (c *SQLGroup) Find(ctx context.Context, request *protov3.MultiGlobRequest) (*protov3.MultiGlobResponse, *types.Stats, merry.Error) {
+	logger := c.logger.With(zap.String("type", "find"), zap.Strings("request", request.Metrics))
+	stats := &types.Stats{}
+
+	r := protov3.MultiGlobResponse{
+		Metrics: make([]protov3.GlobResponse, 0),
+	}
+	var e merry.Error
+	for _, query := range request.Metrics {
+		stats.FindRequests++
+		names, err := c.findNames(ctx, logger, "^"+helper.GlobToRegex(query, globAnyChar)+`(\..*)?$`)
+		if err != nil {
+			stats.FindErrors++
+			if merry.Is(err, types.ErrTimeoutExceeded) {
+				stats.Timeouts++
+				stats.FindTimeouts++
+			}
+			if e == nil {
+				e = err
+			} else {
+				e = e.WithCause(err)
+			}
+			continue
+		}
+
+		depth := strings.Count(query, ".") + 1
+		seen := make(map[protov3.GlobMatch]struct{})
+		matches := make([]protov3.GlobMatch, 0)
+		for _, name := range names {
+			if strings.Contains(name, ";") {
+				continue
+			}
+			nodes := strings.Split(name, ".")
+			if len(nodes) < depth {
+				continue
+			}
+			m := protov3.GlobMatch{Path: strings.Join(nodes[:depth], "."), IsLeaf: len(nodes) == depth}
+			if _, ok := seen[m]; ok {
+				continue
+			}
+			seen[m] = struct{}{}
+			matches = append(matches, m)
+		}
+		sort.Slice(matches, func(i, j int) bool {
+			return matches[i].Path < matches[j].Path
+		})
+		r.Metrics = append(r.Metrics, protov3.GlobResponse{
+			Name:    query,
+			Matches: matches,
+		})
+	}
+
+	if e != nil {
+		stats.FailedServers = []string{c.groupName}
+		logger.Error("errors occurred while getting results",
+			zap.Any("errors", e),
+		)
+		return &r, stats, e
+	}
+	return &r, stats, nil
+}
+
+func (c *SQLGroup) Info(ctx context.Context, request *protov3.MultiMetricsInfoRequest) (*protov3.ZipperInfoResponse, *types.Stats, merry.Error) {
+	return nil, nil, types.ErrNotSupportedByBackend
+}
+
+func (c *SQLGroup) List(ctx context.Context) (*protov3.ListMetricsResponse, *types.Stats, merry.Error) {
+	return nil, nil, types.ErrNotImplementedYet
+}
+func (c *SQLGroup) Stats(ctx context.Context) (*protov3.MetricDetailsResponse, *types.Stats, merry.Error) {
+	return nil, nil, types.ErrNotSupportedByBackend
+}
+
+// doTagQuery resolves tag names and values from the names of tagged series returned by the find query
+func (c *SQLGroup) doTagQuery(ctx context.Context, isTagName bool, query string, limit int64) ([]string, merry.Error) {
+	logger := c.logger.With(zap.String("type", "tagValues"))
+	if isTagName {
+		logger = c.logger.With(zap.String("type", "tagName"))
+	}
+
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return []string{}, merry.Wrap(err)
+	}
+	exprs, err := helper.ParseTagExprs(params["expr"])
+	if err != nil {
+		return []string{}, merry.Wrap(err)
+	}
+	tag := params.Get("tag")
+	prefix := params.Get("valuePrefix")
+	if isTagName {
+		prefix = params.Get("tagPrefix")
+	} else if tag == "" {
+		return []string{}, types.ErrNoTagSpecified
+	}
+
+	names, e := c.findNames(ctx, logger, taggedPattern(exprs))
+	if e != nil {
+		return []string{}, e
+	}
+
+	uniq := make(map[string]struct{})
+	for _, name := range names {
+		t := tags.ExtractTags(name)
+		if !helper.MatchAllTags(exprs, t) {
+			continue
+		}
+		if isTagName {
+			for k := range t {
+				if strings.HasPrefix(k, prefix) {
+					uniq[k] = struct{}{}
+				}
+			}
+		} else if v, ok := t[tag]; ok && strings.HasPrefix(v, prefix) {
+			uniq[v] = struct{}{}
+		}
+	}
+
+	res := make([]string, 0, len(uniq))
+	for v := range uniq {
+		res = append(res, v)
+	}
+	sort.Strings(res)
+	if limit > 0 && int64(len(res)) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+func (c *SQLGroup) TagNames(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
+	return c.doTagQuery(ctx, true, query, limit)
+}
+
+func (c *SQLGroup) TagValues(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
+	return c.doTagQuery(ctx, false, query, limit)
+}
+
+func (c *SQLGroup) ProbeTLDs(ctx context.Context) ([]string, merry.Error) {
+	res, _, err := c.Find(ctx, &protov3.MultiGlobRequest{Metrics: []string{"*"}})
+	if err != nil {
+		return nil, err
+	}
+
+	var tlds []string
+	for _, m := range res.Metrics {
+		for _, v := range m.Matches {
+			tlds = append(tlds, v.Path)
+		}
+	}
+	return tlds, nil
+}
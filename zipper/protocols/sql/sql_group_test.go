@@ -0,0 +1,316 @@
+package sql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+const (
+	testFetchQuery = "SELECT name, ts AS time, value FROM kpi WHERE name ~ :pattern AND ts >= to_timestamp(:from) AND ts < to_timestamp(:until) AND :step::int > 0"
+	testFindQuery  = "SELECT DISTINCT name FROM kpi WHERE name ~ :pattern"
+)
+
+type testPoint struct {
+	name  string
+	ts    int64
+	value driver.Value
+}
+
+var testPoints = []testPoint{
+	{"kpi.orders.eu", 1010, 1.0},
+	{"kpi.orders.eu", 1000, []byte("2")},
+	{"kpi.orders.eu", 1080, int64(3)},
+	{"kpi.orders.us", 1020, 5.0},
+	{"kpi.orders.us", 1100, nil},
+	{"kpi.revenue", 2000, 1.0},
+	{"sales;product=a;region=eu", 1020, 7.0},
+	{"sales;product=b;region=us", 1020, 8.0},
+}
+
+// fakeDriver serves test points for the test queries, DSN "down" always fails
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	return &fakeConn{dsn: dsn}, nil
+}
+
+type fakeConn struct {
+	dsn string
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if c.dsn == "down" {
+		return nil, errors.New("connection refused")
+	}
+
+	re := regexp.MustCompile(args[0].Value.(string))
+	switch query {
+	case "SELECT name, ts AS time, value FROM kpi WHERE name ~ $1 AND ts >= to_timestamp($2) AND ts < to_timestamp($3) AND $4::int > 0":
+		from, until := args[1].Value.(int64), args[2].Value.(int64)
+		rows := &fakeRows{columns: []string{"name", "time", "value"}}
+		for _, p := range testPoints {
+			if re.MatchString(p.name) && p.ts >= from && p.ts < until {
+				rows.values = append(rows.values, []driver.Value{p.name, time.Unix(p.ts, 0), p.value})
+			}
+		}
+		return rows, nil
+	case "SELECT DISTINCT name FROM kpi WHERE name ~ $1":
+		rows := &fakeRows{columns: []string{"name"}}
+		seen := make(map[string]bool)
+		for _, p := range testPoints {
+			if re.MatchString(p.name) && !seen[p.name] {
+				seen[p.name] = true
+				rows.values = append(rows.values, []driver.Value{p.name})
+			}
+		}
+		return rows, nil
+	}
+	return nil, errors.New("unexpected query " + query)
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func init() {
+	dbsql.Register("carbonapi_test", fakeDriver{})
+}
+
+func newTestGroup(t *testing.T) types.BackendServer {
+	t.Helper()
+
+	concurrencyLimit := 10
+	maxBatchSize := 100
+	b, err := New(zap.NewNop(), types.BackendV2{
+		GroupName:        "kpi",
+		Protocol:         "sql",
+		Servers:          []string{"down", "main"},
+		ConcurrencyLimit: &concurrencyLimit,
+		MaxBatchSize:     &maxBatchSize,
+		BackendOptions: map[string]interface{}{
+			"sql_driver":      "carbonapi_test",
+			"sql_fetch_query": testFetchQuery,
+			"sql_find_query":  testFindQuery,
+		},
+	}, true, false)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return b
+}
+
+func TestCompileQuery(t *testing.T) {
+	tests := []struct {
+		query    string
+		question bool
+		want     string
+		params   []string
+		wantErr  bool
+	}{
+		{
+			query:  "SELECT time_bucket(:step * interval '1 second', ts)::timestamp FROM t WHERE name ~ :pattern AND ts >= to_timestamp(:from)",
+			want:   "SELECT time_bucket($1 * interval '1 second', ts)::timestamp FROM t WHERE name ~ $2 AND ts >= to_timestamp($3)",
+			params: []string{"step", "pattern", "from"},
+		},
+		{
+			query:    `SELECT ":pattern", ':from' FROM t WHERE a = :until AND b = :until`,
+			question: true,
+			want:     `SELECT ":pattern", ':from' FROM t WHERE a = ? AND b = ?`,
+			params:   []string{"until", "until"},
+		},
+		{
+			query:   "SELECT * FROM t WHERE name = :name",
+			wantErr: true,
+		},
+		{
+			query:   "SELECT 'unterminated FROM t",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := compileQuery(tt.query, tt.question, "pattern", "from", "until", "step")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", q)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if q.text != tt.want || !reflect.DeepEqual(q.params, tt.params) {
+				t.Errorf("got %q %v, want %q %v", q.text, q.params, tt.want, tt.params)
+			}
+		})
+	}
+}
+
+func TestFetch(t *testing.T) {
+	b := newTestGroup(t)
+	nan := math.NaN()
+
+	tests := []struct {
+		target string
+		want   map[string][]float64
+	}{
+		{
+			target: "kpi.orders.*",
+			want: map[string][]float64{
+				"kpi.orders.eu": {1.5, nan, 3, nan},
+				"kpi.orders.us": {nan, 5, nan, nan},
+			},
+		},
+		{
+			target: "seriesByTag('name=sales','region=~e')",
+			want:   map[string][]float64{"sales;product=a;region=eu": {nan, 7, nan, nan}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			res, _, err := b.Fetch(context.Background(), &protov3.MultiFetchRequest{
+				Metrics: []protov3.FetchRequest{{Name: tt.target, PathExpression: tt.target, StartTime: 1000, StopTime: 1180}},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if len(res.Metrics) != len(tt.want) {
+				t.Fatalf("unexpected response %+v", res.Metrics)
+			}
+			for _, m := range res.Metrics {
+				want, ok := tt.want[m.Name]
+				if !ok {
+					t.Fatalf("unexpected metric %s", m.Name)
+				}
+				if m.PathExpression != tt.target || m.StartTime != 960 || m.StopTime != 1200 || m.StepTime != 60 || m.ConsolidationFunc != "average" {
+					t.Errorf("unexpected metadata %+v", m)
+				}
+				if len(m.Values) != len(want) {
+					t.Fatalf("%s: got %v, want %v", m.Name, m.Values, want)
+				}
+				for i := range want {
+					if m.Values[i] != want[i] && !(math.IsNaN(m.Values[i]) && math.IsNaN(want[i])) {
+						t.Fatalf("%s: got %v, want %v", m.Name, m.Values, want)
+					}
+				}
+			}
+		})
+	}
+
+	_, _, err := b.Fetch(context.Background(), &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{Name: "kpi.revenue", StartTime: 1000, StopTime: 1180}},
+	})
+	if !errors.Is(err, types.ErrNotFound) {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
+
+func TestFind(t *testing.T) {
+	b := newTestGroup(t)
+
+	tests := []struct {
+		query string
+		want  []protov3.GlobMatch
+	}{
+		{
+			query: "*",
+			want:  []protov3.GlobMatch{{Path: "kpi"}},
+		},
+		{
+			query: "kpi.*",
+			want:  []protov3.GlobMatch{{Path: "kpi.orders"}, {Path: "kpi.revenue", IsLeaf: true}},
+		},
+		{
+			query: "kpi.orders.{eu,us}",
+			want:  []protov3.GlobMatch{{Path: "kpi.orders.eu", IsLeaf: true}, {Path: "kpi.orders.us", IsLeaf: true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			res, _, err := b.Find(context.Background(), &protov3.MultiGlobRequest{Metrics: []string{tt.query}})
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if len(res.Metrics) != 1 || !reflect.DeepEqual(res.Metrics[0].Matches, tt.want) {
+				t.Errorf("got %+v, want %+v", res.Metrics, tt.want)
+			}
+		})
+	}
+}
+
+func TestTags(t *testing.T) {
+	b := newTestGroup(t)
+
+	names, err := b.TagNames(context.Background(), "expr=region%3Dus", 0)
+	sort.Strings(names)
+	if err != nil || !reflect.DeepEqual(names, []string{"name", "product", "region"}) {
+		t.Errorf("unexpected tag names %v, error %v", names, err)
+	}
+
+	values, err := b.TagValues(context.Background(), "tag=region&expr=name%3Dsales&valuePrefix=e", 0)
+	if err != nil || !reflect.DeepEqual(values, []string{"eu"}) {
+		t.Errorf("unexpected tag values %v, error %v", values, err)
+	}
+}
+
+func TestRedactedServers(t *testing.T) {
+	concurrencyLimit := 10
+	maxBatchSize := 100
+	b, err := New(zap.NewNop(), types.BackendV2{
+		GroupName:        "postgres://user:secret@db/graphite",
+		Protocol:         "sql",
+		Servers:          []string{"postgres://user:secret@db/graphite"},
+		ConcurrencyLimit: &concurrencyLimit,
+		MaxBatchSize:     &maxBatchSize,
+		BackendOptions: map[string]interface{}{
+			"sql_driver":      "carbonapi_test",
+			"sql_fetch_query": testFetchQuery,
+			"sql_find_query":  testFindQuery,
+		},
+	}, true, false)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if name := b.Name(); name != "postgres://user:xxxxx@db/graphite" {
+		t.Errorf("unexpected name %v", name)
+	}
+	if servers := b.Backends(); len(servers) != 1 || servers[0] != "postgres://user:xxxxx@db/graphite" {
+		t.Errorf("unexpected servers %v", servers)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/url"
+	"sync"
 
 	"github.com/ansel1/merry"
 	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
@@ -45,6 +46,9 @@ type ClientProtoV3Group struct {
 	maxTries             int
 	maxMetricsPerRequest int
 
+	pushdownOnce      sync.Once
+	pushdownFunctions []string
+
 	httpQuery *helper.HttpQuery
 }
 
@@ -52,6 +56,10 @@ func (c *ClientProtoV3Group) Children() []types.BackendServer {
 	return []types.BackendServer{c}
 }
 
+func (c *ClientProtoV3Group) CloseIdleConnections() {
+	c.httpQuery.CloseIdleConnections()
+}
+
 func New(logger *zap.Logger, config types.BackendV2, tldCacheDisabled, requireSuccessAll bool) (types.BackendServer, merry.Error) {
 	if config.ConcurrencyLimit == nil {
 		return nil, types.ErrConcurrencyLimitNotSet
@@ -84,18 +92,97 @@ func NewWithLimiter(logger *zap.Logger, config types.BackendV2, tldCacheDisabled
 
 		httpQuery: httpQuery,
 	}
+
 	return c, nil
 }
 
-func (c ClientProtoV3Group) MaxMetricsPerRequest() int {
+// capabilities is a response of /_internal/capabilities/ in json format. Backend evaluates functions passed as
+// FilterFunctions, that are listed in filteringFunctions, supportFilteringFunctions alone isn't enough, as backends
+// apply only some of the functions (e.x. consolidateBy).
+type capabilities struct {
+	SupportFilteringFunctions bool     `json:"supportFilteringFunctions"`
+	FilteringFunctions        []string `json:"filteringFunctions"`
+}
+
+// capabilitiesRequest asks for capabilities in json format
+type capabilitiesRequest struct {
+	types.CapabilityRequestV3
+}
+
+func (capabilitiesRequest) Headers() map[string]string {
+	return map[string]string{"Accept": httpHeaders.ContentTypeJSON}
+}
+
+// PushdownFunctions returns functions that backend evaluates if they are passed as FilterFunctions. They are the
+// functions, that all the servers list in filteringFunctions of their capabilities, which are requested on the first
+// call.
+func (c *ClientProtoV3Group) PushdownFunctions() []string {
+	c.pushdownOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout.Find)
+		defer cancel()
+		c.pushdownFunctions = c.filteringFunctions(ctx)
+	})
+	return c.pushdownFunctions
+}
+
+// filteringFunctions requests capabilities of all the servers and returns functions of types.FilteringFunctions, that
+// are supported by all of them
+func (c *ClientProtoV3Group) filteringFunctions(ctx context.Context) []string {
+	logger := c.logger.With(zap.String("type", "capabilities"))
+
+	rewrite, _ := url.Parse("http://127.0.0.1/_internal/capabilities/")
+	v := url.Values{
+		"format": []string{"json"},
+	}
+	rewrite.RawQuery = v.Encode()
+	res, err := c.httpQuery.DoQueryToAll(ctx, logger, rewrite.RequestURI(), capabilitiesRequest{})
+	if err != nil {
+		logger.Warn("failed to get capabilities, functions won't be passed to backend",
+			zap.Error(err),
+		)
+		return nil
+	}
+
+	supported := make(map[string]int)
+	for _, r := range res {
+		var caps capabilities
+		if err := json.Unmarshal(r.Response, &caps); err != nil {
+			logger.Warn("failed to parse capabilities, functions won't be passed to backend",
+				zap.String("server", r.Server),
+				zap.Error(err),
+			)
+			return nil
+		}
+		if !caps.SupportFilteringFunctions {
+			return nil
+		}
+		seen := make(map[string]struct{}, len(caps.FilteringFunctions))
+		for _, f := range caps.FilteringFunctions {
+			if _, ok := seen[f]; !ok {
+				seen[f] = struct{}{}
+				supported[f]++
+			}
+		}
+	}
+
+	var functions []string
+	for _, f := range types.FilteringFunctions {
+		if supported[f] == len(res) {
+			functions = append(functions, f)
+		}
+	}
+	return functions
+}
+
+func (c *ClientProtoV3Group) MaxMetricsPerRequest() int {
 	return c.maxMetricsPerRequest
 }
 
-func (c ClientProtoV3Group) Name() string {
+func (c *ClientProtoV3Group) Name() string {
 	return c.groupName
 }
 
-func (c ClientProtoV3Group) Backends() []string {
+func (c *ClientProtoV3Group) Backends() []string {
 	return c.servers
 }
 
@@ -0,0 +1,80 @@
+package v3
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+func newCapabilityServer(supportFilteringFunctions bool, functions ...string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_internal/capabilities/" || r.FormValue("format") != "json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		data, _ := json.Marshal(map[string]interface{}{
+			"supportFilteringFunctions": supportFilteringFunctions,
+			"filteringFunctions":        functions,
+		})
+		_, _ = w.Write(data)
+	}))
+}
+
+func TestPushdownFunctions(t *testing.T) {
+	supported := newCapabilityServer(true, "consolidateBy", "sumSeries", "scale", "unknownFunction")
+	defer supported.Close()
+	replica := newCapabilityServer(true, "sumSeries", "maxSeries")
+	defer replica.Close()
+	withoutList := newCapabilityServer(true)
+	defer withoutList.Close()
+	unsupported := newCapabilityServer(false, "sumSeries")
+	defer unsupported.Close()
+
+	tests := []struct {
+		name    string
+		servers []string
+		want    []string
+	}{
+		{"supported", []string{supported.URL}, []string{"sumSeries", "scale"}},
+		{"functions common to all servers", []string{supported.URL, replica.URL}, []string{"sumSeries"}},
+		{"server without list of functions", []string{withoutList.URL}, nil},
+		{"one server without support", []string{supported.URL, unsupported.URL}, nil},
+		{"unavailable server", []string{supported.URL, "http://127.0.0.1:1"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			concurrencyLimit := 10
+			maxBatchSize := 100
+			maxTries := 1
+			maxIdleConns := 10
+			idleTimeout := time.Minute
+			keepAlive := time.Minute
+			b, err := New(zap.NewNop(), types.BackendV2{
+				GroupName:             tt.name,
+				Protocol:              "carbonapi_v3_pb",
+				Servers:               tt.servers,
+				ConcurrencyLimit:      &concurrencyLimit,
+				MaxBatchSize:          &maxBatchSize,
+				MaxTries:              &maxTries,
+				MaxIdleConnsPerHost:   &maxIdleConns,
+				IdleConnectionTimeout: &idleTimeout,
+				KeepAliveInterval:     &keepAlive,
+				Timeouts:              &types.Timeouts{Find: time.Second, Render: time.Second, Connect: time.Second},
+			}, true, false)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if got := types.PushdownFunctions(b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,494 @@
+package v3grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+
+	"github.com/ansel1/merry"
+	grpcv3 "github.com/go-graphite/protocol/carbonapi_v3_grpc"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/golang/protobuf/ptypes/empty"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	grpcMetadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/go-graphite/carbonapi/internal/dns"
+	"github.com/go-graphite/carbonapi/limiter"
+	"github.com/go-graphite/carbonapi/pkg/tlsconfig"
+	util "github.com/go-graphite/carbonapi/util/ctx"
+	"github.com/go-graphite/carbonapi/zipper/metadata"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+func init() {
+	aliases := []string{"carbonapi_v3_grpc", "v3_grpc"}
+	metadata.Metadata.Lock()
+	for _, name := range aliases {
+		metadata.Metadata.SupportedProtocols[name] = struct{}{}
+		metadata.Metadata.ProtocolInits[name] = New
+		metadata.Metadata.ProtocolInitsWithLimiter[name] = NewWithLimiter
+	}
+	defer metadata.Metadata.Unlock()
+}
+
+// DefaultMaxMessageSize is a default limit for a single message of the response
+const DefaultMaxMessageSize = 64 * 1024 * 1024
+
+// ErrInvalidServer is returned for servers that are not http:// or https:// urls
+var ErrInvalidServer = merry.New("carbonapi_v3_grpc servers must be http:// (plaintext) or https:// (TLS) urls")
+
+// ClientGRPCGroup calls methods of carbonapi_v3_grpc.CarbonV1 service, series are fetched with CarbonV1Stream service,
+// if servers have it
+type ClientGRPCGroup struct {
+	groupName string
+	servers   []string
+	clients   map[string]*serverClient
+	conns     []*grpc.ClientConn
+
+	limiter              limiter.ServerLimiter
+	logger               *zap.Logger
+	timeout              types.Timeouts
+	maxTries             int
+	maxMetricsPerRequest int
+
+	counter uint64
+}
+
+// serverClient calls services of a single server
+type serverClient struct {
+	grpcv3.CarbonV1Client
+	stream carbonV1StreamClient
+	// streamUnsupported is set after the server answered that it doesn't implement FetchMetricsStream, e.g. go-carbon
+	streamUnsupported atomic.Bool
+}
+
+func (c *ClientGRPCGroup) Children() []types.BackendServer {
+	return []types.BackendServer{c}
+}
+
+func New(logger *zap.Logger, config types.BackendV2, tldCacheDisabled, requireSuccessAll bool) (types.BackendServer, merry.Error) {
+	if config.ConcurrencyLimit == nil {
+		return nil, types.ErrConcurrencyLimitNotSet
+	}
+	if len(config.Servers) == 0 {
+		return nil, types.ErrNoServersSpecified
+	}
+	l := limiter.NewServerLimiter(config.Servers, *config.ConcurrencyLimit)
+
+	return NewWithLimiter(logger, config, tldCacheDisabled, requireSuccessAll, l)
+}
+
+func NewWithLimiter(logger *zap.Logger, config types.BackendV2, tldCacheDisabled, requireSuccessAll bool, l limiter.ServerLimiter) (types.BackendServer, merry.Error) {
+	logger = logger.With(zap.String("type", "grpcV3Group"), zap.String("name", config.GroupName))
+
+	maxMessageSize := DefaultMaxMessageSize
+	maxMessageSizeI, ok := config.BackendOptions["max_message_size"]
+	if ok {
+		maxMessageSize, ok = maxMessageSizeI.(int)
+		if !ok {
+			logger.Fatal("failed to parse max_message_size",
+				zap.String("type_parsed", fmt.Sprintf("%T", maxMessageSizeI)),
+				zap.String("type_expected", "int"),
+			)
+		}
+	}
+
+	tlsConfig := &tls.Config{}
+	if config.TLSClientConfig != nil {
+		var warns []string
+		var err error
+		tlsConfig, warns, err = tlsconfig.ParseClientTLSConfig(config.TLSClientConfig)
+		if err != nil {
+			logger.Fatal("failed to initialize client for group",
+				zap.String("group_name", config.GroupName),
+				zap.Error(err),
+			)
+		}
+		if len(warns) > 0 {
+			logger.Warn("insecure options detected, while parsing gRPC Client TLS Config for backed",
+				zap.String("group_name", config.GroupName),
+				zap.Strings("warnings", warns),
+			)
+		}
+	}
+
+	dialContext := dns.GetDialContextWithTimeout(config.Timeouts.Connect, *config.KeepAliveInterval)
+	opts := []grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return dialContext(ctx, "tcp", addr)
+		}),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxMessageSize)),
+	}
+
+	clients := make(map[string]*serverClient, len(config.Servers))
+	conns := make([]*grpc.ClientConn, 0, len(config.Servers))
+	for _, server := range config.Servers {
+		conn, err := dial(server, tlsConfig, opts)
+		if err != nil {
+			for _, conn := range conns {
+				_ = conn.Close()
+			}
+			return nil, err
+		}
+		clients[server] = &serverClient{
+			CarbonV1Client: grpcv3.NewCarbonV1Client(conn),
+			stream:         carbonV1StreamClient{cc: conn},
+		}
+		conns = append(conns, conn)
+	}
+
+	c := &ClientGRPCGroup{
+		groupName:            config.GroupName,
+		servers:              config.Servers,
+		clients:              clients,
+		conns:                conns,
+		timeout:              *config.Timeouts,
+		maxTries:             *config.MaxTries,
+		maxMetricsPerRequest: *config.MaxBatchSize,
+
+		limiter: l,
+		logger:  logger,
+	}
+	return c, nil
+}
+
+// dial returns connection to the server, plaintext HTTP/2 is used for http:// urls and TLS for https:// ones.
+// Connection is established lazily, on the first call.
+func dial(server string, tlsConfig *tls.Config, opts []grpc.DialOption) (*grpc.ClientConn, merry.Error) {
+	u, err := url.Parse(server)
+	if err != nil || u.Host == "" {
+		return nil, ErrInvalidServer.WithValue("server", server)
+	}
+	var creds credentials.TransportCredentials
+	switch u.Scheme {
+	case "http":
+		creds = insecure.NewCredentials()
+	case "https":
+		creds = credentials.NewTLS(tlsConfig)
+	default:
+		return nil, ErrInvalidServer.WithValue("server", server)
+	}
+	conn, err := grpc.Dial(u.Host, append(opts, grpc.WithTransportCredentials(creds))...)
+	if err != nil {
+		return nil, merry.Wrap(err).WithValue("server", server)
+	}
+	return conn, nil
+}
+
+// CloseIdleConnections closes connections to the servers, group can't be used after that
+func (c *ClientGRPCGroup) CloseIdleConnections() {
+	for _, conn := range c.conns {
+		_ = conn.Close()
+	}
+}
+
+func (c *ClientGRPCGroup) MaxMetricsPerRequest() int {
+	return c.maxMetricsPerRequest
+}
+
+func (c *ClientGRPCGroup) Name() string {
+	return c.groupName
+}
+
+func (c *ClientGRPCGroup) Backends() []string {
+	return c.servers
+}
+
+func (c *ClientGRPCGroup) pickServer() string {
+	if len(c.servers) == 1 {
+		return c.servers[0]
+	}
+	counter := atomic.AddUint64(&c.counter, 1)
+	return c.servers[counter%uint64(len(c.servers))]
+}
+
+// outgoingContext passes uuid of the request and headers to pass as gRPC metadata
+func outgoingContext(ctx context.Context) context.Context {
+	uuid := util.GetUUID(ctx)
+	md := grpcMetadata.Pairs(util.HeaderUUIDZipper, uuid, util.HeaderUUIDAPI, uuid)
+	for name, value := range util.GetPassHeaders(ctx) {
+		md.Append(name, value)
+	}
+	return grpcMetadata.NewOutgoingContext(ctx, md)
+}
+
+// statusError converts gRPC status to the error
+func statusError(ctx context.Context, server string, err error) merry.Error {
+	s := status.Convert(err)
+	switch s.Code() {
+	case codes.OK:
+		return nil
+	case codes.NotFound:
+		return types.ErrNotFound.WithValue("server", server)
+	case codes.Unimplemented:
+		return types.ErrNotImplementedYet.WithValue("server", server).WithMessage(s.Message())
+	case codes.DeadlineExceeded:
+		return types.ErrTimeoutExceeded.WithValue("server", server).WithCause(err)
+	case codes.Canceled:
+		if ctx.Err() == context.DeadlineExceeded {
+			return types.ErrTimeoutExceeded.WithValue("server", server).WithCause(err)
+		}
+	}
+	return types.ErrFailedToFetch.WithValue("server", server).WithMessage(s.Message()).WithHTTPCode(httpCode(s.Code()))
+}
+
+// httpCode returns HTTP status code for gRPC status code
+func httpCode(code codes.Code) int {
+	switch code {
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.PermissionDenied, codes.Unauthenticated:
+		return http.StatusForbidden
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
+
+// doCall retries call on other servers, until server responds with anything but transport errors
+func (c *ClientGRPCGroup) doCall(ctx context.Context, logger *zap.Logger, call func(ctx context.Context, client *serverClient) error) (string, merry.Error) {
+	maxTries := c.maxTries
+	if len(c.servers) > maxTries {
+		maxTries = len(c.servers)
+	}
+
+	ctx = outgoingContext(ctx)
+	var e merry.Error
+	for try := 0; try < maxTries; try++ {
+		server := c.pickServer()
+		if err := c.limiter.Enter(ctx, server); err != nil {
+			logger.Debug("timeout waiting for a slot")
+			return server, merry.Here(err).WithValue("server", server)
+		}
+		err := call(ctx, c.clients[server])
+		c.limiter.Leave(ctx, server)
+		if err == nil {
+			return server, nil
+		}
+
+		e = statusError(ctx, server, err)
+		if status.Code(err) != codes.Unavailable || ctx.Err() != nil {
+			return server, e
+		}
+		logger.Debug("have errors",
+			zap.String("error", e.Error()),
+			zap.String("server", server),
+		)
+	}
+	return "", types.ErrMaxTriesExceeded.WithCause(e).WithHTTPCode(merry.HTTPCode(e))
+}
+
+func (c *ClientGRPCGroup) Fetch(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, merry.Error) {
+	stats := &types.Stats{
+		RenderRequests: 1,
+	}
+	logger := c.logger.With(zap.String("type", "fetch"), zap.String("request", request.String()))
+
+	var r *protov3.MultiFetchResponse
+	server, e := c.doCall(ctx, logger, func(ctx context.Context, client *serverClient) (err error) {
+		if !client.streamUnsupported.Load() {
+			r, err = fetchStream(ctx, client, request)
+			if status.Code(err) != codes.Unimplemented || len(r.Metrics) > 0 {
+				return err
+			}
+			logger.Debug("server doesn't support streamed fetch",
+				zap.Error(err),
+			)
+			client.streamUnsupported.Store(true)
+		}
+		r, err = client.FetchMetrics(ctx, request)
+		return err
+	})
+	if e != nil {
+		stats.RenderErrors = 1
+		if merry.Is(e, types.ErrTimeoutExceeded) {
+			stats.Timeouts = 1
+			stats.RenderTimeouts = 1
+		}
+		if server != "" {
+			stats.FailedServers = []string{server}
+		}
+		logger.Warn("errors occurred while getting results",
+			zap.Any("errors", e),
+		)
+		return nil, stats, e
+	}
+	stats.MemoryUsage = int64(r.Size())
+
+	return r, stats, nil
+}
+
+// fetchStream receives series one by one as the server fetches them. Receiving is stopped as soon as the fetch
+// budget is exceeded, the error is reported by the caller, that checks the budget for merged responses.
+func fetchStream(ctx context.Context, client *serverClient, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	r := &protov3.MultiFetchResponse{}
+	stream, err := client.stream.FetchMetricsStream(ctx, request)
+	if err != nil {
+		return r, err
+	}
+	budget := types.GetFetchBudget(ctx)
+	for {
+		m, err := stream.Recv()
+		if err == io.EOF {
+			return r, nil
+		}
+		if err != nil {
+			return r, err
+		}
+		r.Metrics = append(r.Metrics, *m)
+		if budget != nil && budget(r) != nil {
+			return r, nil
+		}
+	}
+}
+
+func (c *ClientGRPCGroup) Find(ctx context.Context, request *protov3.MultiGlobRequest) (*protov3.MultiGlobResponse, *types.Stats, merry.Error) {
+	logger := c.logger.With(zap.String("type", "find"), zap.Strings("request", request.Metrics))
+	stats := &types.Stats{
+		FindRequests: 1,
+	}
+
+	var globs *protov3.MultiGlobResponse
+	server, e := c.doCall(ctx, logger, func(ctx context.Context, client *serverClient) (err error) {
+		globs, err = client.FindMetrics(ctx, request)
+		return err
+	})
+	if e != nil {
+		stats.FindErrors = 1
+		if merry.Is(e, types.ErrTimeoutExceeded) {
+			stats.Timeouts = 1
+			stats.FindTimeouts = 1
+		}
+		if server != "" {
+			stats.FailedServers = []string{server}
+		}
+		return nil, stats, e
+	}
+
+	return globs, stats, nil
+}
+
+func (c *ClientGRPCGroup) Info(ctx context.Context, request *protov3.MultiMetricsInfoRequest) (*protov3.ZipperInfoResponse, *types.Stats, merry.Error) {
+	logger := c.logger.With(zap.String("type", "info"), zap.Strings("request", request.Names))
+	stats := &types.Stats{
+		InfoRequests: 1,
+	}
+
+	var infos *protov3.MultiMetricsInfoResponse
+	server, e := c.doCall(ctx, logger, func(ctx context.Context, client *serverClient) (err error) {
+		infos, err = client.MetricsInfo(ctx, request)
+		return err
+	})
+	if e != nil {
+		stats.InfoErrors = 1
+		if merry.Is(e, types.ErrTimeoutExceeded) {
+			stats.Timeouts = 1
+			stats.InfoTimeouts = 1
+		}
+		if server != "" {
+			stats.FailedServers = []string{server}
+		}
+		return nil, stats, e
+	}
+	stats.MemoryUsage = int64(infos.Size())
+
+	r := &protov3.ZipperInfoResponse{
+		Info: map[string]protov3.MultiMetricsInfoResponse{
+			c.Name(): *infos,
+		},
+	}
+
+	return r, stats, nil
+}
+
+func (c *ClientGRPCGroup) List(ctx context.Context) (*protov3.ListMetricsResponse, *types.Stats, merry.Error) {
+	logger := c.logger.With(zap.String("type", "list"))
+	stats := &types.Stats{}
+
+	var r *protov3.ListMetricsResponse
+	server, e := c.doCall(ctx, logger, func(ctx context.Context, client *serverClient) (err error) {
+		r, err = client.ListMetrics(ctx, &empty.Empty{})
+		return err
+	})
+	if e != nil {
+		if server != "" {
+			stats.FailedServers = []string{server}
+		}
+		return nil, stats, e
+	}
+
+	return r, stats, nil
+}
+
+func (c *ClientGRPCGroup) Stats(ctx context.Context) (*protov3.MetricDetailsResponse, *types.Stats, merry.Error) {
+	logger := c.logger.With(zap.String("type", "stats"))
+	stats := &types.Stats{}
+
+	var r *protov3.MetricDetailsResponse
+	server, e := c.doCall(ctx, logger, func(ctx context.Context, client *serverClient) (err error) {
+		r, err = client.Stats(ctx, &empty.Empty{})
+		return err
+	})
+	if e != nil {
+		if server != "" {
+			stats.FailedServers = []string{server}
+		}
+		return nil, stats, e
+	}
+
+	return r, stats, nil
+}
+
+// TagNames is not supported, as CarbonV1 service doesn't have methods for tags autocompletion
+func (c *ClientGRPCGroup) TagNames(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
+	return nil, types.ErrNotImplementedYet.WithMessage("carbonapi_v3_grpc doesn't support tags autocompletion")
+}
+
+// TagValues is not supported, as CarbonV1 service doesn't have methods for tags autocompletion
+func (c *ClientGRPCGroup) TagValues(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
+	return nil, types.ErrNotImplementedYet.WithMessage("carbonapi_v3_grpc doesn't support tags autocompletion")
+}
+
+func (c *ClientGRPCGroup) ProbeTLDs(ctx context.Context) ([]string, merry.Error) {
+	logger := c.logger.With(zap.String("function", "prober"))
+	req := &protov3.MultiGlobRequest{
+		Metrics: []string{"*"},
+	}
+
+	logger.Debug("doing request",
+		zap.Strings("request", req.Metrics),
+	)
+
+	res, _, err := c.Find(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var tlds []string
+	for _, m := range res.Metrics {
+		for _, v := range m.Matches {
+			tlds = append(tlds, v.Path)
+		}
+	}
+
+	logger.Debug("will return data",
+		zap.Strings("tlds", tlds),
+	)
+
+	return tlds, nil
+}
@@ -0,0 +1,249 @@
+package v3grpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ansel1/merry"
+	grpcv3 "github.com/go-graphite/protocol/carbonapi_v3_grpc"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/golang/protobuf/ptypes/empty"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	util "github.com/go-graphite/carbonapi/util/ctx"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+type testServer struct {
+	deadline time.Time
+	uuid     string
+	streamed bool
+}
+
+func (s *testServer) GetVersion(ctx context.Context, _ *empty.Empty) (*grpcv3.ProtocolVersionResponse, error) {
+	return &grpcv3.ProtocolVersionResponse{Version: 3}, nil
+}
+
+func (s *testServer) FetchMetrics(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, error) {
+	s.deadline, _ = ctx.Deadline()
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get(util.HeaderUUIDAPI); len(v) > 0 {
+		s.uuid = v[0]
+	}
+
+	if request.Metrics[0].Name == "missing" {
+		return nil, status.Error(codes.NotFound, "not found")
+	}
+	var r protov3.MultiFetchResponse
+	for _, m := range request.Metrics {
+		r.Metrics = append(r.Metrics, protov3.FetchResponse{Name: m.Name, PathExpression: m.PathExpression, StepTime: 60})
+	}
+	return &r, nil
+}
+
+func (s *testServer) FetchMetricsStream(request *protov3.MultiFetchRequest, stream CarbonV1Stream_FetchMetricsStreamServer) error {
+	r, err := s.FetchMetrics(stream.Context(), request)
+	if err != nil {
+		return err
+	}
+	s.streamed = true
+	for i := range r.Metrics {
+		if err := stream.Send(&r.Metrics[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *testServer) FindMetrics(ctx context.Context, request *protov3.MultiGlobRequest) (*protov3.MultiGlobResponse, error) {
+	return &protov3.MultiGlobResponse{Metrics: []protov3.GlobResponse{
+		{Name: request.Metrics[0], Matches: []protov3.GlobMatch{{Path: "a", IsLeaf: false}}},
+	}}, nil
+}
+
+func (s *testServer) MetricsInfo(ctx context.Context, request *protov3.MultiMetricsInfoRequest) (*protov3.MultiMetricsInfoResponse, error) {
+	return &protov3.MultiMetricsInfoResponse{Metrics: []protov3.MetricsInfoResponse{{Name: request.Names[0], MaxRetention: 86400}}}, nil
+}
+
+func (s *testServer) ListMetrics(ctx context.Context, _ *empty.Empty) (*protov3.ListMetricsResponse, error) {
+	return &protov3.ListMetricsResponse{Metrics: []string{"a.b"}}, nil
+}
+
+func (s *testServer) Stats(ctx context.Context, _ *empty.Empty) (*protov3.MetricDetailsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "stats are not supported")
+}
+
+func newTestGroup(t *testing.T, servers ...string) (types.BackendServer, merry.Error) {
+	concurrencyLimit := 0
+	maxBatchSize := 100
+	maxTries := 1
+	keepAlive := time.Minute
+	return New(zap.NewNop(), types.BackendV2{
+		GroupName:         "grpc",
+		Protocol:          "carbonapi_v3_grpc",
+		Servers:           servers,
+		ConcurrencyLimit:  &concurrencyLimit,
+		MaxBatchSize:      &maxBatchSize,
+		MaxTries:          &maxTries,
+		KeepAliveInterval: &keepAlive,
+		Timeouts:          &types.Timeouts{Find: time.Second, Render: time.Second, Connect: time.Second},
+	}, true, false)
+}
+
+// startTestServer serves CarbonV1 service and CarbonV1Stream one, if stream is set
+func startTestServer(t *testing.T, srv *testServer, stream bool) (types.BackendServer, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	grpcv3.RegisterCarbonV1Server(s, srv)
+	if stream {
+		RegisterCarbonV1StreamServer(s, srv)
+	}
+	go func() {
+		_ = s.Serve(l)
+	}()
+
+	b, e := newTestGroup(t, "http://"+l.Addr().String())
+	if e != nil {
+		s.Stop()
+		t.Fatalf("unexpected error %v", e)
+	}
+	return b, s.Stop
+}
+
+func TestGRPCGroup(t *testing.T) {
+	for _, stream := range []bool{true, false} {
+		t.Run(fmt.Sprintf("stream=%v", stream), func(t *testing.T) {
+			srv := &testServer{}
+			b, stop := startTestServer(t, srv, stream)
+			defer stop()
+			testGRPCGroup(t, b, srv)
+			if srv.streamed != stream {
+				t.Errorf("got streamed %v, want %v", srv.streamed, stream)
+			}
+		})
+	}
+}
+
+func testGRPCGroup(t *testing.T, b types.BackendServer, srv *testServer) {
+
+	ctx, cancel := context.WithTimeout(util.SetUUID(context.Background(), "test-uuid"), 10*time.Second)
+	defer cancel()
+	res, _, e := b.Fetch(ctx, &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{
+			{Name: "a.b", PathExpression: "a.*"},
+			{Name: "c.d", PathExpression: "c.d"},
+		},
+	})
+	if e != nil {
+		t.Fatalf("unexpected error %v", e)
+	}
+	if len(res.Metrics) != 2 || res.Metrics[0].Name != "a.b" || res.Metrics[1].PathExpression != "c.d" {
+		t.Errorf("unexpected response %+v", res.Metrics)
+	}
+	if d := time.Until(srv.deadline); d <= 9*time.Second || d > 10*time.Second {
+		t.Errorf("unexpected deadline %v", srv.deadline)
+	}
+	if srv.uuid != "test-uuid" {
+		t.Errorf("got uuid %q, want %q", srv.uuid, "test-uuid")
+	}
+
+	_, _, e = b.Fetch(ctx, &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{Name: "missing", PathExpression: "missing"}},
+	})
+	if !merry.Is(e, types.ErrNotFound) {
+		t.Errorf("got error %v, want %v", e, types.ErrNotFound)
+	}
+
+	tlds, e := b.ProbeTLDs(ctx)
+	if e != nil || len(tlds) != 1 || tlds[0] != "a" {
+		t.Errorf("got tlds %v and error %v", tlds, e)
+	}
+
+	info, _, e := b.Info(ctx, &protov3.MultiMetricsInfoRequest{Names: []string{"a.b"}})
+	if e != nil || info.Info["grpc"].Metrics[0].MaxRetention != 86400 {
+		t.Errorf("got info %+v and error %v", info, e)
+	}
+
+	list, _, e := b.List(ctx)
+	if e != nil || len(list.Metrics) != 1 {
+		t.Errorf("got list %+v and error %v", list, e)
+	}
+
+	if _, _, e = b.Stats(ctx); !merry.Is(e, types.ErrNotImplementedYet) {
+		t.Errorf("got error %v, want %v", e, types.ErrNotImplementedYet)
+	}
+}
+
+func TestInvalidServer(t *testing.T) {
+	_, err := newTestGroup(t, "tcp://127.0.0.1:8080")
+	if !merry.Is(err, ErrInvalidServer) {
+		t.Errorf("got error %v, want %v", err, ErrInvalidServer)
+	}
+}
+
+// budgetServer sends the first series and waits until the stream is cancelled
+type budgetServer struct {
+	testServer
+	cancelled chan struct{}
+}
+
+func (s *budgetServer) FetchMetricsStream(request *protov3.MultiFetchRequest, stream CarbonV1Stream_FetchMetricsStreamServer) error {
+	if err := stream.Send(&protov3.FetchResponse{Name: request.Metrics[0].Name, StepTime: 60}); err != nil {
+		return err
+	}
+	<-stream.Context().Done()
+	close(s.cancelled)
+	return stream.Context().Err()
+}
+
+func TestGRPCGroupFetchBudget(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &budgetServer{cancelled: make(chan struct{})}
+	s := grpc.NewServer()
+	RegisterCarbonV1StreamServer(s, srv)
+	go func() {
+		_ = s.Serve(l)
+	}()
+	defer s.Stop()
+
+	b, e := newTestGroup(t, "http://"+l.Addr().String())
+	if e != nil {
+		t.Fatalf("unexpected error %v", e)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ctx = types.WithFetchBudget(ctx, func(response *protov3.MultiFetchResponse) merry.Error {
+		if len(response.Metrics) > 0 {
+			return merry.New("budget exceeded")
+		}
+		return nil
+	})
+	res, _, e := b.Fetch(ctx, &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{Name: "a.b"}, {Name: "c.d"}},
+	})
+	if e != nil {
+		t.Fatalf("unexpected error %v", e)
+	}
+	if len(res.Metrics) != 1 || res.Metrics[0].Name != "a.b" {
+		t.Errorf("unexpected response %+v", res.Metrics)
+	}
+	select {
+	case <-srv.cancelled:
+	case <-time.After(5 * time.Second):
+		t.Error("stream wasn't cancelled when budget was exceeded")
+	}
+}
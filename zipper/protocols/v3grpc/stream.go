@@ -0,0 +1,94 @@
+package v3grpc
+
+import (
+	"context"
+
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"google.golang.org/grpc"
+)
+
+// CarbonV1 service of the protocol has only unary FetchMetrics, so streamed fetch is served by a separate service
+// with the same messages. It's described by hand, as there is no proto file for it.
+const (
+	streamServiceName        = "carbonapi_v3_grpc.CarbonV1Stream"
+	fetchMetricsStreamMethod = "/" + streamServiceName + "/FetchMetricsStream"
+)
+
+// CarbonV1StreamServer is the server API for CarbonV1Stream service
+type CarbonV1StreamServer interface {
+	// FetchMetricsStream sends series of the request as soon as they are fetched
+	FetchMetricsStream(*protov3.MultiFetchRequest, CarbonV1Stream_FetchMetricsStreamServer) error
+}
+
+// CarbonV1Stream_FetchMetricsStreamServer is the server side of FetchMetricsStream
+type CarbonV1Stream_FetchMetricsStreamServer interface {
+	Send(*protov3.FetchResponse) error
+	grpc.ServerStream
+}
+
+// RegisterCarbonV1StreamServer registers CarbonV1Stream service
+func RegisterCarbonV1StreamServer(s *grpc.Server, srv CarbonV1StreamServer) {
+	s.RegisterService(&carbonV1StreamServiceDesc, srv)
+}
+
+var carbonV1StreamServiceDesc = grpc.ServiceDesc{
+	ServiceName: streamServiceName,
+	HandlerType: (*CarbonV1StreamServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "FetchMetricsStream",
+			Handler:       fetchMetricsStreamHandler,
+			ServerStreams: true,
+		},
+	},
+}
+
+func fetchMetricsStreamHandler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(protov3.MultiFetchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CarbonV1StreamServer).FetchMetricsStream(m, &fetchMetricsStreamServer{stream})
+}
+
+type fetchMetricsStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *fetchMetricsStreamServer) Send(m *protov3.FetchResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// carbonV1StreamClient is the client API for CarbonV1Stream service
+type carbonV1StreamClient struct {
+	cc grpc.ClientConnInterface
+}
+
+// fetchMetricsStreamClient is the client side of FetchMetricsStream
+type fetchMetricsStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *fetchMetricsStreamClient) Recv() (*protov3.FetchResponse, error) {
+	m := new(protov3.FetchResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *carbonV1StreamClient) FetchMetricsStream(ctx context.Context, in *protov3.MultiFetchRequest, opts ...grpc.CallOption) (*fetchMetricsStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &carbonV1StreamServiceDesc.Streams[0], fetchMetricsStreamMethod, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &fetchMetricsStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
@@ -19,6 +19,32 @@ type vmSupportedFeatures struct {
 	SupportGraphiteTagsAPI        bool
 	GraphiteTagsAPIRequiresDedupe bool
 	SupportOptimizedGraphiteFetch bool
+	SupportGraphiteRenderAPI      bool
+	// GraphiteRenderFunctions are graphite functions that could be evaluated by Graphite Render API
+	GraphiteRenderFunctions map[string]struct{}
+}
+
+// graphiteRenderFunctionsV72 are functions of Graphite Render API (VictoriaMetrics v1.72.0+), that are also known to expr
+// as pushdown functions
+var graphiteRenderFunctionsV72 = map[string]struct{}{
+	"absolute":              {},
+	"aliasByNode":           {},
+	"averageSeries":         {},
+	"derivative":            {},
+	"groupByNode":           {},
+	"integral":              {},
+	"keepLastValue":         {},
+	"maxSeries":             {},
+	"minSeries":             {},
+	"nonNegativeDerivative": {},
+	"offset":                {},
+	"perSecond":             {},
+	"removeAboveValue":      {},
+	"removeBelowValue":      {},
+	"scale":                 {},
+	"sumSeries":             {},
+	"summarize":             {},
+	"transformNull":         {},
 }
 
 // Example: v1.46.0
@@ -79,6 +105,11 @@ func versionToFeatureSet(logger *zap.Logger, version string) *vmSupportedFeature
 		res.SupportOptimizedGraphiteFetch = true
 	}
 
+	if v2 >= 72 {
+		res.SupportGraphiteRenderAPI = true
+		res.GraphiteRenderFunctions = graphiteRenderFunctionsV72
+	}
+
 	return res
 }
 
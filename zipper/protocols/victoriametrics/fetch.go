@@ -25,6 +25,62 @@ type fetchTarget struct {
 }
 
 func (c *VictoriaMetricsGroup) Fetch(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, merry.Error) {
+	pushdownFunctions := c.PushdownFunctions()
+	if len(pushdownFunctions) == 0 {
+		return c.fetch(ctx, request)
+	}
+
+	// pushed down chains of functions are sent to Graphite Render API, other requests are fetched as raw series
+	logger := c.logger.With(zap.String("type", "fetch"), zap.String("request", request.String()))
+	stats := &types.Stats{}
+	var r protov3.MultiFetchResponse
+	var e merry.Error
+	rest := &protov3.MultiFetchRequest{}
+	for i := range request.Metrics {
+		m := &request.Metrics[i]
+		target, applied, ok := renderTarget(pushdownFunctions, m)
+		if !ok {
+			rest.Metrics = append(rest.Metrics, *m)
+			continue
+		}
+		metrics, err := c.render(ctx, logger, m, target, applied, stats)
+		if err != nil {
+			if e == nil {
+				e = err
+			} else {
+				e = e.WithCause(err)
+			}
+			continue
+		}
+		r.Metrics = append(r.Metrics, metrics...)
+	}
+
+	if len(rest.Metrics) > 0 {
+		res, restStats, err := c.fetch(ctx, rest)
+		stats.Merge(restStats)
+		if res != nil {
+			r.Metrics = append(r.Metrics, res.Metrics...)
+		}
+		if err != nil {
+			if e == nil {
+				e = err
+			} else {
+				e = e.WithCause(err)
+			}
+		}
+	}
+
+	if e != nil {
+		if len(stats.FailedServers) == 0 {
+			stats.FailedServers = []string{c.groupName}
+		}
+		return &r, stats, e
+	}
+	return &r, stats, nil
+}
+
+// fetch gets raw series with Prometheus API, optimized for graphite targets if VictoriaMetrics supports it
+func (c *VictoriaMetricsGroup) fetch(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, merry.Error) {
 	supportedFeatures, _ := c.featureSet.Load().(*vmSupportedFeatures)
 	if !supportedFeatures.SupportOptimizedGraphiteFetch {
 		// VictoriaMetrics <1.53.1 doesn't support graphite find api, reverting back to prometheus code-path
@@ -75,8 +131,17 @@ func (c *VictoriaMetricsGroup) Fetch(ctx context.Context, request *protov3.Multi
 			// Make local copy
 			stepLocalStr := target.step
 			if strings.HasPrefix(target.name, "seriesByTag") {
-				target.name = strings.ReplaceAll(target.name, "'name=", "'__name__=")
-				stepLocalStr, target.name = helpers.SeriesByTagToPromQL(stepLocalStr, target.name)
+				var err error
+				stepLocalStr, target.name, err = helpers.SeriesByTagToPromQL(stepLocalStr, target.name)
+				if err != nil {
+					stats.RenderErrors++
+					if e == nil {
+						e = merry.Wrap(err)
+					} else {
+						e = e.WithCause(err)
+					}
+					continue
+				}
 			} else {
 				target.name = fmt.Sprintf("{__graphite__=%q}", target.name)
 			}
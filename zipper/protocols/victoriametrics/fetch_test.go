@@ -0,0 +1,190 @@
+package victoriametrics
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/tests/seriesbytag"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// queryRecorder reports VictoriaMetrics version, records PromQL queries and answers with empty result
+type queryRecorder struct {
+	sync.Mutex
+	queries []string
+}
+
+func (s *queryRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/metrics" {
+		_, _ = w.Write([]byte(`vm_app_version{version="victoria-metrics-20210924-tags-v1.66.2-0-g1a4f1ef5", short_version="v1.66.2"} 1`))
+		return
+	}
+	s.Lock()
+	s.queries = append(s.queries, r.URL.Query().Get("query"))
+	s.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[]}}`))
+}
+
+func TestFetchSeriesByTag(t *testing.T) {
+	recorder := &queryRecorder{}
+	srv := httptest.NewServer(recorder)
+	defer srv.Close()
+
+	concurrencyLimit := 0
+	maxBatchSize := 100
+	maxTries := 1
+	maxIdleConns := 10
+	idleTimeout := time.Minute
+	keepAlive := time.Minute
+	b, err := New(zap.NewNop(), types.BackendV2{
+		GroupName:             "vm",
+		Protocol:              "victoriametrics",
+		Servers:               []string{srv.URL},
+		ConcurrencyLimit:      &concurrencyLimit,
+		MaxBatchSize:          &maxBatchSize,
+		MaxTries:              &maxTries,
+		MaxIdleConnsPerHost:   &maxIdleConns,
+		IdleConnectionTimeout: &idleTimeout,
+		KeepAliveInterval:     &keepAlive,
+		Timeouts:              &types.Timeouts{Find: time.Second, Render: time.Second, Connect: time.Second},
+	}, true, false)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if f, _ := b.(*VictoriaMetricsGroup).featureSet.Load().(*vmSupportedFeatures); f == nil || !f.SupportOptimizedGraphiteFetch {
+		t.Fatalf("unexpected feature set %+v", f)
+	}
+
+	for _, tt := range seriesbytag.PromQLCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			recorder.queries = nil
+			_, _, err := b.Fetch(context.Background(), &protov3.MultiFetchRequest{
+				Metrics: []protov3.FetchRequest{{Name: tt.Target, PathExpression: tt.Target, StartTime: 1000, StopTime: 1600}},
+			})
+			if tt.Err {
+				if err == nil || len(recorder.queries) != 0 {
+					t.Errorf("expected error without queries, got %v, queries %v", err, recorder.queries)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if len(recorder.queries) != 1 || recorder.queries[0] != tt.Query {
+				t.Errorf("got queries %q, want %q", recorder.queries, tt.Query)
+			}
+		})
+	}
+}
+
+// renderRecorder reports VictoriaMetrics version with Graphite Render API, records render targets and PromQL queries
+type renderRecorder struct {
+	sync.Mutex
+	targets []string
+	queries []string
+}
+
+func (s *renderRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	s.Lock()
+	defer s.Unlock()
+	switch r.URL.Path {
+	case "/metrics":
+		_, _ = w.Write([]byte(`vm_app_version{version="victoria-metrics-20220110-tags-v1.72.0-0-g1a4f1ef5", short_version="v1.72.0"} 1`))
+	case "/render":
+		s.targets = append(s.targets, r.URL.Query().Get("target"))
+		_, _ = w.Write([]byte(`[{"target":"a.b","tags":{"name":"a.b"},"datapoints":[[1,1020],[null,1080],[3,1140]]}]`))
+	default:
+		s.queries = append(s.queries, r.URL.Query().Get("query"))
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[]}}`))
+	}
+}
+
+func TestFetchGraphiteRender(t *testing.T) {
+	recorder := &renderRecorder{}
+	srv := httptest.NewServer(recorder)
+	defer srv.Close()
+
+	concurrencyLimit := 0
+	maxBatchSize := 100
+	maxTries := 1
+	maxIdleConns := 10
+	idleTimeout := time.Minute
+	keepAlive := time.Minute
+	b, err := New(zap.NewNop(), types.BackendV2{
+		GroupName:             "vm",
+		Protocol:              "victoriametrics",
+		Servers:               []string{srv.URL},
+		ConcurrencyLimit:      &concurrencyLimit,
+		MaxBatchSize:          &maxBatchSize,
+		MaxTries:              &maxTries,
+		MaxIdleConnsPerHost:   &maxIdleConns,
+		IdleConnectionTimeout: &idleTimeout,
+		KeepAliveInterval:     &keepAlive,
+		Timeouts:              &types.Timeouts{Find: time.Second, Render: time.Second, Connect: time.Second},
+		BackendOptions: map[string]interface{}{
+			"graphite_render_functions": []interface{}{"sumSeries", "summarize", "movingAverage"},
+		},
+	}, true, false)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got, want := types.PushdownFunctions(b), []string{"sumSeries", "summarize"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got pushdown functions %v, want %v", got, want)
+	}
+
+	res, _, err := b.Fetch(context.Background(), &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{
+			{
+				Name:           "a.*",
+				PathExpression: "summarize(sumSeries(a.*),'1min','sum',true)",
+				StartTime:      1000,
+				StopTime:       1200,
+				FilterFunctions: []*protov3.FilteringFunction{
+					{Name: "consolidateBy", Arguments: []string{"max"}},
+					{Name: "sumSeries"},
+					{Name: "summarize", Arguments: []string{"1min", "sum", "true"}},
+				},
+			},
+			{
+				Name:            "b.*",
+				PathExpression:  "scale(b.*,2)",
+				StartTime:       1000,
+				StopTime:        1200,
+				FilterFunctions: []*protov3.FilteringFunction{{Name: "scale", Arguments: []string{"2"}}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if want := []string{`summarize(sumSeries(a.*),"1min","sum",true)`}; !reflect.DeepEqual(recorder.targets, want) {
+		t.Errorf("got render targets %q, want %q", recorder.targets, want)
+	}
+	if want := []string{`{__graphite__="b.*"}`}; !reflect.DeepEqual(recorder.queries, want) {
+		t.Errorf("got queries %q, want %q", recorder.queries, want)
+	}
+	if len(res.Metrics) != 1 {
+		t.Fatalf("got %d metrics, want 1", len(res.Metrics))
+	}
+	m := res.Metrics[0]
+	if m.Name != "a.b" || m.PathExpression != "summarize(sumSeries(a.*),'1min','sum',true)" ||
+		m.StartTime != 1020 || m.StepTime != 60 || m.StopTime != 1200 || len(m.Values) != 3 ||
+		m.Values[0] != 1 || !math.IsNaN(m.Values[1]) || m.Values[2] != 3 {
+		t.Errorf("unexpected response %+v", m)
+	}
+	if want := []string{"sumSeries", "summarize"}; !reflect.DeepEqual(m.AppliedFunctions, want) {
+		t.Errorf("got applied functions %v, want %v", m.AppliedFunctions, want)
+	}
+}
@@ -0,0 +1,165 @@
+package victoriametrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ansel1/merry"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/zipper/protocols/prometheus/helpers"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// renderSeries is a series of Graphite Render API json response
+type renderSeries struct {
+	Target     string        `json:"target"`
+	Datapoints [][2]*float64 `json:"datapoints"`
+}
+
+// PushdownFunctions returns functions that are enabled by graphite_render_functions and supported by detected
+// version of VictoriaMetrics
+func (c *VictoriaMetricsGroup) PushdownFunctions() []string {
+	supportedFeatures, _ := c.featureSet.Load().(*vmSupportedFeatures)
+	if supportedFeatures == nil || !supportedFeatures.SupportGraphiteRenderAPI {
+		return nil
+	}
+	var res []string
+	for _, f := range c.renderFunctions {
+		if _, ok := supportedFeatures.GraphiteRenderFunctions[f]; ok {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// renderArg formats filtering function argument for graphite target, only numbers and booleans are passed unquoted
+func renderArg(arg string) string {
+	if _, err := strconv.ParseFloat(arg, 64); err == nil || arg == "true" || arg == "false" {
+		return arg
+	}
+	return strconv.Quote(arg)
+}
+
+// renderTarget builds graphite target from filtering functions of the request, that is only the pushed down chain and
+// not the whole user target. It returns false if request doesn't have functions or some of them are not supported,
+// consolidateBy is always left to carbonapi.
+func renderTarget(supported []string, m *protov3.FetchRequest) (string, []string, bool) {
+	target := m.Name
+	var applied []string
+	for _, f := range m.FilterFunctions {
+		if f == nil || f.Name == "consolidateBy" {
+			continue
+		}
+		found := false
+		for _, s := range supported {
+			if s == f.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", nil, false
+		}
+
+		args := make([]string, 0, len(f.Arguments)+1)
+		args = append(args, target)
+		for _, a := range f.Arguments {
+			args = append(args, renderArg(a))
+		}
+		target = f.Name + "(" + strings.Join(args, ",") + ")"
+		applied = append(applied, f.Name)
+	}
+	return target, applied, len(applied) > 0
+}
+
+// render evaluates target with Graphite Render API, all series are reported with applied functions
+func (c *VictoriaMetricsGroup) render(ctx context.Context, logger *zap.Logger, m *protov3.FetchRequest, target string, applied []string, stats *types.Stats) ([]protov3.FetchResponse, merry.Error) {
+	var serverUrl string
+	if len(c.vmClusterTenantID) > 0 {
+		serverUrl = fmt.Sprintf("http://127.0.0.1/select/%s/graphite/render", c.vmClusterTenantID)
+	} else {
+		serverUrl = "http://127.0.0.1/render"
+	}
+	rewrite, _ := url.Parse(serverUrl)
+	v := url.Values{
+		"target": []string{target},
+		"from":   []string{strconv.FormatInt(m.StartTime, 10)},
+		"until":  []string{strconv.FormatInt(m.StopTime, 10)},
+		"format": []string{"json"},
+	}
+	rewrite.RawQuery = v.Encode()
+
+	logger.Debug("will do render query",
+		zap.String("target", target),
+		zap.Int64("start", m.StartTime),
+		zap.Int64("stop", m.StopTime),
+	)
+	stats.RenderRequests++
+	res, err := c.httpQuery.DoQuery(ctx, logger, rewrite.RequestURI(), nil)
+	if err != nil {
+		stats.RenderErrors++
+		if merry.Is(err, types.ErrTimeoutExceeded) {
+			stats.Timeouts++
+			stats.RenderTimeouts++
+		}
+		return nil, err
+	}
+
+	var series []renderSeries
+	if len(res.Response) > 0 {
+		if err := json.Unmarshal(res.Response, &series); err != nil {
+			stats.RenderErrors++
+			return nil, types.ErrFailedToFetch.WithCause(err).WithValue("target", target)
+		}
+	}
+
+	maxPointsPerQuery := c.maxPointsPerQuery
+	if m.MaxDataPoints != 0 {
+		maxPointsPerQuery = m.MaxDataPoints
+	}
+	pathExpr := m.PathExpression
+	if pathExpr == "" {
+		pathExpr = m.Name
+	}
+
+	metrics := make([]protov3.FetchResponse, 0, len(series))
+	for _, s := range series {
+		if len(s.Datapoints) == 0 || s.Datapoints[0][1] == nil {
+			continue
+		}
+		start := int64(*s.Datapoints[0][1])
+		step := helpers.AdjustStep(m.StartTime, m.StopTime, maxPointsPerQuery, c.step, c.forceMinStepInterval)
+		if len(s.Datapoints) > 1 && s.Datapoints[1][1] != nil {
+			step = int64(*s.Datapoints[1][1]) - start
+		}
+		values := make([]float64, len(s.Datapoints))
+		for i, p := range s.Datapoints {
+			if p[0] == nil {
+				values[i] = math.NaN()
+			} else {
+				values[i] = *p[0]
+			}
+		}
+		metrics = append(metrics, protov3.FetchResponse{
+			Name:              s.Target,
+			PathExpression:    pathExpr,
+			ConsolidationFunc: "Average",
+			StartTime:         start,
+			StopTime:          start + int64(len(values))*step,
+			StepTime:          step,
+			Values:            values,
+			XFilesFactor:      0.0,
+			RequestStartTime:  m.StartTime,
+			RequestStopTime:   m.StopTime,
+			AppliedFunctions:  applied,
+		})
+	}
+	return metrics, nil
+}
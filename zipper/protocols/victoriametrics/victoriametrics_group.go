@@ -57,6 +57,7 @@ type VictoriaMetricsGroup struct {
 	startDelay           prometheus.StartDelay
 	probeVersionInterval time.Duration
 	fallbackVersion      string
+	renderFunctions      []string
 
 	httpQuery  *helper.HttpQuery
 	parserPool fastjson.ParserPool
@@ -200,6 +201,28 @@ func NewWithLimiter(logger *zap.Logger, config types.BackendV2, tldCacheDisabled
 		}
 	}
 
+	var renderFunctions []string
+	renderFunctionsParam, ok := config.BackendOptions["graphite_render_functions"]
+	if ok {
+		functions, ok := renderFunctionsParam.([]interface{})
+		if !ok {
+			logger.Fatal("failed to parse graphite_render_functions",
+				zap.String("type_parsed", fmt.Sprintf("%T", renderFunctionsParam)),
+				zap.String("type_expected", "[]string"),
+			)
+		}
+		for _, f := range functions {
+			name, ok := f.(string)
+			if !ok {
+				logger.Fatal("failed to parse graphite_render_functions",
+					zap.String("type_parsed", fmt.Sprintf("%T", f)),
+					zap.String("type_expected", "string"),
+				)
+			}
+			renderFunctions = append(renderFunctions, name)
+		}
+	}
+
 	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, *config.MaxTries, limiter, httpClient, httpHeaders.ContentTypeCarbonAPIv2PB)
 
 	c := &VictoriaMetricsGroup{
@@ -216,6 +239,7 @@ func NewWithLimiter(logger *zap.Logger, config types.BackendV2, tldCacheDisabled
 		startDelay:           delay,
 		probeVersionInterval: probeVersionInterval,
 		fallbackVersion:      fallbackVersion,
+		renderFunctions:      renderFunctions,
 
 		client:  httpClient,
 		limiter: limiter,
@@ -251,3 +275,7 @@ func New(logger *zap.Logger, config types.BackendV2, tldCacheDisabled, requireSu
 
 	return NewWithLimiter(logger, config, tldCacheDisabled, requireSuccessAll, l)
 }
+
+func (c *VictoriaMetricsGroup) CloseIdleConnections() {
+	c.httpQuery.CloseIdleConnections()
+}
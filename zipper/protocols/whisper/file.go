@@ -0,0 +1,210 @@
+package whisper
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+
+	"github.com/ansel1/merry"
+)
+
+const (
+	metadataSize    = 16
+	archiveInfoSize = 12
+	pointSize       = 12
+)
+
+var (
+	ErrInvalidHeader = merry.New("invalid whisper header")
+	ErrNoArchives    = merry.New("whisper file doesn't have archives")
+)
+
+// aggregationMethods maps whisper's aggregation type to consolidation function names that are understood by carbonapi
+var aggregationMethods = map[uint32]string{
+	1: "average",
+	2: "sum",
+	3: "last",
+	4: "max",
+	5: "min",
+	6: "average",
+	7: "max",
+	8: "min",
+}
+
+type archive struct {
+	offset          int64
+	secondsPerPoint int64
+	points          int64
+}
+
+func (a archive) retention() int64 {
+	return a.secondsPerPoint * a.points
+}
+
+type header struct {
+	aggregation  uint32
+	maxRetention int64
+	xFilesFactor float32
+	archives     []archive
+}
+
+func (h *header) aggregationMethod() string {
+	if m, ok := aggregationMethods[h.aggregation]; ok {
+		return m
+	}
+	return "average"
+}
+
+// file is an opened whisper database
+type file struct {
+	f *os.File
+	header
+}
+
+func openFile(path string) (*file, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &file{f: f}
+	if err := w.readHeader(); err != nil {
+		f.Close()
+		return nil, merry.Wrap(err).WithValue("path", path)
+	}
+
+	return w, nil
+}
+
+func (w *file) Close() error {
+	return w.f.Close()
+}
+
+func (w *file) readHeader() error {
+	buf := make([]byte, metadataSize)
+	if _, err := io.ReadFull(w.f, buf); err != nil {
+		return ErrInvalidHeader.Here().WithCause(err)
+	}
+
+	w.aggregation = binary.BigEndian.Uint32(buf[0:4])
+	w.maxRetention = int64(binary.BigEndian.Uint32(buf[4:8]))
+	w.xFilesFactor = math.Float32frombits(binary.BigEndian.Uint32(buf[8:12]))
+	count := binary.BigEndian.Uint32(buf[12:16])
+	if count == 0 {
+		return ErrNoArchives.Here()
+	}
+
+	// header is untrusted, sizes are checked against the file before anything is allocated or read
+	info, err := w.f.Stat()
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	size := info.Size()
+	headerSize := metadataSize + archiveInfoSize*int64(count)
+	if headerSize > size {
+		return ErrInvalidHeader.Here().WithMessagef("%d archives don't fit in the file of %d bytes", count, size)
+	}
+
+	buf = make([]byte, headerSize-metadataSize)
+	if _, err := io.ReadFull(w.f, buf); err != nil {
+		return ErrInvalidHeader.Here().WithCause(err)
+	}
+	for i := 0; i < int(count); i++ {
+		b := buf[i*archiveInfoSize:]
+		a := archive{
+			offset:          int64(binary.BigEndian.Uint32(b[0:4])),
+			secondsPerPoint: int64(binary.BigEndian.Uint32(b[4:8])),
+			points:          int64(binary.BigEndian.Uint32(b[8:12])),
+		}
+		if a.secondsPerPoint == 0 || a.points == 0 {
+			return ErrInvalidHeader.Here().WithMessagef("archive %d has zero resolution or size", i)
+		}
+		if a.offset < headerSize || a.offset+a.points*pointSize > size {
+			return ErrInvalidHeader.Here().WithMessagef("archive %d is out of the file of %d bytes", i, size)
+		}
+		w.archives = append(w.archives, a)
+	}
+
+	return nil
+}
+
+// series is a result of the fetch from the whisper file
+type series struct {
+	from   int64
+	until  int64
+	step   int64
+	values []float64
+}
+
+// fetch reads data for [from, until) from the best archive that covers the range. Logic is the same as in whisper.py,
+// archives are sorted from the highest to the lowest precision, so the first archive that retains from is used.
+func (w *file) fetch(now, from, until int64) (*series, error) {
+	oldest := now - w.maxRetention
+	if from > now || until < oldest || from >= until {
+		return nil, nil
+	}
+	from = max(from, oldest)
+	until = min(until, now)
+
+	a := w.archives[len(w.archives)-1]
+	for _, candidate := range w.archives {
+		if candidate.retention() >= now-from {
+			a = candidate
+			break
+		}
+	}
+
+	step := a.secondsPerPoint
+	fromInterval := from - from%step + step
+	untilInterval := until - until%step + step
+	if fromInterval == untilInterval {
+		untilInterval += step
+	}
+	n := (untilInterval - fromInterval) / step
+
+	s := &series{
+		from:   fromInterval,
+		until:  untilInterval,
+		step:   step,
+		values: make([]float64, n),
+	}
+	for i := range s.values {
+		s.values[i] = math.NaN()
+	}
+
+	// Archive is a ring buffer, position of the point is relative to the first point in the archive
+	first := make([]byte, pointSize)
+	if _, err := w.f.ReadAt(first, a.offset); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	base := int64(binary.BigEndian.Uint32(first[0:4]))
+	if base == 0 {
+		return s, nil
+	}
+
+	// only points of the requested range are read, with two reads if the range wraps around the end of the archive
+	count := min(n, a.points)
+	start := ((fromInterval-base)/step%a.points + a.points) % a.points
+	raw := make([]byte, count*pointSize)
+	head := min(count, a.points-start)
+	if _, err := w.f.ReadAt(raw[:head*pointSize], a.offset+start*pointSize); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if head < count {
+		if _, err := w.f.ReadAt(raw[head*pointSize:], a.offset); err != nil {
+			return nil, merry.Wrap(err)
+		}
+	}
+
+	for i := int64(0); i < count; i++ {
+		ts := fromInterval + i*step
+		p := raw[i*pointSize:]
+		if int64(binary.BigEndian.Uint32(p[0:4])) != ts {
+			continue
+		}
+		s.values[i] = math.Float64frombits(binary.BigEndian.Uint64(p[4:12]))
+	}
+
+	return s, nil
+}
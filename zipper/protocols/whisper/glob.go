@@ -0,0 +1,107 @@
+package whisper
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const extension = ".wsp"
+
+// globMatch is a metric or a directory that matched the query
+type globMatch struct {
+	path   string
+	file   string
+	isLeaf bool
+}
+
+// expandBraces converts graphite's {a,b} alternatives to the list of patterns that filepath.Match understands
+func expandBraces(pattern string) []string {
+	open := strings.IndexByte(pattern, '{')
+	if open < 0 {
+		return []string{pattern}
+	}
+	closing := strings.IndexByte(pattern[open:], '}')
+	if closing < 0 {
+		return []string{pattern}
+	}
+	closing += open
+
+	var res []string
+	for _, alt := range strings.Split(pattern[open+1:closing], ",") {
+		res = append(res, expandBraces(pattern[:open]+alt+pattern[closing+1:])...)
+	}
+	return res
+}
+
+func matchNode(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// find looks for whisper files and directories in root that match graphite glob
+func find(root, query string) ([]globMatch, error) {
+	nodes := strings.Split(query, ".")
+	var res []globMatch
+	if err := findNodes(root, "", nodes, &res); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].path < res[j].path
+	})
+	return res, nil
+}
+
+func findNodes(dir, prefix string, nodes []string, res *[]globMatch) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	patterns := expandBraces(nodes[0])
+	last := len(nodes) == 1
+	for _, e := range entries {
+		name := e.Name()
+		isDir := e.IsDir()
+		if e.Type()&os.ModeSymlink != 0 {
+			if st, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				isDir = st.IsDir()
+			}
+		}
+		isLeaf := false
+		if !isDir {
+			if !last || !strings.HasSuffix(name, extension) {
+				continue
+			}
+			name = strings.TrimSuffix(name, extension)
+			isLeaf = true
+		}
+		if !matchNode(patterns, name) {
+			continue
+		}
+
+		path := prefix + name
+		fsPath := filepath.Join(dir, e.Name())
+		switch {
+		case isLeaf:
+			*res = append(*res, globMatch{path: path, file: fsPath, isLeaf: true})
+		case last:
+			*res = append(*res, globMatch{path: path})
+		default:
+			if err := findNodes(fsPath, path+".", nodes[1:], res); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package whisper
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ansel1/merry"
+
+	"github.com/go-graphite/carbonapi/expr/tags"
+	"github.com/go-graphite/carbonapi/zipper/helper"
+)
+
+var ErrInvalidTagIndex = merry.New("invalid tags index")
+
+type taggedSeries struct {
+	name string
+	tags map[string]string
+	file string
+}
+
+// tagIndex is a sidecar index of tagged series. Every line of the index contains series name with tags and path to
+// its whisper file, separated by whitespace, e.x. "cpu.load;dc=ams;host=a tagged/cpu_load_a.wsp".
+// Relative paths are resolved from the directory of the index. Empty lines and lines starting with # are ignored.
+type tagIndex struct {
+	series []taggedSeries
+}
+
+func loadTagIndex(path string) (*tagIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dir := filepath.Dir(path)
+	idx := &tagIndex{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		s := strings.TrimSpace(scanner.Text())
+		if s == "" || s[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(s)
+		if len(fields) != 2 {
+			return nil, ErrInvalidTagIndex.Here().WithMessagef("line %d: expected '<series> <path>', got '%s'", line, s)
+		}
+		file := fields[1]
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		idx.series = append(idx.series, taggedSeries{
+			name: fields[0],
+			tags: tags.ExtractTags(fields[0]),
+			file: file,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(idx.series, func(i, j int) bool {
+		return idx.series[i].name < idx.series[j].name
+	})
+	return idx, nil
+}
+
+func (idx *tagIndex) query(exprs []helper.TagExpr) []taggedSeries {
+	if idx == nil {
+		return nil
+	}
+
+	var res []taggedSeries
+	for _, s := range idx.series {
+		if helper.MatchAllTags(exprs, s.tags) {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+func sortedKeys(m map[string]struct{}, limit int64) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	if limit > 0 && int64(len(res)) > limit {
+		res = res[:limit]
+	}
+	return res
+}
+
+// tagNames returns names of tags that start with prefix for series that match expressions
+func (idx *tagIndex) tagNames(exprs []helper.TagExpr, prefix string, limit int64) []string {
+	names := make(map[string]struct{})
+	for _, s := range idx.query(exprs) {
+		for t := range s.tags {
+			if strings.HasPrefix(t, prefix) {
+				names[t] = struct{}{}
+			}
+		}
+	}
+	return sortedKeys(names, limit)
+}
+
+// tagValues returns values of the tag that start with prefix for series that match expressions
+func (idx *tagIndex) tagValues(exprs []helper.TagExpr, tag, prefix string, limit int64) []string {
+	values := make(map[string]struct{})
+	for _, s := range idx.query(exprs) {
+		if v, ok := s.tags[tag]; ok && strings.HasPrefix(v, prefix) {
+			values[v] = struct{}{}
+		}
+	}
+	return sortedKeys(values, limit)
+}
@@ -0,0 +1,376 @@
+package whisper
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ansel1/merry"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/limiter"
+	"github.com/go-graphite/carbonapi/zipper/helper"
+	"github.com/go-graphite/carbonapi/zipper/metadata"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+func init() {
+	aliases := []string{"whisper", "wsp"}
+	metadata.Metadata.Lock()
+	for _, name := range aliases {
+		metadata.Metadata.SupportedProtocols[name] = struct{}{}
+		metadata.Metadata.ProtocolInits[name] = New
+		metadata.Metadata.ProtocolInitsWithLimiter[name] = NewWithLimiter
+	}
+	defer metadata.Metadata.Unlock()
+}
+
+var timeNow = time.Now
+
+// WhisperGroup reads whisper files from local directories, implements BackendServer interface.
+// Every server of the group is a root directory of the whisper tree.
+type WhisperGroup struct {
+	groupName            string
+	servers              []string
+	maxMetricsPerRequest int
+
+	tags *tagIndex
+
+	limiter limiter.ServerLimiter
+	logger  *zap.Logger
+}
+
+func NewWithLimiter(logger *zap.Logger, config types.BackendV2, tldCacheDisabled, requireSuccessAll bool, limiter limiter.ServerLimiter) (types.BackendServer, merry.Error) {
+	logger = logger.With(zap.String("type", "whisper"), zap.String("protocol", config.Protocol), zap.String("name", config.GroupName))
+
+	c := &WhisperGroup{
+		groupName:            config.GroupName,
+		servers:              config.Servers,
+		maxMetricsPerRequest: *config.MaxBatchSize,
+
+		limiter: limiter,
+		logger:  logger,
+	}
+
+	for _, root := range config.Servers {
+		st, err := os.Stat(root)
+		if err != nil || !st.IsDir() {
+			logger.Fatal("whisper root is not a directory",
+				zap.String("root", root),
+				zap.Error(err),
+			)
+		}
+	}
+
+	if indexOpt, ok := config.BackendOptions["whisper_tags_index"]; ok {
+		path, ok := indexOpt.(string)
+		if !ok {
+			logger.Fatal("failed to parse whisper_tags_index",
+				zap.String("type_parsed", fmt.Sprintf("%T", indexOpt)),
+				zap.String("type_expected", "string"),
+			)
+		}
+		idx, err := loadTagIndex(path)
+		if err != nil {
+			logger.Fatal("failed to load whisper_tags_index",
+				zap.String("path", path),
+				zap.Error(err),
+			)
+		}
+		c.tags = idx
+	}
+
+	return c, nil
+}
+
+func New(logger *zap.Logger, config types.BackendV2, tldCacheDisabled, requireSuccessAll bool) (types.BackendServer, merry.Error) {
+	if config.ConcurrencyLimit == nil {
+		return nil, types.ErrConcurrencyLimitNotSet
+	}
+	if len(config.Servers) == 0 {
+		return nil, types.ErrNoServersSpecified
+	}
+	limiter := limiter.NewServerLimiter([]string{config.GroupName}, *config.ConcurrencyLimit)
+
+	return NewWithLimiter(logger, config, tldCacheDisabled, requireSuccessAll, limiter)
+}
+
+func (c *WhisperGroup) Children() []types.BackendServer {
+	return []types.BackendServer{c}
+}
+
+func (c WhisperGroup) MaxMetricsPerRequest() int {
+	return c.maxMetricsPerRequest
+}
+
+func (c WhisperGroup) Name() string {
+	return c.groupName
+}
+
+func (c WhisperGroup) Backends() []string {
+	return c.servers
+}
+
+// findMetrics returns whisper files for the path expression, every metric is taken from the first root that has it
+func (c *WhisperGroup) findMetrics(query string) ([]globMatch, error) {
+	if strings.HasPrefix(query, "seriesByTag(") {
+		exprs, err := helper.ParseTagExprs(helper.TagExpressions(query))
+		if err != nil {
+			return nil, err
+		}
+		var res []globMatch
+		for _, s := range c.tags.query(exprs) {
+			res = append(res, globMatch{path: s.name, file: s.file, isLeaf: true})
+		}
+		return res, nil
+	}
+
+	seen := make(map[string]struct{})
+	var res []globMatch
+	for _, root := range c.servers {
+		matches, err := find(root, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			if _, ok := seen[m.path]; ok {
+				continue
+			}
+			seen[m.path] = struct{}{}
+			res = append(res, m)
+		}
+	}
+	return res, nil
+}
+
+func (c *WhisperGroup) fetchFile(m globMatch, pathExpr string, from, until int64) (*protov3.FetchResponse, error) {
+	w, err := openFile(m.file)
+	if err != nil {
+		return nil, err
+	}
+	defer w.Close()
+
+	s, err := w.fetch(timeNow().Unix(), from, until)
+	if err != nil || s == nil {
+		return nil, err
+	}
+
+	return &protov3.FetchResponse{
+		Name:              m.path,
+		PathExpression:    pathExpr,
+		ConsolidationFunc: w.aggregationMethod(),
+		StartTime:         s.from,
+		StopTime:          s.until,
+		StepTime:          s.step,
+		XFilesFactor:      w.xFilesFactor,
+		Values:            s.values,
+		RequestStartTime:  from,
+		RequestStopTime:   until,
+	}, nil
+}
+
+func (c *WhisperGroup) Fetch(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, merry.Error) {
+	logger := c.logger.With(zap.String("type", "fetch"), zap.String("request", request.String()))
+	stats := &types.Stats{}
+
+	if err := c.limiter.Enter(ctx, c.groupName); err != nil {
+		stats.RenderErrors++
+		return nil, stats, types.ErrTimeoutExceeded.WithCause(err)
+	}
+	defer c.limiter.Leave(ctx, c.groupName)
+
+	var r protov3.MultiFetchResponse
+	var e merry.Error
+	for _, m := range request.Metrics {
+		stats.RenderRequests++
+		pathExpr := m.PathExpression
+		if pathExpr == "" {
+			pathExpr = m.Name
+		}
+
+		matches, err := c.findMetrics(m.Name)
+		if err != nil {
+			stats.RenderErrors++
+			e = types.ErrFailedToFetch.Here().WithCause(err).WithValue("target", m.Name)
+			continue
+		}
+
+		for _, match := range matches {
+			if !match.isLeaf {
+				continue
+			}
+			res, err := c.fetchFile(match, pathExpr, m.StartTime, m.StopTime)
+			if err != nil {
+				stats.RenderErrors++
+				e = types.ErrFailedToFetch.Here().WithCause(err).WithValue("file", match.file)
+				continue
+			}
+			if res != nil {
+				r.Metrics = append(r.Metrics, *res)
+			}
+		}
+	}
+
+	if e != nil {
+		stats.FailedServers = []string{c.groupName}
+		logger.Error("errors occurred while getting results",
+			zap.Any("error", e),
+		)
+		return &r, stats, e
+	}
+	if len(r.Metrics) == 0 {
+		return &r, stats, types.ErrNotFound
+	}
+	return &r, stats, nil
+}
+
+func (c *WhisperGroup) Find(ctx context.Context, request *protov3.MultiGlobRequest) (*protov3.MultiGlobResponse, *types.Stats, merry.Error) {
+	logger := c.logger.With(zap.String("type", "find"), zap.Strings("request", request.Metrics))
+	stats := &types.Stats{}
+
+	var r protov3.MultiGlobResponse
+	r.Metrics = make([]protov3.GlobResponse, 0)
+	var e merry.Error
+	for _, query := range request.Metrics {
+		stats.FindRequests++
+		matches, err := c.findMetrics(query)
+		if err != nil {
+			stats.FindErrors++
+			e = merry.Wrap(err).WithValue("query", query)
+			continue
+		}
+
+		globMatches := make([]protov3.GlobMatch, 0, len(matches))
+		for _, m := range matches {
+			globMatches = append(globMatches, protov3.GlobMatch{
+				Path:   m.path,
+				IsLeaf: m.isLeaf,
+			})
+		}
+		r.Metrics = append(r.Metrics, protov3.GlobResponse{
+			Name:    query,
+			Matches: globMatches,
+		})
+	}
+
+	if e != nil {
+		logger.Error("errors occurred while getting results",
+			zap.Any("errors", e),
+		)
+		return &r, stats, e
+	}
+	return &r, stats, nil
+}
+
+func (c *WhisperGroup) Info(ctx context.Context, request *protov3.MultiMetricsInfoRequest) (*protov3.ZipperInfoResponse, *types.Stats, merry.Error) {
+	logger := c.logger.With(zap.String("type", "info"))
+	stats := &types.Stats{}
+
+	var r protov3.ZipperInfoResponse
+	var e merry.Error
+	r.Info = make(map[string]protov3.MultiMetricsInfoResponse)
+	data := protov3.MultiMetricsInfoResponse{}
+
+	for _, query := range request.Names {
+		stats.InfoRequests++
+		matches, err := c.findMetrics(query)
+		if err != nil {
+			stats.InfoErrors++
+			e = merry.Wrap(err).WithValue("query", query)
+			continue
+		}
+
+		for _, m := range matches {
+			if !m.isLeaf {
+				continue
+			}
+			w, err := openFile(m.file)
+			if err != nil {
+				stats.InfoErrors++
+				e = merry.Wrap(err).WithValue("file", m.file)
+				continue
+			}
+			w.Close()
+
+			info := protov3.MetricsInfoResponse{
+				Name:              m.path,
+				ConsolidationFunc: w.aggregationMethod(),
+				XFilesFactor:      w.xFilesFactor,
+				MaxRetention:      w.maxRetention,
+			}
+			for _, a := range w.archives {
+				info.Retentions = append(info.Retentions, protov3.Retention{
+					SecondsPerPoint: a.secondsPerPoint,
+					NumberOfPoints:  a.points,
+				})
+			}
+			data.Metrics = append(data.Metrics, info)
+		}
+	}
+	r.Info[c.groupName] = data
+
+	if e != nil {
+		stats.FailedServers = []string{c.groupName}
+		logger.Error("errors occurred while getting results",
+			zap.Any("errors", e),
+		)
+		return &r, stats, e
+	}
+	return &r, stats, nil
+}
+
+func (c *WhisperGroup) List(ctx context.Context) (*protov3.ListMetricsResponse, *types.Stats, merry.Error) {
+	return nil, nil, types.ErrNotImplementedYet
+}
+func (c *WhisperGroup) Stats(ctx context.Context) (*protov3.MetricDetailsResponse, *types.Stats, merry.Error) {
+	return nil, nil, types.ErrNotImplementedYet
+}
+
+func (c *WhisperGroup) doTagQuery(isTagName bool, query string, limit int64) ([]string, merry.Error) {
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return []string{}, merry.Wrap(err)
+	}
+
+	exprs, err := helper.ParseTagExprs(params["expr"])
+	if err != nil {
+		return []string{}, merry.Wrap(err)
+	}
+
+	if isTagName {
+		return c.tags.tagNames(exprs, params.Get("tagPrefix"), limit), nil
+	}
+
+	tag := params.Get("tag")
+	if tag == "" {
+		return []string{}, types.ErrNoTagSpecified
+	}
+	return c.tags.tagValues(exprs, tag, params.Get("valuePrefix"), limit), nil
+}
+
+func (c *WhisperGroup) TagNames(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
+	return c.doTagQuery(true, query, limit)
+}
+
+func (c *WhisperGroup) TagValues(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
+	return c.doTagQuery(false, query, limit)
+}
+
+func (c *WhisperGroup) ProbeTLDs(ctx context.Context) ([]string, merry.Error) {
+	res, _, err := c.Find(ctx, &protov3.MultiGlobRequest{Metrics: []string{"*"}})
+	if err != nil {
+		return nil, err
+	}
+
+	var tlds []string
+	for _, m := range res.Metrics {
+		for _, v := range m.Matches {
+			tlds = append(tlds, v.Path)
+		}
+	}
+	return tlds, nil
+}
@@ -0,0 +1,362 @@
+package whisper
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ansel1/merry"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+const testNow = 1_000_200 // aligned to 60 and 300
+
+type testPoint struct {
+	ts    int64
+	value float64
+}
+
+// writeWhisper creates whisper file, points of every archive are written to the slots relative to the first point
+func writeWhisper(t *testing.T, path string, aggregation uint32, xff float32, archives [][2]int64, points [][]testPoint) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	var maxRetention int64
+	for _, a := range archives {
+		maxRetention = max(maxRetention, a[0]*a[1])
+	}
+
+	buf := binary.BigEndian.AppendUint32(nil, aggregation)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(maxRetention))
+	buf = binary.BigEndian.AppendUint32(buf, math.Float32bits(xff))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(archives)))
+
+	offset := int64(metadataSize + archiveInfoSize*len(archives))
+	for _, a := range archives {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(offset))
+		buf = binary.BigEndian.AppendUint32(buf, uint32(a[0]))
+		buf = binary.BigEndian.AppendUint32(buf, uint32(a[1]))
+		offset += a[1] * pointSize
+	}
+
+	for i, a := range archives {
+		data := make([]byte, a[1]*pointSize)
+		if i < len(points) && len(points[i]) > 0 {
+			base := points[i][0].ts
+			for _, p := range points[i] {
+				slot := ((p.ts-base)/a[0]%a[1] + a[1]) % a[1]
+				binary.BigEndian.PutUint32(data[slot*pointSize:], uint32(p.ts))
+				binary.BigEndian.PutUint64(data[slot*pointSize+4:], math.Float64bits(p.value))
+			}
+		}
+		buf = append(buf, data...)
+	}
+
+	if err := os.WriteFile(path, buf, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestGroup(t *testing.T, root string, options map[string]interface{}) types.BackendServer {
+	t.Helper()
+
+	timeNow = func() time.Time { return time.Unix(testNow, 0) }
+	t.Cleanup(func() { timeNow = time.Now })
+
+	concurrencyLimit := 10
+	maxBatchSize := 100
+	b, err := New(zap.NewNop(), types.BackendV2{
+		GroupName:        "whisper",
+		Protocol:         "whisper",
+		Servers:          []string{root},
+		ConcurrencyLimit: &concurrencyLimit,
+		MaxBatchSize:     &maxBatchSize,
+		BackendOptions:   options,
+	}, true, false)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return b
+}
+
+func cmpValues(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] && !(math.IsNaN(a[i]) && math.IsNaN(b[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFetch(t *testing.T) {
+	root := t.TempDir()
+	nan := math.NaN()
+
+	// 1 hour of minutely data and 1 day of 5-minutely
+	writeWhisper(t, filepath.Join(root, "foo", "bar.wsp"), 4, 0.5, [][2]int64{{60, 60}, {300, 288}}, [][]testPoint{
+		{{testNow - 180, 1}, {testNow - 120, 2}, {testNow - 60, 3}},
+		{{testNow - 7200, 10}, {testNow - 6900, 11}},
+	})
+
+	b := newTestGroup(t, root, nil)
+
+	tests := []struct {
+		name      string
+		from      int64
+		until     int64
+		wantStart int64
+		wantStep  int64
+		want      []float64
+	}{
+		{
+			name:      "high precision archive",
+			from:      testNow - 240,
+			until:     testNow,
+			wantStart: testNow - 180,
+			wantStep:  60,
+			want:      []float64{1, 2, 3, nan},
+		},
+		{
+			name:      "low precision archive",
+			from:      testNow - 7500,
+			until:     testNow - 6600,
+			wantStart: testNow - 7200,
+			wantStep:  300,
+			want:      []float64{10, 11, nan},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, _, err := b.Fetch(context.Background(), &protov3.MultiFetchRequest{
+				Metrics: []protov3.FetchRequest{{Name: "foo.*", PathExpression: "foo.*", StartTime: tt.from, StopTime: tt.until}},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if len(res.Metrics) != 1 {
+				t.Fatalf("unexpected amount of metrics %v", len(res.Metrics))
+			}
+
+			m := res.Metrics[0]
+			if m.Name != "foo.bar" || m.PathExpression != "foo.*" || m.ConsolidationFunc != "max" || m.XFilesFactor != 0.5 {
+				t.Errorf("unexpected metadata %+v", m)
+			}
+			if m.StartTime != tt.wantStart || m.StepTime != tt.wantStep {
+				t.Errorf("got start %v step %v, want start %v step %v", m.StartTime, m.StepTime, tt.wantStart, tt.wantStep)
+			}
+			if !cmpValues(m.Values, tt.want) {
+				t.Errorf("got values %v, want %v", m.Values, tt.want)
+			}
+		})
+	}
+
+	_, _, err := b.Fetch(context.Background(), &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{Name: "foo.baz", StartTime: testNow - 60, StopTime: testNow}},
+	})
+	if err == nil {
+		t.Errorf("expected not found error")
+	}
+}
+
+func TestFetchWrapped(t *testing.T) {
+	root := t.TempDir()
+	nan := math.NaN()
+
+	// the first point of the archive is in the middle of the requested range, so the range wraps around the end
+	writeWhisper(t, filepath.Join(root, "foo.wsp"), 1, 0, [][2]int64{{60, 60}}, [][]testPoint{
+		{{testNow - 120, 2}, {testNow - 180, 1}, {testNow - 60, 3}},
+	})
+
+	f, err := openFile(filepath.Join(root, "foo.wsp"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	defer f.Close()
+
+	s, err := f.fetch(testNow, testNow-300, testNow)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if s.from != testNow-240 || s.step != 60 {
+		t.Errorf("got from %v step %v", s.from, s.step)
+	}
+	if want := []float64{nan, 1, 2, 3, nan}; !cmpValues(s.values, want) {
+		t.Errorf("got values %v, want %v", s.values, want)
+	}
+}
+
+func TestInvalidHeader(t *testing.T) {
+	root := t.TempDir()
+
+	header := func(count uint32, archives ...[3]uint32) []byte {
+		buf := binary.BigEndian.AppendUint32(nil, 1)
+		buf = binary.BigEndian.AppendUint32(buf, 3600)
+		buf = binary.BigEndian.AppendUint32(buf, 0)
+		buf = binary.BigEndian.AppendUint32(buf, count)
+		for _, a := range archives {
+			buf = binary.BigEndian.AppendUint32(buf, a[0])
+			buf = binary.BigEndian.AppendUint32(buf, a[1])
+			buf = binary.BigEndian.AppendUint32(buf, a[2])
+		}
+		return buf
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"huge count of archives", header(math.MaxUint32)},
+		{"archive out of the file", append(header(1, [3]uint32{28, 60, 1 << 30}), make([]byte, 120)...)},
+		{"archive overlaps header", append(header(1, [3]uint32{0, 60, 1}), make([]byte, 12)...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(root, "bad.wsp")
+			if err := os.WriteFile(path, tt.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := openFile(path); !merry.Is(err, ErrInvalidHeader) {
+				t.Errorf("got error %v, want %v", err, ErrInvalidHeader)
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	root := t.TempDir()
+	for _, p := range []string{"a/b/c.wsp", "a/b/d.wsp", "a/x/c.wsp", "a/y/e.wsp"} {
+		writeWhisper(t, filepath.Join(root, p), 1, 0, [][2]int64{{60, 10}}, nil)
+	}
+	if err := os.WriteFile(filepath.Join(root, "a", "b", "c.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := newTestGroup(t, root, nil)
+
+	tests := []struct {
+		query string
+		want  []protov3.GlobMatch
+	}{
+		{
+			query: "a.*",
+			want:  []protov3.GlobMatch{{Path: "a.b"}, {Path: "a.x"}, {Path: "a.y"}},
+		},
+		{
+			query: "a.{b,x}.c",
+			want:  []protov3.GlobMatch{{Path: "a.b.c", IsLeaf: true}, {Path: "a.x.c", IsLeaf: true}},
+		},
+		{
+			query: "a.b.[cd]",
+			want:  []protov3.GlobMatch{{Path: "a.b.c", IsLeaf: true}, {Path: "a.b.d", IsLeaf: true}},
+		},
+		{
+			query: "a.z.*",
+			want:  []protov3.GlobMatch{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			res, _, err := b.Find(context.Background(), &protov3.MultiGlobRequest{Metrics: []string{tt.query}})
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if len(res.Metrics) != 1 || !reflect.DeepEqual(res.Metrics[0].Matches, tt.want) {
+				t.Errorf("got %+v, want %+v", res.Metrics, tt.want)
+			}
+		})
+	}
+
+	tlds, err := b.ProbeTLDs(context.Background())
+	if err != nil || !reflect.DeepEqual(tlds, []string{"a"}) {
+		t.Errorf("unexpected tlds %v, error %v", tlds, err)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	root := t.TempDir()
+	writeWhisper(t, filepath.Join(root, "foo.wsp"), 2, 0.3, [][2]int64{{10, 360}, {60, 1440}}, nil)
+
+	b := newTestGroup(t, root, nil)
+
+	res, _, err := b.Info(context.Background(), &protov3.MultiMetricsInfoRequest{Names: []string{"foo"}})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	expected := []protov3.MetricsInfoResponse{{
+		Name:              "foo",
+		ConsolidationFunc: "sum",
+		XFilesFactor:      0.3,
+		MaxRetention:      86400,
+		Retentions: []protov3.Retention{
+			{SecondsPerPoint: 10, NumberOfPoints: 360},
+			{SecondsPerPoint: 60, NumberOfPoints: 1440},
+		},
+	}}
+	if !reflect.DeepEqual(res.Info["whisper"].Metrics, expected) {
+		t.Errorf("got %+v, want %+v", res.Info["whisper"].Metrics, expected)
+	}
+}
+
+func TestTags(t *testing.T) {
+	root := t.TempDir()
+	for i, p := range []string{"tagged/cpu_a.wsp", "tagged/cpu_b.wsp", "tagged/mem_a.wsp"} {
+		writeWhisper(t, filepath.Join(root, p), 1, 0, [][2]int64{{60, 10}}, [][]testPoint{{{testNow - 60, float64(i)}}})
+	}
+	index := filepath.Join(root, "tags.idx")
+	if err := os.WriteFile(index, []byte(`# series path
+cpu;dc=ams;host=a tagged/cpu_a.wsp
+cpu;dc=fra;host=b tagged/cpu_b.wsp
+
+mem;dc=ams;host=a tagged/mem_a.wsp
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := newTestGroup(t, root, map[string]interface{}{"whisper_tags_index": index})
+
+	target := "seriesByTag('name=cpu','dc=~am')"
+	res, _, err := b.Fetch(context.Background(), &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{Name: target, PathExpression: target, StartTime: testNow - 120, StopTime: testNow}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(res.Metrics) != 1 || res.Metrics[0].Name != "cpu;dc=ams;host=a" || res.Metrics[0].PathExpression != target {
+		t.Fatalf("unexpected response %+v", res.Metrics)
+	}
+	if !cmpValues(res.Metrics[0].Values, []float64{0, math.NaN()}) {
+		t.Errorf("unexpected values %v", res.Metrics[0].Values)
+	}
+
+	names, err := b.TagNames(context.Background(), "tagPrefix=h&expr=name%3Dcpu", 0)
+	if err != nil || !reflect.DeepEqual(names, []string{"host"}) {
+		t.Errorf("unexpected tag names %v, error %v", names, err)
+	}
+
+	values, err := b.TagValues(context.Background(), "tag=dc&expr=host%3Da", 0)
+	if err != nil || !reflect.DeepEqual(values, []string{"ams"}) {
+		t.Errorf("unexpected tag values %v, error %v", values, err)
+	}
+
+	values, err = b.TagValues(context.Background(), "tag=name&expr=dc!%3Dfra", 1)
+	if err != nil || !reflect.DeepEqual(values, []string{"cpu"}) {
+		t.Errorf("unexpected tag values %v, error %v", values, err)
+	}
+}
@@ -0,0 +1,208 @@
+package routing
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/ansel1/merry"
+
+	"github.com/go-graphite/carbonapi/zipper/helper"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+var (
+	ErrEmptyRule    = merry.New("routing rule must have prefix, regex or tags")
+	ErrNoGroups     = merry.New("routing rule must specify at least one group")
+	ErrInvalidRegex = merry.New("invalid regex in routing rule")
+	ErrInvalidGlob  = merry.New("invalid prefix in routing rule")
+)
+
+// Rule is a compiled version of types.RoutingRule
+type Rule struct {
+	Name   string
+	Groups []string
+
+	prefix []*regexp.Regexp
+	regex  *regexp.Regexp
+	tags   []string
+}
+
+// Router selects backend groups for the request based on the first matching rule
+type Router struct {
+	rules []*Rule
+}
+
+// globNodeToRegexp converts single node of a graphite glob to anchored regular expression
+func globNodeToRegexp(node string) (*regexp.Regexp, error) {
+	if err := helper.ValidateGlob(node); err != nil {
+		return nil, ErrInvalidGlob.Here().WithCause(err)
+	}
+	return regexp.Compile("^" + helper.GlobToRegex(node, "[^.]") + "$")
+}
+
+// New compiles routing rules
+func New(rules []types.RoutingRule) (*Router, merry.Error) {
+	r := &Router{}
+	for _, rule := range rules {
+		if rule.Prefix == "" && rule.Regex == "" && len(rule.Tags) == 0 {
+			return nil, ErrEmptyRule.Here().WithValue("rule", rule.Name)
+		}
+		if len(rule.Groups) == 0 {
+			return nil, ErrNoGroups.Here().WithValue("rule", rule.Name)
+		}
+
+		compiled := &Rule{
+			Name:   rule.Name,
+			Groups: rule.Groups,
+		}
+
+		if rule.Prefix != "" {
+			for _, node := range strings.Split(rule.Prefix, ".") {
+				re, err := globNodeToRegexp(node)
+				if err != nil {
+					return nil, merry.WithValue(err, "rule", rule.Name)
+				}
+				compiled.prefix = append(compiled.prefix, re)
+			}
+		}
+
+		if rule.Regex != "" {
+			re, err := regexp.Compile(rule.Regex)
+			if err != nil {
+				return nil, ErrInvalidRegex.Here().WithValue("rule", rule.Name).WithCause(err)
+			}
+			compiled.regex = re
+		}
+
+		for _, tag := range rule.Tags {
+			compiled.tags = append(compiled.tags, strings.TrimSpace(tag))
+		}
+
+		r.rules = append(r.rules, compiled)
+	}
+
+	return r, nil
+}
+
+// Empty returns true if there are no rules
+func (r *Router) Empty() bool {
+	return r == nil || len(r.rules) == 0
+}
+
+func (rule *Rule) matchPath(path string) bool {
+	if rule.prefix == nil && rule.regex == nil {
+		return false
+	}
+
+	if rule.prefix != nil {
+		nodes := strings.Split(path, ".")
+		if len(nodes) < len(rule.prefix) {
+			return false
+		}
+		for i, re := range rule.prefix {
+			// Glob in the request might match nodes outside of the rule
+			if helper.HasGlob(nodes[i]) {
+				return false
+			}
+			if !re.MatchString(nodes[i]) {
+				return false
+			}
+		}
+	}
+
+	if rule.regex != nil && !rule.regex.MatchString(path) {
+		return false
+	}
+
+	return true
+}
+
+func (rule *Rule) matchTags(exprs []string) bool {
+	if len(rule.tags) == 0 {
+		return false
+	}
+
+	for _, tag := range rule.tags {
+		found := false
+		for _, e := range exprs {
+			if e == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Match returns first rule that matches metric path, glob or seriesByTag expression, or nil if nothing matches
+func (r *Router) Match(query string) *Rule {
+	if r.Empty() {
+		return nil
+	}
+
+	if strings.HasPrefix(query, "seriesByTag") {
+		return r.MatchTags(helper.TagExpressions(query))
+	}
+
+	for _, rule := range r.rules {
+		if rule.matchPath(query) {
+			return rule
+		}
+	}
+
+	return nil
+}
+
+// MatchTags returns first rule which tags are all present in the list of tag expressions
+func (r *Router) MatchTags(exprs []string) *Rule {
+	if r.Empty() {
+		return nil
+	}
+
+	for _, rule := range r.rules {
+		if rule.matchTags(exprs) {
+			return rule
+		}
+	}
+
+	return nil
+}
+
+// MatchTagQuery returns first rule that matches expressions of tag autocomplete query
+func (r *Router) MatchTagQuery(query string) *Rule {
+	if r.Empty() {
+		return nil
+	}
+
+	v, err := url.ParseQuery(query)
+	if err != nil {
+		return nil
+	}
+
+	return r.MatchTags(v["expr"])
+}
+
+// Groups returns union of groups for all the queries if every one of them matched some rule
+func (r *Router) Groups(queries []string) (map[string]struct{}, bool) {
+	if r.Empty() || len(queries) == 0 {
+		return nil, false
+	}
+
+	groups := make(map[string]struct{})
+	for _, q := range queries {
+		rule := r.Match(q)
+		if rule == nil {
+			return nil, false
+		}
+		for _, g := range rule.Groups {
+			groups[g] = struct{}{}
+		}
+	}
+
+	return groups, true
+}
@@ -0,0 +1,74 @@
+package routing
+
+import (
+	"testing"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+func TestRouterMatch(t *testing.T) {
+	r, err := New([]types.RoutingRule{
+		{Name: "team_a", Prefix: "team_a.{web,db}*", Groups: []string{"group_a"}},
+		{Name: "cpu", Regex: `\.cpu\.`, Groups: []string{"group_cpu"}},
+		{Name: "tags", Tags: []string{"team=b"}, Groups: []string{"group_b"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		query string
+		rule  string
+	}{
+		{"team_a.web01.cpu.user", "team_a"},
+		{"team_a.db1.*", "team_a"},
+		{"team_a.*.cpu.user", "cpu"},
+		{"team_a.cache1.mem", ""},
+		{"team_a", ""},
+		{"host.cpu.user", "cpu"},
+		{"seriesByTag('name=cpu', 'team=b')", "tags"},
+		{"seriesByTag(\"team=b\")", "tags"},
+		{"seriesByTag('team=~b')", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rule := r.Match(tt.query)
+			name := ""
+			if rule != nil {
+				name = rule.Name
+			}
+			if name != tt.rule {
+				t.Errorf("got rule '%v', expected '%v'", name, tt.rule)
+			}
+		})
+	}
+
+	if rule := r.MatchTagQuery("tagPrefix=dc&expr=team%3Db&expr=name%3Dcpu"); rule == nil || rule.Name != "tags" {
+		t.Errorf("tag query didn't match rule 'tags', got %v", rule)
+	}
+
+	if _, ok := r.Groups([]string{"team_a.web01.cpu.user", "other.metric"}); ok {
+		t.Errorf("groups shouldn't be resolved if one of the queries doesn't match any rule")
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		rule types.RoutingRule
+	}{
+		{"empty", types.RoutingRule{Groups: []string{"a"}}},
+		{"no groups", types.RoutingRule{Prefix: "a"}},
+		{"bad regex", types.RoutingRule{Regex: "(", Groups: []string{"a"}}},
+		{"bad glob", types.RoutingRule{Prefix: "a.{b,c", Groups: []string{"a"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New([]types.RoutingRule{tt.rule}); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package types
+
+import (
+	"math"
+	"time"
+)
+
+// AgeWindow describes retention of a backend group relative to the current time.
+// Zero MinAge means that group have data up to now, zero MaxAge means that group have data since the beginning of time.
+type AgeWindow struct {
+	MinAge time.Duration
+	MaxAge time.Duration
+}
+
+// IsZero returns true if window do not restrict anything
+func (w AgeWindow) IsZero() bool {
+	return w.MinAge <= 0 && w.MaxAge <= 0
+}
+
+// Bounds returns absolute timestamps of the oldest and newest points that are covered by the window at the moment `now`
+func (w AgeWindow) Bounds(now int64) (int64, int64) {
+	from := int64(math.MinInt64)
+	until := int64(math.MaxInt64)
+	if w.MaxAge > 0 {
+		from = now - int64(w.MaxAge/time.Second)
+	}
+	if w.MinAge > 0 {
+		until = now - int64(w.MinAge/time.Second)
+	}
+	return from, until
+}
+
+// Covers returns true if whole [from, until] range is inside the window at the moment `now`
+func (w AgeWindow) Covers(now, from, until int64) bool {
+	lo, hi := w.Bounds(now)
+	return from >= lo && until <= hi
+}
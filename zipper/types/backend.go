@@ -1,6 +1,8 @@
 package types
 
 import (
+	"encoding/json"
+	"strings"
 	"time"
 
 	"github.com/go-graphite/carbonapi/pkg/tlsconfig"
@@ -14,6 +16,8 @@ type BackendsV2 struct {
 	KeepAliveInterval         time.Duration `mapstructure:"keepAliveInterval"`
 	MaxTries                  int           `mapstructure:"maxTries"`
 	MaxBatchSize              *int          `mapstructure:"maxBatchSize"`
+	FetchSliceWindow          time.Duration `mapstructure:"fetchSliceWindow"`
+	FetchSliceConcurrency     int           `mapstructure:"fetchSliceConcurrency"`
 }
 
 type BackendV2 struct {
@@ -32,6 +36,63 @@ type BackendV2 struct {
 	DoMultipleRequestsIfSplit bool                   `mapstructure:"doMultipleRequestsIfSplit"`
 	IdleConnectionTimeout     *time.Duration         `mapstructure:"idleConnectionTimeout"`
 	TLSClientConfig           *tlsconfig.TLSConfig   `mapstructure:"tlsClientConfig"`
+	MinAge                    time.Duration          `mapstructure:"minAge"` // Data newer than that is not stored in the group
+	MaxAge                    time.Duration          `mapstructure:"maxAge"` // Data older than that is not stored in the group
+	FetchSliceWindow          *time.Duration         `mapstructure:"fetchSliceWindow"`
+	MergeStrategy             string                 `mapstructure:"mergeStrategy"` // Valid: fill-gaps, prefer-most-complete, max, min, avg, prefer-named-primary
+	MergePrimary              string                 `mapstructure:"mergePrimary"`  // Server, which data is preferred by prefer-named-primary strategy
+	Replicas                  bool                   `mapstructure:"replicas"`      // Servers store the same data, functions could be pushed down to them
+	Carbonlink                *CarbonlinkConfig      `mapstructure:"carbonlink"`
+	Discovery                 *DiscoveryConfig       `mapstructure:"discovery"` // Servers are discovered at runtime instead of static list
+}
+
+// DiscoveryConfig describes where servers of the backend group are taken from at runtime
+type DiscoveryConfig struct {
+	Type            string        `mapstructure:"type"`            // Valid: dns_srv, file
+	Name            string        `mapstructure:"name"`            // SRV record, e.x. _carbonserver._tcp.example.com
+	File            string        `mapstructure:"file"`            // Prometheus file_sd JSON or YAML file
+	Scheme          string        `mapstructure:"scheme"`          // Scheme for discovered host:port targets, default: http
+	RefreshInterval time.Duration `mapstructure:"refreshInterval"` // How often servers are resolved, default: 30s
+	DrainTimeout    time.Duration `mapstructure:"drainTimeout"`    // How long requests to removed servers are waited for, default: 1m
+}
+
+func (c *DiscoveryConfig) FillDefaults() {
+	if c.Scheme == "" {
+		c.Scheme = "http"
+	}
+
+	if c.RefreshInterval == 0 {
+		c.RefreshInterval = 30 * time.Second
+	}
+
+	if c.DrainTimeout == 0 {
+		c.DrainTimeout = time.Minute
+	}
+}
+
+// MarshalJSON hides passwords in servers and backend options, as configuration is logged
+func (b BackendV2) MarshalJSON() ([]byte, error) {
+	type backendV2 BackendV2
+	b.Servers = RedactServers(b.Servers)
+	if len(b.BackendOptions) > 0 {
+		options := make(map[string]interface{}, len(b.BackendOptions))
+		for k, v := range b.BackendOptions {
+			if strings.Contains(strings.ToLower(k), "password") {
+				v = redactedPassword
+			}
+			options[k] = v
+		}
+		b.BackendOptions = options
+	}
+	return json.Marshal(backendV2(b))
+}
+
+// AgeWindow returns part of the time axis, relative to now, that backend group can serve
+func (b *BackendV2) AgeWindow() AgeWindow {
+	return AgeWindow{
+		MinAge: b.MinAge,
+		MaxAge: b.MaxAge,
+	}
 }
 
 func (b *BackendV2) FillDefaults() {
@@ -51,3 +112,26 @@ func (b *BackendV2) FillDefaults() {
 		b.Timeouts.Connect = 200 * time.Millisecond
 	}
 }
+
+// RoutingRule maps metric paths or tag expressions to the set of backend groups that contains them
+type RoutingRule struct {
+	Name   string   `mapstructure:"name"`
+	Prefix string   `mapstructure:"prefix"` // Glob prefix, matched node by node, e.x. "team_a.*.cpu"
+	Regex  string   `mapstructure:"regex"`  // Regular expression that is matched against requested path
+	Tags   []string `mapstructure:"tags"`   // seriesByTag expressions that all must be present in a query, e.x. "team=a"
+	Groups []string `mapstructure:"groups"` // Names of backend groups that should receive matched requests
+}
+
+// DivergenceConfig controls sampling of responses from replicas in broadcast groups for consistency checks
+type DivergenceConfig struct {
+	SampleRate  float64 `mapstructure:"sampleRate"`  // Share of fetch requests that are checked, 0 disables the check
+	PrefixDepth int     `mapstructure:"prefixDepth"` // Amount of metric name nodes used to aggregate counters
+	RecentSize  int     `mapstructure:"recentSize"`  // Amount of recently diverged metrics that are kept for debugging
+	MaxPrefixes int     `mapstructure:"maxPrefixes"` // Amount of distinct prefixes counters are kept for, others are counted as "_other"
+}
+
+// CarbonlinkConfig describes carbon-cache instances that are queried for the points that are not yet flushed to disk
+type CarbonlinkConfig struct {
+	Hosts   []string      `mapstructure:"hosts"`   // host:port[:instance], the same format as CARBONLINK_HOSTS of graphite-web
+	Timeout time.Duration `mapstructure:"timeout"` // Timeout for a single cache query
+}
@@ -0,0 +1,29 @@
+package types
+
+import (
+	"context"
+
+	"github.com/ansel1/merry"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+// FetchBudget is called with merged response every time a fetch response of a backend is received. If it returns an
+// error, remaining responses aren't waited for and requests to backends are cancelled. Groups, that split metrics
+// between backends, call it with pieces already combined, so each metric is counted once.
+type FetchBudget func(response *protov3.MultiFetchResponse) merry.Error
+
+type fetchBudgetKey struct{}
+
+// WithFetchBudget returns context, fetch requests with which are checked by budget while responses are gathered
+func WithFetchBudget(ctx context.Context, budget FetchBudget) context.Context {
+	if budget == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, fetchBudgetKey{}, budget)
+}
+
+// GetFetchBudget returns budget set by WithFetchBudget, if any
+func GetFetchBudget(ctx context.Context) FetchBudget {
+	budget, _ := ctx.Value(fetchBudgetKey{}).(FetchBudget)
+	return budget
+}
@@ -31,3 +31,54 @@ type BackendServer interface {
 
 	Children() []BackendServer
 }
+
+// FilteringFunctions are graphite functions that could be passed to backends as FilterFunctions of the fetch request.
+// All of them take series as the first argument and constants as the rest and don't change requested time range.
+var FilteringFunctions = []string{
+	"sumSeries",
+	"averageSeries",
+	"maxSeries",
+	"minSeries",
+	"groupByNode",
+	"summarize",
+	"scale",
+	"offset",
+	"absolute",
+	"aliasByNode",
+	"derivative",
+	"nonNegativeDerivative",
+	"perSecond",
+	"integral",
+	"keepLastValue",
+	"transformNull",
+	"removeAboveValue",
+	"removeBelowValue",
+}
+
+// PushdownBackend is implemented by backends that evaluate graphite functions passed as FilterFunctions of the fetch
+// request. Backend must report evaluated functions in AppliedFunctions of the response, otherwise they are evaluated
+// by carbonapi.
+type PushdownBackend interface {
+	PushdownFunctions() []string
+}
+
+// PushdownFunctions returns functions advertised by the backend, nil if it doesn't support pushdown
+func PushdownFunctions(s BackendServer) []string {
+	if p, ok := s.(PushdownBackend); ok {
+		return p.PushdownFunctions()
+	}
+	return nil
+}
+
+// IdleConnectionsCloser is implemented by backends that keep connections to their servers
+type IdleConnectionsCloser interface {
+	CloseIdleConnections()
+}
+
+// CloseIdleConnections closes idle connections of the backend, it's called for backends that are replaced or removed
+// from the group, when requests in flight to them are finished
+func CloseIdleConnections(s BackendServer) {
+	if c, ok := s.(IdleConnectionsCloser); ok {
+		c.CloseIdleConnections()
+	}
+}
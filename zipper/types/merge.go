@@ -0,0 +1,236 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/ansel1/merry"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+var ErrUnknownMergeMethodFmt = "unknown merge strategy: '%v', supported: %v"
+
+// MergeMethod defines how responses for the same metric from different replicas are combined
+type MergeMethod int
+
+const (
+	// MergeFillGaps fills NaNs with the values from other replicas, prefers smaller step
+	MergeFillGaps MergeMethod = iota
+	// MergePreferMostComplete takes the replica with the largest share of non-NaN points
+	MergePreferMostComplete
+	// MergeMax takes maximum of replicas' values for every point
+	MergeMax
+	// MergeMin takes minimum of replicas' values for every point
+	MergeMin
+	// MergeAvg takes average of replicas' values for every point
+	MergeAvg
+	// MergePreferPrimary takes values from the primary replica and fills its gaps from the others
+	MergePreferPrimary
+)
+
+var supportedMergeMethods = map[string]MergeMethod{
+	"":                     MergeFillGaps,
+	"fill-gaps":            MergeFillGaps,
+	"prefer-most-complete": MergePreferMostComplete,
+	"max":                  MergeMax,
+	"min":                  MergeMin,
+	"avg":                  MergeAvg,
+	"average":              MergeAvg,
+	"prefer-named-primary": MergePreferPrimary,
+	"prefer-primary":       MergePreferPrimary,
+}
+
+func (m MergeMethod) keys(methods map[string]MergeMethod) []string {
+	res := make([]string, 0)
+	for k := range methods {
+		if k == "" {
+			continue
+		}
+		res = append(res, k)
+	}
+	return res
+}
+
+func (m *MergeMethod) FromString(method string) error {
+	var ok bool
+	if *m, ok = supportedMergeMethods[strings.ToLower(method)]; !ok {
+		return fmt.Errorf(ErrUnknownMergeMethodFmt, method, m.keys(supportedMergeMethods))
+	}
+	return nil
+}
+
+func (m MergeMethod) String() string {
+	switch m {
+	case MergeFillGaps:
+		return "fill-gaps"
+	case MergePreferMostComplete:
+		return "prefer-most-complete"
+	case MergeMax:
+		return "max"
+	case MergeMin:
+		return "min"
+	case MergeAvg:
+		return "avg"
+	case MergePreferPrimary:
+		return "prefer-named-primary"
+	}
+	return fmt.Sprintf("unknown(%d)", int(m))
+}
+
+func (m MergeMethod) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// MergeStrategy describes how replicas of the same metric should be merged
+type MergeStrategy struct {
+	Method MergeMethod
+	// Primary is a name of the server which data is preferred by MergePreferPrimary
+	Primary string
+}
+
+// NewMergeStrategy parses merge strategy from config values
+func NewMergeStrategy(method, primary string) (MergeStrategy, error) {
+	s := MergeStrategy{Primary: primary}
+	if err := s.Method.FromString(method); err != nil {
+		return s, err
+	}
+	if s.Method == MergePreferPrimary && primary == "" {
+		return s, fmt.Errorf("merge strategy '%v' requires primary server to be specified", s.Method)
+	}
+	return s, nil
+}
+
+func coverage(m *protov3.FetchResponse) float64 {
+	if len(m.Values) == 0 {
+		return 0
+	}
+	n := 0
+	for _, v := range m.Values {
+		if !math.IsNaN(v) {
+			n++
+		}
+	}
+	return float64(n) / float64(len(m.Values))
+}
+
+// resample consolidates values of m to the (larger) step using m's consolidation function
+func resample(m *protov3.FetchResponse, step int64) {
+	if m.StepTime == step || step <= 0 {
+		return
+	}
+	empty := protov3.FetchResponse{StartTime: m.StartTime, StepTime: step}
+	res := StitchFetchResponses([]protov3.FetchResponse{*m, empty})
+	m.StartTime = res.StartTime
+	m.StopTime = res.StopTime
+	m.StepTime = res.StepTime
+	m.Values = res.Values
+}
+
+// mergePerPoint combines m2 into m1 point by point. counts contains amount of replicas that contributed to every point of m1
+// and is used for averaging, updated counts are returned.
+func mergePerPoint(method MergeMethod, m1, m2 *protov3.FetchResponse, counts []int) []int {
+	if m1.StepTime != m2.StepTime {
+		step := max(m1.StepTime, m2.StepTime)
+		if m1.StepTime != step {
+			counts = nil
+		}
+		resample(m1, step)
+		resample(m2, step)
+	}
+
+	if counts == nil || len(counts) != len(m1.Values) {
+		counts = make([]int, len(m1.Values))
+		for i, v := range m1.Values {
+			if !math.IsNaN(v) {
+				counts[i] = 1
+			}
+		}
+	}
+
+	step := m1.StepTime
+	if step <= 0 {
+		step = 1
+	}
+	start := min(m1.StartTime, m2.StartTime)
+	stop := max(m1.StartTime+int64(len(m1.Values))*step, m2.StartTime+int64(len(m2.Values))*step)
+	n := (stop - start) / step
+
+	values := make([]float64, n)
+	newCounts := make([]int, n)
+	for i := range values {
+		values[i] = math.NaN()
+	}
+	offset := (m1.StartTime - start) / step
+	for i, v := range m1.Values {
+		values[int64(i)+offset] = v
+		newCounts[int64(i)+offset] = counts[i]
+	}
+
+	offset = (m2.StartTime - start) / step
+	for i, v := range m2.Values {
+		j := int64(i) + offset
+		if math.IsNaN(v) {
+			continue
+		}
+		if math.IsNaN(values[j]) {
+			values[j] = v
+			newCounts[j] = 1
+			continue
+		}
+		switch method {
+		case MergeMax:
+			values[j] = math.Max(values[j], v)
+		case MergeMin:
+			values[j] = math.Min(values[j], v)
+		case MergeAvg:
+			values[j] = (values[j]*float64(newCounts[j]) + v) / float64(newCounts[j]+1)
+		}
+		newCounts[j]++
+	}
+
+	m1.StartTime = start
+	m1.StopTime = stop
+	m1.Values = values
+
+	return newCounts
+}
+
+// MergeFetchResponsesWithStrategy merges m2 into m1 according to the strategy. secondIsPrimary should be true if m2
+// was received from the strategy's primary server. For per-point averages counts of contributed replicas are required,
+// updated counts are returned.
+func MergeFetchResponsesWithStrategy(strategy MergeStrategy, m1, m2 *protov3.FetchResponse, secondIsPrimary bool, counts []int) ([]int, merry.Error) {
+	if m1.RequestStartTime != m2.RequestStartTime {
+		return counts, ErrResponseStartTimeMismatch
+	}
+
+	switch strategy.Method {
+	case MergePreferMostComplete:
+		c1, c2 := coverage(m1), coverage(m2)
+		if c2 > c1 || (c2 == c1 && m2.StepTime < m1.StepTime) {
+			swapFetchResponses(m1, m2)
+		}
+		return nil, nil
+	case MergeMax, MergeMin, MergeAvg:
+		return mergePerPoint(strategy.Method, m1, m2, counts), nil
+	case MergePreferPrimary:
+		if secondIsPrimary {
+			swapFetchResponses(m1, m2)
+		}
+		if m1.StepTime != m2.StepTime {
+			return nil, nil
+		}
+		if m1.StartTime != m2.StartTime {
+			return nil, ErrResponseStartTimeMismatch
+		}
+		for i := 0; i < len(m1.Values) && i < len(m2.Values); i++ {
+			if math.IsNaN(m1.Values[i]) {
+				m1.Values[i] = m2.Values[i]
+			}
+		}
+		return nil, nil
+	}
+
+	return nil, MergeFetchResponses(m1, m2)
+}
@@ -0,0 +1,174 @@
+package types
+
+import (
+	"math"
+	"testing"
+
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+func TestNewMergeStrategy(t *testing.T) {
+	tests := []struct {
+		method  string
+		primary string
+		want    MergeMethod
+		wantErr bool
+	}{
+		{method: "", want: MergeFillGaps},
+		{method: "fill-gaps", want: MergeFillGaps},
+		{method: "prefer-most-complete", want: MergePreferMostComplete},
+		{method: "MAX", want: MergeMax},
+		{method: "min", want: MergeMin},
+		{method: "avg", want: MergeAvg},
+		{method: "prefer-named-primary", primary: "a", want: MergePreferPrimary},
+		{method: "prefer-named-primary", wantErr: true},
+		{method: "median", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			s, err := NewMergeStrategy(tt.method, tt.primary)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got strategy %v", s.Method)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if s.Method != tt.want {
+				t.Errorf("got %v, want %v", s.Method, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerFetchResponseMergeWithStrategy(t *testing.T) {
+	nan := math.NaN()
+	response := func(server string, start, step int64, values ...float64) *ServerFetchResponse {
+		return &ServerFetchResponse{
+			Server: server,
+			Response: &protov3.MultiFetchResponse{
+				Metrics: []protov3.FetchResponse{{
+					Name:              "a",
+					ConsolidationFunc: "avg",
+					StartTime:         start,
+					StopTime:          start + int64(len(values))*step,
+					StepTime:          step,
+					Values:            values,
+				}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		method    string
+		primary   string
+		responses []*ServerFetchResponse
+		wantStep  int64
+		want      []float64
+	}{
+		{
+			name:   "fill-gaps",
+			method: "fill-gaps",
+			responses: []*ServerFetchResponse{
+				response("a", 0, 60, 1, nan, 3, nan),
+				response("b", 0, 60, 5, 2, nan, nan),
+			},
+			wantStep: 60,
+			want:     []float64{1, 2, 3, nan},
+		},
+		{
+			name:   "prefer-most-complete",
+			method: "prefer-most-complete",
+			responses: []*ServerFetchResponse{
+				response("a", 0, 60, 1, nan, 3, nan),
+				response("b", 0, 60, 5, 6, 7, nan),
+			},
+			wantStep: 60,
+			want:     []float64{5, 6, 7, nan},
+		},
+		{
+			name:   "max",
+			method: "max",
+			responses: []*ServerFetchResponse{
+				response("a", 0, 60, 1, nan, 8, nan),
+				response("b", 0, 60, 5, 6, 7, nan),
+			},
+			wantStep: 60,
+			want:     []float64{5, 6, 8, nan},
+		},
+		{
+			name:   "min",
+			method: "min",
+			responses: []*ServerFetchResponse{
+				response("a", 0, 60, 1, nan, 8, nan),
+				response("b", 0, 60, 5, 6, 7, nan),
+			},
+			wantStep: 60,
+			want:     []float64{1, 6, 7, nan},
+		},
+		{
+			name:   "avg of three replicas",
+			method: "avg",
+			responses: []*ServerFetchResponse{
+				response("a", 0, 60, 1, nan, 3),
+				response("b", 0, 60, 2, 4, nan),
+				response("c", 0, 60, 6, 8, 3),
+			},
+			wantStep: 60,
+			want:     []float64{3, 6, 3},
+		},
+		{
+			name:   "avg with different steps",
+			method: "avg",
+			responses: []*ServerFetchResponse{
+				response("a", 0, 60, 1, 3, 5, 7),
+				response("b", 0, 120, 4, 8),
+			},
+			wantStep: 120,
+			want:     []float64{3, 7},
+		},
+		{
+			name:    "prefer-named-primary",
+			method:  "prefer-named-primary",
+			primary: "b",
+			responses: []*ServerFetchResponse{
+				response("a", 0, 60, 1, 2, 3, 4),
+				response("b", 0, 60, 5, nan, 7, nan),
+			},
+			wantStep: 60,
+			want:     []float64{5, 2, 7, 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy, err := NewMergeStrategy(tt.method, tt.primary)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			result := NewServerFetchResponse()
+			result.MergeStrategy = strategy
+			for _, r := range tt.responses {
+				if err := result.Merge(r); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			if len(result.Response.Metrics) != 1 {
+				t.Fatalf("expected 1 metric, got %d", len(result.Response.Metrics))
+			}
+			got := result.Response.Metrics[0]
+			if got.StepTime != tt.wantStep {
+				t.Errorf("step mismatch, got %v, want %v", got.StepTime, tt.wantStep)
+			}
+			if !cmpFloat64Arrays(got.Values, tt.want, 0.00001) {
+				t.Errorf("values mismatch\nExp: %v\nGot: %v", tt.want, got.Values)
+			}
+		})
+	}
+}
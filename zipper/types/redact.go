@@ -0,0 +1,38 @@
+package types
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const redactedPassword = "xxxxx"
+
+var (
+	// passwordParamRe matches password in key=value data source names and in query strings
+	passwordParamRe = regexp.MustCompile(`(?i)\b(password|passwd|pwd)=('[^']*'|[^\s&;]*)`)
+	// userInfoRe matches credentials of DSNs without scheme, e.x. user:password@tcp(localhost:3306)/db
+	userInfoRe = regexp.MustCompile(`^([^:@/]*):[^@]*@`)
+)
+
+// RedactServer hides password in server address or data source name, so it could be logged or reported
+func RedactServer(server string) string {
+	if strings.Contains(server, "://") {
+		if u, err := url.Parse(server); err == nil {
+			server = u.Redacted()
+		}
+	} else {
+		server = userInfoRe.ReplaceAllString(server, "${1}:"+redactedPassword+"@")
+	}
+
+	return passwordParamRe.ReplaceAllString(server, "${1}="+redactedPassword)
+}
+
+// RedactServers hides passwords in all the servers
+func RedactServers(servers []string) []string {
+	res := make([]string, 0, len(servers))
+	for _, s := range servers {
+		res = append(res, RedactServer(s))
+	}
+	return res
+}
@@ -0,0 +1,41 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactServer(t *testing.T) {
+	tests := []struct {
+		server string
+		want   string
+	}{
+		{"http://127.0.0.1:8080", "http://127.0.0.1:8080"},
+		{"postgres://user:secret@db:5432/graphite?sslmode=disable", "postgres://user:xxxxx@db:5432/graphite?sslmode=disable"},
+		{"postgres://db/graphite?user=u&password=secret", "postgres://db/graphite?user=u&password=xxxxx"},
+		{"host=db user=u password='se cret' dbname=graphite", "host=db user=u password=xxxxx dbname=graphite"},
+		{"user:secret@tcp(db:3306)/graphite", "user:xxxxx@tcp(db:3306)/graphite"},
+		{"127.0.0.1:8080", "127.0.0.1:8080"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, RedactServer(tt.server))
+	}
+}
+
+func TestBackendV2MarshalJSON(t *testing.T) {
+	b := BackendV2{
+		GroupName:      "sql",
+		Servers:        []string{"postgres://user:secret@db/graphite"},
+		BackendOptions: map[string]interface{}{"influxdb_password": "secret", "sql_step": "1m"},
+	}
+	data, err := json.Marshal(b)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NotContains(t, string(data), "secret")
+	assert.Contains(t, string(data), `"postgres://user:xxxxx@db/graphite"`)
+	assert.Contains(t, string(data), `"sql_step":"1m"`)
+	assert.Equal(t, "postgres://user:secret@db/graphite", b.Servers[0])
+}
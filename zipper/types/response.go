@@ -3,6 +3,7 @@ package types
 import (
 	"context"
 	"math"
+	"sort"
 
 	"github.com/ansel1/merry"
 
@@ -45,6 +46,7 @@ func DoRequest(ctx context.Context, logger *zap.Logger, clients []BackendServer,
 		go fetcher(ctx, logger, client, request, resCh)
 	}
 
+	budget := GetFetchBudget(ctx)
 	answeredServers := make(map[string]struct{})
 	responseCount := 0
 GATHER:
@@ -57,6 +59,13 @@ GATHER:
 			} else {
 				result.AddError(err)
 			}
+			if r, ok := result.Self().(*ServerFetchResponse); ok && budget != nil && r.Response != nil {
+				// requests to backends, that haven't answered yet, are cancelled by the caller
+				if err := budget(r.Response); err != nil {
+					result.AddError(err)
+					break GATHER
+				}
+			}
 		case <-ctx.Done():
 			err := ErrTimeoutExceeded.WithValue("timedout_backends", NoAnswerBackends(clients, answeredServers))
 			result.AddError(err)
@@ -323,6 +332,11 @@ type ServerFetchResponse struct {
 	Response *protov3.MultiFetchResponse
 	Stats    *Stats
 	Err      []merry.Error
+
+	// MergeStrategy controls how responses for the same metric are merged
+	MergeStrategy MergeStrategy
+	// amount of replicas that contributed to every point, used by per-point averaging
+	mergeCounts map[fetchResponseCoordinates][]int
 }
 
 func NewServerFetchResponse() *ServerFetchResponse {
@@ -364,13 +378,29 @@ func (first *ServerFetchResponse) Merge(second *ServerFetchResponse) merry.Error
 		metrics[coordinates(&first.Response.Metrics[i])] = i
 	}
 
+	secondIsPrimary := first.MergeStrategy.Primary != "" && second.Server == first.MergeStrategy.Primary
 	for i := range second.Response.Metrics {
 		if j, ok := metrics[coordinates(&second.Response.Metrics[i])]; ok {
-			err := MergeFetchResponses(&first.Response.Metrics[j], &second.Response.Metrics[i])
+			if first.MergeStrategy.Method == MergeFillGaps {
+				err := MergeFetchResponses(&first.Response.Metrics[j], &second.Response.Metrics[i])
+				if err != nil {
+					// TODO: Normal merry.Error handling
+					continue
+				}
+				continue
+			}
+
+			key := coordinates(&first.Response.Metrics[j])
+			counts, err := MergeFetchResponsesWithStrategy(first.MergeStrategy, &first.Response.Metrics[j], &second.Response.Metrics[i], secondIsPrimary, first.mergeCounts[key])
 			if err != nil {
-				// TODO: Normal merry.Error handling
 				continue
 			}
+			if counts != nil {
+				if first.mergeCounts == nil {
+					first.mergeCounts = make(map[fetchResponseCoordinates][]int)
+				}
+				first.mergeCounts[key] = counts
+			}
 		} else {
 			first.Response.Metrics = append(first.Response.Metrics, second.Response.Metrics[i])
 		}
@@ -482,6 +512,114 @@ func MergeFetchResponses(m1, m2 *protov3.FetchResponse) merry.Error {
 	return err
 }
 
+// ConsolidatePoints aggregates values with consolidation function, NaNs are skipped
+func ConsolidatePoints(consolidationFunc string, values []float64) float64 {
+	res := math.NaN()
+	count := 0
+	for _, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		if count == 0 {
+			res = v
+			count++
+			if consolidationFunc == "first" {
+				return res
+			}
+			continue
+		}
+		count++
+		switch consolidationFunc {
+		case "sum":
+			res += v
+		case "min":
+			res = math.Min(res, v)
+		case "max":
+			res = math.Max(res, v)
+		case "last":
+			res = v
+		default:
+			res += v
+		}
+	}
+
+	switch consolidationFunc {
+	case "sum", "min", "max", "last", "first":
+		return res
+	}
+
+	if count > 0 {
+		res /= float64(count)
+	}
+	return res
+}
+
+// StitchFetchResponses combines responses for the same metric that covers different, possibly overlapping,
+// parts of the time range. Result will have the coarsest step among the pieces, finer pieces are consolidated
+// using their ConsolidationFunc. If pieces overlap, data from the piece with the finer step wins.
+func StitchFetchResponses(pieces []protov3.FetchResponse) protov3.FetchResponse {
+	if len(pieces) == 1 {
+		return pieces[0]
+	}
+
+	sort.SliceStable(pieces, func(i, j int) bool {
+		return pieces[i].StepTime < pieces[j].StepTime
+	})
+
+	res := pieces[0]
+	res.StepTime = pieces[len(pieces)-1].StepTime
+	if res.StepTime <= 0 {
+		res.StepTime = 1
+	}
+
+	start := int64(math.MaxInt64)
+	stop := int64(math.MinInt64)
+	for i := range pieces {
+		if pieces[i].StartTime < start {
+			start = pieces[i].StartTime
+		}
+		pieceStop := pieces[i].StartTime + int64(len(pieces[i].Values))*pieces[i].StepTime
+		if pieceStop > stop {
+			stop = pieceStop
+		}
+	}
+	start -= start % res.StepTime
+
+	n := (stop - start + res.StepTime - 1) / res.StepTime
+	if n < 0 {
+		n = 0
+	}
+	res.StartTime = start
+	res.StopTime = start + n*res.StepTime
+	res.Values = make([]float64, n)
+	filled := make([]bool, n)
+	for i := range res.Values {
+		res.Values[i] = math.NaN()
+	}
+
+	for i := range pieces {
+		buckets := make(map[int64][]float64)
+		for j, v := range pieces[i].Values {
+			b := (pieces[i].StartTime + int64(j)*pieces[i].StepTime - start) / res.StepTime
+			if b < 0 || b >= n || filled[b] {
+				continue
+			}
+			buckets[b] = append(buckets[b], v)
+		}
+
+		for b, values := range buckets {
+			v := ConsolidatePoints(pieces[i].ConsolidationFunc, values)
+			if math.IsNaN(v) {
+				continue
+			}
+			res.Values[b] = v
+			filled[b] = true
+		}
+	}
+
+	return res
+}
+
 type fetchResponseCoordinates struct {
 	name  string
 	from  int64
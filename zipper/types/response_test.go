@@ -52,3 +52,33 @@ func cmpFloat64Arrays(a, b []float64, epsilon float64) bool {
 
 	return true
 }
+
+func TestStitchFetchResponses(t *testing.T) {
+	pieces := []protov3.FetchResponse{
+		{
+			Name:              "foo",
+			ConsolidationFunc: "sum",
+			StartTime:         100,
+			StepTime:          10,
+			Values:            []float64{1, 2, 3, 4, 5, 6, math.NaN(), math.NaN()},
+		},
+		{
+			Name:              "foo",
+			ConsolidationFunc: "avg",
+			StartTime:         60,
+			StepTime:          20,
+			Values:            []float64{7, 8, 9, 10, 11, 12},
+		},
+	}
+
+	exp := []float64{7, 8, 3, 7, 11, 12}
+
+	res := StitchFetchResponses(pieces)
+	if res.StartTime != 60 || res.StepTime != 20 || res.StopTime != 180 {
+		t.Errorf("unexpected start/step/stop %v/%v/%v, expected 60/20/180", res.StartTime, res.StepTime, res.StopTime)
+	}
+
+	if !cmpFloat64Arrays(res.Values, exp, 0.00001) {
+		t.Errorf("Error stitching responses\nExp: %v\nGot: %v", exp, res.Values)
+	}
+}
@@ -25,6 +25,15 @@ type Stats struct {
 
 	Servers       []string
 	FailedServers []string
+
+	ReplicaDivergences []ReplicaDivergence
+}
+
+// ReplicaDivergence contains amount of points where server's response differs from other replicas
+type ReplicaDivergence struct {
+	Server string
+	Prefix string
+	Points uint64
 }
 
 func (s *Stats) Merge(stats *Stats) {
@@ -47,4 +56,5 @@ func (s *Stats) Merge(stats *Stats) {
 
 	s.Servers = append(s.Servers, stats.Servers...)
 	s.FailedServers = append(s.FailedServers, stats.FailedServers...)
+	s.ReplicaDivergences = append(s.ReplicaDivergences, stats.ReplicaDivergences...)
 }
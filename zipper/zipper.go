@@ -11,18 +11,27 @@ import (
 
 	utilctx "github.com/go-graphite/carbonapi/util/ctx"
 	"github.com/go-graphite/carbonapi/zipper/broadcast"
+	"github.com/go-graphite/carbonapi/zipper/carbonlink"
 	"github.com/go-graphite/carbonapi/zipper/config"
+	"github.com/go-graphite/carbonapi/zipper/discovery"
+	"github.com/go-graphite/carbonapi/zipper/divergence"
 	"github.com/go-graphite/carbonapi/zipper/helper"
 	"github.com/go-graphite/carbonapi/zipper/metadata"
+	"github.com/go-graphite/carbonapi/zipper/routing"
 	"github.com/go-graphite/carbonapi/zipper/types"
 
 	_ "github.com/go-graphite/carbonapi/zipper/protocols/auto"
 	_ "github.com/go-graphite/carbonapi/zipper/protocols/graphite"
+	_ "github.com/go-graphite/carbonapi/zipper/protocols/influxdb"
 	_ "github.com/go-graphite/carbonapi/zipper/protocols/irondb"
 	_ "github.com/go-graphite/carbonapi/zipper/protocols/prometheus"
+	_ "github.com/go-graphite/carbonapi/zipper/protocols/remoteread"
+	_ "github.com/go-graphite/carbonapi/zipper/protocols/sql"
 	_ "github.com/go-graphite/carbonapi/zipper/protocols/v2"
 	_ "github.com/go-graphite/carbonapi/zipper/protocols/v3"
+	_ "github.com/go-graphite/carbonapi/zipper/protocols/v3grpc"
 	_ "github.com/go-graphite/carbonapi/zipper/protocols/victoriametrics"
+	_ "github.com/go-graphite/carbonapi/zipper/protocols/whisper"
 )
 
 // Zipper provides interface to Zipper-related functions
@@ -41,12 +50,15 @@ type Zipper struct {
 
 	ScaleToCommonStep bool
 
+	router     *routing.Router
+	divergence *divergence.Tracker
+
 	sendStats func(*types.Stats)
 
 	logger *zap.Logger
 }
 
-func createBackendsV2(logger *zap.Logger, backends types.BackendsV2, expireDelaySec int32, tldCacheDisabled, requireSuccessAll bool) ([]types.BackendServer, merry.Error) {
+func createBackendsV2(logger *zap.Logger, backends types.BackendsV2, expireDelaySec int32, tldCacheDisabled, requireSuccessAll bool, tracker *divergence.Tracker) ([]types.BackendServer, merry.Error) {
 	backendServers := make([]types.BackendServer, 0)
 	var e merry.Error
 	timeouts := backends.Timeouts
@@ -76,10 +88,25 @@ func createBackendsV2(logger *zap.Logger, backends types.BackendsV2, expireDelay
 			backend.KeepAliveInterval = &keepAliveInterval
 		}
 
+		var source discovery.Source
+		if backend.Discovery != nil {
+			backend.Discovery.FillDefaults()
+			source, e = discovery.New(*backend.Discovery)
+			if e != nil {
+				return nil, e.WithValue("groupName", backend.GroupName)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), backend.Discovery.RefreshInterval)
+			backend.Servers, e = discovery.Discover(ctx, source)
+			cancel()
+			if e != nil {
+				return nil, e.WithValue("groupName", backend.GroupName)
+			}
+		}
+
 		var backendServer types.BackendServer
 		logger.Debug("creating lb group",
 			zap.String("name", backend.GroupName),
-			zap.Strings("servers", backend.Servers),
+			zap.Strings("servers", types.RedactServers(backend.Servers)),
 			zap.Any("type", backend.LBMethod),
 		)
 
@@ -109,31 +136,116 @@ func createBackendsV2(logger *zap.Logger, backends types.BackendsV2, expireDelay
 				zap.Error(err),
 			)
 		}
+
+		var onChange discovery.OnChangeFunc
 		if lbMethod == types.RoundRobinLB {
-			backendServer, e = backendInit(logger, backend, tldCacheDisabled, requireSuccessAll)
-			if e != nil {
-				return nil, e
+			if source == nil {
+				backendServer, e = backendInit(logger, backend, tldCacheDisabled, requireSuccessAll)
+				if e != nil {
+					return nil, e
+				}
+			} else {
+				config := backend
+				group, e := discovery.NewGroup(logger, backend.GroupName, backend.Servers, backend.Discovery.DrainTimeout, func(servers []string) (types.BackendServer, merry.Error) {
+					config.Servers = servers
+					return backendInit(logger, config, tldCacheDisabled, requireSuccessAll)
+				})
+				if e != nil {
+					return nil, e
+				}
+				onChange = group.UpdateServers
+				backendServer = group
 			}
 		} else {
 			config := backend
+			newServer := func(server string) (types.BackendServer, merry.Error) {
+				config.Servers = []string{server}
+				config.GroupName = server
+				return backendInit(logger, config, tldCacheDisabled, requireSuccessAll)
+			}
 
 			backendServers := make([]types.BackendServer, 0, len(backend.Servers))
 			for _, server := range backend.Servers {
-				config.Servers = []string{server}
-				config.GroupName = server
-				backendServer, e = backendInit(logger, config, tldCacheDisabled, requireSuccessAll)
+				backendServer, e = newServer(server)
 				if e != nil {
 					return nil, e
 				}
 				backendServers = append(backendServers, backendServer)
 			}
 
-			backendServer, err = broadcast.NewBroadcastGroup(logger, backend.GroupName, backend.DoMultipleRequestsIfSplit, backendServers,
-				expireDelaySec, *backend.ConcurrencyLimit, *backend.MaxBatchSize, timeouts, tldCacheDisabled, requireSuccessAll,
-			)
+			mergeStrategy, err := types.NewMergeStrategy(backend.MergeStrategy, backend.MergePrimary)
+			if err != nil {
+				logger.Fatal("failed to parse mergeStrategy",
+					zap.String("mergeStrategy", backend.MergeStrategy),
+					zap.String("mergePrimary", backend.MergePrimary),
+					zap.Error(err),
+				)
+			}
+
+			opts := []broadcast.Option{
+				broadcast.WithLogger(logger),
+				broadcast.WithGroupName(backend.GroupName),
+				broadcast.WithSplitMultipleRequests(backend.DoMultipleRequestsIfSplit),
+				broadcast.WithBackends(backendServers),
+				broadcast.WithPathCache(expireDelaySec),
+				broadcast.WithLimiter(*backend.ConcurrencyLimit),
+				broadcast.WithMaxMetricsPerRequest(*backend.MaxBatchSize),
+				broadcast.WithTimeouts(timeouts),
+				broadcast.WithTLDCache(!tldCacheDisabled),
+				broadcast.WithSuccess(requireSuccessAll),
+				broadcast.WithMergeStrategy(mergeStrategy),
+				broadcast.WithReplicas(backend.Replicas),
+				broadcast.WithDivergenceTracker(tracker),
+			}
+			if source != nil {
+				opts = append(opts, broadcast.WithDynamicBackends(backend.Discovery.DrainTimeout))
+			}
+			bg, err := broadcast.New(opts...)
 			if err != nil {
 				return nil, merry.Wrap(err)
 			}
+			backendServer = bg
+
+			if source != nil {
+				groupName := backend.GroupName
+				onChange = func(added, removed []string) ([]string, merry.Error) {
+					var e merry.Error
+					addedServers := make([]types.BackendServer, 0, len(added))
+					for _, server := range added {
+						s, err := newServer(server)
+						if err != nil {
+							logger.Error("failed to create backend for discovered server",
+								zap.String("groupName", groupName),
+								zap.String("server", server),
+								zap.Error(err),
+							)
+							e = err
+							continue
+						}
+						addedServers = append(addedServers, s)
+					}
+					bg.UpdateBackends(addedServers, removed)
+					// servers that failed are not applied, so they are retried on the next refresh
+					return bg.Backends(), e
+				}
+			}
+		}
+
+		if source != nil {
+			watcher := discovery.NewWatcher(logger.With(zap.String("groupName", backend.GroupName)), source, backend.Discovery.RefreshInterval, backend.Servers, onChange)
+			go watcher.Run(context.Background())
+		}
+
+		if backend.Carbonlink != nil {
+			client, err := carbonlink.New(logger, *backend.Carbonlink)
+			if err != nil {
+				logger.Fatal("failed to create carbonlink client",
+					zap.String("groupName", backend.GroupName),
+					zap.Strings("hosts", backend.Carbonlink.Hosts),
+					zap.Error(err),
+				)
+			}
+			backendServer = carbonlink.Wrap(backendServer, client)
 		}
 		backendServers = append(backendServers, backendServer)
 	}
@@ -146,7 +258,8 @@ func NewZipper(sender func(*types.Stats), cfg *config.Config, logger *zap.Logger
 		cfg = config.SanitizeConfig(logger, *cfg)
 	}
 
-	backends, err := createBackendsV2(logger, cfg.BackendsV2, int32(cfg.InternalRoutingCache.Seconds()), cfg.TLDCacheDisabled, cfg.RequireSuccessAll)
+	tracker := divergence.New(cfg.ReplicaDivergence)
+	backends, err := createBackendsV2(logger, cfg.BackendsV2, int32(cfg.InternalRoutingCache.Seconds()), cfg.TLDCacheDisabled, cfg.RequireSuccessAll, tracker)
 	if err != nil {
 		logger.Fatal("errors while initialing zipper store backend",
 			zap.Any("error", err),
@@ -154,8 +267,38 @@ func NewZipper(sender func(*types.Stats), cfg *config.Config, logger *zap.Logger
 	}
 
 	logger.Error("DEBUG ERROR LOGGGGG", zap.Any("cfg", cfg))
-	broadcastGroup, err := broadcast.NewBroadcastGroup(logger, "root", cfg.DoMultipleRequestsIfSplit, backends,
-		int32(cfg.InternalRoutingCache.Seconds()), cfg.ConcurrencyLimitPerServer, *cfg.MaxBatchSize, cfg.Timeouts, cfg.TLDCacheDisabled, cfg.RequireSuccessAll,
+	router, err := routing.New(cfg.RoutingRules)
+	if err != nil {
+		logger.Fatal("failed to parse routing rules",
+			zap.Any("error", err),
+		)
+	}
+
+	ageWindows := make(map[string]types.AgeWindow)
+	sliceWindows := make(map[string]time.Duration)
+	for i := range cfg.BackendsV2.Backends {
+		ageWindows[cfg.BackendsV2.Backends[i].GroupName] = cfg.BackendsV2.Backends[i].AgeWindow()
+		sliceWindows[cfg.BackendsV2.Backends[i].GroupName] = cfg.BackendsV2.FetchSliceWindow
+		if cfg.BackendsV2.Backends[i].FetchSliceWindow != nil {
+			sliceWindows[cfg.BackendsV2.Backends[i].GroupName] = *cfg.BackendsV2.Backends[i].FetchSliceWindow
+		}
+	}
+
+	broadcastGroup, err := broadcast.New(
+		broadcast.WithLogger(logger),
+		broadcast.WithGroupName("root"),
+		broadcast.WithSplitMultipleRequests(cfg.DoMultipleRequestsIfSplit),
+		broadcast.WithBackends(backends),
+		broadcast.WithPathCache(int32(cfg.InternalRoutingCache.Seconds())),
+		broadcast.WithLimiter(cfg.ConcurrencyLimitPerServer),
+		broadcast.WithMaxMetricsPerRequest(*cfg.MaxBatchSize),
+		broadcast.WithTimeouts(cfg.Timeouts),
+		broadcast.WithTLDCache(!cfg.TLDCacheDisabled),
+		broadcast.WithSuccess(cfg.RequireSuccessAll),
+		broadcast.WithAgeWindows(ageWindows),
+		broadcast.WithTimeSliceWindows(sliceWindows),
+		broadcast.WithTimeSliceConcurrency(cfg.BackendsV2.FetchSliceConcurrency),
+		broadcast.WithRouter(router),
 	)
 	if err != nil {
 		logger.Fatal("error while initialing zipper store backend",
@@ -168,6 +311,8 @@ func NewZipper(sender func(*types.Stats), cfg *config.Config, logger *zap.Logger
 		ProbeForce: make(chan int),
 
 		ScaleToCommonStep: cfg.ScaleToCommonStep,
+		router:            router,
+		divergence:        tracker,
 		sendStats:         sender,
 
 		backend:                   broadcastGroup,
@@ -192,6 +337,21 @@ func NewZipper(sender func(*types.Stats), cfg *config.Config, logger *zap.Logger
 	return z, nil
 }
 
+// PushdownFunctions returns graphite functions that are evaluated by all backends
+func (z *Zipper) PushdownFunctions() []string {
+	return types.PushdownFunctions(z.backend)
+}
+
+// Router returns static routing rules used by zipper
+func (z *Zipper) Router() *routing.Router {
+	return z.router
+}
+
+// Divergence returns tracker of inconsistencies between replicas, nil if it's disabled
+func (z *Zipper) Divergence() *divergence.Tracker {
+	return z.divergence
+}
+
 func (z *Zipper) doProbe(logger *zap.Logger) {
 	ctx := context.Background()
 